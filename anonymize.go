@@ -0,0 +1,77 @@
+package jsonstream
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"iter"
+	"strconv"
+)
+
+const (
+	// pseudonymStringBytes is the number of bytes of the HMAC that are
+	// hex-encoded to form a string pseudonym.
+	pseudonymStringBytes = 8
+	// maxPseudonymInt is the bound of number pseudonyms, which are integers
+	// that can be represented exactly by a float64.
+	maxPseudonymInt = 1 << 53
+)
+
+// Pseudonymize replaces the strings and numbers whose paths match one of the
+// given patterns (see PathMatches) with deterministic pseudonyms, for
+// producing shareable test data from production JSON. If a matching value is
+// an array or an object, each string and number inside it is replaced (but
+// not the keys of objects). Booleans and nulls are unchanged.
+//
+// A pseudonym is derived from the HMAC-SHA256 of the value (the unescaped
+// contents of a string, or a number as written) using key. A string is
+// replaced by a string of 16 hexadecimal digits, and a number by a
+// non-negative integer less than 2^53. Since equal values have equal
+// pseudonyms, wherever and in whichever document they occur, references
+// between records (e.g. a user ID and the IDs of the orders of the user) are
+// preserved if the same key is used throughout a dataset. The key must be
+// kept secret, since anyone with the key can test whether a pseudonym was
+// derived from a guessed value. Numbers are pseudonymized as written, so 1
+// and 1.0 have different pseudonyms.
+//
+// The replacement tokens have the key and the position of the original
+// value. The rest of the document, including error tokens, is unchanged.
+func Pseudonymize(tokens iter.Seq[Token], key []byte, patterns ...[]any) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		mac := hmac.New(sha256.New, key)
+		var sum []byte
+		var pt pathTracker
+		depth := 0 // > 0 while inside an array or object being pseudonymized
+		for t := range tokens {
+			path := pt.next(t)
+			if IsError(t.Kind) {
+				if !yield(t) {
+					return
+				}
+				continue
+			}
+
+			if depth > 0 || (isValueKind(t.Kind) && matchesAny(path, patterns)) {
+				switch t.Kind {
+				case ArrayStart, ObjectStart:
+					depth++
+				case ArrayEnd, ObjectEnd:
+					depth--
+				case String, Number:
+					mac.Reset()
+					mac.Write(t.Value)
+					sum = mac.Sum(sum[:0])
+					if t.Kind == String {
+						t.Value = hex.AppendEncode(nil, sum[:pseudonymStringBytes])
+					} else {
+						t.Value = strconv.AppendUint(nil, binary.BigEndian.Uint64(sum)%maxPseudonymInt, 10)
+					}
+				}
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package jsonstream
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPseudonymize(t *testing.T) {
+	key := []byte("secret")
+	patterns := [][]any{{"users", Wildcard{}, "id"}, {"users", Wildcard{}, "email"}, {"orders", Wildcard{}, "user"}, {"meta"}}
+	const input = `{"users": [{"id": 42, "email": "a@example.com", "admin": true}, {"id": 7, "email": "b@example.com"}],
+		"orders": [{"user": 42, "total": 9.5}, {"user": 7}], "meta": {"source": "prod", "tags": ["x", 1, null]}}`
+	var p Parser
+	got := compactJSON(Pseudonymize(p.Tokenize([]byte(input)), key, patterns...))
+
+	for _, s := range []string{`:42,`, `"a@example.com"`, `"b@example.com"`, `"prod"`, `"x"`} {
+		if strings.Contains(got, s) {
+			t.Errorf("Expected %v to be pseudonymized in %v", s, got)
+		}
+	}
+	re := regexp.MustCompile(`^\{"users":\[\{"id":(\d+),"email":"([0-9a-f]{16})","admin":true\},\{"id":(\d+),"email":"([0-9a-f]{16})"\}\],` +
+		`"orders":\[\{"user":(\d+),"total":9\.5\},\{"user":(\d+)\}\],"meta":\{"source":"[0-9a-f]{16}","tags":\["[0-9a-f]{16}",\d+,null\]\}\}$`)
+	m := re.FindStringSubmatch(got)
+	if m == nil {
+		t.Fatalf("Unexpected output %v", got)
+	}
+	if m[1] != m[5] || m[3] != m[6] || m[1] == m[3] || m[2] == m[4] {
+		t.Errorf("Expected references to be preserved in %v", got)
+	}
+
+	if again := compactJSON(Pseudonymize(p.Tokenize([]byte(input)), key, patterns...)); again != got {
+		t.Errorf("Expected deterministic output, got %v and %v", got, again)
+	}
+	if other := compactJSON(Pseudonymize(p.Tokenize([]byte(input)), []byte("other"), patterns...)); other == got {
+		t.Errorf("Expected a different key to give different pseudonyms")
+	}
+
+	t.Run("replacement tokens have the position and key of the value", func(t *testing.T) {
+		for tok := range Pseudonymize(p.Tokenize([]byte(`{"id": "abc"}`)), key, []any{"id"}) {
+			if tok.Kind == String && (tok.KeyAsString() != "id" || tok.Line != 1 || tok.Col != 8 || tok.Start != 7) {
+				t.Errorf("Unexpected token %v", tok)
+			}
+		}
+	})
+
+	t.Run("key tokens are unchanged", func(t *testing.T) {
+		kp := Parser{EmitKeyTokens: true}
+		var got []string
+		for tok := range Pseudonymize(kp.Tokenize([]byte(`{"meta": {"id": 1}}`)), key, []any{"meta"}) {
+			if tok.Kind == Key {
+				got = append(got, string(tok.Value))
+			}
+		}
+		if !slices.Equal(got, []string{"meta", "id"}) {
+			t.Errorf("Unexpected keys %v", got)
+		}
+	})
+
+	t.Run("errors are passed through", func(t *testing.T) {
+		if got := compactJSON(Pseudonymize(p.Tokenize([]byte(`{"id": tru}`)), key, []any{"id"})); !strings.Contains(got, "<error:") {
+			t.Errorf("Expected an error, got %v", got)
+		}
+	})
+}
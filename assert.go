@@ -0,0 +1,116 @@
+package jsonstream
+
+import (
+	"iter"
+	"strings"
+)
+
+// ValueType is a set of JSON value types, used by AssertTypes. Types can be
+// combined using '|' (e.g. TypeString|TypeNull).
+type ValueType int
+
+const (
+	TypeNull ValueType = 1 << iota
+	TypeBool
+	TypeNumber
+	TypeString
+	TypeArray
+	TypeObject
+)
+
+func (vt ValueType) String() string {
+	names := []string{"null", "bool", "number", "string", "array", "object"}
+	var parts []string
+	for i, name := range names {
+		if vt&(1<<i) != 0 {
+			parts = append(parts, name)
+		}
+	}
+	if len(parts) == 0 {
+		return "<no ValueType>"
+	}
+	return strings.Join(parts, " or ")
+}
+
+// valueTypeOf returns the type of the value beginning with a token of the
+// given kind, or 0 for Extension tokens.
+func valueTypeOf(k Kind) ValueType {
+	switch k {
+	case Null:
+		return TypeNull
+	case True, False:
+		return TypeBool
+	case Number:
+		return TypeNumber
+	case String:
+		return TypeString
+	case ArrayStart:
+		return TypeArray
+	case ObjectStart:
+		return TypeObject
+	}
+	return 0
+}
+
+// TypeRule requires the values whose paths match the pattern Path (see
+// PathMatches) to have one of the types in Type.
+type TypeRule struct {
+	Path []any
+	Type ValueType
+}
+
+// AssertTypes checks the types of the values at the paths given by the rules.
+// This is a lightweight alternative to validating documents against a schema
+// when only the shape of the values used by a program matters. If a value
+// matches more than one rule, the first matching rule is applied. When a
+// value does not have the type required by its rule, an error token of kind
+// ErrorTypeMismatch is yielded before the value, positioned at its first
+// token, and the expected and actual types can be obtained using
+// Token.TypeMismatch. The value itself is then yielded unchanged, so that all
+// of the mismatches in the input are reported; a consumer that should reject
+// the input can stop at the first error. Extension values match no type.
+func AssertTypes(tokens iter.Seq[Token], rules ...TypeRule) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		for t := range tokens {
+			path := pt.next(t)
+			if isValueKind(t.Kind) && !IsError(t.Kind) {
+				for _, rule := range rules {
+					if !PathMatches(path, rule.Path) {
+						continue
+					}
+					if actual := valueTypeOf(t.Kind); actual&rule.Type == 0 {
+						msg := "Expected " + rule.Type.String()
+						if path.end != nil {
+							msg += " at " + path.String()
+						}
+						if actual != 0 {
+							msg += ", got " + actual.String()
+						} else {
+							msg += ", got extension value"
+						}
+						err := stageError("AssertTypes", ErrorTypeMismatch, t, t, msg)
+						err.Value = []byte{byte(rule.Type), byte(actual)}
+						if !yield(err) {
+							return
+						}
+					}
+					break
+				}
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// TypeMismatch returns the expected and actual types of the value reported by
+// an error token of kind ErrorTypeMismatch. The actual type is 0 for an
+// Extension value. If the token has a different kind, ok is false.
+func (t Token) TypeMismatch() (expected, actual ValueType, ok bool) {
+	if t.Kind != ErrorTypeMismatch || len(t.Value) != 2 {
+		return 0, 0, false
+	}
+	return ValueType(t.Value[0]), ValueType(t.Value[1]), true
+}
@@ -0,0 +1,64 @@
+package jsonstream
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAssertTypes(t *testing.T) {
+	const input = `{
+	"id": "7",
+	"name": "Ann",
+	"tags": ["a", 2, null],
+	"address": null,
+	"age": 41
+}`
+	rules := []TypeRule{
+		{Path: []any{"id"}, Type: TypeNumber},
+		{Path: []any{"tags", Wildcard{}}, Type: TypeString},
+		{Path: []any{"address"}, Type: TypeObject | TypeNull},
+		{Path: []any{"age"}, Type: TypeNumber},
+		{Path: []any{Wildcard{}}, Type: TypeString},
+		{Path: []any{}, Type: TypeObject},
+	}
+	var p Parser
+	var errs []string
+	var rest []Token
+	for tok := range AssertTypes(p.Tokenize([]byte(input)), rules...) {
+		if IsError(tok.Kind) {
+			errs = append(errs, tok.String())
+			continue
+		}
+		rest = append(rest, tok)
+	}
+	expected := []string{
+		`2:9 Error (AssertTypes): Expected number at ["id"], got string`,
+		`4:11 Error (AssertTypes): Expected string at ["tags"], got array`,
+		`4:17 Error (AssertTypes): Expected string at ["tags"][1], got number`,
+		`4:20 Error (AssertTypes): Expected string at ["tags"][2], got null`,
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+	if got := compactJSON(slices.Values(rest)); got != `{"id":"7","name":"Ann","tags":["a",2,null],"address":null,"age":41}` {
+		t.Errorf("Expected the input to be yielded unchanged, got %v", got)
+	}
+}
+
+func TestTypeMismatch(t *testing.T) {
+	var p Parser
+	for tok := range AssertTypes(p.Tokenize([]byte(`[1]`)), TypeRule{Path: []any{}, Type: TypeObject | TypeNull}) {
+		expected, actual, ok := tok.TypeMismatch()
+		if !ok || expected != TypeObject|TypeNull || actual != TypeArray {
+			t.Errorf("Unexpected type mismatch %v %v %v", expected, actual, ok)
+		}
+		if tok.String() != "1:1 Error (AssertTypes): Expected null or object, got array" {
+			t.Errorf("Unexpected error %v", tok)
+		}
+		break
+	}
+	if _, _, ok := (Token{Kind: Number}).TypeMismatch(); ok {
+		t.Errorf("Expected ok to be false for a Number token")
+	}
+}
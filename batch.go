@@ -0,0 +1,110 @@
+package jsonstream
+
+import (
+	"iter"
+)
+
+// Batch groups the elements of the top-level array in the input into batches
+// of n elements (the last batch may have fewer), yielding the raw input bytes
+// of each element. This is useful for bulk inserts of the records in a large
+// array. If the input contains an error or its top-level value is not an
+// array, any partial batch is yielded, followed by the error, and iteration
+// stops. Comments and Whitespace tokens between elements are discarded.
+func (p *Parser) Batch(inp []byte, n int) iter.Seq2[[][]byte, error] {
+	return batchElements("Batch", p.Tokenize(inp), n, false, func(first, last Token, _ []Token) []byte {
+		return inp[first.Start : last.End+1]
+	})
+}
+
+// BatchTokens is like Parser.Batch, but it yields the tokens of each element.
+func BatchTokens(tokens iter.Seq[Token], n int) iter.Seq2[[][]Token, error] {
+	return batchTokens("BatchTokens", tokens, n)
+}
+
+// batchTokens is like BatchTokens, but errors detected by it are attributed to
+// the given stage (see Token.Stage).
+func batchTokens(stage string, tokens iter.Seq[Token], n int) iter.Seq2[[][]Token, error] {
+	return batchElements(stage, tokens, n, true, func(_, _ Token, toks []Token) []Token {
+		return toks
+	})
+}
+
+func batchElements[T any](stage string, tokens iter.Seq[Token], n int, keepTokens bool, element func(first, last Token, toks []Token) T) iter.Seq2[[]T, error] {
+	if n <= 0 {
+		panic("jsonstream: batch size must be positive")
+	}
+	return func(yield func([]T, error) bool) {
+		var batch []T
+		var first Token
+		var toks []Token
+		depth := 0
+
+		for t := range tokens {
+			if IsError(t.Kind) {
+				if len(batch) > 0 && !yield(batch, nil) {
+					return
+				}
+				yield(nil, t.AsError())
+				return
+			}
+			if (t.Kind == Comment || t.Kind == Whitespace) && depth <= 1 {
+				continue
+			}
+
+			if depth == 0 {
+				if t.Kind != ArrayStart {
+					if len(batch) > 0 && !yield(batch, nil) {
+						return
+					}
+					yield(nil, stageError(stage, ErrorUnexpectedToken, t, t, "Expected array").AsError())
+					return
+				}
+				depth++
+				continue
+			}
+
+			if depth == 1 {
+				if t.Kind == ArrayEnd {
+					depth--
+					if len(batch) > 0 && !yield(batch, nil) {
+						return
+					}
+					batch = nil
+					continue
+				}
+				first = t
+				if keepTokens {
+					toks = nil
+				}
+			}
+
+			if keepTokens {
+				toks = append(toks, t)
+			}
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+				continue
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+
+			if depth == 1 {
+				if batch == nil {
+					batch = make([]T, 0, n)
+				}
+				batch = append(batch, element(first, t, toks))
+				if len(batch) == n {
+					if !yield(batch, nil) {
+						return
+					}
+					batch = nil
+				}
+			}
+		}
+
+		if len(batch) > 0 {
+			yield(batch, nil)
+		}
+	}
+}
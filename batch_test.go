@@ -0,0 +1,88 @@
+package jsonstream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	t.Run("raw elements", func(t *testing.T) {
+		const input = `[1, {"a": [2, 3]}, "x", [], null, /* c */ true, {"b": {}}]`
+		var p Parser
+		p.AllowComments = true
+		var batches []string
+		for batch, err := range p.Batch([]byte(input), 3) {
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			var elems []string
+			for _, e := range batch {
+				elems = append(elems, string(e))
+			}
+			batches = append(batches, strings.Join(elems, " | "))
+		}
+		expected := []string{`1 | {"a": [2, 3]} | "x"`, `[] | null | true`, `{"b": {}}`}
+		if fmt.Sprint(batches) != fmt.Sprint(expected) {
+			t.Errorf("Expected %v, got %v", expected, batches)
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		var p Parser
+		var sizes []int
+		for batch, err := range BatchTokens(p.Tokenize([]byte(`[[1, 2], 3, {"a": 4}, 5]`)), 2) {
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			for _, toks := range batch {
+				sizes = append(sizes, len(toks))
+			}
+		}
+		if fmt.Sprint(sizes) != "[4 1 3 1]" {
+			t.Errorf("Unexpected element sizes %v", sizes)
+		}
+	})
+
+	t.Run("empty array", func(t *testing.T) {
+		var p Parser
+		for batch, err := range p.Batch([]byte(`[]`), 10) {
+			t.Errorf("Unexpected batch %v %v", batch, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var p Parser
+		var results []string
+		for batch, err := range p.Batch([]byte(`[1, 2, 3, 01]`), 2) {
+			results = append(results, fmt.Sprintf("%d %v", len(batch), err))
+		}
+		expected := []string{"2 <nil>", "1 <nil>", "0 1:11 Error: Leading zeros not permitted in numbers"}
+		if fmt.Sprint(results) != fmt.Sprint(expected) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		var p Parser
+		for _, err := range p.Batch([]byte(`{"a": 1}`), 2) {
+			if err == nil || err.Error() != "1:1 Error (Batch): Expected array" {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}
+	})
+
+	t.Run("early termination", func(t *testing.T) {
+		var p Parser
+		n := 0
+		for range p.Batch([]byte(`[1, 2, 3, 4, 5]`), 1) {
+			n++
+			if n == 2 {
+				break
+			}
+		}
+		if n != 2 {
+			t.Errorf("Expected 2 batches, got %v", n)
+		}
+	})
+}
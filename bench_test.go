@@ -2,6 +2,7 @@ package jsonstream
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -85,6 +86,56 @@ func BenchmarkJsonstream(b *testing.B) {
 	}
 }
 
+func BenchmarkJsonstreamSelected(b *testing.B) {
+	for range b.N {
+		var p Parser
+		for t := range p.TokenizeSelected(input, []any{Wildcard{}, 3, "key2", 0}) {
+			if IsError(t.Kind) {
+				b.Fatalf("Unexpected Tokenize error: %+v\n", t)
+			}
+			if t.Kind == Number {
+				t.AsInt()
+			}
+		}
+	}
+}
+
+// TestAllocationsPerToken enforces the allocation guarantee documented for
+// Parser.Tokenize: with the configuration below, the number of allocations
+// made by an iteration does not depend on the number of tokens.
+func TestAllocationsPerToken(t *testing.T) {
+	const element = `{"key": [1, -2.5e3, true, false, null, "foo", {}, []]} /* comment */`
+	small := []byte("[" + element + "]")
+	large := []byte("[" + strings.Repeat(element+",\n", 1000) + element + "]")
+
+	parsers := map[string]Parser{
+		"default":      {AllowComments: true},
+		"key tokens":   {AllowComments: true, EmitKeyTokens: true},
+		"whitespace":   {AllowComments: true, EmitWhitespace: true},
+		"max depth":    {AllowComments: true, MaxDepth: 8},
+		"trailing ,":   {AllowComments: true, Commas: CommasAllowTrailing},
+		"version 2":    {AllowComments: true, Version: TokenStreamV2},
+		"unicode line": {AllowComments: true, LineTerminators: LineTerminatorUnicode},
+	}
+	for name, p := range parsers {
+		allocs := func(input []byte) float64 {
+			return testing.AllocsPerRun(10, func() {
+				for tok := range p.Tokenize(input) {
+					if IsError(tok.Kind) {
+						t.Fatalf("Unexpected error %v", tok)
+					}
+					if tok.Kind == Number {
+						tok.AsFloat64()
+					}
+				}
+			})
+		}
+		if s, l := allocs(small), allocs(large); s != l {
+			t.Errorf("%v: %v allocations for a small input, but %v for a large input", name, s, l)
+		}
+	}
+}
+
 // Notes on benchmarking:
 //
 // Run just the jsonstream benchmark with profiling:
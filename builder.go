@@ -0,0 +1,248 @@
+package jsonstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TokenBuilder constructs a token sequence from a series of calls, so that
+// code generating JSON can take part in token pipelines without formatting
+// and reparsing text. For example,
+//
+//	b := NewTokenBuilder(nil)
+//	b.BeginObject().Key("id").Value(7).Key("tags").BeginArray().Value("a").EndArray().EndObject()
+//	tokens := b.Tokens()
+//
+// builds the tokens of {"id":7,"tags":["a"]}. Each method returns the builder
+// so that calls can be chained. The first misuse (e.g. a value in an object
+// without a key) is recorded as the builder's error and later calls are
+// ignored. The tokens have no position information.
+type TokenBuilder struct {
+	w      *Writer
+	tokens []Token
+	stack  []Token // the start tokens of the open containers
+	key    []byte  // the key for the next value, or nil
+	err    error
+}
+
+// NewTokenBuilder returns an empty TokenBuilder. If w is non-nil, each token
+// is written to w as soon as it is built (and not retained), and any error
+// returned by w becomes the builder's error; w must be flushed by the caller.
+func NewTokenBuilder(w *Writer) *TokenBuilder {
+	return &TokenBuilder{w: w}
+}
+
+// Err returns the first error encountered by the builder, if any.
+func (b *TokenBuilder) Err() error {
+	return b.err
+}
+
+// Tokens returns the tokens built so far. If the builder has an error, or an
+// array or object has not been closed, an error token of kind ErrorStage
+// (for the stage "TokenBuilder") is yielded after the tokens. The tokens must
+// not be modified. For a builder with a Writer, no tokens are retained.
+func (b *TokenBuilder) Tokens() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		for _, t := range b.tokens {
+			if !yield(t) {
+				return
+			}
+		}
+		switch {
+		case b.err != nil:
+			yield(NewStageError("TokenBuilder", Token{}, strings.TrimPrefix(b.err.Error(), "jsonstream: ")))
+		case len(b.stack) > 0:
+			yield(NewStageError("TokenBuilder", Token{}, "Unclosed "+containerName(b.stack[len(b.stack)-1].Kind)))
+		}
+	}
+}
+
+func containerName(k Kind) string {
+	if k == ArrayStart {
+		return "array"
+	}
+	return "object"
+}
+
+func (b *TokenBuilder) fail(format string, args ...any) *TokenBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("jsonstream: "+format, args...)
+	}
+	return b
+}
+
+// emit adds the token t to the sequence.
+func (b *TokenBuilder) emit(t Token) {
+	if b.w != nil {
+		if err := b.w.WriteToken(t); err != nil {
+			b.err = err
+		}
+		return
+	}
+	b.tokens = append(b.tokens, t)
+}
+
+// begin checks that a value may be added, returning the key for the value.
+func (b *TokenBuilder) begin() ([]byte, bool) {
+	if b.err != nil {
+		return nil, false
+	}
+	key := b.key
+	b.key = nil
+	if len(b.stack) > 0 && b.stack[len(b.stack)-1].Kind == ObjectStart && key == nil {
+		b.fail("value in object has no key")
+		return nil, false
+	}
+	return key, true
+}
+
+// Key sets the key of the next value, which must be a member of an object.
+func (b *TokenBuilder) Key(key string) *TokenBuilder {
+	switch {
+	case b.err != nil:
+	case len(b.stack) == 0 || b.stack[len(b.stack)-1].Kind != ObjectStart:
+		b.fail("key %q outside object", key)
+	case b.key != nil:
+		b.fail("key %q follows key %q", key, b.key)
+	default:
+		b.key = append([]byte{}, key...)
+	}
+	return b
+}
+
+// BeginObject starts an object.
+func (b *TokenBuilder) BeginObject() *TokenBuilder {
+	return b.beginContainer(ObjectStart)
+}
+
+// BeginArray starts an array.
+func (b *TokenBuilder) BeginArray() *TokenBuilder {
+	return b.beginContainer(ArrayStart)
+}
+
+func (b *TokenBuilder) beginContainer(kind Kind) *TokenBuilder {
+	if key, ok := b.begin(); ok {
+		t := Token{Kind: kind, Key: key}
+		b.stack = append(b.stack, t)
+		b.emit(t)
+	}
+	return b
+}
+
+// EndObject ends the innermost open container, which must be an object.
+func (b *TokenBuilder) EndObject() *TokenBuilder {
+	return b.endContainer(ObjectStart, ObjectEnd)
+}
+
+// EndArray ends the innermost open container, which must be an array.
+func (b *TokenBuilder) EndArray() *TokenBuilder {
+	return b.endContainer(ArrayStart, ArrayEnd)
+}
+
+func (b *TokenBuilder) endContainer(start, end Kind) *TokenBuilder {
+	switch {
+	case b.err != nil:
+	case len(b.stack) == 0 || b.stack[len(b.stack)-1].Kind != start:
+		b.fail("end of %v outside %v", containerName(start), containerName(start))
+	case b.key != nil:
+		b.fail("key %q has no value", b.key)
+	default:
+		top := b.stack[len(b.stack)-1]
+		b.stack = b.stack[:len(b.stack)-1]
+		b.emit(Token{Kind: end, Key: top.Key})
+	}
+	return b
+}
+
+// Value adds a value. Strings, booleans, nil, integer and floating-point
+// types and json.Number are converted directly to the corresponding tokens.
+// Other values are encoded using encoding/json and added as the tokens of
+// the encoding.
+func (b *TokenBuilder) Value(v any) *TokenBuilder {
+	key, ok := b.begin()
+	if !ok {
+		return b
+	}
+	t := Token{Key: key}
+	switch v := v.(type) {
+	case nil:
+		t.Kind = Null
+	case bool:
+		t.Kind = False
+		if v {
+			t.Kind = True
+		}
+	case string:
+		t.Kind, t.Value = String, []byte(v)
+	case json.Number:
+		if !isValidNumber([]byte(v)) {
+			return b.fail("invalid number %q", v)
+		}
+		t.Kind, t.Value = Number, []byte(v)
+	case int:
+		t.Kind, t.Value = Number, strconv.AppendInt(nil, int64(v), 10)
+	case int8:
+		t.Kind, t.Value = Number, strconv.AppendInt(nil, int64(v), 10)
+	case int16:
+		t.Kind, t.Value = Number, strconv.AppendInt(nil, int64(v), 10)
+	case int32:
+		t.Kind, t.Value = Number, strconv.AppendInt(nil, int64(v), 10)
+	case int64:
+		t.Kind, t.Value = Number, strconv.AppendInt(nil, v, 10)
+	case uint:
+		t.Kind, t.Value = Number, strconv.AppendUint(nil, uint64(v), 10)
+	case uint8:
+		t.Kind, t.Value = Number, strconv.AppendUint(nil, uint64(v), 10)
+	case uint16:
+		t.Kind, t.Value = Number, strconv.AppendUint(nil, uint64(v), 10)
+	case uint32:
+		t.Kind, t.Value = Number, strconv.AppendUint(nil, uint64(v), 10)
+	case uint64:
+		t.Kind, t.Value = Number, strconv.AppendUint(nil, v, 10)
+	case float32:
+		return b.float(t, float64(v), 32)
+	case float64:
+		return b.float(t, v, 64)
+	default:
+		return b.encoded(key, v)
+	}
+	b.emit(t)
+	return b
+}
+
+func (b *TokenBuilder) float(t Token, f float64, bitSize int) *TokenBuilder {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return b.fail("unsupported number %v", f)
+	}
+	t.Kind, t.Value = Number, strconv.AppendFloat(nil, f, 'g', -1, bitSize)
+	b.emit(t)
+	return b
+}
+
+// encoded adds the tokens of the encoding of v using encoding/json.
+func (b *TokenBuilder) encoded(key []byte, v any) *TokenBuilder {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	var p Parser
+	tokens := slices.Collect(p.Tokenize(enc))
+	for i, t := range tokens {
+		if IsError(t.Kind) {
+			return b.fail("cannot encode %T: %v", v, t.ErrorMsg)
+		}
+		// The tokens refer to the encoding rather than to an input.
+		t.Line, t.Col, t.Start, t.End, t.parser = 0, 0, 0, 0, nil
+		if i == 0 || i == len(tokens)-1 {
+			t.Key = key
+		}
+		b.emit(t)
+	}
+	return b
+}
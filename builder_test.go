@@ -0,0 +1,74 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestTokenBuilder(t *testing.T) {
+	type point struct {
+		X int `json:"x"`
+	}
+	b := NewTokenBuilder(nil)
+	b.BeginObject().
+		Key("id").Value(7).
+		Key("name").Value("Ann").
+		Key("score").Value(1.5).
+		Key("n").Value(json.Number("1e3")).
+		Key("ok").Value(true).
+		Key("none").Value(nil).
+		Key("tags").BeginArray().Value("a").Value(uint8(2)).BeginObject().EndObject().EndArray().
+		Key("point").Value(point{3}).
+		EndObject()
+	if err := b.Err(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	const expected = `{"id":7,"name":"Ann","score":1.5,"n":1e3,"ok":true,"none":null,"tags":["a",2,{}],"point":{"x":3}}`
+	if got := compactJSON(b.Tokens()); got != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, got)
+	}
+	if err := ValidateTokenSeq(b.Tokens()); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	b = NewTokenBuilder(w)
+	b.BeginArray().Value(1).Value([]int{2, 3}).EndArray()
+	if err := w.Flush(); err != nil || b.Err() != nil {
+		t.Fatalf("Unexpected errors %v, %v", err, b.Err())
+	}
+	if buf.String() != `[1,[2,3]]` {
+		t.Errorf("Unexpected output %v", buf.String())
+	}
+}
+
+func TestTokenBuilderErrors(t *testing.T) {
+	cases := []struct {
+		build    func(b *TokenBuilder)
+		expected string
+	}{
+		{func(b *TokenBuilder) { b.BeginObject().Value(1) }, "value in object has no key"},
+		{func(b *TokenBuilder) { b.BeginArray().Key("a") }, `key "a" outside object`},
+		{func(b *TokenBuilder) { b.BeginObject().Key("a").Key("b") }, `key "b" follows key "a"`},
+		{func(b *TokenBuilder) { b.BeginObject().Key("a").EndObject() }, `key "a" has no value`},
+		{func(b *TokenBuilder) { b.BeginArray().EndObject() }, "end of object outside object"},
+		{func(b *TokenBuilder) { b.Value(math.NaN()).Value(1) }, "unsupported number NaN"},
+		{func(b *TokenBuilder) { b.Value(json.Number("01")) }, `invalid number "01"`},
+		{func(b *TokenBuilder) { b.BeginArray().BeginObject() }, "Unclosed object"},
+	}
+	for _, c := range cases {
+		b := NewTokenBuilder(nil)
+		c.build(b)
+		if got := compactJSON(b.Tokens()); !bytes.HasSuffix([]byte(got), []byte("<error: "+c.expected+">")) {
+			t.Errorf("Expected error %v, got %v", c.expected, got)
+		}
+	}
+	b := NewTokenBuilder(nil)
+	b.Value(make(chan int))
+	if b.Err() == nil {
+		t.Errorf("Expected an error for a value that cannot be encoded")
+	}
+}
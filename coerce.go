@@ -0,0 +1,268 @@
+package jsonstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Coercion identifies a type conversion performed by Coerce.
+type Coercion int
+
+const (
+	// Convert numbers and booleans to strings (e.g. 1.5 to "1.5" and true to
+	// "true").
+	CoerceToString Coercion = iota
+	// Convert strings containing a valid JSON number to numbers and booleans
+	// to 1 or 0.
+	CoerceToNumber
+	// Convert numbers to booleans (zero is false and all other values are
+	// true) and the strings "true" and "false" to booleans.
+	CoerceToBool
+	// Convert numbers giving seconds since the Unix epoch to RFC 3339 strings
+	// in UTC.
+	CoerceEpochToRFC3339
+	// Convert RFC 3339 strings to numbers giving seconds since the Unix epoch.
+	// Fractional seconds are preserved.
+	CoerceRFC3339ToEpoch
+)
+
+func (c Coercion) String() string {
+	switch c {
+	case CoerceToString:
+		return "string"
+	case CoerceToNumber:
+		return "number"
+	case CoerceToBool:
+		return "bool"
+	case CoerceEpochToRFC3339:
+		return "RFC 3339 string"
+	case CoerceRFC3339ToEpoch:
+		return "epoch number"
+	}
+	return "<unknown Coercion>"
+}
+
+// CoercionRule specifies a conversion to be applied by Coerce to the values
+// whose paths match the pattern Path (see PathMatches).
+type CoercionRule struct {
+	Path []any
+	To   Coercion
+}
+
+// CoercionError is the decode error recorded by Coerce when a value cannot be
+// converted.
+type CoercionError struct {
+	Line   int      // the line of the value that could not be converted
+	Col    int      // the column of the value that could not be converted
+	Start  int      // the byte index of the start of the value in the input
+	Path   Path     // the path of the value
+	Kind   Kind     // the kind of the value
+	Value  string   // the value (empty for arrays and objects)
+	To     Coercion // the conversion that failed
+	reason string
+}
+
+func (e *CoercionError) Error() string {
+	if e.Kind == ArrayStart || e.Kind == ObjectStart {
+		return fmt.Sprintf("%v:%v cannot convert %v at %v to %v", e.Line, e.Col, e.Kind, e.Path, e.To)
+	}
+	return fmt.Sprintf("%v:%v cannot convert %v %q at %v to %v: %v", e.Line, e.Col, e.Kind, e.Value, e.Path, e.To, e.reason)
+}
+
+// Coerce converts the values at the paths given by the rules between types.
+// If a value matches more than one rule, the first matching rule is applied.
+// Null values are left unchanged. If a value cannot be converted, it is left
+// unchanged and a *CoercionError is added to the decode errors of the
+// associated Parser (see Parser.DecodeErrors). Converted tokens keep the key
+// and position of the original token.
+func Coerce(tokens iter.Seq[Token], rules ...CoercionRule) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		for t := range tokens {
+			path := pt.next(t)
+			if isValueKind(t.Kind) && t.Kind != Null && !IsError(t.Kind) {
+				for _, rule := range rules {
+					if PathMatches(path, rule.Path) {
+						if err := coerceToken(&t, rule.To); err != nil {
+							err.Path = path
+							appendDecodeError(&t, err)
+						}
+						break
+					}
+				}
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+func coerceToken(t *Token, to Coercion) *CoercionError {
+	fail := func(reason string) *CoercionError {
+		err := &CoercionError{Line: t.Line, Col: t.Col, Start: t.Start, Kind: t.Kind, To: to, reason: reason}
+		switch t.Kind {
+		case True:
+			err.Value = "true"
+		case False:
+			err.Value = "false"
+		case ArrayStart, ObjectStart:
+		default:
+			err.Value = string(t.Value)
+		}
+		return err
+	}
+
+	if t.Kind == ArrayStart || t.Kind == ObjectStart {
+		return fail("")
+	}
+
+	switch to {
+	case CoerceToString:
+		switch t.Kind {
+		case Number:
+			t.Kind = String
+		case True:
+			t.Kind = String
+			t.Value = []byte("true")
+		case False:
+			t.Kind = String
+			t.Value = []byte("false")
+		}
+	case CoerceToNumber:
+		switch t.Kind {
+		case String:
+			if !isValidNumber(t.Value) {
+				return fail("not a valid JSON number")
+			}
+			t.Kind = Number
+		case True:
+			t.Kind = Number
+			t.Value = []byte("1")
+		case False:
+			t.Kind = Number
+			t.Value = []byte("0")
+		}
+	case CoerceToBool:
+		switch t.Kind {
+		case Number:
+			// Out of range values are nonzero, so only syntax errors matter here.
+			f, err := parseNumber(t.Value, 64)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				return fail(err.Error())
+			}
+			if f == 0 {
+				t.Kind = False
+			} else {
+				t.Kind = True
+			}
+			t.Value = nil
+		case String:
+			switch string(t.Value) {
+			case "true":
+				t.Kind = True
+			case "false":
+				t.Kind = False
+			default:
+				return fail(`not "true" or "false"`)
+			}
+			t.Value = nil
+		}
+	case CoerceEpochToRFC3339:
+		if t.Kind != Number {
+			return fail("not a number")
+		}
+		f, err := parseNumber(t.Value, 64)
+		if err != nil {
+			return fail(err.Error())
+		}
+		sec := math.Floor(f)
+		if sec < math.MinInt64 || sec >= math.MaxInt64 {
+			return fail("out of range")
+		}
+		nsec := math.Round((f - sec) * 1e9)
+		t.Kind = String
+		t.Value = []byte(time.Unix(int64(sec), int64(nsec)).UTC().Format(time.RFC3339Nano))
+	case CoerceRFC3339ToEpoch:
+		if t.Kind != String {
+			return fail("not a string")
+		}
+		tm, err := time.Parse(time.RFC3339Nano, string(t.Value))
+		if err != nil {
+			return fail(err.Error())
+		}
+		t.Kind = Number
+		t.Value = appendEpoch(nil, tm.Unix(), tm.Nanosecond())
+	}
+	return nil
+}
+
+// appendEpoch appends to b the exact decimal representation of the time sec
+// seconds and nsec nanoseconds (0 <= nsec < 1e9) after the Unix epoch, with
+// no trailing zeros in the fraction.
+func appendEpoch(b []byte, sec int64, nsec int) []byte {
+	if nsec == 0 {
+		return strconv.AppendInt(b, sec, 10)
+	}
+	if sec < 0 {
+		// E.g. -2s + 0.25s is -1.75s.
+		b = append(b, '-')
+		b = strconv.AppendUint(b, uint64(-(sec + 1)), 10)
+		nsec = 1e9 - nsec
+	} else {
+		b = strconv.AppendInt(b, sec, 10)
+	}
+	var buf [10]byte
+	frac := strconv.AppendInt(buf[:0], int64(1e9+nsec), 10)[1:]
+	return append(append(b, '.'), bytes.TrimRight(frac, "0")...)
+}
+
+// isValidNumber returns true iff b is a numeric literal permitted by the JSON
+// standard.
+func isValidNumber(b []byte) bool {
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	if i >= len(b) {
+		return false
+	}
+	if b[i] == '0' {
+		i++
+	} else if b[i] >= '1' && b[i] <= '9' {
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+	} else {
+		return false
+	}
+	if i < len(b) && b[i] == '.' {
+		i++
+		start := i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		start := i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	return i == len(b)
+}
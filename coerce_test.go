@@ -0,0 +1,82 @@
+package jsonstream
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCoerce(t *testing.T) {
+	cases := []struct {
+		input    string
+		rules    []CoercionRule
+		expected string
+	}{
+		{`{"a": 1.5, "b": true, "c": "x", "d": null}`, []CoercionRule{{[]any{Wildcard{}}, CoerceToString}}, `{"a":"1.5","b":"true","c":"x","d":null}`},
+		{`["12", "-1.5e3", true, false, 7]`, []CoercionRule{{[]any{Wildcard{}}, CoerceToNumber}}, `[12,-1.5e3,1,0,7]`},
+		{`[0, -0.0, 0e10, 1, "true", "false", false]`, []CoercionRule{{[]any{Wildcard{}}, CoerceToBool}}, `[false,false,false,true,true,false,false]`},
+		{`{"t": 1700000000, "u": 1.5}`, []CoercionRule{{[]any{Wildcard{}}, CoerceEpochToRFC3339}}, `{"t":"2023-11-14T22:13:20Z","u":"1970-01-01T00:00:01.5Z"}`},
+		{`{"t": "2023-11-14T22:13:20Z", "u": "1970-01-01T01:00:01.25+01:00"}`, []CoercionRule{{[]any{Wildcard{}}, CoerceRFC3339ToEpoch}}, `{"t":1700000000,"u":1.25}`},
+		{`["2023-11-14T22:13:20.123456789Z", "1969-12-31T23:59:58.25Z", "1969-12-31T23:59:59.000000001Z"]`, []CoercionRule{{[]any{Wildcard{}}, CoerceRFC3339ToEpoch}}, `[1700000000.123456789,-1.75,-0.999999999]`},
+		{`[{"id": "1", "n": "2"}, {"id": "3", "n": "4"}]`, []CoercionRule{{[]any{Wildcard{}, "id"}, CoerceToNumber}}, `[{"id":1,"n":"2"},{"id":3,"n":"4"}]`},
+		{`{"a": 1}`, []CoercionRule{{[]any{"a"}, CoerceToString}, {[]any{"a"}, CoerceToBool}}, `{"a":"1"}`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(Coerce(p.Tokenize([]byte(c.input)), c.rules...))
+		if out != c.expected {
+			t.Errorf("Coercing %v: expected %v, got %v", c.input, c.expected, out)
+		}
+		if err := p.DecodeError(); err != nil {
+			t.Errorf("Unexpected decode error %v", err)
+		}
+	}
+
+	t.Run("failed conversions are recorded as decode errors", func(t *testing.T) {
+		var p Parser
+		const input = `{"a": "1x", "b": [1], "c": "yes"}`
+		out := compactJSON(Coerce(p.Tokenize([]byte(input)),
+			CoercionRule{[]any{"a"}, CoerceToNumber},
+			CoercionRule{[]any{"b"}, CoerceToNumber},
+			CoercionRule{[]any{"c"}, CoerceToBool},
+		))
+		if out != `{"a":"1x","b":[1],"c":"yes"}` {
+			t.Errorf("Expected values to be unchanged, got %v", out)
+		}
+		errs := p.DecodeErrors()
+		if len(errs) != 3 {
+			t.Fatalf("Expected 3 decode errors, got %v", errs)
+		}
+		var ce *CoercionError
+		if !errors.As(errs[0], &ce) || ce.Line != 1 || ce.Col != 7 || ce.Start != 6 || ce.To != CoerceToNumber || ce.Path.String() != `["a"]` {
+			t.Errorf("Unexpected error %+v", errs[0])
+		}
+		const expectedMsg = `1:7 cannot convert String "1x" at ["a"] to number: not a valid JSON number`
+		if errs[0].Error() != expectedMsg {
+			t.Errorf("Expected %v, got %v", expectedMsg, errs[0].Error())
+		}
+		if errs[1].Error() != `1:18 cannot convert ArrayStart at ["b"] to number` {
+			t.Errorf("Unexpected error message %v", errs[1].Error())
+		}
+	})
+
+	t.Run("epoch times beyond the range of int64 are rejected", func(t *testing.T) {
+		var p Parser
+		out := compactJSON(Coerce(p.Tokenize([]byte(`[9223372036854775807, 1e19]`)), CoercionRule{[]any{Wildcard{}}, CoerceEpochToRFC3339}))
+		if out != `[9223372036854775807,1e19]` || len(p.DecodeErrors()) != 2 {
+			t.Errorf("Unexpected output %v (errors %v)", out, p.DecodeErrors())
+		}
+	})
+}
+
+func TestIsValidNumber(t *testing.T) {
+	for _, s := range []string{"0", "-0", "1", "-12", "1.5", "1e5", "1E+5", "1.25e-5", "0.0"} {
+		if !isValidNumber([]byte(s)) {
+			t.Errorf("Expected %q to be valid", s)
+		}
+	}
+	for _, s := range []string{"", "-", "01", "1.", ".5", "1e", "1e+", "+1", "0x1", "1.5.5", " 1", "NaN"} {
+		if isValidNumber([]byte(s)) {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package jsonstream
+
+import (
+	"iter"
+	"math"
+	"slices"
+)
+
+// CompareOptions configures Equal and Diff.
+type CompareOptions struct {
+	// Numbers are equal if they differ by no more than AbsTolerance, or by no
+	// more than RelTolerance times the larger of their magnitudes. If both are
+	// zero, numbers are equal only if they have the same float64 value.
+	AbsTolerance float64
+	RelTolerance float64
+	// Set to true to compare the text of numbers rather than their values
+	// (so that 1 and 1.0 differ). The tolerances are then ignored.
+	ExactNumbers bool
+}
+
+// Difference describes a value that differs between the documents compared
+// by Diff.
+type Difference struct {
+	Path        []any // the path of the value (see PathToSlice)
+	Left, Right *Node // the value in each document, or nil if it is absent from that document
+}
+
+// Equal reports whether the first top-level values of two token sequences are
+// semantically equal, i.e. Diff finds no differences between them.
+func Equal(left, right iter.Seq[Token], opts CompareOptions) (bool, error) {
+	diffs, err := diff(left, right, opts, true)
+	return len(diffs) == 0, err
+}
+
+// Diff returns the differences between the first top-level values of two
+// token sequences. Objects are equal if they have the same keys with equal
+// values, whatever the order of their members (only the first member with
+// each key is compared). Arrays are equal if they have the same length and
+// equal elements. Numbers are compared by value, within the tolerances given
+// by opts, and strings by their decoded values. A difference is reported for
+// the outermost values that differ, other than for arrays and objects, whose
+// elements and members are compared. If either sequence contains an error,
+// the error (as returned by Token.AsError) is returned.
+func Diff(left, right iter.Seq[Token], opts CompareOptions) ([]Difference, error) {
+	return diff(left, right, opts, false)
+}
+
+func diff(left, right iter.Seq[Token], opts CompareOptions, first bool) ([]Difference, error) {
+	l, err := BuildTree(left, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := BuildTree(right, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := comparer{opts: opts, first: first}
+	c.compare([]any{}, l, r)
+	return c.diffs, nil
+}
+
+type comparer struct {
+	opts  CompareOptions
+	first bool // whether to stop at the first difference
+	diffs []Difference
+}
+
+func (c *comparer) compare(path []any, l, r *Node) {
+	if c.first && len(c.diffs) > 0 {
+		return
+	}
+	differ := func() {
+		c.diffs = append(c.diffs, Difference{Path: slices.Clone(path), Left: l, Right: r})
+	}
+	if l == nil || r == nil {
+		if l != r {
+			differ()
+		}
+		return
+	}
+	if l.Kind != r.Kind {
+		differ()
+		return
+	}
+	switch l.Kind {
+	case ArrayStart:
+		for i := range max(len(l.Children), len(r.Children)) {
+			var le, re *Node
+			if i < len(l.Children) {
+				le = l.Children[i]
+			}
+			if i < len(r.Children) {
+				re = r.Children[i]
+			}
+			c.compare(append(path, i), le, re)
+		}
+	case ObjectStart:
+		lm, rm := firstMembers(l), firstMembers(r)
+		for _, m := range l.Children {
+			if lm[string(m.Key)] == m {
+				c.compare(append(path, string(m.Key)), m, rm[string(m.Key)])
+			}
+		}
+		for _, m := range r.Children {
+			if rm[string(m.Key)] == m && lm[string(m.Key)] == nil {
+				c.compare(append(path, string(m.Key)), nil, m)
+			}
+		}
+	case Number:
+		if !c.numbersEqual(l.Value, r.Value) {
+			differ()
+		}
+	default:
+		if string(l.Value) != string(r.Value) {
+			differ()
+		}
+	}
+}
+
+// numbersEqual reports whether the numbers with the literals a and b are
+// equal for the options of c.
+func (c *comparer) numbersEqual(a, b []byte) bool {
+	if c.opts.ExactNumbers || string(a) == string(b) {
+		return string(a) == string(b)
+	}
+	x, errX := parseNumber(a, 64)
+	y, errY := parseNumber(b, 64)
+	if errX != nil || errY != nil {
+		return false
+	}
+	d := math.Abs(x - y)
+	return x == y || d <= c.opts.AbsTolerance || d <= c.opts.RelTolerance*max(math.Abs(x), math.Abs(y))
+}
+
+// firstMembers returns the first member of the object n with each key.
+func firstMembers(n *Node) map[string]*Node {
+	members := make(map[string]*Node, len(n.Children))
+	for _, m := range n.Children {
+		if _, ok := members[string(m.Key)]; !ok {
+			members[string(m.Key)] = m
+		}
+	}
+	return members
+}
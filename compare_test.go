@@ -0,0 +1,56 @@
+package jsonstream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		left, right string
+		opts        CompareOptions
+		expected    [][]any
+	}{
+		{`{"a": 1, "b": [true, "x"]}`, `{"b": [true, "x"], "a": 1.0}`, CompareOptions{}, nil},
+		{`{"a": 1, "b": [true, "x"]}`, `{"b": [true, "x"], "a": 1.0}`, CompareOptions{ExactNumbers: true}, [][]any{{"a"}}},
+		{`{"a": 1, "b": 2}`, `{"b": 3, "c": 4}`, CompareOptions{}, [][]any{{"a"}, {"b"}, {"c"}}},
+		{`[1, [2, 3]]`, `[1, [2], 4]`, CompareOptions{}, [][]any{{1, 1}, {2}}},
+		{`[0.1, 100, 3]`, `[0.10000001, 100.5, 3.5]`, CompareOptions{AbsTolerance: 1e-6, RelTolerance: 0.01}, [][]any{{2}}},
+		{`{"a": null, "a": 1}`, `{"a": null}`, CompareOptions{}, nil},
+		{`{"a": {}}`, `{"a": []}`, CompareOptions{}, [][]any{{"a"}}},
+		{`"x"`, `1`, CompareOptions{}, [][]any{{}}},
+	}
+	for _, c := range cases {
+		var lp, rp Parser
+		diffs, err := Diff(lp.Tokenize([]byte(c.left)), rp.Tokenize([]byte(c.right)), c.opts)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var paths [][]any
+		for _, d := range diffs {
+			paths = append(paths, d.Path)
+		}
+		if !reflect.DeepEqual(paths, c.expected) {
+			t.Errorf("Comparing %v with %v (%+v): expected %v, got %v", c.left, c.right, c.opts, c.expected, paths)
+		}
+		equal, err := Equal(lp.Tokenize([]byte(c.left)), rp.Tokenize([]byte(c.right)), c.opts)
+		if err != nil || equal != (len(c.expected) == 0) {
+			t.Errorf("Comparing %v with %v (%+v): unexpected result %v (error %v)", c.left, c.right, c.opts, equal, err)
+		}
+	}
+
+	t.Run("differences give the values", func(t *testing.T) {
+		var lp, rp Parser
+		diffs, _ := Diff(lp.Tokenize([]byte(`{"a": 1}`)), rp.Tokenize([]byte(`{"a": 2, "b": 3}`)), CompareOptions{})
+		if len(diffs) != 2 || string(diffs[0].Left.Value) != "1" || string(diffs[0].Right.Value) != "2" || diffs[1].Left != nil || string(diffs[1].Right.Value) != "3" {
+			t.Errorf("Unexpected differences %+v", diffs)
+		}
+	})
+
+	t.Run("errors are returned", func(t *testing.T) {
+		var lp, rp Parser
+		if _, err := Diff(lp.Tokenize([]byte(`[1]`)), rp.Tokenize([]byte(`[1,]`)), CompareOptions{}); err == nil || err.Error() != "1:3 Error: Trailing ','" {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
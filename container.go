@@ -0,0 +1,57 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+)
+
+// TokenWithContainerIDs is a Token together with the IDs of the containers
+// that it starts, ends or belongs to.
+type TokenWithContainerIDs struct {
+	Token    Token
+	ID       int // for ArrayStart, ArrayEnd, ObjectStart and ObjectEnd tokens, the ID of the container; otherwise 0
+	ParentID int // the ID of the container enclosing the token, or 0 for top-level tokens
+}
+
+func (t TokenWithContainerIDs) String() string {
+	return fmt.Sprintf("%v id=%v parent=%v", t.Token, t.ID, t.ParentID)
+}
+
+// WithContainerIDs converts a sequence of Token values into a sequence of
+// TokenWithContainerIDs values. Each array or object is assigned an ID when it
+// starts. IDs begin at 1 and increase by 1 for each container, so they
+// increase in document order. The start and end tokens of the same container
+// have the same ID, and the ParentID of a token is the ID of its enclosing
+// container, allowing structural relationships to be reconstructed without
+// maintaining a stack.
+func WithContainerIDs(tokens iter.Seq[Token]) iter.Seq[TokenWithContainerIDs] {
+	return func(yield func(TokenWithContainerIDs) bool) {
+		var stack []int
+		nextID := 1
+		for t := range tokens {
+			parent := 0
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			id := 0
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				id = nextID
+				nextID++
+				stack = append(stack, id)
+			case ArrayEnd, ObjectEnd:
+				if len(stack) > 0 {
+					id = parent
+					stack = stack[:len(stack)-1]
+					parent = 0
+					if len(stack) > 0 {
+						parent = stack[len(stack)-1]
+					}
+				}
+			}
+			if !yield(TokenWithContainerIDs{Token: t, ID: id, ParentID: parent}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package jsonstream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWithContainerIDs(t *testing.T) {
+	var p Parser
+	var got []string
+	for twc := range WithContainerIDs(p.Tokenize([]byte(`{"a": [1, {"b": 2}], "c": []}`))) {
+		got = append(got, fmt.Sprintf("%v %v %v", twc.Token.Kind, twc.ID, twc.ParentID))
+	}
+	expected := []string{
+		"ObjectStart 1 0",
+		"ArrayStart 2 1",
+		"Number 0 2",
+		"ObjectStart 3 2",
+		"Number 0 3",
+		"ObjectEnd 3 2",
+		"ArrayEnd 2 1",
+		"ArrayStart 4 1",
+		"ArrayEnd 4 1",
+		"ObjectEnd 1 0",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,38 @@
+package jsonstream
+
+import (
+	"io"
+)
+
+const copyChunkSize = 32 * 1024
+
+// Copy writes the input to dst without modification, validating it as it is
+// copied. This is useful for proxies that must verify but not modify
+// payloads. The input is written in chunks as it is validated, so if an
+// error is found, the part of the input preceding it may already have been
+// written. The error returned in that case is the error of the first error
+// token (which gives its position). Copy returns the number of bytes written.
+func (p *Parser) Copy(dst io.Writer, src []byte) (int64, error) {
+	written := 0
+	write := func(end int) error {
+		n, err := dst.Write(src[written:end])
+		written += n
+		if err == nil && written < end {
+			err = io.ErrShortWrite
+		}
+		return err
+	}
+
+	for t := range p.Tokenize(src) {
+		if err := t.AsError(); err != nil {
+			return int64(written), err
+		}
+		if t.End+1-written >= copyChunkSize {
+			if err := write(t.End + 1); err != nil {
+				return int64(written), err
+			}
+		}
+	}
+	err := write(len(src))
+	return int64(written), err
+}
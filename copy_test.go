@@ -0,0 +1,55 @@
+package jsonstream
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	p := Parser{AllowComments: true}
+	inputs := []string{
+		`{"a": [1, 2, 3]}`,
+		" [ \"x\" , /* c */ null ]\n\n",
+		"[" + strings.Repeat(`"abcdefghij", `, 10000) + "1]",
+	}
+	for _, input := range inputs {
+		var buf bytes.Buffer
+		n, err := p.Copy(&buf, []byte(input))
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if buf.String() != input || n != int64(len(input)) {
+			t.Errorf("Expected input to be copied unchanged (%v bytes written)", n)
+		}
+	}
+
+	t.Run("reports the first error", func(t *testing.T) {
+		input := "[" + strings.Repeat("1, ", 20000) + "x]"
+		var buf bytes.Buffer
+		n, err := p.Copy(&buf, []byte(input))
+		if err == nil || !strings.Contains(err.Error(), "1:60002") {
+			t.Fatalf("Expected error, got %v", err)
+		}
+		if int64(buf.Len()) != n || n >= int64(len(input)) || !strings.HasPrefix(input, buf.String()) {
+			t.Errorf("Expected a proper prefix of the input to be written, got %v bytes", n)
+		}
+	})
+
+	t.Run("reports write errors", func(t *testing.T) {
+		errWrite := errors.New("write failed")
+		n, err := p.Copy(failingWriter{errWrite}, []byte("[1]"))
+		if err != errWrite || n != 0 {
+			t.Errorf("Expected write error, got %v (%v bytes)", err, n)
+		}
+	})
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,116 @@
+package jsonstream
+
+import "iter"
+
+// Cursor reads a sequence of tokens one at a time, as an alternative to
+// iterating over the sequence with range. Since a Cursor can be passed to
+// functions that each consume part of the sequence, it suits recursive
+// descent (e.g. a function that reads an object and calls another function
+// to read each of its values).
+//
+// A Cursor must be closed unless Next has returned false. A Cursor may not be
+// used by more than one goroutine at once.
+type Cursor struct {
+	next  func() (Token, bool)
+	stop  func()
+	ahead []Token // tokens read from the sequence but not yet returned by Next
+	done  bool    // whether the sequence is exhausted or the cursor is closed
+	depth int
+}
+
+// MaxPeek is the largest number of tokens that PeekN can look ahead by.
+const MaxPeek = 64
+
+// NewCursor returns a Cursor that reads the given sequence of tokens, which
+// is iterated over only once.
+func NewCursor(tokens iter.Seq[Token]) *Cursor {
+	next, stop := iter.Pull(tokens)
+	return &Cursor{next: next, stop: stop}
+}
+
+// Next returns the next token, or false if there are no more tokens.
+func (c *Cursor) Next() (Token, bool) {
+	t, ok := c.Peek()
+	if !ok {
+		return Token{}, false
+	}
+	n := copy(c.ahead, c.ahead[1:])
+	c.ahead[n] = Token{}
+	c.ahead = c.ahead[:n]
+	switch t.Kind {
+	case ArrayStart, ObjectStart:
+		c.depth++
+	case ArrayEnd, ObjectEnd:
+		c.depth--
+	}
+	return t, true
+}
+
+// Peek returns the token that the next call to Next will return, without
+// consuming it, or false if there are no more tokens.
+func (c *Cursor) Peek() (Token, bool) {
+	return c.PeekN(1)
+}
+
+// PeekN returns the token that the nth following call to Next will return,
+// without consuming any tokens, or false if the sequence ends before it.
+// PeekN(1) is equivalent to Peek. The tokens read to reach the nth token are
+// kept in a buffer until they are returned by Next, so PeekN panics if n is
+// less than 1 or greater than MaxPeek.
+func (c *Cursor) PeekN(n int) (Token, bool) {
+	if n < 1 || n > MaxPeek {
+		panic("jsonstream: PeekN called with n out of range")
+	}
+	for len(c.ahead) < n {
+		if c.done {
+			return Token{}, false
+		}
+		t, ok := c.next()
+		if !ok {
+			c.done = true
+			c.stop()
+			return Token{}, false
+		}
+		c.ahead = append(c.ahead, t)
+	}
+	return c.ahead[n-1], true
+}
+
+// Skip consumes the next value, together with any Comment, Key and
+// Whitespace tokens preceding it. If the value is an array or an object, all
+// of its tokens are consumed, up to and including the token that ends it.
+// Skip returns false if the next token (other than a Comment, Key or
+// Whitespace token) ends an array or object, or if the sequence ends or an
+// error token is reached before the end of the value. An error token is not
+// consumed, so that it is returned by the following call to Next. The tokens
+// consumed by Skip count as having been returned by Next for Depth.
+func (c *Cursor) Skip() bool {
+	depth := c.depth
+	for {
+		t, ok := c.Peek()
+		if !ok || IsError(t.Kind) || (c.depth == depth && isContainerEnd(t.Kind)) {
+			return false
+		}
+		c.Next()
+		if c.depth == depth && (isValueKind(t.Kind) || isContainerEnd(t.Kind)) {
+			return true
+		}
+	}
+}
+
+// Depth returns the number of arrays and objects that have been started but
+// not ended by the tokens returned by Next.
+func (c *Cursor) Depth() int {
+	return c.depth
+}
+
+// Close stops the iteration over the sequence of tokens. Subsequent calls to
+// Next, Peek and PeekN return false. Close may be called more than once.
+func (c *Cursor) Close() {
+	if !c.done {
+		c.done = true
+		c.stop()
+	}
+	clear(c.ahead)
+	c.ahead = c.ahead[:0]
+}
@@ -0,0 +1,156 @@
+package jsonstream
+
+import (
+	"slices"
+	"testing"
+)
+
+// cursorSum sums the numbers in the array or object read from c, by
+// recursive descent, skipping any value with the key "skip".
+func cursorSum(c *Cursor) float64 {
+	sum := 0.0
+	for {
+		t, ok := c.Peek()
+		if !ok || isContainerEnd(t.Kind) {
+			c.Next()
+			return sum
+		}
+		if string(t.Key) == "skip" {
+			c.Skip()
+			continue
+		}
+		c.Next()
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			sum += cursorSum(c)
+		case Number:
+			f, _ := parseNumber(t.Value, 64)
+			sum += f
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	const input = `{"a": 1, "b": [2, {"c": 3}], "skip": {"d": [100]}, "e": 4}`
+	var p Parser
+	c := NewCursor(p.Tokenize([]byte(input)))
+	defer c.Close()
+	if t0, ok := c.Next(); !ok || t0.Kind != ObjectStart || c.Depth() != 1 {
+		t.Fatalf("Unexpected first token %v", t0)
+	}
+	if got := cursorSum(c); got != 10 {
+		t.Errorf("Expected 10, got %v", got)
+	}
+	if c.Depth() != 0 {
+		t.Errorf("Expected depth 0, got %v", c.Depth())
+	}
+	if _, ok := c.Next(); ok {
+		t.Errorf("Expected the end of the sequence")
+	}
+	if _, ok := c.Peek(); ok || c.Skip() {
+		t.Errorf("Expected the end of the sequence")
+	}
+}
+
+func TestCursorSkip(t *testing.T) {
+	p := Parser{AllowComments: true}
+	c := NewCursor(p.Tokenize([]byte(`[/* c */ {"a": [1, 2]}, 3]`)))
+	defer c.Close()
+	c.Next()
+	if tok, ok := c.Peek(); !ok || tok.Kind != Comment {
+		t.Fatalf("Expected a comment, got %v", tok)
+	}
+	if !c.Skip() || c.Depth() != 1 {
+		t.Fatalf("Expected the object to be skipped at depth 1, got depth %v", c.Depth())
+	}
+	if !c.Skip() {
+		t.Fatalf("Expected the number to be skipped")
+	}
+	if c.Skip() {
+		t.Errorf("Expected Skip to stop at the end of the array")
+	}
+	if tok, ok := c.Next(); !ok || tok.Kind != ArrayEnd || c.Depth() != 0 {
+		t.Errorf("Expected the end of the array, got %v", tok)
+	}
+
+	t.Run("an error is not consumed", func(t *testing.T) {
+		var p Parser
+		c := NewCursor(p.Tokenize([]byte(`[[1, tru], 2]`)))
+		defer c.Close()
+		c.Next()
+		if c.Skip() {
+			t.Fatalf("Expected Skip to fail")
+		}
+		if tok, ok := c.Next(); !ok || !IsError(tok.Kind) || c.Depth() != 2 {
+			t.Errorf("Expected an error at depth 2, got %v at depth %v", tok, c.Depth())
+		}
+	})
+
+	t.Run("close stops the sequence", func(t *testing.T) {
+		var kinds []Kind
+		seq := func(yield func(Token) bool) {
+			for _, k := range []Kind{ArrayStart, Null, Null, ArrayEnd} {
+				kinds = append(kinds, k)
+				if !yield(Token{Kind: k}) {
+					return
+				}
+			}
+		}
+		c := NewCursor(seq)
+		c.Next()
+		c.Close()
+		c.Close()
+		if _, ok := c.Next(); ok {
+			t.Errorf("Expected no tokens after Close")
+		}
+		if !slices.Equal(kinds, []Kind{ArrayStart}) {
+			t.Errorf("Expected the sequence to stop, got %v", kinds)
+		}
+	})
+}
+
+func TestCursorPeekN(t *testing.T) {
+	var p Parser
+	c := NewCursor(p.Tokenize([]byte(`[{}, {"a": 1}]`)))
+	defer c.Close()
+	c.Next()
+	// An empty object can be distinguished from a non-empty one before the
+	// object is consumed.
+	for _, expected := range []Kind{ObjectEnd, Number} {
+		if tok, ok := c.PeekN(2); !ok || tok.Kind != expected {
+			t.Fatalf("Expected %v, got %v", expected, tok)
+		}
+		if tok, ok := c.Peek(); !ok || tok.Kind != ObjectStart || c.Depth() != 1 {
+			t.Fatalf("Expected the start of an object at depth 1, got %v", tok)
+		}
+		c.Skip()
+	}
+	if tok, ok := c.PeekN(1); !ok || tok.Kind != ArrayEnd {
+		t.Errorf("Expected the end of the array, got %v", tok)
+	}
+	if _, ok := c.PeekN(2); ok {
+		t.Errorf("Expected the end of the sequence")
+	}
+	if tok, ok := c.Next(); !ok || tok.Kind != ArrayEnd || c.Depth() != 0 {
+		t.Errorf("Expected the buffered end of the array, got %v", tok)
+	}
+	if _, ok := c.Next(); ok {
+		t.Errorf("Expected the end of the sequence")
+	}
+
+	t.Run("n out of range", func(t *testing.T) {
+		for _, n := range []int{0, MaxPeek + 1} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("Expected PeekN(%v) to panic", n)
+					}
+				}()
+				var p Parser
+				c := NewCursor(p.Tokenize([]byte(`1`)))
+				defer c.Close()
+				c.PeekN(n)
+			}()
+		}
+	})
+}
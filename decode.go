@@ -0,0 +1,908 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UnmarshalError is returned by Decode and Parser.Unmarshal if a value cannot
+// be stored in the Go value of the corresponding type (e.g. a string for an
+// int field, or a number that overflows it). It gives the position and path
+// of the value.
+type UnmarshalError struct {
+	Line  int          // the line of the value that could not be decoded
+	Col   int          // the column of the value that could not be decoded
+	Start int          // the byte index of the start of the value in the input
+	Path  Path         // the path of the value
+	Kind  Kind         // the kind of the value
+	Value string       // the value (empty for arrays and objects)
+	Type  reflect.Type // the type into which the value could not be decoded
+	Err   error        // the reason for the failure, if any (e.g. an error returned by an UnmarshalJSON method)
+}
+
+func (e *UnmarshalError) Error() string {
+	var msg string
+	if e.Kind == ArrayStart || e.Kind == ObjectStart {
+		msg = fmt.Sprintf("%v:%v cannot decode %v at %v into %v", e.Line, e.Col, e.Kind, e.Path, e.Type)
+	} else {
+		msg = fmt.Sprintf("%v:%v cannot decode %v %q at %v into %v", e.Line, e.Col, e.Kind, e.Value, e.Path, e.Type)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the reason for the failure.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownFieldError is returned by DecodeWithOptions and
+// Parser.UnmarshalWithOptions if DecodeOptions.DisallowUnknownFields is set
+// and a member of an object decoded into a struct matches none of its fields.
+type UnknownFieldError struct {
+	Line  int          // the line of the member's value
+	Col   int          // the column of the member's value
+	Start int          // the byte index of the start of the member's value in the input
+	Path  Path         // the path of the member
+	Key   string       // the key of the member
+	Type  reflect.Type // the struct type
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("%v:%v unknown field %q at %v in %v", e.Line, e.Col, e.Key, e.Path, e.Type)
+}
+
+// MissingFieldError is returned by Decode and Parser.Unmarshal if an object
+// decoded into a struct has no member for a field with the "required" option
+// (e.g. Name string `json:"name,required"`).
+type MissingFieldError struct {
+	Line  int          // the line of the object
+	Col   int          // the column of the object
+	Start int          // the byte index of the start of the object in the input
+	Path  Path         // the path of the object
+	Field string       // the name of the missing field
+	Type  reflect.Type // the struct type
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("%v:%v missing required field %q in object at %v for %v", e.Line, e.Col, e.Field, e.Path, e.Type)
+}
+
+// Position is the position of a value in the input (see
+// DecodeOptions.Positions).
+type Position struct {
+	Line  int // the line of the value
+	Col   int // the column of the value
+	Start int // the byte index of the start of the value in the input
+}
+
+// DecodeOptions configures DecodeWithOptions and Parser.UnmarshalWithOptions.
+type DecodeOptions struct {
+	// If set, an object key matches a struct field only if it is exactly equal
+	// to the field's name. Otherwise, as for json.Unmarshal, a key that
+	// exactly matches no field matches a field whose name differs from it
+	// only in case.
+	ExactFieldNames bool
+	// If set, a member of an object decoded into a struct that matches none of
+	// its fields is an error (as for json.Decoder.DisallowUnknownFields),
+	// unless the struct has a field that collects such members (see Decode).
+	// Decoding continues with the following members, and an
+	// *UnknownFieldError for the first such member is returned unless an
+	// earlier value could not be decoded.
+	DisallowUnknownFields bool
+	// If non-nil, the position of the value of each struct field that is
+	// decoded is added to Positions, keyed by the path of the value as given
+	// by Path.String (e.g. ["servers"][0]["port"]), so that problems found
+	// after decoding (e.g. by validating the decoded value) can be reported
+	// at their place in the input.
+	Positions map[string]Position
+}
+
+var errDecodeTarget = errors.New("jsonstream: Decode requires a non-nil pointer")
+
+// Decode decodes the first value in the token sequence into the value pointed
+// to by v, following the rules of json.Unmarshal: struct fields are matched
+// to object keys using their json tags (including the "string" option) or,
+// failing that, their names (preferring an exact match to a case-insensitive
+// one), values implementing json.Unmarshaler or encoding.TextUnmarshaler
+// decode themselves (an UnmarshalJSON method receives the value as written
+// by Writer), and values of interface type receive map[string]any, []any,
+// string, float64, bool or nil. Extension tokens are decoded as strings.
+// Comments, Key tokens and Whitespace tokens are ignored, and tokens after
+// the first value are not read.
+//
+// Members of an object that match no field of a struct are ignored, unless
+// the struct has a field of map type with string keys and the "unknown"
+// option (e.g. Extra map[string]json.RawMessage `json:",unknown"`), in which
+// case they are decoded as entries of that map (as for a map being decoded),
+// so that members that a program does not recognize can be preserved. If an
+// object has no member for a struct field with the "required" option (e.g.
+// Name string `json:"name,required"`), a *MissingFieldError is returned
+// unless an earlier value caused an error; a member whose value is null is
+// not missing.
+//
+// If the input contains an error before the end of the first value, the
+// error (as returned by Token.AsError) is returned. If a value cannot be
+// stored in v, decoding continues with the following values and a
+// *UnmarshalError for the first such value is returned. If the sequence ends
+// before the end of the first value, ErrMalformedTokenSequence is returned.
+// See DecodeWithOptions for stricter matching of keys to struct fields.
+func Decode(tokens iter.Seq[Token], v any) error {
+	return decode(tokens, v, false, DecodeOptions{})
+}
+
+// DecodeWithOptions is like Decode, but with the given options.
+func DecodeWithOptions(tokens iter.Seq[Token], v any, opts DecodeOptions) error {
+	return decode(tokens, v, false, opts)
+}
+
+// Unmarshal is like json.Unmarshal, but tokenizes the input using the options
+// of p (so that it may contain comments, trailing commas and so on; see
+// Decode). Unlike Decode, it tokenizes the whole input, so that an error after
+// the first value (such as trailing input) is returned. If
+// p.AllowMultipleValues is set, values after the first are ignored.
+func (p *Parser) Unmarshal(data []byte, v any) error {
+	return decode(p.Tokenize(data), v, true, DecodeOptions{})
+}
+
+// UnmarshalWithOptions is like Unmarshal, but with the given options.
+func (p *Parser) UnmarshalWithOptions(data []byte, v any, opts DecodeOptions) error {
+	return decode(p.Tokenize(data), v, true, opts)
+}
+
+// decode implements Decode. If all is set, the rest of the sequence is read
+// after the first value and any error token is returned.
+func decode(tokens iter.Seq[Token], v any, all bool, opts DecodeOptions) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errDecodeTarget
+	}
+	next, stop := iter.Pull(tokens)
+	defer stop()
+	d := decoder{next: next, opts: opts}
+	t, err := d.read()
+	if err == nil {
+		err = d.value(t, rv.Elem())
+	}
+	for all && err == nil {
+		t, ok := d.next()
+		if !ok {
+			break
+		}
+		err = t.AsError()
+	}
+	if err != nil {
+		return err
+	}
+	return d.err
+}
+
+// decoder holds the state of Decode.
+type decoder struct {
+	next func() (Token, bool)
+	opts DecodeOptions
+	pt   pathTracker
+	path Path  // the path of the last token read
+	err  error // the first *UnmarshalError, *UnknownFieldError or *MissingFieldError
+}
+
+// read returns the next token that is not a comment, Key or Whitespace token,
+// or the error that decoding fails with.
+func (d *decoder) read() (Token, error) {
+	for {
+		t, ok := d.next()
+		if !ok {
+			return Token{}, ErrMalformedTokenSequence
+		}
+		if IsError(t.Kind) {
+			return Token{}, t.AsError()
+		}
+		if t.Kind == Comment || t.Kind == Key || t.Kind == Whitespace {
+			continue
+		}
+		d.path = d.pt.next(t)
+		return t, nil
+	}
+}
+
+// mismatch records an *UnmarshalError for the value beginning with the token
+// t (the last token read) and skips the rest of the value.
+func (d *decoder) mismatch(t Token, typ reflect.Type, reason error) error {
+	d.record(t, typ, reason)
+	return d.skip(t)
+}
+
+// record records an *UnmarshalError for the value beginning with the token t
+// if no error has been recorded.
+func (d *decoder) record(t Token, typ reflect.Type, reason error) {
+	if d.err == nil {
+		e := &UnmarshalError{Line: t.Line, Col: t.Col, Start: t.Start, Path: d.path, Kind: t.Kind, Type: typ, Err: reason}
+		if t.Kind != ArrayStart && t.Kind != ObjectStart {
+			e.Value = string(t.Value)
+		}
+		d.err = e
+	}
+}
+
+// skip skips the rest of the value beginning with the token t.
+func (d *decoder) skip(t Token) error {
+	depth := 0
+	for {
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth <= 0 {
+			if depth < 0 {
+				return ErrMalformedTokenSequence
+			}
+			return nil
+		}
+		var err error
+		if t, err = d.read(); err != nil {
+			return err
+		}
+	}
+}
+
+// raw returns the text of the value beginning with the token t.
+func (d *decoder) raw(t Token) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	depth := 0
+	for {
+		if err := w.WriteToken(t); err != nil {
+			return nil, err
+		}
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth == 0 {
+			if err := w.Flush(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+		var err error
+		if t, err = d.read(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+var (
+	unmarshalerType     = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	numberType          = reflect.TypeFor[json.Number]()
+	anyType             = reflect.TypeFor[any]()
+)
+
+// indirect follows the pointers (and pointers in interfaces) from v,
+// allocating them as needed, until it reaches a value that is not a pointer
+// or a pointer that implements json.Unmarshaler or encoding.TextUnmarshaler.
+// If null is set, it stops at a settable pointer (so that it can be set to
+// nil).
+func indirect(v reflect.Value, null bool) reflect.Value {
+	if v.Kind() != reflect.Pointer && v.Type().Name() != "" && v.CanAddr() {
+		v = v.Addr()
+	}
+	for {
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			if e := v.Elem(); e.Kind() == reflect.Pointer && !e.IsNil() && (!null || e.Elem().Kind() == reflect.Pointer) {
+				v = e
+				continue
+			}
+		}
+		if v.Kind() != reflect.Pointer || (null && v.CanSet()) {
+			return v
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().NumMethod() > 0 && (v.Type().Implements(unmarshalerType) || v.Type().Implements(textUnmarshalerType)) {
+			return v
+		}
+		v = v.Elem()
+	}
+}
+
+// value decodes the value beginning with the token t into v.
+func (d *decoder) value(t Token, v reflect.Value) error {
+	v = indirect(v, t.Kind == Null)
+	if t.Kind == Null && v.Kind() == reflect.Pointer && v.CanSet() {
+		v.SetZero()
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if u, ok := v.Interface().(json.Unmarshaler); ok {
+			raw, err := d.raw(t)
+			if err != nil {
+				return err
+			}
+			if err := u.UnmarshalJSON(raw); err != nil {
+				d.record(t, v.Type(), err)
+			}
+			return nil
+		}
+		if u, ok := v.Interface().(encoding.TextUnmarshaler); ok && t.Kind != Null {
+			if t.Kind != String {
+				return d.mismatch(t, v.Type(), nil)
+			}
+			if err := u.UnmarshalText(t.Value); err != nil {
+				d.record(t, v.Type(), err)
+			}
+			return nil
+		}
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		x, err := d.anyValue(t)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	switch t.Kind {
+	case ObjectStart:
+		return d.object(t, v)
+	case ArrayStart:
+		return d.array(t, v)
+	case ArrayEnd, ObjectEnd:
+		return ErrMalformedTokenSequence
+	}
+	return d.literal(t, v)
+}
+
+// anyValue decodes the value beginning with the token t as it is stored in
+// an interface value, without using reflection.
+func (d *decoder) anyValue(t Token) (any, error) {
+	switch t.Kind {
+	case ObjectStart:
+		m := make(map[string]any)
+		return m, d.anyMap(m)
+	case ArrayStart:
+		elems := []any{}
+		for {
+			elemTok, err := d.read()
+			if err != nil {
+				return nil, err
+			}
+			if elemTok.Kind == ArrayEnd {
+				return elems, nil
+			}
+			x, err := d.anyValue(elemTok)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, x)
+		}
+	case ArrayEnd, ObjectEnd:
+		return nil, ErrMalformedTokenSequence
+	}
+	x, ok := d.scalar(t)
+	if !ok {
+		d.record(t, anyType, nil)
+	}
+	return x, nil
+}
+
+// anyMap decodes the members of the object whose ObjectStart token has been
+// read into m, without using reflection.
+func (d *decoder) anyMap(m map[string]any) error {
+	for {
+		member, err := d.read()
+		if err != nil {
+			return err
+		}
+		if member.Kind == ObjectEnd {
+			return nil
+		}
+		x, err := d.anyValue(member)
+		if err != nil {
+			return err
+		}
+		m[string(member.Key)] = x
+	}
+}
+
+// stringMap decodes the members of the object whose ObjectStart token has
+// been read into m (the map v), using reflection only for members whose
+// values are not strings.
+func (d *decoder) stringMap(m map[string]string, v reflect.Value) error {
+	for {
+		member, err := d.read()
+		if err != nil {
+			return err
+		}
+		switch member.Kind {
+		case ObjectEnd:
+			return nil
+		case String, Extension:
+			m[string(member.Key)] = string(member.Value)
+		default:
+			if err := d.mapEntry(member, v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scalar returns the value of the scalar token t as it is stored in an
+// interface value.
+func (d *decoder) scalar(t Token) (any, bool) {
+	switch t.Kind {
+	case Number:
+		f, err := parseNumber(t.Value, 64)
+		return f, err == nil
+	case True, False:
+		return t.Kind == True, true
+	case Null:
+		return nil, true
+	}
+	return string(t.Value), true
+}
+
+// literal decodes the scalar token t into v, which is not an empty interface.
+func (d *decoder) literal(t Token, v reflect.Value) error {
+	var err error
+	switch t.Kind {
+	case Null:
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			v.SetZero()
+		}
+		return nil
+	case True, False:
+		if v.Kind() != reflect.Bool {
+			return d.mismatch(t, v.Type(), nil)
+		}
+		v.SetBool(t.Kind == True)
+		return nil
+	case Number:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(string(t.Value), 10, 64); err == nil {
+				if !v.OverflowInt(n) {
+					v.SetInt(n)
+					return nil
+				}
+				err = strconv.ErrRange
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			var n uint64
+			if n, err = strconv.ParseUint(string(t.Value), 10, 64); err == nil {
+				if !v.OverflowUint(n) {
+					v.SetUint(n)
+					return nil
+				}
+				err = strconv.ErrRange
+			}
+		case reflect.Float32, reflect.Float64:
+			var f float64
+			if f, err = parseNumber(t.Value, v.Type().Bits()); err == nil {
+				v.SetFloat(f)
+				return nil
+			}
+		case reflect.String:
+			if v.Type() == numberType {
+				v.SetString(string(t.Value))
+				return nil
+			}
+		}
+		if numErr, ok := err.(*strconv.NumError); ok {
+			err = numErr.Err
+		}
+		return d.mismatch(t, v.Type(), err)
+	}
+
+	// A string or an Extension token.
+	switch {
+	case v.Type() == numberType:
+		if !isValidNumber(t.Value) {
+			return d.mismatch(t, v.Type(), nil)
+		}
+		v.SetString(string(t.Value))
+	case v.Kind() == reflect.String:
+		v.SetString(string(t.Value))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, base64.StdEncoding.DecodedLen(len(t.Value)))
+		n, err := base64.StdEncoding.Decode(b, t.Value)
+		if err != nil {
+			return d.mismatch(t, v.Type(), err)
+		}
+		v.SetBytes(b[:n])
+	default:
+		return d.mismatch(t, v.Type(), nil)
+	}
+	return nil
+}
+
+// array decodes the array beginning with the token t into v.
+func (d *decoder) array(t Token, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.Slice:
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		v.SetLen(0)
+	case v.Kind() != reflect.Array:
+		return d.mismatch(t, v.Type(), nil)
+	}
+
+	for i := 0; ; i++ {
+		elemTok, err := d.read()
+		if err != nil {
+			return err
+		}
+		if elemTok.Kind == ArrayEnd {
+			if v.Kind() == reflect.Array {
+				for ; i < v.Len(); i++ {
+					v.Index(i).SetZero()
+				}
+			}
+			return nil
+		}
+		switch {
+		case v.Kind() == reflect.Slice:
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(elemTok, elem); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		case i < v.Len():
+			err = d.value(elemTok, v.Index(i))
+		default:
+			err = d.skip(elemTok)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// object decodes the object beginning with the token t into v.
+func (d *decoder) object(t Token, v reflect.Value) error {
+	var fields *decodeFields
+	switch v.Kind() {
+	case reflect.Map:
+		kt := v.Type().Key()
+		switch {
+		case reflect.PointerTo(kt).Implements(textUnmarshalerType), kt.Kind() == reflect.String:
+		case kt.Kind() >= reflect.Int && kt.Kind() <= reflect.Uintptr:
+		default:
+			return d.mismatch(t, v.Type(), nil)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		// Maps with string values, which are common in configuration files
+		// and headers, and maps of arbitrary values are decoded without
+		// reflection for each member.
+		if v.CanInterface() {
+			switch m := v.Interface().(type) {
+			case map[string]string:
+				return d.stringMap(m, v)
+			case map[string]any:
+				return d.anyMap(m)
+			}
+		}
+	case reflect.Struct:
+		fields = cachedDecodeFields(v.Type())
+	default:
+		return d.mismatch(t, v.Type(), nil)
+	}
+
+	var seen []bool // whether each required field has a member
+	path := d.path
+	if fields != nil && len(fields.required) > 0 {
+		seen = make([]bool, len(fields.required))
+	}
+	for {
+		member, err := d.read()
+		if err != nil {
+			return err
+		}
+		if member.Kind == ObjectEnd {
+			for i := range seen {
+				if !seen[i] && d.err == nil {
+					d.err = &MissingFieldError{Line: t.Line, Col: t.Col, Start: t.Start, Path: path, Field: fields.required[i], Type: v.Type()}
+				}
+			}
+			return nil
+		}
+		if fields != nil {
+			err = d.field(member, v, fields, seen)
+		} else {
+			err = d.mapEntry(member, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mapEntry decodes the object member beginning with the token t into the map
+// v.
+func (d *decoder) mapEntry(t Token, v reflect.Value) error {
+	kt := v.Type().Key()
+	key := reflect.New(kt)
+	var err error
+	switch {
+	case reflect.PointerTo(kt).Implements(textUnmarshalerType):
+		err = key.Interface().(encoding.TextUnmarshaler).UnmarshalText(t.Key)
+	case kt.Kind() == reflect.String:
+		key.Elem().SetString(string(t.Key))
+	case kt.Kind() >= reflect.Int && kt.Kind() <= reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(string(t.Key), 10, 64); err == nil && key.Elem().OverflowInt(n) {
+			err = strconv.ErrRange
+		}
+		key.Elem().SetInt(n)
+	default:
+		var n uint64
+		if n, err = strconv.ParseUint(string(t.Key), 10, 64); err == nil && key.Elem().OverflowUint(n) {
+			err = strconv.ErrRange
+		}
+		key.Elem().SetUint(n)
+	}
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok {
+			err = numErr.Err
+		}
+		d.record(Token{Line: t.Line, Col: t.Col, Start: t.Start, Kind: String, Value: t.Key}, kt, err)
+		return d.skip(t)
+	}
+	elem := reflect.New(v.Type().Elem()).Elem()
+	if err := d.value(t, elem); err != nil {
+		return err
+	}
+	v.SetMapIndex(key.Elem(), elem)
+	return nil
+}
+
+// field decodes the object member beginning with the token t into the
+// corresponding field of the struct v, if any.
+func (d *decoder) field(t Token, v reflect.Value, fields *decodeFields, seen []bool) error {
+	f, ok := fields.lookup(string(t.Key), d.opts.ExactFieldNames)
+	if ok && f.req >= 0 {
+		seen[f.req] = true
+	}
+	if !ok && fields.unknown != nil {
+		if fv, ok := fieldByIndex(v, fields.unknown); ok {
+			if fv.IsNil() {
+				fv.Set(reflect.MakeMap(fv.Type()))
+			}
+			return d.mapEntry(t, fv)
+		}
+	}
+	if !ok {
+		if d.opts.DisallowUnknownFields && d.err == nil {
+			d.err = &UnknownFieldError{Line: t.Line, Col: t.Col, Start: t.Start, Path: d.path, Key: string(t.Key), Type: v.Type()}
+		}
+		return d.skip(t)
+	}
+	fv, ok := fieldByIndex(v, f.index)
+	if !ok {
+		return d.skip(t)
+	}
+	if d.opts.Positions != nil {
+		d.opts.Positions[d.path.String()] = Position{Line: t.Line, Col: t.Col, Start: t.Start}
+	}
+	if f.quoted && t.Kind != Null {
+		switch fv.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.String:
+			if t.Kind != String {
+				return d.mismatch(t, fv.Type(), errQuotedField)
+			}
+			var p Parser
+			inner := slices.Collect(p.Tokenize(t.Value))
+			if len(inner) != 1 || IsError(inner[0].Kind) || !isValueKind(inner[0].Kind) || (fv.Kind() == reflect.String) != (inner[0].Kind == String) {
+				return d.mismatch(t, fv.Type(), errQuotedField)
+			}
+			it := inner[0]
+			it.Line, it.Col, it.Start, it.End, it.Key = t.Line, t.Col, t.Start, t.End, t.Key
+			return d.literal(it, fv)
+		}
+	}
+	return d.value(t, fv)
+}
+
+var errQuotedField = errors.New("invalid use of ,string struct tag")
+
+// fieldByIndex returns the field of the struct v with the given index,
+// allocating nil pointers to embedded structs. It returns false if such a
+// pointer cannot be set.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// decodeField is a struct field that receives the value of an object member.
+type decodeField struct {
+	name     string
+	index    []int
+	quoted   bool // whether the field has the "string" option
+	tagged   bool // whether the name was given by the json tag
+	unknown  bool // whether the field has the "unknown" option
+	required bool // whether the field has the "required" option
+	req      int  // the index of the field in decodeFields.required if it is required, and otherwise -1
+}
+
+// decodeFields are the fields of a struct type that receive the values of
+// object members, by name.
+type decodeFields struct {
+	byName   map[string]decodeField
+	folded   map[string]decodeField // by the lower-case name, for names differing only in case from the key
+	unknown  []int                  // the index of the field that receives unknown members, if any
+	required []string               // the names of the required fields
+}
+
+// lookup returns the field for the given key, matching it case-insensitively
+// unless exact is set.
+func (fs *decodeFields) lookup(key string, exact bool) (decodeField, bool) {
+	if f, ok := fs.byName[key]; ok || exact {
+		return f, ok
+	}
+	f, ok := fs.folded[strings.ToLower(key)]
+	return f, ok
+}
+
+var decodeFieldCache sync.Map // map[reflect.Type]*decodeFields
+
+// cachedDecodeFields returns the fields of the struct type t.
+func cachedDecodeFields(t reflect.Type) *decodeFields {
+	if fs, ok := decodeFieldCache.Load(t); ok {
+		return fs.(*decodeFields)
+	}
+	fs, _ := decodeFieldCache.LoadOrStore(t, typeDecodeFields(t))
+	return fs.(*decodeFields)
+}
+
+// typeDecodeFields computes the fields of the struct type t following the
+// rules of encoding/json: the fields of embedded structs without a tag name
+// are promoted, and of several fields with the same name, the least deeply
+// nested is used, then one with a tag name; if that leaves several, the name
+// is ignored. Of the fields with the "unknown" option, the least deeply
+// nested (or else the first) receives the unknown members. A field with the
+// "required" option is required only if it is the one used for its name.
+func typeDecodeFields(t reflect.Type) *decodeFields {
+	var candidates []decodeField
+	var unknown []int
+	for _, sf := range reflect.VisibleFields(t) {
+		tag := sf.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		switch {
+		case tag == "-":
+			continue
+		case !promoted(t, sf.Index):
+			continue
+		case sf.Anonymous:
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if name == "" && ft.Kind() == reflect.Struct {
+				continue // the fields are promoted
+			}
+			if !sf.IsExported() {
+				continue
+			}
+		case !sf.IsExported():
+			continue
+		}
+		f := decodeField{name: name, index: sf.Index, tagged: name != ""}
+		if name == "" {
+			f.name = sf.Name
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			f.quoted = f.quoted || opt == "string"
+			f.unknown = f.unknown || opt == "unknown"
+			f.required = f.required || opt == "required"
+		}
+		if f.unknown && sf.Type.Kind() == reflect.Map && sf.Type.Key().Kind() == reflect.String {
+			if unknown == nil || len(sf.Index) < len(unknown) {
+				unknown = sf.Index
+			}
+			continue
+		}
+		candidates = append(candidates, f)
+	}
+
+	byName := make(map[string][]decodeField)
+	for _, f := range candidates {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	fs := &decodeFields{byName: make(map[string]decodeField), folded: make(map[string]decodeField), unknown: unknown}
+	for _, f := range candidates {
+		if _, ok := fs.byName[f.name]; ok {
+			continue
+		}
+		f, ok := dominantField(byName[f.name])
+		if !ok {
+			continue
+		}
+		f.req = -1
+		if f.required {
+			f.req = len(fs.required)
+			fs.required = append(fs.required, f.name)
+		}
+		fs.byName[f.name] = f
+		if _, ok := fs.folded[strings.ToLower(f.name)]; !ok {
+			fs.folded[strings.ToLower(f.name)] = f
+		}
+	}
+	return fs
+}
+
+// dominantField returns the field that is used of several fields with the
+// same name, if any.
+func dominantField(fields []decodeField) (decodeField, bool) {
+	depth := len(fields[0].index)
+	for _, f := range fields {
+		depth = min(depth, len(f.index))
+	}
+	var chosen []decodeField
+	for _, f := range fields {
+		if len(f.index) == depth {
+			chosen = append(chosen, f)
+		}
+	}
+	if len(chosen) > 1 {
+		chosen = slices.DeleteFunc(chosen, func(f decodeField) bool { return !f.tagged })
+	}
+	if len(chosen) != 1 {
+		return decodeField{}, false
+	}
+	return chosen[0], true
+}
+
+// promoted reports whether the field of the struct type t with the given
+// index is reached only through embedded structs without a tag name, and not
+// through an unexported pointer (which cannot be allocated).
+func promoted(t reflect.Type, index []int) bool {
+	for i := 1; i < len(index); i++ {
+		sf := t.FieldByIndex(index[:i])
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if !sf.Anonymous || name != "" || (sf.Type.Kind() == reflect.Pointer && !sf.IsExported()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,382 @@
+package jsonstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type decodeInner struct {
+	X int `json:"x"`
+	Y string
+}
+
+type DecodeEmbedded struct {
+	E string `json:"e"`
+	X int    `json:"x"` // hidden by decodeOuter.X
+}
+
+type decodeOuter struct {
+	DecodeEmbedded
+	Inner      *decodeInner      `json:"inner"`
+	X          int               `json:"x"`
+	Name       string            `json:"name"`
+	Skip       string            `json:"-"`
+	Dash       string            `json:"-,"`
+	Count      int64             `json:"count,string"`
+	Flag       bool              `json:",string"`
+	Ptr        *float64          `json:"ptr"`
+	Tags       []string          `json:"tags"`
+	Pair       [2]int            `json:"pair"`
+	Counts     map[string]int    `json:"counts"`
+	ByID       map[int]string    `json:"by_id"`
+	Any        any               `json:"any"`
+	Raw        json.RawMessage   `json:"raw"`
+	Num        json.Number       `json:"num"`
+	Bytes      []byte            `json:"bytes"`
+	When       time.Time         `json:"when"`
+	Inners     []decodeInner     `json:"inners"`
+	Nested     map[string][]uint `json:"nested"`
+	unexported int
+}
+
+func TestDecodeMatchesEncodingJSON(t *testing.T) {
+	inputs := []string{
+		`{"x": 1, "e": "emb", "inner": {"x": 2, "y": "yy"}, "name": "n", "Skip": "s", "-": "d", "count": "12", "Flag": "true",
+		  "ptr": 1.5, "tags": ["a", "b"], "pair": [1, 2, 3], "counts": {"a": 1}, "by_id": {"7": "seven"},
+		  "any": {"a": [1, "x", true, null, {"b": 2.5}]}, "raw": [1,{"a":2}], "num": 1e3, "bytes": "aGVsbG8=",
+		  "when": "2023-11-14T22:13:20Z", "inners": [{"x": 1}, {"X": 2, "Y": "z"}], "nested": {"a": [1, 2]}, "unexported": 3}`,
+		`{"NAME": "folded", "ptr": null, "tags": null, "tags": [], "pair": [9]}`,
+		`{"x": "str"}`,
+		`{"x": 1.5}`,
+		`{"tags": {"a": 1}, "name": "after"}`,
+		`{"by_id": {"x": "bad key", "8": "eight"}}`,
+		`{"counts": {"a": 300000000000}}`,
+		`{"bytes": "!!"}`,
+		`{"when": "yesterday"}`,
+		`{"count": 12}`,
+		`[1, 2]`,
+		`"str"`,
+		`null`,
+	}
+	for _, input := range inputs {
+		var expected, got decodeOuter
+		expectedErr := json.Unmarshal([]byte(input), &expected)
+		var p Parser
+		gotErr := p.Unmarshal([]byte(input), &got)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("For %.40q expected\n%+v\ngot\n%+v", input, expected, got)
+		}
+		if (gotErr == nil) != (expectedErr == nil) {
+			t.Errorf("For %.40q expected error %v, got %v", input, expectedErr, gotErr)
+		}
+	}
+
+	for _, input := range []string{`{"a": [1, "x", {"b": null}], "c": 1e300}`, `[true, 2]`, `7`} {
+		var expected, got any
+		if err := json.Unmarshal([]byte(input), &expected); err != nil {
+			t.Fatal(err)
+		}
+		var p Parser
+		if err := p.Unmarshal([]byte(input), &got); err != nil || !reflect.DeepEqual(got, expected) {
+			t.Errorf("For %q expected %v, got %v (error %v)", input, expected, got, err)
+		}
+	}
+}
+
+func TestDecodeExtensions(t *testing.T) {
+	const input = `
+		// A config file.
+		{
+			"name": "svc",
+			"ports": [80, 443,],   /* trailing comma */
+		}
+		{"next": "value"}`
+	var v struct {
+		Name  string
+		Ports []int
+	}
+	p := Parser{AllowComments: true, AllowTrailingCommas: true, AllowMultipleValues: true}
+	if err := Decode(p.Tokenize([]byte(input)), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "svc" || fmt.Sprint(v.Ports) != "[80 443]" {
+		t.Errorf("Unexpected value %+v", v)
+	}
+	if err := Decode(p.TokenizeReader(strings.NewReader(input)), &v); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	var strict Parser
+	err := strict.Unmarshal([]byte(input), &v)
+	if err == nil || !strings.Contains(err.Error(), "3:4") {
+		t.Errorf("Expected a positioned syntax error, got %v", err)
+	}
+	if err := strict.Unmarshal([]byte(`{} x`), &v); err == nil {
+		t.Errorf("Expected an error for trailing input")
+	}
+	if err := Decode(strict.Tokenize([]byte(`{} x`)), &v); err != nil {
+		t.Errorf("Expected tokens after the value to be ignored, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var v struct {
+		A []struct {
+			N uint8 `json:"n"`
+		} `json:"a"`
+		B string `json:"b"`
+	}
+	var p Parser
+	err := p.Unmarshal([]byte("{\"a\": [{\"n\": 1},\n  {\"n\": 256}], \"b\": \"ok\"}"), &v)
+	var ue *UnmarshalError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Expected an *UnmarshalError, got %v", err)
+	}
+	if ue.Line != 2 || ue.Col != 10 || ue.Start != 25 || ue.Path.String() != `["a"][1]["n"]` || ue.Type != reflect.TypeFor[uint8]() || !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("Unexpected error %#v", ue)
+	}
+	if err.Error() != `2:10 cannot decode Number "256" at ["a"][1]["n"] into uint8: value out of range` {
+		t.Errorf("Unexpected message %v", err)
+	}
+	if v.B != "ok" || v.A[0].N != 1 {
+		t.Errorf("Expected decoding to continue after the error, got %+v", v)
+	}
+
+	if err := p.Unmarshal([]byte(`{"a": {}}`), &v); !errors.As(err, &ue) || err.Error() != `1:7 cannot decode ObjectStart at ["a"] into []struct { N uint8 "json:\"n\"" }` {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := Decode(p.Tokenize([]byte(`[1, 2`)), &v); err == nil || errors.As(err, &ue) {
+		t.Errorf("Expected a syntax error, got %v", err)
+	}
+	if err := Decode(p.Tokenize([]byte(`{}`)), v); err != errDecodeTarget {
+		t.Errorf("Expected an error for a non-pointer, got %v", err)
+	}
+	tokens := func(yield func(Token) bool) {
+		_ = yield(Token{Kind: ArrayStart}) && yield(Token{Kind: Number, Value: []byte("1")})
+	}
+	var s []int
+	if err := Decode(tokens, &s); err != ErrMalformedTokenSequence {
+		t.Errorf("Expected ErrMalformedTokenSequence, got %v", err)
+	}
+}
+
+// decodeRaw records the JSON it is decoded from.
+type decodeRaw struct {
+	raw string
+}
+
+func (r *decodeRaw) UnmarshalJSON(b []byte) error {
+	if string(b) == `"fail"` {
+		return errors.New("refused")
+	}
+	r.raw = string(b)
+	return nil
+}
+
+// decodeUpper decodes a string as its upper-case form.
+type decodeUpper string
+
+func (u *decodeUpper) UnmarshalText(b []byte) error {
+	*u = decodeUpper(strings.ToUpper(string(b)))
+	return nil
+}
+
+func TestDecodeUnmarshalers(t *testing.T) {
+	var v struct {
+		Raw   decodeRaw
+		Ptr   *decodeRaw
+		Text  decodeUpper
+		Texts map[decodeUpper]decodeUpper
+	}
+	p := Parser{AllowComments: true}
+	const input = `{"raw": {"a": [1, /* c */ "x"]}, "ptr": 2.50, "text": "abc", "texts": {"k": "v"}}`
+	if err := p.Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Raw.raw != `{"a":[1,"x"]}` || v.Ptr == nil || v.Ptr.raw != "2.50" || v.Text != "ABC" || v.Texts["K"] != "V" {
+		t.Errorf("Unexpected value %+v", v)
+	}
+
+	err := p.Unmarshal([]byte(`{"text": 1, "raw": "fail"}`), &v)
+	var ue *UnmarshalError
+	if !errors.As(err, &ue) || ue.Path.String() != `["text"]` || ue.Type != reflect.TypeFor[*decodeUpper]() {
+		t.Errorf("Expected an error for a number decoded by UnmarshalText, got %v", err)
+	}
+	if err := p.Unmarshal([]byte(`{"raw": "fail"}`), &v); !errors.As(err, &ue) || ue.Err == nil || ue.Err.Error() != "refused" {
+		t.Errorf("Expected the error from UnmarshalJSON, got %v", err)
+	}
+}
+
+func TestDecodeNumberAllocations(t *testing.T) {
+	var f float64
+	var f32 float32
+	v, v32 := reflect.ValueOf(&f).Elem(), reflect.ValueOf(&f32).Elem()
+	tok := Token{Kind: Number, Value: []byte("-12.625e1")}
+	var d decoder
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = d.literal(tok, v)
+		_ = d.literal(tok, v32)
+	})
+	if allocs != 0 || f != -126.25 || f32 != -126.25 {
+		t.Errorf("Expected no allocations, got %v (values %v, %v)", allocs, f, f32)
+	}
+}
+
+func TestDecodeFieldMatching(t *testing.T) {
+	type config struct {
+		Name  string `json:"name"`
+		Inner decodeInner
+	}
+	const input = `{"NAME": "a", "Inner": {"x": 1, "y": "y", "z": true}, "extra": [1]}`
+	var p Parser
+
+	var v config
+	if err := p.UnmarshalWithOptions([]byte(input), &v, DecodeOptions{}); err != nil || v.Name != "a" || v.Inner.X != 1 || v.Inner.Y != "y" {
+		t.Errorf("Expected case-insensitive matching, got %+v (error %v)", v, err)
+	}
+
+	v = config{}
+	if err := p.UnmarshalWithOptions([]byte(input), &v, DecodeOptions{ExactFieldNames: true}); err != nil || v.Name != "" || v.Inner.X != 1 || v.Inner.Y != "" {
+		t.Errorf("Expected exact matching, got %+v (error %v)", v, err)
+	}
+
+	v = config{}
+	err := p.UnmarshalWithOptions([]byte(input), &v, DecodeOptions{ExactFieldNames: true, DisallowUnknownFields: true})
+	var ufe *UnknownFieldError
+	if !errors.As(err, &ufe) || ufe.Key != "NAME" || ufe.Path.String() != `["NAME"]` || ufe.Line != 1 || ufe.Col != 10 || ufe.Type != reflect.TypeFor[config]() {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err.Error() != `1:10 unknown field "NAME" at ["NAME"] in jsonstream.config` || v.Inner.X != 1 {
+		t.Errorf("Expected decoding to continue after %v, got %+v", err, v)
+	}
+
+	err = DecodeWithOptions(p.Tokenize([]byte(input)), &v, DecodeOptions{DisallowUnknownFields: true})
+	if !errors.As(err, &ufe) || ufe.Key != "z" || ufe.Path.String() != `["Inner"]["z"]` || ufe.Type != reflect.TypeFor[decodeInner]() {
+		t.Errorf("Unexpected error %v", err)
+	}
+	var m map[string]any
+	if err := DecodeWithOptions(p.Tokenize([]byte(input)), &m, DecodeOptions{DisallowUnknownFields: true}); err != nil {
+		t.Errorf("Expected maps to accept any key, got %v", err)
+	}
+}
+
+func TestDecodeUnknownFields(t *testing.T) {
+	type embedded struct {
+		Deeper map[string]any `json:",unknown"`
+	}
+	var v struct {
+		embedded
+		Name  string                     `json:"name"`
+		Extra map[string]json.RawMessage `json:"extra,unknown"`
+		Inner struct {
+			X    int
+			Rest map[string]any `json:",unknown"`
+		} `json:"inner"`
+	}
+	const input = `{"name": "a", "v2": {"b": [1, "x"]}, "inner": {"x": 1, "y": null, "z": true}, "extra": 1, "n": 2.5}`
+	var p Parser
+	if err := p.UnmarshalWithOptions([]byte(input), &v, DecodeOptions{DisallowUnknownFields: true}); err != nil {
+		t.Fatal(err)
+	}
+	extra := map[string]string{}
+	for k, raw := range v.Extra {
+		extra[k] = string(raw)
+	}
+	if fmt.Sprint(extra) != `map[extra:1 n:2.5 v2:{"b":[1,"x"]}]` || v.Name != "a" || v.Deeper != nil {
+		t.Errorf("Unexpected unknown members %v (value %+v)", extra, v)
+	}
+	if v.Inner.X != 1 || fmt.Sprint(v.Inner.Rest) != "map[y:<nil> z:true]" {
+		t.Errorf("Unexpected nested unknown members %+v", v.Inner)
+	}
+}
+
+func TestDecodePositions(t *testing.T) {
+	var v struct {
+		Servers []struct {
+			Host string
+			Port int `json:"port"`
+		} `json:"servers"`
+		Timeout int `json:"timeout,string"`
+	}
+	const input = "{\n  \"servers\": [{\"host\": \"a\", \"port\": 80},\n    {\"port\": 0}],\n  \"timeout\": \"5\", \"other\": 1\n}"
+	positions := make(map[string]Position)
+	var p Parser
+	if err := p.UnmarshalWithOptions([]byte(input), &v, DecodeOptions{Positions: positions}); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Position{
+		`["servers"]`:            {2, 15, 15},
+		`["servers"][0]["host"]`: {2, 25, 25},
+		`["servers"][0]["port"]`: {2, 38, 38},
+		`["servers"][1]["port"]`: {3, 15, 56},
+		`["timeout"]`:            {4, 15, 74},
+	}
+	if !reflect.DeepEqual(positions, expected) {
+		t.Errorf("Expected %v, got %v", expected, positions)
+	}
+	for path, pos := range positions {
+		if input[pos.Start] != '[' && input[pos.Start] != '"' && (input[pos.Start] < '0' || input[pos.Start] > '9') {
+			t.Errorf("Position of %v does not start a value", path)
+		}
+	}
+}
+
+func TestDecodeRequiredFields(t *testing.T) {
+	type server struct {
+		Host string `json:"host,required"`
+		Port int    `json:",required"`
+		Note string
+	}
+	var v struct {
+		Servers []server `json:"servers,required"`
+	}
+	var p Parser
+	if err := p.Unmarshal([]byte(`{"servers": [{"host": "a", "Port": 1}, {"host": null, "port": 2}]}`), &v); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	err := p.Unmarshal([]byte("{\"servers\": [{\"host\": \"a\", \"Port\": 1},\n {\"note\": \"x\"}]}"), &v)
+	var mfe *MissingFieldError
+	if !errors.As(err, &mfe) || mfe.Field != "host" || mfe.Line != 2 || mfe.Col != 3 || mfe.Start != 40 || mfe.Path.String() != `["servers"][1]` || mfe.Type != reflect.TypeFor[server]() {
+		t.Fatalf("Unexpected error %#v", err)
+	}
+	if err.Error() != `2:3 missing required field "host" in object at ["servers"][1] for jsonstream.server` || v.Servers[1].Note != "x" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := p.Unmarshal([]byte(`{}`), &v); !errors.As(err, &mfe) || mfe.Field != "servers" || mfe.Path.String() != "" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestDecodeStringMaps(t *testing.T) {
+	inputs := []string{
+		`{"a": "x", "b": "", "a": "y"}`,
+		`{"a": "x", "b": 1, "c": null, "d": {"e": "f"}, "g": [true]}`,
+		`{"a": {"b": [1, "x", {}, []], "c": 1e400}, "d": false}`,
+		`{}`,
+		`null`,
+		`["a"]`,
+	}
+	for _, input := range inputs {
+		expectedStrs, gotStrs := map[string]string{"old": "v"}, map[string]string{"old": "v"}
+		expectedStrsErr := json.Unmarshal([]byte(input), &expectedStrs)
+		var p Parser
+		gotStrsErr := p.Unmarshal([]byte(input), &gotStrs)
+		if !reflect.DeepEqual(gotStrs, expectedStrs) || (gotStrsErr == nil) != (expectedStrsErr == nil) {
+			t.Errorf("For %q expected %v (error %v), got %v (error %v)", input, expectedStrs, expectedStrsErr, gotStrs, gotStrsErr)
+		}
+
+		var expectedAnys, gotAnys map[string]any
+		expectedAnysErr := json.Unmarshal([]byte(input), &expectedAnys)
+		gotAnysErr := p.Unmarshal([]byte(input), &gotAnys)
+		if (gotAnysErr == nil) != (expectedAnysErr == nil) || (gotAnysErr == nil && !reflect.DeepEqual(gotAnys, expectedAnys)) {
+			t.Errorf("For %q expected %v (error %v), got %v (error %v)", input, expectedAnys, expectedAnysErr, gotAnys, gotAnysErr)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package jsonstream
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"iter"
+)
+
+// DedupeOptions configures Dedupe.
+type DedupeOptions struct {
+	// If ReportOnly is true, the input is passed through unchanged and only the
+	// statistics are collected. No tokens are buffered in this mode.
+	ReportOnly bool
+	// Subtrees with fewer than MinTokens tokens (including their start and end
+	// tokens) are never replaced. If MinTokens is zero, a default of 4 is used,
+	// so that a subtree is never replaced by a reference that is larger than it.
+	MinTokens int
+	// Ref returns the tokens used to replace a duplicate subtree given the path
+	// of its first occurrence. The key of the duplicate is transferred to the
+	// first returned token. If Ref is nil, a duplicate is replaced by the object
+	// {"$ref": path.String()}.
+	Ref func(first Path) []Token
+}
+
+// DedupeStats records the duplication statistics collected by Dedupe.
+type DedupeStats struct {
+	Subtrees        int // the number of object and array subtrees seen
+	Duplicates      int // the number of subtrees identical to an earlier subtree
+	DuplicateTokens int // the total number of tokens in duplicate subtrees
+}
+
+const defaultDedupeMinTokens = 4
+
+type dedupeFrame struct {
+	h        hash.Hash
+	start    Token
+	path     Path
+	bufStart int
+	tokens   int
+	tainted  bool // contains an error token
+}
+
+// Dedupe detects object and array subtrees that are identical to an earlier
+// subtree in the same stream and replaces them with references to the first
+// occurrence. Two subtrees are identical if they contain the same sequence of
+// keys and values (comments are ignored). Statistics are written to stats if
+// it is non-nil; they are complete only once the sequence has been fully
+// consumed.
+//
+// To decide whether a subtree should be replaced it must be read in full, so
+// (unless opts.ReportOnly is set) each child of the top-level value is
+// buffered until it has been completely read.
+func Dedupe(tokens iter.Seq[Token], opts DedupeOptions, stats *DedupeStats) iter.Seq[Token] {
+	if stats == nil {
+		stats = &DedupeStats{}
+	}
+	minTokens := opts.MinTokens
+	if minTokens == 0 {
+		minTokens = defaultDedupeMinTokens
+	}
+
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		var frames []dedupeFrame
+		var buf []Token
+		seen := make(map[[sha256.Size]byte]Path)
+
+		emit := func(t Token, buffered bool) bool {
+			if buffered {
+				buf = append(buf, t)
+				return true
+			}
+			return yield(t)
+		}
+
+		for t := range tokens {
+			path := pt.next(t)
+
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				stats.Subtrees++
+				frames = append(frames, dedupeFrame{
+					h:        sha256.New(),
+					start:    t,
+					path:     path,
+					bufStart: len(buf),
+					tokens:   1,
+				})
+				writeSubtreeHashHeader(frames[len(frames)-1].h, t.Kind, nil)
+				if !emit(t, !opts.ReportOnly && len(frames) > 1) {
+					return
+				}
+			case ArrayEnd, ObjectEnd:
+				if len(frames) == 0 {
+					if !yield(t) {
+						return
+					}
+					continue
+				}
+				buffered := !opts.ReportOnly && len(frames) > 1
+				f := frames[len(frames)-1]
+				frames = frames[:len(frames)-1]
+				f.tokens++
+				writeSubtreeHashHeader(f.h, t.Kind, nil)
+				var digest [sha256.Size]byte
+				f.h.Sum(digest[:0])
+
+				replaced := false
+				if !f.tainted {
+					if first, ok := seen[digest]; ok {
+						stats.Duplicates++
+						stats.DuplicateTokens += f.tokens
+						if buffered && f.tokens >= minTokens {
+							buf = append(buf[:f.bufStart], dedupeRef(opts, first, f.start)...)
+							replaced = true
+						}
+					} else {
+						seen[digest] = f.path
+					}
+				}
+
+				if len(frames) > 0 {
+					parent := &frames[len(frames)-1]
+					parent.tokens += f.tokens
+					parent.tainted = parent.tainted || f.tainted
+					writeSubtreeHashHeader(parent.h, ArrayStart, f.start.Key)
+					parent.h.Write(digest[:])
+				}
+
+				if !replaced && !emit(t, buffered) {
+					return
+				}
+				if len(frames) == 1 {
+					for _, bt := range buf {
+						if !yield(bt) {
+							return
+						}
+					}
+					buf = buf[:0]
+				}
+			default:
+				if len(frames) > 0 {
+					f := &frames[len(frames)-1]
+					if IsError(t.Kind) {
+						f.tainted = true
+					}
+					if isValueKind(t.Kind) {
+						f.tokens++
+						writeSubtreeHashHeader(f.h, t.Kind, t.Key)
+						writeSubtreeHashBytes(f.h, t.Value)
+					}
+				}
+				if !emit(t, !opts.ReportOnly && len(frames) > 1) {
+					return
+				}
+			}
+		}
+
+		// Only reached if the input ended inside a container.
+		for _, bt := range buf {
+			if !yield(bt) {
+				return
+			}
+		}
+	}
+}
+
+func dedupeRef(opts DedupeOptions, first Path, start Token) []Token {
+	var ref []Token
+	if opts.Ref != nil {
+		ref = opts.Ref(first)
+	} else {
+		ref = []Token{
+			{Kind: ObjectStart},
+			{Kind: String, Key: []byte("$ref"), Value: []byte(first.String())},
+			{Kind: ObjectEnd},
+		}
+	}
+	for i := range ref {
+		ref[i].Line = start.Line
+		ref[i].Col = start.Col
+		ref[i].Start = start.Start
+		ref[i].End = start.End
+		ref[i].parser = start.parser
+	}
+	if len(ref) > 0 {
+		ref[0].Key = start.Key
+		if last := &ref[len(ref)-1]; len(ref) > 1 && isContainerEnd(last.Kind) {
+			last.Key = start.Key
+		}
+	}
+	return ref
+}
+
+func writeSubtreeHashHeader(h hash.Hash, k Kind, key []byte) {
+	var b [binary.MaxVarintLen64 + 1]byte
+	b[0] = byte(k)
+	n := 1
+	if key != nil {
+		n += binary.PutUvarint(b[n:], uint64(len(key))+1)
+	} else {
+		b[n] = 0
+		n++
+	}
+	h.Write(b[:n])
+	h.Write(key)
+}
+
+func writeSubtreeHashBytes(h hash.Hash, v []byte) {
+	var b [binary.MaxVarintLen64]byte
+	h.Write(b[:binary.PutUvarint(b[:], uint64(len(v)))])
+	h.Write(v)
+}
@@ -0,0 +1,79 @@
+package jsonstream
+
+import (
+	"testing"
+)
+
+func TestDedupe(t *testing.T) {
+	t.Run("replaces repeated subtrees with references", func(t *testing.T) {
+		const input = `[{"a": [1, 2]}, {"b": {"x": 1, "y": [true]}}, {"a": [1, 2]}, {"c": {"x": 1, "y": [true]}}]`
+		const expected = `[{"a":[1,2]},{"b":{"x":1,"y":[true]}},{"$ref":"[0]"},{"c":{"$ref":"[1][\"b\"]"}}]`
+		var p Parser
+		var stats DedupeStats
+		out := compactJSON(Dedupe(p.Tokenize([]byte(input)), DedupeOptions{}, &stats))
+		if out != expected {
+			t.Errorf("Expected %v, got %v", expected, out)
+		}
+		if stats.Duplicates != 4 || stats.Subtrees != 11 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("small subtrees are not replaced", func(t *testing.T) {
+		const input = `[[], [], [1], [1], [1, 2], [1, 2]]`
+		const expected = `[[],[],[1],[1],[1,2],{"$ref":"[4]"}]`
+		var p Parser
+		out := compactJSON(Dedupe(p.Tokenize([]byte(input)), DedupeOptions{}, nil))
+		if out != expected {
+			t.Errorf("Expected %v, got %v", expected, out)
+		}
+	})
+
+	t.Run("keys of subtrees are not part of their identity", func(t *testing.T) {
+		const input = `{"a": {"x": [1, 2]}, "b": {"x": [1, 2]}, "c": {"y": [1, 2]}}`
+		const expected = `{"a":{"x":[1,2]},"b":{"$ref":"[\"a\"]"},"c":{"y":{"$ref":"[\"a\"][\"x\"]"}}}`
+		var p Parser
+		out := compactJSON(Dedupe(p.Tokenize([]byte(input)), DedupeOptions{}, nil))
+		if out != expected {
+			t.Errorf("Expected %v, got %v", expected, out)
+		}
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		const input = `[[1, 2, 3], [1, 2, 3], [1, 2, 3]]`
+		var p Parser
+		var stats DedupeStats
+		out := compactJSON(Dedupe(p.Tokenize([]byte(input)), DedupeOptions{ReportOnly: true}, &stats))
+		if out != `[[1,2,3],[1,2,3],[1,2,3]]` {
+			t.Errorf("Expected input to be passed through unchanged, got %v", out)
+		}
+		if stats.Duplicates != 2 || stats.DuplicateTokens != 10 || stats.Subtrees != 4 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("custom references", func(t *testing.T) {
+		const input = `[[1, 2, 3], [1, 2, 3]]`
+		var p Parser
+		opts := DedupeOptions{
+			Ref: func(first Path) []Token {
+				return []Token{{Kind: String, Value: []byte("see " + first.String())}}
+			},
+		}
+		out := compactJSON(Dedupe(p.Tokenize([]byte(input)), opts, nil))
+		if out != `[[1,2,3],"see [0]"]` {
+			t.Errorf("Unexpected output %v", out)
+		}
+	})
+
+	t.Run("subtrees containing errors are not replaced", func(t *testing.T) {
+		const input = `[[01, 2, 3], [01, 2, 3]]`
+		var p Parser
+		var stats DedupeStats
+		for range Dedupe(p.Tokenize([]byte(input)), DedupeOptions{}, &stats) {
+		}
+		if stats.Duplicates != 0 {
+			t.Errorf("Expected no duplicates, got %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,419 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+)
+
+// Delete removes each value whose path matches one of the given patterns (see
+// PathMatches), together with its key if it is an object member. This is the
+// equivalent of jq's del(...). The output remains structurally valid, as complete
+// values are always removed. Comments inside deleted values are also removed,
+// as are the Key token of a deleted member and any comments or whitespace
+// between the key and the value, but error tokens are always passed through.
+func Delete(tokens iter.Seq[Token], patterns ...[]any) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		var held heldKey
+		deleteDepth := 0 // > 0 while inside a deleted value
+		for t := range tokens {
+			path := pt.next(t)
+
+			if deleteDepth > 0 {
+				switch t.Kind {
+				case ArrayStart, ObjectStart:
+					deleteDepth++
+				case ArrayEnd, ObjectEnd:
+					deleteDepth--
+				}
+				if IsError(t.Kind) && !yield(t) {
+					return
+				}
+				continue
+			}
+
+			if held.hold(t) {
+				continue
+			}
+			if isValueKind(t.Kind) && matchesAny(path, patterns) {
+				held.drop()
+				if t.Kind == ArrayStart || t.Kind == ObjectStart {
+					deleteDepth = 1
+				}
+				if IsError(t.Kind) && !yield(t) {
+					return
+				}
+				continue
+			}
+
+			if !held.flush(yield) || !yield(t) {
+				return
+			}
+		}
+		held.flush(yield)
+	}
+}
+
+func matchesAny(path Path, patterns [][]any) bool {
+	for _, pattern := range patterns {
+		if PathMatches(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// heldKey holds back a Key token (yielded if Parser.EmitKeyTokens is set),
+// and the Comment and Whitespace tokens following it, until the value of the
+// member arrives, so that a stage that removes the value can remove its key
+// too.
+type heldKey struct {
+	tokens []Token
+}
+
+// hold holds t and returns true if t is a Key token, or a comment or
+// whitespace following a held Key token.
+func (h *heldKey) hold(t Token) bool {
+	if t.Kind == Key || (len(h.tokens) > 0 && (t.Kind == Comment || t.Kind == Whitespace)) {
+		h.tokens = append(h.tokens, t)
+		return true
+	}
+	return false
+}
+
+// flush yields the held tokens, returning false if iteration should stop.
+func (h *heldKey) flush(yield func(Token) bool) bool {
+	for i, t := range h.tokens {
+		if !yield(t) {
+			h.tokens = h.tokens[:0]
+			return false
+		}
+		h.tokens[i] = Token{}
+	}
+	h.tokens = h.tokens[:0]
+	return true
+}
+
+// drop discards the held tokens.
+func (h *heldKey) drop() {
+	clear(h.tokens)
+	h.tokens = h.tokens[:0]
+}
+
+type insertFrame struct {
+	target bool // the container matches the parent of the insertion path
+	count  int  // the number of values seen so far in the container
+	done   bool // the value has already been inserted
+}
+
+// Insert inserts the given value at the given path. The last element of the
+// path determines the position of the inserted value. If it is a string, the
+// value is added to the end of the object as a member with that key, or, if a
+// member with that key already exists, it replaces that member's value. If it
+// is an int i, the value is inserted into the array before the element
+// currently at index i (or at the end if the array has fewer than i
+// elements). The preceding elements of the path are a pattern (see
+// PathMatches), so that a value can be inserted into multiple containers.
+// Containers that are not of the appropriate type are left unchanged.
+//
+// The value is buffered on first use, so value need only support being
+// iterated once. If the input contains Key tokens (see Parser.EmitKeyTokens),
+// a Key token is yielded before each member added to an object.
+func Insert(tokens iter.Seq[Token], path []any, value iter.Seq[Token]) iter.Seq[Token] {
+	var valueTokens []Token
+	valueRead := false
+	return insertAt("Insert", tokens, path, false, func(key []byte, _ Token, yield func(Token) bool) bool {
+		if !valueRead {
+			valueRead = true
+			for t := range value {
+				valueTokens = append(valueTokens, t)
+			}
+		}
+		for i, t := range valueTokens {
+			if i == 0 || (i == len(valueTokens)-1 && isContainerEnd(t.Kind)) {
+				t.Key = key
+			}
+			if !yield(t) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Splice inserts the value given by the token sequence inner into the token
+// sequence outer at the given path, as for Insert, except that the value is
+// inserted only into the first container that matches, and inner is streamed
+// rather than buffered. This is useful for wrapping a large payload in an
+// envelope (e.g. by splicing it into {"meta": {...}, "payload": null} at
+// ["payload"]) or injecting a computed value into a document. The first and
+// last tokens of the value are given the key of the member that they add or
+// replace (or no key in an array).
+//
+// The structure of inner is checked as it is streamed (as by
+// ValidateTokenSeq), and it must contain a single value. Error tokens in inner
+// are yielded and iteration stops. If inner is malformed, an error token of
+// kind ErrorUnexpectedToken is yielded and iteration stops. Comments, Key
+// tokens and Whitespace tokens in inner are discarded. If no container
+// matches, inner is not iterated.
+func Splice(outer iter.Seq[Token], path []any, inner iter.Seq[Token]) iter.Seq[Token] {
+	return insertAt("Splice", outer, path, true, func(key []byte, at Token, yield func(Token) bool) bool {
+		var c tokenSeqChecker
+		var last Token
+		started := false
+		for t := range inner {
+			if IsError(t.Kind) {
+				yield(t)
+				return false
+			}
+			if t.Kind == Comment || t.Kind == Key || t.Kind == Whitespace {
+				continue
+			}
+			top := len(c.stack) == 0 || (len(c.stack) == 1 && isContainerEnd(t.Kind))
+			if started && len(c.stack) == 0 {
+				yield(stageError("Splice", ErrorUnexpectedToken, t, t, "Spliced sequence contains more than one value"))
+				return false
+			}
+			if reason := c.check(t); reason != "" {
+				yield(stageError("Splice", ErrorUnexpectedToken, t, t, reason))
+				return false
+			}
+			started = true
+			if top {
+				t.Key = key
+			}
+			if !yield(t) {
+				return false
+			}
+			last = t
+		}
+		switch {
+		case !started:
+			yield(stageError("Splice", ErrorUnexpectedToken, at, at, "Spliced sequence contains no value"))
+			return false
+		case len(c.stack) > 0:
+			yield(stageError("Splice", ErrorUnexpectedToken, last, last, c.unclosed()))
+			return false
+		}
+		return true
+	})
+}
+
+// insertAt implements Insert and Splice (named by stage), calling emitValue to
+// yield the value to be inserted with the given key at the token at. If once
+// is set, the value is inserted only into the first matching container.
+// emitValue returns false if iteration should stop.
+func insertAt(stage string, tokens iter.Seq[Token], path []any, once bool, emitValue func(key []byte, at Token, yield func(Token) bool) bool) iter.Seq[Token] {
+	if len(path) == 0 {
+		panic(stage + ": path must not be empty")
+	}
+	parentPattern := path[:len(path)-1]
+	var key []byte
+	index := -1
+	switch e := path[len(path)-1].(type) {
+	case string:
+		key = []byte(e)
+	case int:
+		index = e
+	default:
+		panic(stage + ": last element of path must be int or string")
+	}
+
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		var frames []insertFrame
+		inserted := false
+		keyTokens := false // whether the input contains Key tokens
+		skipDepth := 0     // > 0 while inside a replaced value
+		for t := range tokens {
+			path := pt.next(t)
+			keyTokens = keyTokens || t.Kind == Key
+
+			if skipDepth > 0 {
+				switch t.Kind {
+				case ArrayStart, ObjectStart:
+					skipDepth++
+				case ArrayEnd, ObjectEnd:
+					skipDepth--
+				}
+				if IsError(t.Kind) && !yield(t) {
+					return
+				}
+				continue
+			}
+
+			if isValueKind(t.Kind) && len(frames) > 0 {
+				f := &frames[len(frames)-1]
+				if f.target && !f.done {
+					if key == nil && f.count == index {
+						f.done, inserted = true, true
+						if !emitValue(nil, t, yield) {
+							return
+						}
+					} else if key != nil && string(t.Key) == string(key) {
+						f.done, inserted = true, true
+						if t.Kind == ArrayStart || t.Kind == ObjectStart {
+							skipDepth = 1
+						}
+						if !emitValue(t.Key, t, yield) {
+							return
+						}
+						f.count++
+						continue
+					}
+				}
+				f.count++
+			}
+
+			target := (!once || !inserted) && PathMatches(path, parentPattern)
+			switch t.Kind {
+			case ArrayStart:
+				frames = append(frames, insertFrame{target: key == nil && target})
+			case ObjectStart:
+				frames = append(frames, insertFrame{target: key != nil && target})
+			case ArrayEnd, ObjectEnd:
+				if len(frames) > 0 {
+					f := frames[len(frames)-1]
+					frames = frames[:len(frames)-1]
+					if f.target && !f.done && (!once || !inserted) {
+						inserted = true
+						if key != nil && keyTokens && !yield(Token{Kind: Key, Value: key}) {
+							return
+						}
+						if !emitValue(key, t, yield) {
+							return
+						}
+					}
+				}
+			}
+
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// CollisionPolicy determines what RenameKeys does when a key produced by
+// renaming is the same as another key in the same object.
+type CollisionPolicy int
+
+const (
+	// Keep both members, so that the object has duplicate keys.
+	CollisionKeepBoth CollisionPolicy = iota
+	// Keep the first of the colliding members and remove the others.
+	CollisionKeepFirst
+	// Remove all but the first of the colliding members and yield an error
+	// token of kind ErrorKeyCollision for each member removed.
+	CollisionError
+)
+
+// RenameOptions configures RenameKeys.
+type RenameOptions struct {
+	// Patterns (see PathMatches) giving the paths of the objects whose keys
+	// should be renamed. If nil, keys are renamed in all objects.
+	At [][]any
+	// Determines what happens if renaming a key produces a duplicate key.
+	OnCollision CollisionPolicy
+}
+
+type renameFrame struct {
+	active bool
+	seen   map[string]bool // keys (of those that are the target of a rename) seen so far
+}
+
+// RenameKeys renames object keys according to the given map from old key to
+// new key. A collision occurs when a member whose key is a new key appears in
+// an object that already contains a member with that key (whether or not
+// either key was produced by renaming). As members are processed in document
+// order, the first of the colliding members is always the one that is kept
+// (other than with CollisionKeepBoth). Key tokens (see Parser.EmitKeyTokens)
+// are renamed and removed along with their members.
+func RenameKeys(tokens iter.Seq[Token], renames map[string]string, opts RenameOptions) iter.Seq[Token] {
+	newKeys := make(map[string][]byte, len(renames))
+	targets := make(map[string]bool, len(renames))
+	for k, v := range renames {
+		newKeys[k] = []byte(v)
+		targets[v] = true
+	}
+
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		var frames []renameFrame
+		var held heldKey
+		skipDepth := 0 // > 0 while inside a removed value
+		for t := range tokens {
+			path := pt.next(t)
+
+			if skipDepth > 0 {
+				switch t.Kind {
+				case ArrayStart, ObjectStart:
+					skipDepth++
+				case ArrayEnd, ObjectEnd:
+					skipDepth--
+				}
+				if IsError(t.Kind) && !yield(t) {
+					return
+				}
+				continue
+			}
+
+			if held.hold(t) {
+				continue
+			}
+			if isValueKind(t.Kind) && t.Key != nil && len(frames) > 0 && frames[len(frames)-1].active {
+				f := &frames[len(frames)-1]
+				newKey, renamed := newKeys[string(t.Key)]
+				if renamed {
+					t.Key = newKey
+				}
+				if targets[string(t.Key)] {
+					if f.seen[string(t.Key)] && opts.OnCollision != CollisionKeepBoth {
+						held.drop()
+						if t.Kind == ArrayStart || t.Kind == ObjectStart {
+							skipDepth = 1
+						}
+						if opts.OnCollision == CollisionError {
+							err := stageError("RenameKeys", ErrorKeyCollision, t, t, fmt.Sprintf("Key %q collides with an earlier key in the same object", t.Key))
+							if !yield(err) {
+								return
+							}
+						}
+						continue
+					}
+					if f.seen == nil {
+						f.seen = make(map[string]bool)
+					}
+					f.seen[string(t.Key)] = true
+				}
+				for i := range held.tokens {
+					if held.tokens[i].Kind == Key {
+						held.tokens[i].Value = t.Key
+					}
+				}
+			}
+
+			switch t.Kind {
+			case ObjectStart:
+				frames = append(frames, renameFrame{active: opts.At == nil || matchesAny(path, opts.At)})
+			case ArrayStart:
+				frames = append(frames, renameFrame{})
+			case ArrayEnd, ObjectEnd:
+				if len(frames) > 0 {
+					frames = frames[:len(frames)-1]
+				}
+				// Keep the key of the end token consistent with the start token.
+				if len(frames) > 0 && frames[len(frames)-1].active && t.Key != nil {
+					if newKey, renamed := newKeys[string(t.Key)]; renamed {
+						t.Key = newKey
+					}
+				}
+			}
+
+			if !held.flush(yield) || !yield(t) {
+				return
+			}
+		}
+		held.flush(yield)
+	}
+}
@@ -0,0 +1,180 @@
+package jsonstream
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	cases := []struct {
+		input    string
+		patterns [][]any
+		expected string
+	}{
+		{`{"a": 1, "b": 2, "c": 3}`, [][]any{{"b"}}, `{"a":1,"c":3}`},
+		{`{"a": 1, "b": {"x": [1, 2]}, "c": 3}`, [][]any{{"b"}}, `{"a":1,"c":3}`},
+		{`{"a": 1, "b": 2}`, [][]any{{"a"}, {"b"}}, `{}`},
+		{`[1, [2, 3], 4]`, [][]any{{1}}, `[1,4]`},
+		{`[1, [2, 3], 4]`, [][]any{{1, 0}}, `[1,[3],4]`},
+		{`[{"id": 1, "secret": "x"}, {"id": 2, "secret": "y"}]`, [][]any{{Wildcard{}, "secret"}}, `[{"id":1},{"id":2}]`},
+		{`{"a": [1, 2]}`, [][]any{{"a", Wildcard{}}}, `{"a":[]}`},
+		{`{"a": 1}`, [][]any{{}}, ``},
+		{`{"a": 1}`, [][]any{{"b"}}, `{"a":1}`},
+		{`{"a": 1}`, nil, `{"a":1}`},
+	}
+	for _, c := range cases {
+		var p Parser
+		if out := compactJSON(Delete(p.Tokenize([]byte(c.input)), c.patterns...)); out != c.expected {
+			t.Errorf("Deleting %v from %v: expected %v, got %v", c.patterns, c.input, c.expected, out)
+		}
+	}
+
+	t.Run("errors inside deleted values are passed through", func(t *testing.T) {
+		var p Parser
+		out := compactJSON(Delete(p.Tokenize([]byte(`{"a": [01], "b": 1}`)), []any{"a"}))
+		if out != `{<error: Leading zeros not permitted in numbers>,"b":1}` {
+			t.Errorf("Unexpected output %v", out)
+		}
+	})
+
+	t.Run("the key tokens of deleted members are removed", func(t *testing.T) {
+		p := Parser{EmitKeyTokens: true, EmitWhitespace: true}
+		var got []string
+		for tok := range Delete(p.Tokenize([]byte(`{"a": 1, "b": [2], "c": 3}`)), []any{"a"}, []any{"c"}) {
+			got = append(got, tok.Kind.String()+":"+string(tok.Value))
+		}
+		expected := []string{"ObjectStart:", "Whitespace: ", "Key:b", "Whitespace: ", "ArrayStart:", "Number:2", "ArrayEnd:", "Whitespace: ", "ObjectEnd:"}
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestInsert(t *testing.T) {
+	cases := []struct {
+		input    string
+		path     []any
+		value    string
+		expected string
+	}{
+		{`{"a": 1}`, []any{"b"}, `2`, `{"a":1,"b":2}`},
+		{`{}`, []any{"b"}, `[true]`, `{"b":[true]}`},
+		{`{"a": 1, "b": {"x": 1}, "c": 3}`, []any{"b"}, `"new"`, `{"a":1,"b":"new","c":3}`},
+		{`{"a": {"b": {}}}`, []any{"a", "b", "c"}, `{"d": null}`, `{"a":{"b":{"c":{"d":null}}}}`},
+		{`[1, 2, 3]`, []any{0}, `0`, `[0,1,2,3]`},
+		{`[1, 2, 3]`, []any{2}, `{"x": 1}`, `[1,2,{"x":1},3]`},
+		{`[1, 2, 3]`, []any{3}, `4`, `[1,2,3,4]`},
+		{`[1, 2, 3]`, []any{99}, `4`, `[1,2,3,4]`},
+		{`[]`, []any{0}, `1`, `[1]`},
+		{`[{"id": 1}, {"id": 2}]`, []any{Wildcard{}, "ok"}, `true`, `[{"id":1,"ok":true},{"id":2,"ok":true}]`},
+		{`[[1], {"a": 1}]`, []any{Wildcard{}, 0}, `0`, `[[0,1],{"a":1}]`},
+		{`{"a": [1]}`, []any{"a", "k"}, `0`, `{"a":[1]}`},
+		{`{"a": 1}`, []any{"x", "k"}, `0`, `{"a":1}`},
+	}
+	for _, c := range cases {
+		var p, vp Parser
+		out := compactJSON(Insert(p.Tokenize([]byte(c.input)), c.path, vp.Tokenize([]byte(c.value))))
+		if out != c.expected {
+			t.Errorf("Inserting %v at %v in %v: expected %v, got %v", c.value, c.path, c.input, c.expected, out)
+		}
+	}
+
+	t.Run("added members have key tokens", func(t *testing.T) {
+		p := Parser{EmitKeyTokens: true}
+		var vp Parser
+		var got []string
+		for tok := range Insert(p.Tokenize([]byte(`{"a": 1}`)), []any{"b"}, vp.Tokenize([]byte(`2`))) {
+			got = append(got, tok.Kind.String()+":"+string(tok.Value))
+		}
+		expected := []string{"ObjectStart:", "Key:a", "Number:1", "Key:b", "Number:2", "ObjectEnd:"}
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestSplice(t *testing.T) {
+	cases := []struct {
+		input    string
+		path     []any
+		inner    []Token
+		expected string
+	}{
+		{`{"meta": {"v": 1}, "payload": null}`, []any{"payload"}, []Token{{Kind: ArrayStart, Key: []byte("x")}, {Kind: Number, Value: []byte("1")}, {Kind: ArrayEnd, Key: []byte("x")}}, `{"meta":{"v":1},"payload":[1]}`},
+		{`[{"id": 1}, {"id": 2}]`, []any{Wildcard{}, "ok"}, []Token{{Kind: True}}, `[{"id":1,"ok":true},{"id":2}]`},
+		{`[1, 2]`, []any{1}, []Token{{Kind: String, Value: []byte("x")}}, `[1,"x",2]`},
+		{`{"a": 1}`, []any{"x", "k"}, []Token{{Kind: ArrayEnd}}, `{"a":1}`},
+		{`{"a": 1}`, []any{"b"}, []Token{{Kind: ObjectStart}, {Kind: Number, Value: []byte("1")}}, `{"a":1,"b":{<error: Number in object has no key>`},
+		{`{"a": 1}`, []any{"b"}, []Token{{Kind: ArrayStart}, {Kind: ObjectEnd}}, `{"a":1,"b":[<error: ObjectEnd does not match ArrayStart>`},
+		{`{"a": 1}`, []any{"b"}, []Token{{Kind: ArrayStart}}, `{"a":1,"b":[<error: Sequence ends inside ArrayStart>`},
+		{`{"a": 1}`, []any{"b"}, []Token{{Kind: Null}, {Kind: Null}}, `{"a":1,"b":null,<error: Spliced sequence contains more than one value>`},
+		{`{"a": 1}`, []any{"b"}, nil, `{"a":1,<error: Spliced sequence contains no value>`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(Splice(p.Tokenize([]byte(c.input)), c.path, slices.Values(c.inner)))
+		if out != c.expected {
+			t.Errorf("Splicing %v at %v in %v: expected %v, got %v", c.inner, c.path, c.input, c.expected, out)
+		}
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	renames := map[string]string{"old": "new", "a": "b"}
+	cases := []struct {
+		input    string
+		opts     RenameOptions
+		expected string
+	}{
+		{`{"old": 1, "x": {"old": [{"old": 2}]}}`, RenameOptions{}, `{"new":1,"x":{"new":[{"new":2}]}}`},
+		{`{"old": 1, "x": {"old": 2}}`, RenameOptions{At: [][]any{{"x"}}}, `{"old":1,"x":{"new":2}}`},
+		{`[{"old": 1}, {"old": 2}]`, RenameOptions{At: [][]any{{Wildcard{}}}}, `[{"new":1},{"new":2}]`},
+		{`{"a": 1, "b": 2}`, RenameOptions{OnCollision: CollisionKeepBoth}, `{"b":1,"b":2}`},
+		{`{"a": 1, "b": [2]}`, RenameOptions{OnCollision: CollisionKeepFirst}, `{"b":1}`},
+		{`{"b": {"c": 1}, "a": 1}`, RenameOptions{OnCollision: CollisionKeepFirst}, `{"b":{"c":1}}`},
+		{`{"a": 1, "x": {"a": 2}, "b": 3}`, RenameOptions{OnCollision: CollisionError}, `{"b":1,"x":{"b":2},<error: Key "b" collides with an earlier key in the same object>}`},
+		{`{"b": 1, "c": 2, "b": 3}`, RenameOptions{OnCollision: CollisionKeepFirst}, `{"b":1,"c":2}`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(RenameKeys(p.Tokenize([]byte(c.input)), renames, c.opts))
+		if out != c.expected {
+			t.Errorf("Renaming keys in %v with %+v: expected %v, got %v", c.input, c.opts, c.expected, out)
+		}
+	}
+
+	t.Run("collision errors have the position of the removed member", func(t *testing.T) {
+		var p Parser
+		for tok := range RenameKeys(p.Tokenize([]byte(`{"a": 1, "b": 2}`)), renames, RenameOptions{OnCollision: CollisionError}) {
+			if IsError(tok.Kind) && (tok.Kind != ErrorKeyCollision || tok.Line != 1 || tok.Col != 15) {
+				t.Errorf("Unexpected error token %v", tok)
+			}
+		}
+	})
+
+	t.Run("end tokens are renamed", func(t *testing.T) {
+		var p Parser
+		var keys []string
+		for tok := range RenameKeys(p.Tokenize([]byte(`{"old": {"a": [1]}}`)), renames, RenameOptions{}) {
+			if tok.Kind == ArrayEnd || tok.Kind == ObjectEnd {
+				keys = append(keys, string(tok.Key))
+			}
+		}
+		if strings.Join(keys, ",") != "b,new," {
+			t.Errorf("Unexpected end token keys %v", keys)
+		}
+	})
+
+	t.Run("key tokens are renamed and removed with their members", func(t *testing.T) {
+		p := Parser{EmitKeyTokens: true}
+		var got []string
+		for tok := range RenameKeys(p.Tokenize([]byte(`{"old": 1, "a": [2], "b": 3}`)), renames, RenameOptions{OnCollision: CollisionKeepFirst}) {
+			got = append(got, tok.Kind.String()+":"+string(tok.Value))
+		}
+		expected := []string{"ObjectStart:", "Key:new", "Number:1", "Key:b", "ArrayStart:", "Number:2", "ArrayEnd:", "ObjectEnd:"}
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
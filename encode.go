@@ -0,0 +1,182 @@
+package jsonstream
+
+import (
+	"encoding/binary"
+	"iter"
+)
+
+// encodedTokensMagic identifies the format produced by EncodeTokens.
+const encodedTokensMagic = "JST1"
+
+// encodedKinds gives the kind for each code in the format produced by
+// EncodeTokens. Since encoded tokens may be cached, the codes do not depend
+// on the values of the kinds, and new kinds are added at the end.
+var encodedKinds = []Kind{
+	ObjectStart, ObjectEnd, ArrayStart, ArrayEnd, String, Number, True, False, Null, Comment,
+	ErrorTrailingInput, ErrorUnexpectedEOF, ErrorUnexpectedToken, ErrorTrailingComma, ErrorUnexpectedComma,
+	ErrorUnexpectedCharacter, ErrorLeadingZerosNotPermitted, ErrorExpectedDigitAfterDecimalPoint,
+	ErrorExpectedDigitFollowingEInNumber, ErrorBadUnicodeEscape, ErrorIllegalControlCharInsideString,
+	ErrorUTF8DecodingErrorInsideString, ErrorKeyCollision, ErrorInclude, ErrorReference, ErrorMaxDepthExceeded,
+	ErrorQuery, ErrorStage, ErrorQuotaExceeded, Extension, Key, Whitespace, Colon, Comma, ErrorTypeMismatch,
+	ErrorInvalidKey, ErrorRead, ErrorNonASCII, ErrorExpansionDepth, ErrorExpansionSize,
+}
+
+// kindCodes gives the code of each kind in encodedKinds.
+var kindCodes = func() map[Kind]uint64 {
+	codes := make(map[Kind]uint64, len(encodedKinds))
+	for i, k := range encodedKinds {
+		codes[k] = uint64(i)
+	}
+	return codes
+}()
+
+// EncodeTokens encodes a token sequence in a compact binary format that can
+// be decoded by DecodeTokens. This allows the tokenization of a large
+// document to be cached and replayed cheaply (e.g. to run several queries
+// over it). Positions are encoded as variable-length deltas, and each distinct
+// key is stored only once. The encoding is self-contained: it includes the
+// values of the tokens, so the input is not needed to decode it. Error tokens
+// are encoded with their messages and stages. Tokens of kinds that are not
+// defined by this package are encoded so that DecodeTokens reports the data as
+// malformed.
+func EncodeTokens(tokens iter.Seq[Token]) []byte {
+	buf := []byte(encodedTokensMagic)
+	keys := make(map[string]uint64)
+	var prev Token
+	appendBytes := func(b []byte) {
+		if b == nil {
+			buf = binary.AppendUvarint(buf, 0)
+			return
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(b))+1)
+		buf = append(buf, b...)
+	}
+	for t := range tokens {
+		code, ok := kindCodes[t.Kind]
+		if !ok {
+			code = uint64(len(encodedKinds))
+		}
+		buf = binary.AppendUvarint(buf, code)
+		buf = binary.AppendVarint(buf, int64(t.Line-prev.Line))
+		buf = binary.AppendVarint(buf, int64(t.Col))
+		buf = binary.AppendVarint(buf, int64(t.Start-prev.Start))
+		buf = binary.AppendVarint(buf, int64(t.End-t.Start))
+
+		// A key is encoded as 0 if it is nil, as the index of the key plus one
+		// if it has already been encoded, and otherwise as the number of keys
+		// encoded so far plus one, followed by the key.
+		switch i, ok := keys[string(t.Key)]; {
+		case t.Key == nil:
+			buf = binary.AppendUvarint(buf, 0)
+		case ok:
+			buf = binary.AppendUvarint(buf, i+1)
+		default:
+			i = uint64(len(keys))
+			keys[string(t.Key)] = i
+			buf = binary.AppendUvarint(buf, i+1)
+			buf = binary.AppendUvarint(buf, uint64(len(t.Key)))
+			buf = append(buf, t.Key...)
+		}
+
+		appendBytes(t.Value)
+		if IsError(t.Kind) {
+			appendBytes([]byte(t.ErrorMsg))
+			appendBytes([]byte(t.stage))
+		}
+		prev = t
+	}
+	return buf
+}
+
+// DecodeTokens returns the token sequence encoded by EncodeTokens. The Key and
+// Value fields of the tokens are sub-slices of data, which must therefore not
+// be modified while they are in use. The decoded tokens are not associated
+// with a Parser, so decode errors from methods such as AsInt are not recorded
+// and the tokens have no Filename. If data is malformed, an error token (of
+// kind ErrorStage, for the stage "DecodeTokens") is yielded and decoding
+// stops.
+func DecodeTokens(data []byte) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		fail := func(at Token) {
+			yield(stageError("DecodeTokens", ErrorStage, at, at, "Malformed encoded tokens"))
+		}
+		if len(data) < len(encodedTokensMagic) || string(data[:len(encodedTokensMagic)]) != encodedTokensMagic {
+			fail(Token{})
+			return
+		}
+
+		pos := len(encodedTokensMagic)
+		bad := false
+		uvarint := func() uint64 {
+			v, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				bad = true
+				return 0
+			}
+			pos += n
+			return v
+		}
+		varint := func() int {
+			v, n := binary.Varint(data[pos:])
+			if n <= 0 {
+				bad = true
+				return 0
+			}
+			pos += n
+			return int(v)
+		}
+		bytesOfLen := func(n uint64) []byte {
+			if bad || n > uint64(len(data)-pos) {
+				bad = true
+				return nil
+			}
+			b := data[pos : pos+int(n) : pos+int(n)]
+			pos += int(n)
+			return b
+		}
+		optionalBytes := func() []byte {
+			if n := uvarint(); n > 0 {
+				return bytesOfLen(n - 1)
+			}
+			return nil
+		}
+
+		var keys [][]byte
+		var prev Token
+		for pos < len(data) {
+			var t Token
+			if code := uvarint(); code < uint64(len(encodedKinds)) {
+				t.Kind = encodedKinds[code]
+			} else {
+				bad = true
+			}
+			t.Line = prev.Line + varint()
+			t.Col = varint()
+			t.Start = prev.Start + varint()
+			t.End = t.Start + varint()
+			switch i := uvarint(); {
+			case i == 0:
+			case i <= uint64(len(keys)):
+				t.Key = keys[i-1]
+			case i == uint64(len(keys))+1:
+				t.Key = bytesOfLen(uvarint())
+				keys = append(keys, t.Key)
+			default:
+				bad = true
+			}
+			t.Value = optionalBytes()
+			if IsError(t.Kind) {
+				t.ErrorMsg = string(optionalBytes())
+				t.stage = string(optionalBytes())
+			}
+			if bad {
+				fail(prev)
+				return
+			}
+			if !yield(t) {
+				return
+			}
+			prev = t
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package jsonstream
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestEncodeTokens(t *testing.T) {
+	inputs := []string{
+		`{"a": [1, "x\n", true, false, null], "b": {"a": {}, "": []}, "a": "é"}`,
+		"[\n  1,\n  // comment\n  {\"k\": 2.5e10}\n]",
+		`[1, @, {"a": }]`,
+		``,
+	}
+	for _, input := range inputs {
+		p := Parser{AllowComments: true, EmitKeyTokens: true}
+		expected := slices.Collect(p.Tokenize([]byte(input)))
+		for i := range expected {
+			expected[i].parser = nil
+		}
+		encoded := EncodeTokens(p.Tokenize([]byte(input)))
+		got := slices.Collect(DecodeTokens(encoded))
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("For %v expected\n%v\ngot\n%v", input, expected, got)
+		}
+	}
+
+	t.Run("keys are stored once", func(t *testing.T) {
+		var p Parser
+		encoded := EncodeTokens(p.Tokenize([]byte(`[{"a_long_key": 1}, {"a_long_key": [2]}, {"a_long_key": 3}]`)))
+		if n := bytes.Count(encoded, []byte("a_long_key")); n != 1 {
+			t.Errorf("Expected the key to be stored once, got %v", n)
+		}
+	})
+
+	t.Run("stage errors survive encoding", func(t *testing.T) {
+		err := NewStageError("Mine", Token{Line: 3, Col: 4, Start: 20, End: 22}, "bad")
+		got := slices.Collect(DecodeTokens(EncodeTokens(slices.Values([]Token{err}))))
+		if len(got) != 1 || got[0].String() != "3:4 Error (Mine): bad" || got[0].End != 22 {
+			t.Errorf("Unexpected tokens %v", got)
+		}
+	})
+
+	t.Run("the codes of kinds do not change", func(t *testing.T) {
+		tokens := []Token{
+			{Kind: ObjectStart}, {Kind: Key, Value: []byte("k")}, {Kind: Whitespace, Value: []byte(" ")},
+			{Kind: Extension, Key: []byte("k"), Value: []byte("x")}, {Kind: Comma}, {Kind: ErrorQuotaExceeded, ErrorMsg: "m"},
+			{Kind: ErrorExpansionSize}, {Kind: ObjectEnd, Key: []byte("k")},
+		}
+		const expected = "JST1" + "\x00\x00\x00\x00\x00\x00\x00" + "\x1e\x00\x00\x00\x00\x00\x02k" + "\x1f\x00\x00\x00\x00\x00\x02 " +
+			"\x1d\x00\x00\x00\x00\x01\x01k\x02x" + "\x21\x00\x00\x00\x00\x00\x00" + "\x1c\x00\x00\x00\x00\x00\x00\x02m\x01" +
+			"\x27\x00\x00\x00\x00\x00\x00\x01\x01" + "\x01\x00\x00\x00\x00\x01\x00"
+		if got := EncodeTokens(slices.Values(tokens)); string(got) != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+		for _, r := range [][2]Kind{{ObjectStart, Comment}, {Extension, Comma}, {ErrorTrailingInput, ErrorExpansionSize}} {
+			for k := r[0]; k <= r[1]; k++ {
+				if _, ok := kindCodes[k]; !ok {
+					t.Errorf("No code for kind %d", k)
+				}
+			}
+		}
+	})
+
+	t.Run("malformed data", func(t *testing.T) {
+		var p Parser
+		encoded := EncodeTokens(p.Tokenize([]byte(`{"a": [1, 2]}`)))
+		for _, data := range [][]byte{nil, []byte("JSON"), encoded[:len(encoded)-1], append(slices.Clone(encoded), 0x80), []byte("JST1\x7f\x00\x00\x00\x00\x00\x00")} {
+			tokens := slices.Collect(DecodeTokens(data))
+			if len(tokens) == 0 || tokens[len(tokens)-1].Kind != ErrorStage || tokens[len(tokens)-1].Stage() != "DecodeTokens" {
+				t.Errorf("Expected an error for %v, got %v", data, tokens)
+			}
+		}
+	})
+}
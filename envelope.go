@@ -0,0 +1,104 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+)
+
+// WrapInObject wraps each top-level value in the input in an object with a
+// single member with the given key, so that (e.g.) [1, 2] becomes
+// {"data": [1, 2]} for the key "data". The value is streamed, not buffered.
+// The tokens of the enclosing object have no position information. This is
+// the inverse of UnwrapKey.
+func WrapInObject(tokens iter.Seq[Token], key string) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		k := []byte(key)
+		depth := 0
+		for t := range tokens {
+			if depth == 0 && isValueKind(t.Kind) && !IsError(t.Kind) {
+				if !yield(Token{Kind: ObjectStart}) {
+					return
+				}
+			}
+			if depth == 0 || (depth == 1 && isContainerEnd(t.Kind)) {
+				if isValueKind(t.Kind) || isContainerEnd(t.Kind) {
+					t.Key = k
+				}
+			}
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+			if !yield(t) {
+				return
+			}
+			if depth == 0 && (isValueKind(t.Kind) || isContainerEnd(t.Kind)) && !IsError(t.Kind) {
+				if !yield(Token{Kind: ObjectEnd}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// UnwrapKey replaces each top-level object in the input with the value of
+// its member with the given key, so that (e.g.) {"data": [1, 2], "meta": {}}
+// becomes [1, 2] for the key "data". The value is streamed, and the other
+// members are discarded, as are any later members with the same key. If a
+// top-level value is not an object, or has no member with the key, an error
+// token is yielded and iteration stops. Error tokens in the discarded
+// members are yielded. This is the inverse of WrapInObject.
+func UnwrapKey(tokens iter.Seq[Token], key string) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		depth := 0
+		found := false
+		inValue := false // whether the current token is within the unwrapped value
+		for t := range tokens {
+			if IsError(t.Kind) {
+				if !yield(t) {
+					return
+				}
+				continue
+			}
+			if depth == 0 {
+				if isValueKind(t.Kind) && t.Kind != ObjectStart {
+					yield(stageError("UnwrapKey", ErrorUnexpectedToken, t, t, "Expected object"))
+					return
+				}
+				if t.Kind != ObjectStart {
+					if !yield(t) { // a comment or whitespace between values
+						return
+					}
+					continue
+				}
+				found = false
+			}
+			if depth == 1 && !found && isValueKind(t.Kind) && string(t.Key) == key {
+				found, inValue = true, true
+			}
+			if t.Kind == ArrayEnd || t.Kind == ObjectEnd {
+				depth--
+			}
+			if depth == 0 && t.Kind == ObjectEnd && !found {
+				yield(stageError("UnwrapKey", ErrorUnexpectedToken, t, t, fmt.Sprintf("Object has no member with key %q", key)))
+				return
+			}
+			if inValue {
+				if depth == 1 && (isValueKind(t.Kind) || isContainerEnd(t.Kind)) {
+					t.Key = nil
+				}
+				if !yield(t) {
+					return
+				}
+				if depth == 1 && (isContainerEnd(t.Kind) || (t.Kind != ArrayStart && t.Kind != ObjectStart)) {
+					inValue = false
+				}
+			}
+			if t.Kind == ArrayStart || t.Kind == ObjectStart {
+				depth++
+			}
+		}
+	}
+}
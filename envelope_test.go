@@ -0,0 +1,40 @@
+package jsonstream
+
+import (
+	"testing"
+)
+
+func TestWrapInObject(t *testing.T) {
+	p := Parser{AllowMultipleValues: true}
+	got := compactJSON(WrapInObject(p.Tokenize([]byte(`[1, {"a": 2}] "x" {}`)), "data"))
+	if got != `{"data":[1,{"a":2}]},{"data":"x"},{"data":{}}` {
+		t.Errorf("Unexpected output %v", got)
+	}
+}
+
+func TestUnwrapKey(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{`{"meta": {"v": 1}, "data": [1, {"a": 2}], "x": 3}`, `[1,{"a":2}]`},
+		{`{"data": 1, "data": 2} {"data": {"data": 3}}`, `1,{"data":3}`},
+		{`{"data": "x", "meta": [1,]}`, `"x",<error: Trailing ','>`},
+		{`[{"data": 1}]`, `<error: Expected object>`},
+		{`{"meta": 1}`, `<error: Object has no member with key "data">`},
+	}
+	for _, c := range cases {
+		p := Parser{AllowMultipleValues: true}
+		got := compactJSON(UnwrapKey(p.Tokenize([]byte(c.input)), "data"))
+		if got != c.expected {
+			t.Errorf("For %v expected %v, got %v", c.input, c.expected, got)
+		}
+	}
+
+	// Unwrapping reverses wrapping.
+	var p Parser
+	const input = `{"a": [1, 2], "b": null}`
+	if got := compactJSON(UnwrapKey(WrapInObject(p.Tokenize([]byte(input)), "k"), "k")); got != `{"a":[1,2],"b":null}` {
+		t.Errorf("Unexpected output %v", got)
+	}
+}
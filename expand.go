@@ -0,0 +1,90 @@
+package jsonstream
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"slices"
+)
+
+// ExpandOptions configures ExpandStringified.
+type ExpandOptions struct {
+	// The number of strings that stringified JSON may be nested in, counting
+	// the string in the input (8 if not positive).
+	MaxDepth int
+	// The total length in bytes of the strings expanded from each string in
+	// the input, including the strings nested in it (1 MiB if not positive).
+	MaxBytes int
+}
+
+const (
+	defaultExpandMaxDepth = 8
+	defaultExpandMaxBytes = 1024 * 1024
+)
+
+// ExpandStringified replaces each string whose value is the JSON text of an
+// array or object (e.g. "{\"a\": 1}", as produced by encoding a document
+// twice) with the tokens of that array or object. Strings inside the expanded
+// value are expanded in turn. Strings whose values begin with '[' or '{' but
+// are not valid JSON are left unchanged. The tokens of an expanded value have
+// the position of the string from which they were expanded, and its top-level
+// tokens have the key of the string.
+//
+// As stringified JSON can be nested without limit, expansion is bounded by
+// opts. A string that would exceed opts.MaxDepth or opts.MaxBytes is replaced
+// by a token of kind ErrorExpansionDepth or ErrorExpansionSize, respectively.
+func ExpandStringified(tokens iter.Seq[Token], opts ExpandOptions) iter.Seq[Token] {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultExpandMaxDepth
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultExpandMaxBytes
+	}
+	return func(yield func(Token) bool) {
+		for t := range tokens {
+			budget := opts.MaxBytes
+			if !expandString(t, &opts, 0, &budget, yield) {
+				return
+			}
+		}
+	}
+}
+
+// expandString yields t, or the tokens of the array or object stringified in
+// t if t is such a string. depth is the number of strings that t was expanded
+// from, and budget the number of bytes that may still be expanded.
+func expandString(t Token, opts *ExpandOptions, depth int, budget *int, yield func(Token) bool) bool {
+	if t.Kind != String {
+		return yield(t)
+	}
+	text := bytes.TrimLeft(t.Value, " \t\r\n")
+	if len(text) == 0 || text[0] != '[' && text[0] != '{' {
+		return yield(t)
+	}
+	if len(t.Value) > *budget {
+		return yield(stageError("ExpandStringified", ErrorExpansionSize, t, t, fmt.Sprintf("Stringified JSON exceeds %d bytes", opts.MaxBytes)))
+	}
+	// The budget is spent even if the string is not valid JSON, since it has
+	// been tokenized.
+	*budget -= len(t.Value)
+	var p Parser
+	inner := slices.Collect(p.Tokenize(t.Value))
+	if slices.ContainsFunc(inner, func(u Token) bool { return IsError(u.Kind) }) {
+		return yield(t)
+	}
+	if depth+1 > opts.MaxDepth {
+		return yield(stageError("ExpandStringified", ErrorExpansionDepth, t, t, fmt.Sprintf("Stringified JSON nested more than %d deep", opts.MaxDepth)))
+	}
+
+	for i, u := range inner {
+		if i == 0 || i == len(inner)-1 {
+			u.Key = t.Key
+		}
+		u.Line, u.Col, u.Start, u.End = t.Line, t.Col, t.Start, t.End
+		u.parser = t.parser
+		if !expandString(u, opts, depth+1, budget, yield) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package jsonstream
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandStringified(t *testing.T) {
+	cases := []struct {
+		input    string
+		opts     ExpandOptions
+		expected string
+	}{
+		{`{"a": "{\"b\": [1, \"x\"]}", "c": "[1]"}`, ExpandOptions{}, `{"a":{"b":[1,"x"]},"c":[1]}`},
+		{`["{\"b\": \"[\\\"c\\\"]\"}"]`, ExpandOptions{}, `[{"b":["c"]}]`},
+		{`["{not json", " [1] ", "1", "", "{}"]`, ExpandOptions{}, `["{not json",[1],"1","",{}]`},
+		{`"[true]"`, ExpandOptions{}, `[true]`},
+		{`["{\"b\": \"[\\\"c\\\"]\"}"]`, ExpandOptions{MaxDepth: 1}, `[{<error: Stringified JSON nested more than 1 deep>}]`},
+		{`["[1, \"[2]\"]", "[3]"]`, ExpandOptions{MaxBytes: 12}, `[[1,<error: Stringified JSON exceeds 12 bytes>],[3]]`},
+		{`["[1, \"[2]\"]", "[3]"]`, ExpandOptions{MaxBytes: 13}, `[[1,[2]],[3]]`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(ExpandStringified(p.Tokenize([]byte(c.input)), c.opts))
+		if out != c.expected {
+			t.Errorf("Expanding %v with %+v: expected %v, got %v", c.input, c.opts, c.expected, out)
+		}
+	}
+
+	t.Run("expanded tokens have the position of the string", func(t *testing.T) {
+		var p Parser
+		for tok := range ExpandStringified(p.Tokenize([]byte(`[1, "[2]"]`)), ExpandOptions{}) {
+			if tok.Kind == Number && string(tok.Value) == "2" && (tok.Line != 1 || tok.Col != 5 || tok.Start != 4) {
+				t.Errorf("Unexpected position %v:%v (%v)", tok.Line, tok.Col, tok.Start)
+			}
+		}
+	})
+
+	t.Run("the size limit bounds hostile nesting", func(t *testing.T) {
+		// Each level of quoting doubles the number of backslashes.
+		s := `1`
+		for range 12 {
+			s = `[` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `]`
+			s = `"` + s + `"`
+		}
+		var p Parser
+		out := compactJSON(ExpandStringified(p.Tokenize([]byte(s)), ExpandOptions{MaxDepth: 100, MaxBytes: 1000}))
+		if !strings.Contains(out, "<error: Stringified JSON exceeds 1000 bytes>") {
+			t.Errorf("Expected the expansion to be stopped, got %.80v", out)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/base64"
+	"iter"
+)
+
+// Cipher transforms the bytes of a value for EncryptValues or DecryptValues
+// (e.g. by sealing or opening them with a crypto/cipher.AEAD).
+type Cipher func(data []byte) ([]byte, error)
+
+// EncryptValues replaces each value whose path matches one of the given
+// patterns (see PathMatches) with a string giving the base64 encoding (with
+// padding, as for encoding/base64.StdEncoding) of the result of applying
+// encrypt to the value's compact JSON encoding. Arrays and objects are
+// encrypted as a whole. The rest of the document is unchanged, so that
+// sensitive fields can be protected without changing the shape of the
+// document. The string token has the key and the position of the original
+// value. If encrypt fails, an error token is yielded and the stage stops.
+func EncryptValues(tokens iter.Seq[Token], encrypt Cipher, patterns ...[]any) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		var buf bytes.Buffer
+		var w *Writer
+		var start Token // the first token of the value being encrypted
+		depth := 0      // > 0 while inside an array or object being encrypted
+		for t := range tokens {
+			path := pt.next(t)
+			if IsError(t.Kind) {
+				if !yield(t) || w != nil {
+					return // an incomplete value cannot be encrypted
+				}
+				continue
+			}
+
+			if w == nil {
+				if !isValueKind(t.Kind) || !matchesAny(path, patterns) {
+					if !yield(t) {
+						return
+					}
+					continue
+				}
+				buf.Reset()
+				w = NewWriter(&buf)
+				start = t
+			}
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+			_ = w.WriteToken(t) // the input has been checked for errors
+			if depth > 0 {
+				continue
+			}
+
+			_ = w.Flush()
+			w = nil
+			ciphertext, err := encrypt(buf.Bytes())
+			if err != nil {
+				yield(stageError("EncryptValues", ErrorStage, start, t, "Cannot encrypt value: "+err.Error()))
+				return
+			}
+			enc := make([]byte, base64.StdEncoding.EncodedLen(len(ciphertext)))
+			base64.StdEncoding.Encode(enc, ciphertext)
+			if !yield(Token{Line: start.Line, Col: start.Col, Start: start.Start, End: t.End, Key: start.Key, Kind: String, Value: enc, parser: start.parser}) {
+				return
+			}
+		}
+	}
+}
+
+// DecryptValues reverses EncryptValues: it replaces each string whose path
+// matches one of the given patterns with the value given by decoding the
+// string as base64 and applying decrypt. Each of the tokens of the value has
+// the position of the original string, and the value has its key. If a
+// matching value is not a string, its decoding or decryption fails, or the
+// result is not a single JSON value, an error token is yielded and the stage
+// stops.
+func DecryptValues(tokens iter.Seq[Token], decrypt Cipher, patterns ...[]any) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		for t := range tokens {
+			path := pt.next(t)
+			if IsError(t.Kind) || !isValueKind(t.Kind) || !matchesAny(path, patterns) {
+				if !yield(t) {
+					return
+				}
+				continue
+			}
+
+			fail := func(msg string) {
+				yield(stageError("DecryptValues", ErrorStage, t, t, msg))
+			}
+			if t.Kind != String {
+				fail("Expected encrypted string")
+				return
+			}
+			ciphertext, err := base64.StdEncoding.DecodeString(string(t.Value))
+			if err != nil {
+				fail("Cannot decode encrypted string: " + err.Error())
+				return
+			}
+			plaintext, err := decrypt(ciphertext)
+			if err != nil {
+				fail("Cannot decrypt value: " + err.Error())
+				return
+			}
+
+			var p Parser
+			depth, n := 0, 0
+			for vt := range p.Tokenize(plaintext) {
+				if IsError(vt.Kind) {
+					fail("Decrypted value is not valid JSON: " + vt.ErrorMsg)
+					return
+				}
+				if depth == 0 || (depth == 1 && isContainerEnd(vt.Kind)) {
+					vt.Key = t.Key
+				}
+				switch vt.Kind {
+				case ArrayStart, ObjectStart:
+					depth++
+				case ArrayEnd, ObjectEnd:
+					depth--
+				}
+				vt.Line, vt.Col, vt.Start, vt.End, vt.parser = t.Line, t.Col, t.Start, t.End, t.parser
+				if !yield(vt) {
+					return
+				}
+				n++
+			}
+			if n == 0 {
+				fail("Decrypted value is empty")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package jsonstream
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncryptValues(t *testing.T) {
+	block, err := aes.NewCipher([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize()) // a fixed nonce is acceptable only in tests
+	encrypt := func(b []byte) ([]byte, error) { return aead.Seal(nil, nonce, b, nil), nil }
+	decrypt := func(b []byte) ([]byte, error) { return aead.Open(nil, nonce, b, nil) }
+	patterns := [][]any{{"users", Wildcard{}, "ssn"}, {"users", Wildcard{}, "card"}}
+
+	const input = `{"users": [{"name": "a", "ssn": "123-45-6789", "card": {"no": 4111, "exp": [1, 30]}}, {"name": "b", "ssn": null}]}`
+	var p Parser
+	encrypted := compactJSON(EncryptValues(p.Tokenize([]byte(input)), encrypt, patterns...))
+	if strings.Contains(encrypted, "123-45") || strings.Contains(encrypted, "4111") || !strings.Contains(encrypted, `"name":"a"`) {
+		t.Errorf("Unexpected encrypted output %v", encrypted)
+	}
+
+	decrypted := compactJSON(DecryptValues(p.Tokenize([]byte(encrypted)), decrypt, patterns...))
+	if expected := `{"users":[{"name":"a","ssn":"123-45-6789","card":{"no":4111,"exp":[1,30]}},{"name":"b","ssn":null}]}`; decrypted != expected {
+		t.Errorf("Expected %v, got %v", expected, decrypted)
+	}
+
+	t.Run("decrypted tokens have the position and key of the string", func(t *testing.T) {
+		for tok := range DecryptValues(p.Tokenize([]byte(encrypted)), decrypt, patterns...) {
+			if tok.Kind == ObjectEnd && tok.KeyAsString() == "card" {
+				return
+			}
+		}
+		t.Errorf("Expected the end of the decrypted object to have its key")
+	})
+
+	t.Run("key tokens are kept with encrypted members", func(t *testing.T) {
+		kp := Parser{EmitKeyTokens: true}
+		var kinds []Kind
+		for tok := range EncryptValues(kp.Tokenize([]byte(`{"ssn": {"a": 1}, "x": 1}`)), encrypt, []any{"ssn"}) {
+			kinds = append(kinds, tok.Kind)
+		}
+		if !slices.Equal(kinds, []Kind{ObjectStart, Key, String, Key, Number, ObjectEnd}) {
+			t.Errorf("Unexpected kinds %v", kinds)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		failing := func([]byte) ([]byte, error) { return nil, errors.New("no key") }
+		cases := map[string]string{
+			compactJSON(EncryptValues(p.Tokenize([]byte(`{"ssn": [1, 2], "x": 1}`)), failing, []any{"ssn"})):                                          `{<error: Cannot encrypt value: no key>`,
+			compactJSON(DecryptValues(p.Tokenize([]byte(`{"ssn": 1, "x": 1}`)), decrypt, []any{"ssn"})):                                               `{<error: Expected encrypted string>`,
+			compactJSON(DecryptValues(p.Tokenize([]byte(`{"ssn": "%%", "x": 1}`)), decrypt, []any{"ssn"})):                                            `{<error: Cannot decode encrypted string: illegal base64 data at input byte 0>`,
+			compactJSON(DecryptValues(p.Tokenize([]byte(`{"ssn": "AAAA", "x": 1}`)), decrypt, []any{"ssn"})):                                          `{<error: Cannot decrypt value: cipher: message authentication failed>`,
+			compactJSON(DecryptValues(p.Tokenize([]byte(`{"ssn": "W10s", "x": 1}`)), func(b []byte) ([]byte, error) { return b, nil }, []any{"ssn"})): `{"ssn":[],<error: Decrypted value is not valid JSON: Trailing input>`,
+		}
+		for got, expected := range cases {
+			if got != expected {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package jsonstream
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// FormatOptions configures Parser.Format.
+type FormatOptions struct {
+	Indent            string // the string used for each level of indentation (if empty, as given by Tabs and IndentWidth)
+	Tabs              bool   // indent with a tab for each level if Indent is empty
+	IndentWidth       int    // the number of spaces for each level if Indent is empty and Tabs is not set (two if not positive)
+	CompactArrayWidth int    // if positive, the maximum length in bytes of a line on which an array of scalars is written whole
+	NoSpaceAfterColon bool   // write "key":value rather than "key": value
+}
+
+// Format reformats the input with one array element or object member per
+// line and consistent indentation, preserving comments (if p.AllowComments
+// is set) and single blank lines separating groups of elements or members.
+// A comment that follows another token on the same line in the input remains
+// on that line. Other comments are placed on their own lines. Comments between
+// a key and its value are moved before the key.
+//
+// If opts.CompactArrayWidth is positive, an array whose elements are all
+// scalars, which contains no comments, is written on a single line (e.g.
+// [1, 2, 3]) if that line, including its indentation, is no longer than
+// opts.CompactArrayWidth bytes.
+//
+// Keys and scalar values are written exactly as in the input, so that numbers
+// and string escape sequences are preserved. Trailing commas are removed. If
+// the input contains an error, the error (as returned by Token.AsError) is
+// returned.
+func (p *Parser) Format(inp []byte, opts FormatOptions) ([]byte, error) {
+	f := formatter{
+		inp:     inp,
+		policy:  p.LineTerminators,
+		indent:  opts.Indent,
+		prevEnd: -1,
+		stack:   []formatFrame{{}},
+	}
+	switch {
+	case f.indent != "":
+	case opts.Tabs:
+		f.indent = "\t"
+	case opts.IndentWidth > 0:
+		f.indent = strings.Repeat(" ", opts.IndentWidth)
+	default:
+		f.indent = "  "
+	}
+
+	// The tokens are collected so that the formatter can look ahead to the
+	// end of an array that may be written on one line. Key tokens give the
+	// positions of the keys, so that they can be copied from the input.
+	q := *p
+	q.EmitKeyTokens = true
+	tokens := slices.Collect(q.Tokenize(inp))
+	var key Token
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if IsError(t.Kind) {
+			return nil, t.AsError()
+		}
+
+		if t.Kind == Key {
+			key = t
+			continue
+		}
+		if t.Kind == Whitespace {
+			continue
+		}
+
+		newlines := f.newlinesBefore(t)
+		f.prevEnd = t.End
+		if t.Kind == Comment {
+			f.pending = append(f.pending, pendingComment{
+				tok:      t,
+				trailing: newlines == 0 && len(f.out) > 0,
+				blank:    newlines > 1,
+			})
+			continue
+		}
+
+		fr := &f.stack[len(f.stack)-1]
+		if t.Kind == ArrayEnd || t.Kind == ObjectEnd {
+			f.flushComments()
+			f.stack = f.stack[:len(f.stack)-1]
+			if fr.items > 0 {
+				f.newline(false)
+			}
+			f.out = append(f.out, inp[t.Start])
+			f.lineComment = false
+			continue
+		}
+
+		// Top-level values are separated by newlines only.
+		if fr.values > 0 && len(f.stack) > 1 {
+			f.out = append(f.out, ',')
+		}
+		f.flushComments()
+		f.newline(newlines > 1 && fr.items > 0)
+		fr.items++
+		fr.values++
+		if t.Key != nil {
+			// Keys recognized by a Hook may not be JSON string literals.
+			if lit := inp[key.Start : key.End+1]; len(lit) > 1 && lit[0] == '"' {
+				f.out = append(f.out, lit...)
+			} else {
+				f.out = appendQuotedString(f.out, t.Key)
+			}
+			f.out = append(f.out, ':')
+			if !opts.NoSpaceAfterColon {
+				f.out = append(f.out, ' ')
+			}
+		}
+		switch t.Kind {
+		case ArrayStart:
+			if n := f.compactArray(tokens[i:], opts.CompactArrayWidth); n > 0 {
+				i += n
+				f.prevEnd = tokens[i].End
+				break
+			}
+			f.out = append(f.out, '[')
+			f.stack = append(f.stack, formatFrame{})
+		case ObjectStart:
+			f.out = append(f.out, inp[t.Start])
+			f.stack = append(f.stack, formatFrame{})
+		default:
+			f.out = append(f.out, inp[t.Start:t.End+1]...)
+		}
+		f.lineComment = false
+	}
+
+	f.flushComments()
+	if len(f.out) > 0 {
+		f.out = append(f.out, '\n')
+	}
+	return f.out, nil
+}
+
+type formatter struct {
+	inp         []byte
+	policy      LineTerminatorPolicy
+	indent      string
+	out         []byte
+	stack       []formatFrame // the bottom frame is for top-level values
+	prevEnd     int           // the index of the last byte of the previous token
+	pending     []pendingComment
+	lineComment bool // the current output line ends with a comment that runs to the end of the line
+}
+
+type formatFrame struct {
+	items  int // the number of values and comments written
+	values int
+}
+
+type pendingComment struct {
+	tok      Token
+	trailing bool // the comment follows another token on the same line
+	blank    bool // the comment is preceded by a blank line
+}
+
+// compactArray writes the array beginning with tokens[0] on the current line
+// if its elements are all scalars, it contains no comments, and the line would
+// be no longer than width bytes. It returns the index in tokens of the end of
+// the array, or 0 if the array is not written.
+func (f *formatter) compactArray(tokens []Token, width int) int {
+	if width <= 0 {
+		return 0
+	}
+	lineLen := len(f.out) - (bytes.LastIndexByte(f.out, '\n') + 1)
+	n := lineLen + len("[]")
+	end := 0
+	values := 0
+	for j := 1; j < len(tokens) && end == 0; j++ {
+		switch t := tokens[j]; {
+		case t.Kind == ArrayEnd:
+			end = j
+		case t.Kind == Whitespace:
+		case isValueKind(t.Kind) && t.Kind != ArrayStart && t.Kind != ObjectStart:
+			if values > 0 {
+				n += len(", ")
+			}
+			values++
+			n += t.End + 1 - t.Start
+		default:
+			return 0
+		}
+		if n > width {
+			return 0
+		}
+	}
+	if end == 0 || values == 0 {
+		return 0
+	}
+	f.out = append(f.out, '[')
+	values = 0
+	for _, t := range tokens[1:end] {
+		if t.Kind == Whitespace {
+			continue
+		}
+		if values > 0 {
+			f.out = append(f.out, ", "...)
+		}
+		values++
+		f.out = append(f.out, f.inp[t.Start:t.End+1]...)
+	}
+	f.out = append(f.out, ']')
+	return end
+}
+
+// newlinesBefore returns the number of line terminators between the previous
+// token and t.
+func (f *formatter) newlinesBefore(t Token) int {
+	n := 0
+	for i := f.prevEnd + 1; i < t.Start; i++ {
+		if l := lineTerminatorLen(f.policy, f.inp, i); l > 0 {
+			n++
+			i += l - 1
+		}
+	}
+	return n
+}
+
+// newline starts a new output line indented to the current depth, preceded by
+// a blank line if blank is true.
+func (f *formatter) newline(blank bool) {
+	if len(f.out) > 0 {
+		f.out = append(f.out, '\n')
+		if blank {
+			f.out = append(f.out, '\n')
+		}
+	}
+	for range len(f.stack) - 1 {
+		f.out = append(f.out, f.indent...)
+	}
+}
+
+func (f *formatter) flushComments() {
+	fr := &f.stack[len(f.stack)-1]
+	for _, c := range f.pending {
+		if c.trailing && !f.lineComment {
+			f.out = append(f.out, ' ')
+		} else {
+			f.newline(c.blank && fr.items > 0)
+		}
+		fr.items++
+		text := f.inp[c.tok.Start : c.tok.End+1]
+		f.lineComment = !bytes.HasPrefix(text, []byte("/*"))
+		if f.lineComment {
+			text = bytes.TrimRight(text, " \t\r")
+		}
+		f.out = append(f.out, text...)
+	}
+	f.pending = f.pending[:0]
+}
@@ -0,0 +1,98 @@
+package jsonstream
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{`1`, "1\n"},
+		{`{"a":[],"b":{}}`, "{\n  \"a\": [],\n  \"b\": {}\n}\n"},
+		{`[1,[2,3],{"a":"\u0041"}]`, "[\n  1,\n  [\n    2,\n    3\n  ],\n  {\n    \"a\": \"\\u0041\"\n  }\n]\n"},
+		{`{"\u0041\/b":{"c\n":1}}`, "{\n  \"\\u0041\\/b\": {\n    \"c\\n\": 1\n  }\n}\n"},
+		{
+			"// header\n\n{\n\"a\": 1, // first\n\n\n  \"b\": 2,\n  /* block */ \"c\": 3 // last\n}\n// footer\n",
+			"// header\n\n{\n  \"a\": 1, // first\n\n  \"b\": 2,\n  /* block */\n  \"c\": 3 // last\n}\n// footer\n",
+		},
+		{"[ // empty\n]", "[ // empty\n]\n"},
+		{"[\n  1,\n\n  // group\n  2,\n  3,\n]", "[\n  1,\n\n  // group\n  2,\n  3\n]\n"},
+		{"{\"a\": 1 /* x */, \"b\": 2}", "{\n  \"a\": 1, /* x */\n  \"b\": 2\n}\n"},
+	}
+
+	p := Parser{AllowComments: true, AllowTrailingCommas: true}
+	for _, c := range cases {
+		out, err := p.Format([]byte(c.input), FormatOptions{})
+		if err != nil {
+			t.Errorf("Unexpected error %v for %q", err, c.input)
+			continue
+		}
+		if string(out) != c.expected {
+			t.Errorf("For %q expected\n%s\ngot\n%s", c.input, c.expected, out)
+		}
+		again, err := p.Format(out, FormatOptions{})
+		if err != nil || string(again) != string(out) {
+			t.Errorf("Expected formatting to be idempotent for %q, got\n%s", c.input, again)
+		}
+	}
+
+	multiple := Parser{AllowComments: true, AllowMultipleValues: true}
+	for input, expected := range map[string]string{
+		"{\"a\":1}\n{\"b\":2}":          "{\n  \"a\": 1\n}\n{\n  \"b\": 2\n}\n",
+		"{\"a\":1} // a\n\n// b\n[2] 3": "{\n  \"a\": 1\n} // a\n\n// b\n[\n  2\n]\n3\n",
+	} {
+		out, err := multiple.Format([]byte(input), FormatOptions{})
+		if err != nil || string(out) != expected {
+			t.Errorf("For %q expected\n%s\ngot\n%s (error %v)", input, expected, out, err)
+		}
+	}
+
+	out, err := p.Format([]byte(`{"a":[1]}`), FormatOptions{Indent: "\t"})
+	if err != nil || string(out) != "{\n\t\"a\": [\n\t\t1\n\t]\n}\n" {
+		t.Errorf("Unexpected output %q (error %v)", out, err)
+	}
+
+	if _, err := p.Format([]byte(`[1 2]`), FormatOptions{}); err == nil || err.Error() != "1:4 Error: Unexpected token inside array (expecting ',')" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	const input = `{"a": [1, "two", null], "b": [[1, 2], [3, {"c": 4}]], "d": [1 /* x */], "e": [], "long": [100, 200, 300]}`
+	cases := []struct {
+		opts     FormatOptions
+		expected string
+	}{
+		{FormatOptions{Tabs: true}, "{\n\t\"a\": [\n\t\t1,\n\t\t\"two\",\n\t\tnull\n\t],\n"},
+		{FormatOptions{IndentWidth: 4, NoSpaceAfterColon: true}, "{\n    \"a\":[\n        1,\n        \"two\",\n        null\n    ],\n"},
+		{FormatOptions{Indent: "\t", IndentWidth: 4}, "{\n\t\"a\": [\n\t\t1,\n\t\t\"two\",\n\t\tnull\n\t],\n"},
+		{
+			FormatOptions{CompactArrayWidth: 24},
+			"{\n  \"a\": [1, \"two\", null],\n  \"b\": [\n    [1, 2],\n    [\n      3,\n      {\n        \"c\": 4\n      }\n    ]\n  ],\n" +
+				"  \"d\": [\n    1 /* x */\n  ],\n  \"e\": [],\n  \"long\": [\n    100,\n    200,\n    300\n  ]\n}\n",
+		},
+		{FormatOptions{CompactArrayWidth: 25, NoSpaceAfterColon: true}, "{\n  \"a\":[1, \"two\", null],\n  \"b\":[\n    [1, 2],\n"},
+	}
+	p := Parser{AllowComments: true}
+	for _, c := range cases {
+		out, err := p.Format([]byte(input), c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(out), c.expected) {
+			t.Errorf("For %+v expected output beginning\n%s\ngot\n%s", c.opts, c.expected, out)
+		}
+		again, err := p.Format(out, c.opts)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("Expected formatting to be idempotent for %+v, got\n%s", c.opts, again)
+		}
+	}
+
+	out, err := p.Format([]byte(`{"long": [100, 200, 300]}`), FormatOptions{CompactArrayWidth: 25})
+	if err != nil || string(out) != "{\n  \"long\": [100, 200, 300]\n}\n" {
+		t.Errorf("Unexpected output %q (error %v)", out, err)
+	}
+}
@@ -0,0 +1,60 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrPathNotFound is returned by GetAs and RawValue.Get if no value in the
+// input has the given path.
+var ErrPathNotFound = errors.New("jsonstream: path not found")
+
+// GetAs decodes the first value in the input whose path matches the given
+// pattern (see PathMatches) as a value of type T, using encoding/json.
+// For example,
+//
+//	GetAs[[]string](input, "users", 0, "roles")
+//
+// returns the roles of the first user. Tokenization stops at the end of the
+// selected value, and only the tokens of the value are encoded for decoding,
+// so a value near the start of a large document is extracted cheaply. An
+// error in the input before the end of the value is returned (as by
+// Token.AsError), as is an error decoding the value. If no value matches,
+// ErrPathNotFound is returned.
+func GetAs[T any](input []byte, path ...any) (T, error) {
+	var result T
+	var p Parser
+	var pt pathTracker
+	var buf bytes.Buffer
+	var w *Writer // non-nil once the value is found
+	depth := 0
+	for t := range p.Tokenize(input) {
+		if IsError(t.Kind) {
+			return result, t.AsError()
+		}
+		tp := pt.next(t)
+		if w == nil {
+			if !isValueKind(t.Kind) || !PathMatches(tp, path) {
+				continue
+			}
+			w = NewWriter(&buf)
+		}
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if err := w.WriteToken(t); err != nil {
+			return result, err
+		}
+		if depth == 0 {
+			if err := w.Flush(); err != nil {
+				return result, err
+			}
+			return result, json.Unmarshal(buf.Bytes(), &result)
+		}
+	}
+	return result, ErrPathNotFound
+}
@@ -0,0 +1,47 @@
+package jsonstream
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetAs(t *testing.T) {
+	input := []byte(`{"id": 7, "users": [{"name": "a", "roles": ["admin", "dev"], "age": 41}, {"name": "b", "roles": []}]}`)
+
+	if id, err := GetAs[int](input, "id"); err != nil || id != 7 {
+		t.Errorf("Expected 7, got %v %v", id, err)
+	}
+	if roles, err := GetAs[[]string](input, "users", 0, "roles"); err != nil || !reflect.DeepEqual(roles, []string{"admin", "dev"}) {
+		t.Errorf("Unexpected roles %v %v", roles, err)
+	}
+	if name, err := GetAs[string](input, "users", Wildcard{}, "name"); err != nil || name != "a" {
+		t.Errorf("Expected the first match, got %v %v", name, err)
+	}
+	type user struct {
+		Name  string
+		Roles []string
+	}
+	if u, err := GetAs[user](input, "users", 1); err != nil || u.Name != "b" || u.Roles == nil || len(u.Roles) != 0 {
+		t.Errorf("Unexpected user %+v %v", u, err)
+	}
+	if v, err := GetAs[map[string]any](input); err != nil || v["id"] != 7.0 {
+		t.Errorf("Expected the whole document, got %v %v", v, err)
+	}
+
+	if _, err := GetAs[int](input, "users", 5); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+	if _, err := GetAs[int](input, "users", 0, "name"); err == nil {
+		t.Errorf("Expected a decoding error")
+	}
+	if _, err := GetAs[float64]([]byte(`{"big": 1e400}`), "big"); err == nil {
+		t.Errorf("Expected an out of range error")
+	}
+	if age, err := GetAs[int](append([]byte(`{"users": [{"age": 41}], "x": `), '@'), "users", 0, "age"); err != nil || age != 41 {
+		t.Errorf("Expected errors after the value to be ignored, got %v %v", age, err)
+	}
+	if _, err := GetAs[int]([]byte(`{"x": @, "id": 1}`), "id"); err == nil {
+		t.Errorf("Expected an error in the input to be returned")
+	}
+}
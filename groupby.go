@@ -0,0 +1,133 @@
+package jsonstream
+
+import (
+	"errors"
+	"iter"
+	"strconv"
+)
+
+// GroupBy aggregates the elements of the top-level array of the input (e.g.
+// an array of records) grouped by the value whose path within each element
+// matches the pattern keyPath (see PathMatches). It yields an array with one
+// object for each group, in order of first occurrence, of the form
+//
+//	{"key": <key>, "count": <number of elements>}
+//
+// If valuePath is non-nil, the numeric values whose paths within each element
+// match valuePath are also aggregated, and each object has the additional
+// members "sum", "min" and "max" (min and max are null if the group has no
+// numeric values). Only the first matching value in each element is used.
+// Elements with no scalar value matching keyPath are ignored. Two keys are
+// the same if they have the same kind and value (so 1 and "1" are different
+// keys). Min and max values are yielded as written in the input.
+//
+// Memory use is proportional to the number of groups and the size of the
+// largest element. If the input contains an error or its top-level value is
+// not an array, the error is yielded and iteration stops.
+func GroupBy(tokens iter.Seq[Token], keyPath, valuePath []any) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		type group struct {
+			key      Token
+			count    int
+			sum      float64
+			min, max Token
+			hasValue bool
+			minVal   float64
+			maxVal   float64
+		}
+		var groups []*group
+		index := make(map[string]*group)
+
+		for elements, err := range batchTokens("GroupBy", tokens, 1) {
+			if err != nil {
+				yieldBatchError(yield, err)
+				return
+			}
+			elem := elements[0]
+			key, ok := findScalar(elem, keyPath)
+			if !ok {
+				continue
+			}
+			id := string(rune(key.Kind)) + string(key.Value)
+			g := index[id]
+			if g == nil {
+				g = &group{key: key}
+				groups = append(groups, g)
+				index[id] = g
+			}
+			g.count++
+			if valuePath == nil {
+				continue
+			}
+			v, ok := findScalar(elem, valuePath)
+			if !ok || v.Kind != Number {
+				continue
+			}
+			f, err := parseNumber(v.Value, 64)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				continue
+			}
+			g.sum += f
+			if !g.hasValue || f < g.minVal {
+				g.min, g.minVal = v, f
+			}
+			if !g.hasValue || f > g.maxVal {
+				g.max, g.maxVal = v, f
+			}
+			g.hasValue = true
+		}
+
+		if !yield(Token{Kind: ArrayStart}) {
+			return
+		}
+		for _, g := range groups {
+			out := []Token{
+				{Kind: ObjectStart},
+				scalarToken(g.key.Kind, "key", g.key.Value),
+				scalarToken(Number, "count", strconv.AppendInt(nil, int64(g.count), 10)),
+			}
+			if valuePath != nil {
+				out = append(out, scalarToken(Number, "sum", strconv.AppendFloat(nil, g.sum, 'g', -1, 64)))
+				if g.hasValue {
+					out = append(out, scalarToken(Number, "min", g.min.Value), scalarToken(Number, "max", g.max.Value))
+				} else {
+					out = append(out, scalarToken(Null, "min", nil), scalarToken(Null, "max", nil))
+				}
+			}
+			out = append(out, Token{Kind: ObjectEnd})
+			for _, t := range out {
+				if !yield(t) {
+					return
+				}
+			}
+		}
+		yield(Token{Kind: ArrayEnd})
+	}
+}
+
+// findScalar returns the first scalar value in the given value whose path
+// (relative to the value) matches the pattern.
+func findScalar(value []Token, pattern []any) (Token, bool) {
+	var pt pathTracker
+	for _, t := range value {
+		path := pt.next(t)
+		if isValueKind(t.Kind) && t.Kind != ArrayStart && t.Kind != ObjectStart && PathMatches(path, pattern) {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// scalarToken returns a token for an object member with the given key.
+func scalarToken(kind Kind, key string, value []byte) Token {
+	return Token{Kind: kind, Key: []byte(key), Value: value}
+}
+
+// yieldBatchError yields the error token underlying an error returned by
+// batchTokens.
+func yieldBatchError(yield func(Token) bool, err error) {
+	var t Token
+	if errors.As(err, &t) {
+		yield(t)
+	}
+}
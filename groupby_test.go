@@ -0,0 +1,45 @@
+package jsonstream
+
+import (
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	const input = `[
+		{"type": "a", "n": 1},
+		{"type": "b", "n": 2.5},
+		{"type": "a", "n": -3},
+		{"type": 1, "n": 4},
+		{"n": 5},
+		{"type": "a", "n": "x"},
+		{"type": "a", "n": 10}
+	]`
+
+	cases := []struct {
+		keyPath, valuePath []any
+		expected           string
+	}{
+		{[]any{"type"}, nil, `[{"key":"a","count":4},{"key":"b","count":1},{"key":1,"count":1}]`},
+		{[]any{"type"}, []any{"n"}, `[{"key":"a","count":4,"sum":8,"min":-3,"max":10},{"key":"b","count":1,"sum":2.5,"min":2.5,"max":2.5},{"key":1,"count":1,"sum":4,"min":4,"max":4}]`},
+		{[]any{"n"}, []any{"missing"}, `[{"key":1,"count":1,"sum":0,"min":null,"max":null},{"key":2.5,"count":1,"sum":0,"min":null,"max":null},{"key":-3,"count":1,"sum":0,"min":null,"max":null},{"key":4,"count":1,"sum":0,"min":null,"max":null},{"key":5,"count":1,"sum":0,"min":null,"max":null},{"key":"x","count":1,"sum":0,"min":null,"max":null},{"key":10,"count":1,"sum":0,"min":null,"max":null}]`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(GroupBy(p.Tokenize([]byte(input)), c.keyPath, c.valuePath))
+		if out != c.expected {
+			t.Errorf("Grouping by %v, %v: expected\n%v\ngot\n%v", c.keyPath, c.valuePath, c.expected, out)
+		}
+	}
+
+	errorCases := map[string]string{
+		`{"a": 1}`:         `<error: Expected array>`,
+		`[{"type": "a"},]`: `<error: Trailing ','>`,
+	}
+	for input, expected := range errorCases {
+		var p Parser
+		out := compactJSON(GroupBy(p.Tokenize([]byte(input)), []any{"type"}, nil))
+		if out != expected {
+			t.Errorf("For %v expected %v, got %v", input, expected, out)
+		}
+	}
+}
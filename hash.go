@@ -0,0 +1,16 @@
+package jsonstream
+
+import (
+	"hash"
+	"iter"
+)
+
+// HashTokens feeds the canonical encoding of the given tokens into h, without
+// constructing the encoded document in memory. The canonical encoding is the
+// compact encoding produced by Writer, so token sequences that differ only in
+// whitespace, comments or the choice of string escape sequences produce the
+// same hash. Object keys are hashed in the order in which they occur. The
+// caller obtains the result using h.Sum.
+func HashTokens(h hash.Hash, tokens iter.Seq[Token]) error {
+	return NewWriter(h).WriteAll(tokens)
+}
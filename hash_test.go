@@ -0,0 +1,45 @@
+package jsonstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestHashTokens(t *testing.T) {
+	hashOf := func(input string) []byte {
+		p := Parser{AllowComments: true}
+		h := sha256.New()
+		if err := HashTokens(h, p.Tokenize([]byte(input))); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return h.Sum(nil)
+	}
+
+	const canonical = `{"a":[1,"x\n"],"b":{"c":null}}`
+	expected := sha256.Sum256([]byte(canonical))
+	if !bytes.Equal(hashOf(canonical), expected[:]) {
+		t.Errorf("Expected hash of canonical input to be the hash of its bytes")
+	}
+
+	equivalent := []string{
+		"{ \"a\" : [ 1 , \"x\\n\" ] , \"b\" : { \"c\" : null } }",
+		"{\"\\u0061\": [1, \"x\\u000a\"], // comment\n \"b\": {\"c\": null}}",
+	}
+	for _, input := range equivalent {
+		if !bytes.Equal(hashOf(input), expected[:]) {
+			t.Errorf("Expected %v to have the same hash as %v", input, canonical)
+		}
+	}
+
+	if bytes.Equal(hashOf(`{"b":{"c":null},"a":[1,"x\n"]}`), expected[:]) {
+		t.Errorf("Expected key order to be significant")
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		var p Parser
+		if err := HashTokens(sha256.New(), p.Tokenize([]byte(`[1,]`))); err == nil {
+			t.Errorf("Expected error")
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+)
+
+// RequestBodyOptions configures ValidateRequestBody.
+type RequestBodyOptions struct {
+	Parser   *Parser    // the options with which bodies are tokenized (the zero Parser if nil)
+	MaxBytes int64      // if positive, the maximum size of a body in bytes
+	Limits   Usage      // limits on the resources used by a body, as for MaxUsage (in addition to any Parser.Quota)
+	Types    []TypeRule // rules for the types of values, as for AssertTypes
+	Redact   [][]any    // patterns giving values to remove, as for Delete
+
+	// If non-nil, Transform is a stage applied to the body after the other
+	// checks (e.g. to rename keys or fill in defaults).
+	Transform func(tokens iter.Seq[Token]) iter.Seq[Token]
+
+	// If non-nil, OnError writes the response for an invalid body, instead of
+	// the default JSON response.
+	OnError func(w http.ResponseWriter, r *http.Request, err *RequestBodyError)
+}
+
+// RequestBodyError describes a request body rejected by ValidateRequestBody.
+// By default it is written as the response as a JSON object of the form
+// {"error": {...}} with the fields below.
+type RequestBodyError struct {
+	Status  int    `json:"status"`          // the HTTP status of the response (400, or 413 if the body exceeds MaxBytes)
+	Message string `json:"message"`         // a description of the error
+	Stage   string `json:"stage,omitempty"` // the stage that detected the error (see Token.Stage)
+	Line    int    `json:"line,omitempty"`  // the line of the error in the body (zero if the error has no position)
+	Col     int    `json:"col,omitempty"`   // the column of the error in the body
+}
+
+func (e *RequestBodyError) Error() string {
+	if e.Line == 0 {
+		return "jsonstream: invalid request body: " + e.Message
+	}
+	return "jsonstream: invalid request body at " + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Col) + ": " + e.Message
+}
+
+// ValidateRequestBody returns a handler that checks and rewrites the JSON
+// body of each request before passing the request to next. The body is read
+// (up to opts.MaxBytes), tokenized with opts.Parser and opts.Limits, checked
+// against opts.Types, stripped of the values matching opts.Redact and passed
+// through opts.Transform. The handler next receives the result as compact
+// JSON, with the Content-Length of the request updated. If any step fails, next
+// is not called, and the response is the *RequestBodyError giving the first
+// error and its position in the body, written by opts.OnError or as JSON with
+// a 400 (Bad Request) or 413 (Request Entity Too Large) status.
+func ValidateRequestBody(next http.Handler, opts RequestBodyOptions) http.Handler {
+	var p Parser
+	if opts.Parser != nil {
+		p = *opts.Parser
+	}
+	if opts.Limits != (Usage{}) {
+		limit, quota := MaxUsage(opts.Limits), p.Quota
+		p.Quota = limit
+		if quota != nil {
+			p.Quota = func(u Usage) error {
+				if err := quota(u); err != nil {
+					return err
+				}
+				return limit(u)
+			}
+		}
+	}
+	onError := opts.OnError
+	if onError == nil {
+		onError = writeRequestBodyError
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Body
+		if opts.MaxBytes > 0 {
+			body = http.MaxBytesReader(w, body, opts.MaxBytes)
+		}
+		inp, err := io.ReadAll(body)
+		if err != nil {
+			e := &RequestBodyError{Status: http.StatusBadRequest, Message: "Cannot read body: " + err.Error()}
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				e.Status, e.Message = http.StatusRequestEntityTooLarge, "Body exceeds "+strconv.FormatInt(mbe.Limit, 10)+" bytes"
+			}
+			onError(w, r, e)
+			return
+		}
+
+		q := p // each request has its own record of errors
+		tokens := q.Tokenize(inp)
+		if len(opts.Types) > 0 {
+			tokens = AssertTypes(tokens, opts.Types...)
+		}
+		if len(opts.Redact) > 0 {
+			tokens = Delete(tokens, opts.Redact...)
+		}
+		if opts.Transform != nil {
+			tokens = opts.Transform(tokens)
+		}
+		var buf bytes.Buffer
+		jw := NewWriter(&buf)
+		var werr error
+		for t := range tokens {
+			if IsError(t.Kind) {
+				onError(w, r, &RequestBodyError{
+					Status:  http.StatusBadRequest,
+					Message: t.ErrorMsg,
+					Stage:   t.Stage(),
+					Line:    t.Line,
+					Col:     t.Col,
+				})
+				return
+			}
+			if werr == nil {
+				werr = jw.WriteToken(t)
+			}
+		}
+		if werr == nil {
+			werr = jw.finish()
+		}
+		if werr != nil {
+			onError(w, r, &RequestBodyError{Status: http.StatusBadRequest, Message: werr.Error()})
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+		r.ContentLength = int64(buf.Len())
+		r.Header.Set("Content-Length", strconv.Itoa(buf.Len()))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeRequestBodyError(w http.ResponseWriter, _ *http.Request, e *RequestBodyError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(struct {
+		Error *RequestBodyError `json:"error"`
+	}{e})
+}
@@ -0,0 +1,71 @@
+package jsonstream
+
+import (
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequestBody(t *testing.T) {
+	var received string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.ContentLength != int64(len(b)) {
+			t.Errorf("ContentLength %v does not match body %s", r.ContentLength, b)
+		}
+		received = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := ValidateRequestBody(next, RequestBodyOptions{
+		Parser:   &Parser{AllowComments: true},
+		MaxBytes: 100,
+		Limits:   Usage{Depth: 2},
+		Types:    []TypeRule{{Path: []any{"id"}, Type: TypeNumber}},
+		Redact:   [][]any{{"password"}},
+	})
+
+	cases := []struct {
+		body     string
+		status   int
+		response string
+	}{
+		{`{"id": 1, /* c */ "password": "x", "tags": ["a"]}`, http.StatusNoContent, ``},
+		{`{"id": "1"}`, http.StatusBadRequest, `{"error":{"status":400,"message":"Expected number at [\"id\"], got string","stage":"AssertTypes","line":1,"col":8}}`},
+		{"{\n  \"id\": 1,\n}", http.StatusBadRequest, `{"error":{"status":400,"message":"Trailing ','","line":2,"col":11}}`},
+		{`{"a": [{}]}`, http.StatusBadRequest, `{"error":{"status":400,"message":"Quota exceeded: Depth is 3 (limit 2)","line":1,"col":8}}`},
+		{`[` + strings.Repeat(`1,`, 60) + `1]`, http.StatusRequestEntityTooLarge, `{"error":{"status":413,"message":"Body exceeds 100 bytes"}}`},
+	}
+	for _, c := range cases {
+		received = ""
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(c.body)))
+		if rec.Code != c.status || strings.TrimSpace(rec.Body.String()) != c.response {
+			t.Errorf("For %v expected %v %v, got %v %v", c.body, c.status, c.response, rec.Code, rec.Body.String())
+		}
+		if c.status == http.StatusNoContent && received != `{"id":1,"tags":["a"]}` {
+			t.Errorf("Unexpected body %v", received)
+		}
+		if c.status != http.StatusNoContent && received != "" {
+			t.Errorf("Expected the handler not to be called for %v", c.body)
+		}
+	}
+}
+
+func TestValidateRequestBodyOnError(t *testing.T) {
+	var got *RequestBodyError
+	h := ValidateRequestBody(http.NotFoundHandler(), RequestBodyOptions{
+		Transform: func(tokens iter.Seq[Token]) iter.Seq[Token] { return UnwrapKey(tokens, "data") },
+		OnError: func(w http.ResponseWriter, r *http.Request, err *RequestBodyError) {
+			got = err
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		},
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"x": 1}`)))
+	if rec.Code != http.StatusUnprocessableEntity || got == nil || got.Error() != `jsonstream: invalid request body at 1:8: Object has no member with key "data"` {
+		t.Errorf("Unexpected response %v with error %v", rec.Code, got)
+	}
+}
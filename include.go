@@ -0,0 +1,155 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+)
+
+// IncludeOptions configures Include.
+type IncludeOptions struct {
+	// The key of the include directive ("$include" if empty).
+	Directive string
+	// Load returns the contents of the file with the given name, which is
+	// included from the file named from (the Filename of the Parser that
+	// produced the directive). This allows relative names to be resolved.
+	Load func(name, from string) ([]byte, error)
+	// The configuration used to tokenize included files. If nil, a default
+	// initialized Parser is used. The Filename of the Parser is ignored.
+	Parser *Parser
+}
+
+const defaultIncludeDirective = "$include"
+
+// Include replaces each include directive (an object with a single member
+// whose key is opts.Directive and whose value is a string, such as
+// {"$include": "other.json"}) with the top-level value of the named file.
+// Included files are tokenized using a copy of opts.Parser whose Filename is
+// set to the name of the file, so that the positions of tokens from included
+// files can be attributed to them (see Token.Filename). Includes are processed
+// recursively.
+//
+// If a file cannot be loaded or includes itself (directly or indirectly), a
+// token of kind ErrorInclude is yielded in place of the directive.
+func Include(tokens iter.Seq[Token], opts IncludeOptions) iter.Seq[Token] {
+	if opts.Directive == "" {
+		opts.Directive = defaultIncludeDirective
+	}
+	return func(yield func(Token) bool) {
+		includeFiles(tokens, &opts, nil, yield)
+	}
+}
+
+func includeFiles(tokens iter.Seq[Token], opts *IncludeOptions, stack []string, yield func(Token) bool) bool {
+	isDirective := func(key []byte) bool {
+		return string(key) == opts.Directive
+	}
+	return replaceDirectives(tokens, isDirective, yield, func(start, member, end Token) bool {
+		return includeFile(start, end, string(member.Value), opts, stack, yield)
+	})
+}
+
+// replaceDirectives yields the given tokens, except that each object with a
+// single member whose value is a string and whose key satisfies isDirective is
+// passed to replace instead. It returns false if iteration should stop.
+func replaceDirectives(tokens iter.Seq[Token], isDirective func(key []byte) bool, yield func(Token) bool, replace func(start, member, end Token) bool) bool {
+	next, stop := iter.Pull(tokens)
+	defer stop()
+
+	var pending []Token
+	pull := func() (Token, bool) {
+		if len(pending) > 0 {
+			t := pending[0]
+			pending = pending[1:]
+			return t, true
+		}
+		return next()
+	}
+	unpull := func(ts ...Token) {
+		pending = append(ts, pending...)
+	}
+
+	for {
+		t, ok := pull()
+		if !ok {
+			return true
+		}
+		if t.Kind == ObjectStart {
+			member, ok := pull()
+			if ok && member.Kind == String && isDirective(member.Key) {
+				end, ok := pull()
+				if ok && end.Kind == ObjectEnd {
+					if !replace(t, member, end) {
+						return false
+					}
+					continue
+				}
+				if ok {
+					unpull(member, end)
+				} else {
+					unpull(member)
+				}
+			} else if ok {
+				unpull(member)
+			}
+		}
+		if !yield(t) {
+			return false
+		}
+	}
+}
+
+// includeFile yields the tokens of the named file in place of the directive
+// beginning with start and ending with end.
+func includeFile(start, end Token, name string, opts *IncludeOptions, stack []string, yield func(Token) bool) bool {
+	from := start.Filename()
+	fail := func(msg string) bool {
+		return yield(stageError("Include", ErrorInclude, start, end, msg))
+	}
+
+	if name == from || slices.Contains(stack, name) {
+		return fail(fmt.Sprintf("Cyclic include of %q", name))
+	}
+	if opts.Load == nil {
+		return fail(fmt.Sprintf("Cannot include %q: no Load function", name))
+	}
+	data, err := opts.Load(name, from)
+	if err != nil {
+		return fail(fmt.Sprintf("Cannot include %q: %v", name, err))
+	}
+
+	var p Parser
+	if opts.Parser != nil {
+		p = *opts.Parser
+		p.errors = nil
+		p.decodeErrors = nil
+	}
+	p.Filename = name
+
+	// The top-level value of the included file takes the key of the directive.
+	included := func(yield func(Token) bool) {
+		depth := 0
+		for t := range p.Tokenize(data) {
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				if depth == 0 {
+					t.Key = start.Key
+				}
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+				if depth == 0 {
+					t.Key = start.Key
+				}
+			default:
+				if depth == 0 && isValueKind(t.Kind) {
+					t.Key = start.Key
+				}
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+	return includeFiles(included, opts, append(stack, name), yield)
+}
@@ -0,0 +1,65 @@
+package jsonstream
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	files := map[string]string{
+		"db.json":     `{"host": "localhost", "port": {"$include": "port.json"}}`,
+		"port.json":   `5432`,
+		"list.json":   `[1, /* c */ 2]`,
+		"bad.json":    `{"a": 1,}`,
+		"cycle.json":  `[{"$include": "cycle2.json"}]`,
+		"cycle2.json": `{"$include": "cycle.json"}`,
+	}
+	load := func(name, from string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(data), nil
+	}
+	opts := IncludeOptions{Load: load, Parser: &Parser{AllowComments: true}}
+
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{`{"db": {"$include": "db.json"}, "x": [{"$include": "list.json"}]}`, `{"db":{"host":"localhost","port":5432},"x":[[1,2]]}`},
+		{`{"$include": "port.json"}`, `5432`},
+		{`{"$include": "port.json", "other": 1}`, `{"$include":"port.json","other":1}`},
+		{`[{"a": {"$include": 1}}, {}]`, `[{"a":{"$include":1}},{}]`},
+		{`{"a": {"$include": "missing.json"}}`, `{<error: Cannot include "missing.json": not found>}`},
+		{`{"a": {"$include": "bad.json"}}`, `{"a":{"a":1,<error: Trailing ','>}}`},
+		{`{"$include": "cycle.json"}`, `[<error: Cyclic include of "cycle.json">]`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(Include(p.Tokenize([]byte(c.input)), opts))
+		if out != c.expected {
+			t.Errorf("For %v expected %v, got %v", c.input, c.expected, out)
+		}
+	}
+
+	t.Run("positions are attributed to included files", func(t *testing.T) {
+		p := Parser{Filename: "main.json"}
+		for tok := range Include(p.Tokenize([]byte(`{"a": {"$include": "bad.json"}, "b": 1}`)), opts) {
+			switch {
+			case IsError(tok.Kind):
+				if tok.Filename() != "bad.json" || tok.Error() != "bad.json:1:8 Error: Trailing ','" {
+					t.Errorf("Unexpected error %v", tok)
+				}
+			case tok.Kind == Number && tok.AsInt() == 1 && tok.Col == 7:
+				if tok.Filename() != "bad.json" || tok.KeyAsString() != "a" {
+					t.Errorf("Unexpected token %v from %v", tok, tok.Filename())
+				}
+			default:
+				if tok.Filename() != "main.json" && tok.Filename() != "bad.json" {
+					t.Errorf("Unexpected filename %q for %v", tok.Filename(), tok)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package jsonstream
+
+// Index is an immutable structural index of a document, giving the position
+// of each value. Once built, an Index can be queried by any number of
+// goroutines concurrently without locking, and values are located without
+// tokenizing the input again, so it is suited to caches that serve many
+// reads of the same document. The values are returned as RawValue handles,
+// so that only the selected value is tokenized when it is used. Decode
+// errors for the tokens of these values are not recorded (see
+// Parser.DecodeErrors), as the Parser may be in use elsewhere.
+//
+// The Index refers to the input, which must not be modified while the Index
+// is in use.
+type Index struct {
+	input  []byte
+	config Parser       // the configuration with which values are tokenized
+	nodes  []indexEntry // the values of the document in document order
+}
+
+type indexEntry struct {
+	first Token // the first token of the value
+	end   int   // the index of the last byte of the value in the input
+	next  int   // the index of the entry following the value and its descendants
+}
+
+// BuildIndex tokenizes the first value in the input and returns an Index for
+// it. If the input contains an error, the error (as returned by
+// Token.AsError) is returned.
+func (p *Parser) BuildIndex(inp []byte) (*Index, error) {
+	idx := &Index{input: inp}
+	var open []int // the entries of the open containers
+	for t := range p.Tokenize(inp) {
+		if IsError(t.Kind) {
+			return nil, t.AsError()
+		}
+		switch {
+		case isContainerEnd(t.Kind):
+			i := open[len(open)-1]
+			open = open[:len(open)-1]
+			idx.nodes[i].end = t.End
+			idx.nodes[i].next = len(idx.nodes)
+		case isValueKind(t.Kind):
+			t.parser = nil
+			idx.nodes = append(idx.nodes, indexEntry{first: t, end: t.End, next: len(idx.nodes) + 1})
+			if t.Kind == ArrayStart || t.Kind == ObjectStart {
+				open = append(open, len(idx.nodes)-1)
+			}
+		default:
+			continue
+		}
+		if len(open) == 0 {
+			break
+		}
+	}
+	idx.config = rawValueConfig(p)
+	return idx, nil
+}
+
+// value returns a handle to the value of the entry i.
+func (idx *Index) value(i int) RawValue {
+	n := idx.nodes[i]
+	return RawValue{input: idx.input, first: n.first, end: n.end, config: idx.config}
+}
+
+// Get returns the value at the given path, which is a sequence of string keys
+// and int indices (see PathToSlice), in which FoldKey values can be used to
+// match keys case-insensitively. If an object has several members with a
+// matching key, the first is selected. If there is no value at the path, ok is
+// false.
+func (idx *Index) Get(path ...any) (value RawValue, ok bool) {
+	if len(idx.nodes) == 0 {
+		return RawValue{}, false
+	}
+	i := 0
+outer:
+	for _, elem := range path {
+		n := idx.nodes[i]
+		child, count := i+1, 0
+		for ; child < n.next; child = idx.nodes[child].next {
+			switch e := elem.(type) {
+			case string:
+				if n.first.Kind == ObjectStart && string(idx.nodes[child].first.Key) == e {
+					i = child
+					continue outer
+				}
+			case FoldKey:
+				if n.first.Kind == ObjectStart && e.matches(string(idx.nodes[child].first.Key)) {
+					i = child
+					continue outer
+				}
+			case int:
+				if n.first.Kind == ArrayStart && count == e {
+					i = child
+					continue outer
+				}
+			}
+			count++
+		}
+		return RawValue{}, false
+	}
+	return idx.value(i), true
+}
+
+// Find returns the innermost value whose range in the input contains the byte
+// at index offset, together with its path (see PathToSlice). This is useful
+// for mapping an editor's cursor position to a value. If no value contains
+// the byte, ok is false.
+func (idx *Index) Find(offset int) (path []any, value RawValue, ok bool) {
+	if len(idx.nodes) == 0 || offset < idx.nodes[0].first.Start || offset > idx.nodes[0].end {
+		return nil, RawValue{}, false
+	}
+	path = []any{}
+	i := 0
+outer:
+	for {
+		n := idx.nodes[i]
+		count := 0
+		for child := i + 1; child < n.next; child = idx.nodes[child].next {
+			c := idx.nodes[child]
+			if c.first.Start > offset {
+				break
+			}
+			if offset <= c.end {
+				if n.first.Kind == ObjectStart {
+					path = append(path, string(c.first.Key))
+				} else {
+					path = append(path, count)
+				}
+				i = child
+				continue outer
+			}
+			count++
+		}
+		return path, idx.value(i), true
+	}
+}
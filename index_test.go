@@ -0,0 +1,95 @@
+package jsonstream
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	const input = `{"a": [1, {"b": "x"}], "c": null, "c": 2}`
+	var p Parser
+	idx, err := p.BuildIndex([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path     []any
+		expected string
+	}{
+		{nil, input},
+		{[]any{"a"}, `[1, {"b": "x"}]`},
+		{[]any{"a", 1, "b"}, `"x"`},
+		{[]any{"c"}, `null`},
+		{[]any{"a", 2}, ``},
+		{[]any{"a", "b"}, ``},
+		{[]any{"d"}, ``},
+		{[]any{FoldKey{Key: "A"}, 1, FoldKey{Key: "B"}}, `"x"`},
+	}
+	for _, c := range cases {
+		v, ok := idx.Get(c.path...)
+		if ok != (c.expected != "") || (ok && string(v.Bytes()) != c.expected) {
+			t.Errorf("Get(%v): expected %v, got %q (%v)", c.path, c.expected, v.Bytes(), ok)
+		}
+	}
+
+	for offset, expected := range map[int][]any{0: {}, 7: {"a", 0}, 16: {"a", 1, "b"}, 12: {"a", 1}, 8: {"a"}} {
+		path, v, ok := idx.Find(offset)
+		if !ok || !reflect.DeepEqual(path, expected) {
+			t.Errorf("Find(%v): expected %v, got %v (%v)", offset, expected, path, ok)
+		}
+		if ok && (v.first.Start > offset || v.end < offset) {
+			t.Errorf("Find(%v): value %q does not contain the offset", offset, v.Bytes())
+		}
+	}
+	if _, _, ok := idx.Find(len(input)); ok {
+		t.Errorf("Expected no value after the end of the input")
+	}
+
+	if _, err := p.BuildIndex([]byte(`{"a": [}`)); err == nil {
+		t.Errorf("Expected an error for malformed input")
+	}
+}
+
+func TestIndexConcurrentReads(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := range 100 {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(`{"id": 1, "tags": ["a", "b"]}`)
+	}
+	sb.WriteString("]")
+	p := Parser{Filename: "in.json"}
+	idx, err := p.BuildIndex([]byte(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				v, ok := idx.Get((i+g)%100, "id")
+				if !ok {
+					t.Errorf("Missing value for %v", i)
+					return
+				}
+				var id int
+				if err := v.Decode(&id); err != nil || id != 1 {
+					t.Errorf("Unexpected result %v (%v)", id, err)
+				}
+				for tok := range v.Tokenize() {
+					if tok.AsInt() != 1 || tok.Filename() != "in.json" {
+						t.Errorf("Unexpected token %v", tok)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
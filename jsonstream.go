@@ -4,10 +4,13 @@
 package jsonstream
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"iter"
 	"math"
-	"strconv"
+	"regexp"
+	"strings"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -67,8 +70,49 @@ const (
 	ErrorIllegalControlCharInsideString
 	// UTF-8 decoding failing inside a string.
 	ErrorUTF8DecodingErrorInsideString
-	colon = iota
-	comma
+	// Two members of an object have the same key after renaming (see
+	// RenameKeys).
+	ErrorKeyCollision
+	// An include directive could not be processed (see Include).
+	ErrorInclude
+	// A reference could not be resolved (see ResolveReferences).
+	ErrorReference
+	// Arrays and objects are nested more deeply than Parser.MaxDepth permits.
+	ErrorMaxDepthExceeded
+	// A query could not be evaluated (see Query.Run).
+	ErrorQuery
+	// An error reported by a user-defined stage (see NewStageError).
+	ErrorStage
+	// The input uses more resources than Parser.Quota permits.
+	ErrorQuotaExceeded
+	// A value does not have the type required by AssertTypes.
+	ErrorTypeMismatch
+	// An object key is longer than Parser.MaxKeyBytes permits or is rejected
+	// by Parser.ValidateKey.
+	ErrorInvalidKey
+	// The io.Reader given to TokenizeReader returned an error.
+	ErrorRead
+	// The input contains a non-ASCII character and Parser.RequireASCII is set.
+	ErrorNonASCII
+	// A string holding stringified JSON is nested in more such strings than
+	// ExpandOptions.MaxDepth permits (see ExpandStringified).
+	ErrorExpansionDepth
+	// The stringified JSON expanded from a string exceeds
+	// ExpandOptions.MaxBytes (see ExpandStringified).
+	ErrorExpansionSize
+	// A value of a custom type recognized by a TokenHook
+	Extension Kind = iota
+	// An object key (yielded only if Parser.EmitKeyTokens is set). The Value
+	// field holds the key, which is also attached to the following value token.
+	Key
+	// A run of whitespace between tokens (yielded only if
+	// Parser.EmitWhitespace is set). The Value field holds the whitespace.
+	Whitespace
+	// A ':' separator (yielded only by NextRawToken)
+	Colon Kind = iota
+	// A ',' separator (yielded only by NextRawToken)
+	Comma
+	skippedValue // a value skipped by TokenizeSelected
 )
 
 const isError = (1 << 29)
@@ -104,20 +148,175 @@ func (k Kind) String() string {
 		return "Null"
 	case Comment:
 		return "Comment"
-	case colon:
-		return "colon"
-	case comma:
-		return "comma"
+	case Extension:
+		return "Extension"
+	case Key:
+		return "Key"
+	case Whitespace:
+		return "Whitespace"
+	case Colon:
+		return "Colon"
+	case Comma:
+		return "Comma"
 	}
 	return "<unknown Kind>"
 }
 
+// LineTerminatorPolicy determines which character sequences are treated as
+// line terminators when computing the Line and Col fields of tokens.
+type LineTerminatorPolicy int
+
+const (
+	// Only '\n' terminates a line. As "\r\n" ends with '\n', this also gives
+	// the expected line numbers for input with Windows line endings.
+	LineTerminatorLF LineTerminatorPolicy = iota
+	// '\n', "\r\n" and a lone '\r' each terminate a line.
+	LineTerminatorLFOrCR
+	// As for LineTerminatorLFOrCR, but U+2028 (LINE SEPARATOR) and U+2029
+	// (PARAGRAPH SEPARATOR) also terminate a line. These characters can appear
+	// only inside strings and comments.
+	LineTerminatorUnicode
+)
+
+// CommaPolicy determines where a Parser accepts commas in arrays and
+// objects.
+type CommaPolicy int
+
+const (
+	// Commas must separate elements and members, as in standard JSON (unless
+	// Parser.AllowTrailingCommas is set).
+	CommasStrict CommaPolicy = iota
+	// As for CommasStrict, but a comma may follow the last element or member
+	// (as for Parser.AllowTrailingCommas).
+	CommasAllowTrailing
+	// Any number of commas may precede, separate or follow elements and
+	// members. In arrays, each element elided by a leading comma or by
+	// consecutive commas (e.g. the second element of [1,,3]) is yielded as a
+	// Null token positioned at the comma following it, with an empty range
+	// (End is Start - 1). A single trailing comma does not elide an element,
+	// so [1,] has one element. In objects, extra commas are ignored. This
+	// allows data from producers that emit elisions to be salvaged.
+	CommasLenient
+)
+
+// TokenStreamVersion selects a version of the exact token stream produced by
+// Parser.Tokenize. Each version is fixed: the kinds, positions and order of
+// the tokens produced for any given input (including error tokens and the
+// placement of errors) never change for a version, so that tests comparing
+// token sequences do not break when error recovery or position reporting is
+// improved. Improvements that change token sequences are made available only
+// in new versions.
+type TokenStreamVersion int
+
+const (
+	// The original behavior. On lines after the first, columns are one greater
+	// than the 1-based column (e.g. the first character of the second line is
+	// in column 2).
+	TokenStreamV1 TokenStreamVersion = iota
+	// As for TokenStreamV1, except that columns are 1-based on all lines.
+	TokenStreamV2
+)
+
 // Parser is a streaming JSON parser. It is valid when default initialized.
 type Parser struct {
-	AllowComments       bool // Set to true to allow /* */ and // comments in the input
-	AllowTrailingCommas bool // Set to true to allow trailing commas in arrays and objects (does not allow initial commas or multiple commas)
+	AllowComments       bool                   // Set to true to allow /* */ and // comments in the input
+	AllowTrailingCommas bool                   // Set to true to allow trailing commas in arrays and objects (does not allow initial commas or multiple commas; see Commas)
+	AllowMultipleValues bool                   // Set to true to allow a sequence of top-level values (e.g. NDJSON or concatenated JSON)
+	EmitKeyTokens       bool                   // Set to true to yield a token of kind Key (giving the key's position) before each object member
+	EmitWhitespace      bool                   // Set to true to yield a token of kind Whitespace for each run of whitespace, so that only ',' and ':' separators are not covered by tokens
+	LineTerminators     LineTerminatorPolicy   // Determines which character sequences terminate a line (default is '\n' only)
+	Hook                TokenHook              // If non-nil, called to recognize custom syntax before each token is scanned
+	Filename            string                 // The name of the input, if any, used to attribute token positions (see Token.Filename)
+	Version             TokenStreamVersion     // The version of the token stream behavior (default is TokenStreamV1)
+	MaxDepth            int                    // If greater than zero, the maximum nesting depth of arrays and objects (tokenization halts with an error if it is exceeded)
+	MaxKeyBytes         int                    // If greater than zero, the maximum length of a decoded object key in bytes (an error token of kind ErrorInvalidKey precedes each member with a longer key)
+	ValidateKey         func(key []byte) error // If non-nil, called with each decoded object key; if it returns an error, an error token of kind ErrorInvalidKey precedes the member
+	StopAfterFirstValue bool                   // Set to true to stop tokenizing once the first top-level value is complete, leaving any following input unread (see ValueRanges)
+	Commas              CommaPolicy            // Determines where commas are accepted in arrays and objects (default is CommasStrict)
+	MaxErrors           int                    // If greater than zero, the maximum number of error tokens yielded (tokenization halts after yielding the last)
+	Quota               QuotaFunc              // If non-nil, called before each token is yielded to check the resources used (tokenization halts with an error if it fails)
+	JSONSeq             bool                   // Set to true to tokenize a JSON text sequence (RFC 7464), in which each value is preceded by a record separator (0x1E); see Tokenize
+	ExtraWhitespace     string                 // Characters other than space, tab, '\r' and '\n' to treat as whitespace between tokens (default is none, as the JSON standard requires; see UnicodeWhitespace)
+	Messages            func(t Token) string   // If non-nil, called to give the message of each error token in place of its default English message t.ErrorMsg (e.g. to translate it; see MessageCatalog)
+	ReaderBuffer        *ReaderBuffer          // If non-nil, the buffer used by TokenizeReader, which sets the limits of the buffer and is reused by each iteration (default is a new buffer for each iteration)
+	RequireASCII        bool                   // Set to true to require the input to be pure ASCII (an error token of kind ErrorNonASCII precedes each token in which a non-ASCII character appears, counting any preceding whitespace and comments)
 	errors              []Token
 	decodeErrors        []error
+	valueRanges         []ValueRange
+}
+
+// UnicodeWhitespace is a value for Parser.ExtraWhitespace that treats as
+// whitespace the characters that unicode.IsSpace reports as spaces (such as
+// form feed and U+00A0 NO-BREAK SPACE) and U+FEFF, which appears as a byte
+// order mark in the middle of concatenated files. It is useful for salvaging
+// documents produced by generators that emit such characters between tokens.
+// Characters inside strings are unaffected.
+const UnicodeWhitespace = "\v\f\u0085\u00a0\u1680\u2000\u2001\u2002\u2003\u2004\u2005\u2006\u2007\u2008\u2009\u200a\u2028\u2029\u202f\u205f\u3000\ufeff"
+
+// extraWhitespaceLen returns the length of the character in p.ExtraWhitespace
+// with which inp[pos:] begins, or 0 if there is none.
+func (p *Parser) extraWhitespaceLen(inp []byte, pos int) int {
+	if p.ExtraWhitespace == "" {
+		return 0
+	}
+	r, n := utf8.DecodeRune(inp[pos:])
+	if r == utf8.RuneError || !strings.ContainsRune(p.ExtraWhitespace, r) {
+		return 0
+	}
+	return n
+}
+
+// ValueRange gives the position of a top-level value in the input.
+type ValueRange struct {
+	Start int // the byte index of the first byte of the value
+	End   int // the byte index of the last byte of the value
+}
+
+// ValueRanges returns the positions of the top-level values completely
+// tokenized so far by the most recent iteration over the sequence returned by
+// Tokenize. This is useful with AllowMultipleValues for building indexes of
+// files containing many values, or for recording checkpoints for resuming
+// ingestion. The range of a value is recorded once the token following it is
+// requested or the input is exhausted. With StopAfterFirstValue, the input
+// following the first value begins at ValueRanges()[0].End + 1, which is
+// useful for framing protocols in which the caller handles the input
+// following a value.
+func (p *Parser) ValueRanges() []ValueRange {
+	return p.valueRanges
+}
+
+// Errors returns the error tokens yielded so far by the most recent iteration
+// over the sequence returned by Tokenize (or TokenizeSelected). If the
+// consumer stopped iterating early, the errors yielded before it stopped are
+// returned. Errors detected by stages such as Include are not included.
+func (p *Parser) Errors() []Token {
+	return p.errors
+}
+
+// TokenHook is an extension point for recognizing custom syntax (e.g. '#'
+// comments or date literals) without modifying the tokenizer.
+type TokenHook interface {
+	// ScanToken is called at the start of each token (after whitespace has been
+	// skipped) with the full input and the index of the token's first byte. To
+	// recognize a token, it sets tok.Kind (and optionally tok.Value and
+	// tok.ErrorMsg) and returns the number of bytes consumed, which must be
+	// greater than zero. Otherwise, it returns 0 and the input is scanned as
+	// usual. The position fields of the token are set by the parser.
+	//
+	// Tokens of kind Comment are treated as comments even if AllowComments is
+	// false. Tokens of kind Extension are treated as scalar values. Tokens of
+	// other kinds are handled in the same way as the corresponding standard
+	// tokens.
+	ScanToken(inp []byte, pos int, tok *Token) int
+}
+
+// TokenHookFunc is an adapter that allows an ordinary function to be used as
+// a TokenHook.
+type TokenHookFunc func(inp []byte, pos int, tok *Token) int
+
+// ScanToken calls f(inp, pos, tok).
+func (f TokenHookFunc) ScanToken(inp []byte, pos int, tok *Token) int {
+	return f(inp, pos, tok)
 }
 
 // Token represents a JSON token.
@@ -126,20 +325,59 @@ type Token struct {
 	Col      int    // the column of the first character of the token
 	Start    int    // the start position of the token in the input (byte index)
 	End      int    // the end position of the token in the input (byte index)
-	Key      []byte // the key of the token, or nil if none (may be a sub-slice of the input)
+	Key      []byte // the key of the token, or nil if none (may be a sub-slice of the input); ArrayEnd and ObjectEnd tokens have the key of their container
 	Kind     Kind   // the kind of token
 	Value    []byte // the value of the token (may be a sub-slice of the input).
 	ErrorMsg string // error message set if IsError(token.Kind) == true
 	parser   *Parser
+	stage    string // the stage that produced the error (see Token.Stage)
 }
 
 func appendDecodeError(t *Token, err error) {
-	t.parser.decodeErrors = append(t.parser.decodeErrors, err)
+	// Tokens constructed by stages (rather than by Tokenize) may have no
+	// associated Parser.
+	if t.parser != nil {
+		t.parser.decodeErrors = append(t.parser.decodeErrors, err)
+	}
+}
+
+// NumberDecodeError is the decode error recorded by AsInt, AsInt32, AsInt64,
+// AsFloat32 and AsFloat64 when a value cannot be decoded. It gives the
+// position of the token, so that the value can be located in a large
+// document. The reason for the failure can be tested using
+// IsNonIntegerDecodeError and IsOutOfRangeDecodeError.
+type NumberDecodeError struct {
+	Line  int    // the line of the value that could not be decoded
+	Col   int    // the column of the value that could not be decoded
+	Start int    // the byte index of the start of the value in the input
+	Value string // the value
+	Err   error  // the reason for the failure
+}
+
+func (e *NumberDecodeError) Error() string {
+	return fmt.Sprintf("%v:%v cannot decode %v: %v", e.Line, e.Col, e.Value, e.Err)
+}
+
+// Unwrap returns the reason for the failure.
+func (e *NumberDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// appendNumberDecodeError records a NumberDecodeError for the token t.
+func appendNumberDecodeError(t *Token, err error) {
+	appendDecodeError(t, &NumberDecodeError{Line: t.Line, Col: t.Col, Start: t.Start, Value: string(t.Value), Err: err})
 }
 
 func (t Token) String() string {
 	if IsError(t.Kind) {
-		return fmt.Sprintf("%v:%v Error: %v", t.Line, t.Col, t.ErrorMsg)
+		var stage string
+		if t.stage != "" {
+			stage = " (" + t.stage + ")"
+		}
+		if name := t.Filename(); name != "" {
+			return fmt.Sprintf("%v:%v:%v Error%v: %v", name, t.Line, t.Col, stage, t.ErrorMsg)
+		}
+		return fmt.Sprintf("%v:%v Error%v: %v", t.Line, t.Col, stage, t.ErrorMsg)
 	}
 	var key string
 	if len(t.Key) > 0 {
@@ -148,6 +386,17 @@ func (t Token) String() string {
 	return fmt.Sprintf("%v:%v %v %v%s", t.Line, t.Col, t.Kind, key, t.Value)
 }
 
+// Filename returns the Filename of the Parser that produced the token, or the
+// empty string if there is none. The positions of the token are relative to
+// this input. If Filename is non-empty, it is included in the messages of
+// errors.
+func (t Token) Filename() string {
+	if t.parser == nil {
+		return ""
+	}
+	return t.parser.Filename
+}
+
 func (t Token) Error() string {
 	return t.String()
 }
@@ -187,26 +436,80 @@ func (t *Token) KeyAsString() string {
 	return string(t.Key)
 }
 
+// ValueEquals returns true iff the token's value is equal to s. Escape
+// sequences in strings are decoded by the tokenizer (which takes a slice of
+// the input if a string contains no escapes), so no allocation is required.
+// This is useful for dispatching on the value of a string token.
+func (t *Token) ValueEquals(s string) bool {
+	return string(t.Value) == s
+}
+
+// KeyEquals returns true iff the token has an associated object key equal to
+// s. As for ValueEquals, no allocation is required, so this is more
+// efficient than comparing the result of KeyAsString when dispatching on the
+// key of an object member.
+func (t *Token) KeyEquals(s string) bool {
+	return t.Key != nil && string(t.Key) == s
+}
+
+// ValueHasPrefix returns true iff the token's value begins with s. As for
+// ValueEquals, escape sequences have already been decoded and no allocation
+// is required.
+func (t *Token) ValueHasPrefix(s string) bool {
+	return len(t.Value) >= len(s) && string(t.Value[:len(s)]) == s
+}
+
+// ValueHasSuffix returns true iff the token's value ends with s.
+func (t *Token) ValueHasSuffix(s string) bool {
+	return len(t.Value) >= len(s) && string(t.Value[len(t.Value)-len(s):]) == s
+}
+
+// MatchValue returns true iff the token's value contains a match of the
+// regular expression re. As escape sequences have already been decoded, the
+// value is matched in place without allocating a string, which is useful for
+// stages that search or redact many values.
+func (t *Token) MatchValue(re *regexp.Regexp) bool {
+	return re.Match(t.Value)
+}
+
+// ValueContains returns true iff the token's value contains s.
+func (t *Token) ValueContains(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for v := t.Value; len(v) >= len(s); v = v[1:] {
+		i := bytes.IndexByte(v[:len(v)-len(s)+1], s[0])
+		if i == -1 {
+			return false
+		}
+		v = v[i:]
+		if string(v[:len(s)]) == s {
+			return true
+		}
+	}
+	return false
+}
+
 // AsFloat64 returns the token's value as a float64. Its return value is
-// defined only for tokens where Kind == Number. The input is parsed using
-// strconv.ParseFloat. If ParseFloat signals an error, a decode error is added
-// to the associated Parser.
+// defined only for tokens where Kind == Number. The input is parsed as by
+// ParseNumber. If parsing fails, a decode error is added to the associated
+// Parser.
 func (t *Token) AsFloat64() float64 {
-	f, err := strconv.ParseFloat(string(t.Value), 64)
+	f, err := parseNumber(t.Value, 64)
 	if err != nil {
-		appendDecodeError(t, err)
+		appendNumberDecodeError(t, err)
 	}
 	return f
 }
 
 // AsFloat32 returns the token's value as a float32. Its return value is
-// defined only for tokens where Kind == Number. The input is parsed using
-// strconv.ParseFloat. If ParseFloat signals an error, a decode error is added
-// to the associated Parser.
+// defined only for tokens where Kind == Number. The input is parsed as by
+// ParseNumber, but with rounding to float32 precision. If parsing fails, a
+// decode error is added to the associated Parser.
 func (t *Token) AsFloat32() float32 {
-	f, err := strconv.ParseFloat(string(t.Value), 32)
+	f, err := parseNumber(t.Value, 32)
 	if err != nil {
-		appendDecodeError(t, err)
+		appendNumberDecodeError(t, err)
 		return float32(f)
 	}
 	return float32(f)
@@ -232,15 +535,15 @@ func (e intConversionError) Error() string {
 // IsNonIntegerDecodeError Returns true iff a decode error results from an
 // attempt to parse a non-integer numeric value as an integer.
 func IsNonIntegerDecodeError(e error) bool {
-	e, ok := e.(intConversionError)
-	return ok && e == notAnInteger
+	var ice intConversionError
+	return errors.As(e, &ice) && ice == notAnInteger
 }
 
 // IsOutOfRangeDecodeError returns true iff a decode error results from an
 // attempt to parse a numeric value that is out of range.
 func IsOutOfRangeDecodeError(e error) bool {
-	e, ok := e.(intConversionError)
-	return ok && e == outOfRange
+	var ice intConversionError
+	return errors.As(e, &ice) && ice == outOfRange
 }
 
 // Removes the last decode error if it satisfies the predicate. This is useful
@@ -256,7 +559,8 @@ func (p *Parser) PopDecodeErrorIf(predicate func(error) bool) {
 
 // DecodeError returns the first decode error if any, or nil otherwise. A decode
 // error is an error caused by invalid input to AsInt, AsInt32, AsInt64,
-// AsFloat32, or AsFloat64.
+// AsFloat32, or AsFloat64 (a *NumberDecodeError giving the position of the
+// input).
 func (p *Parser) DecodeError() error {
 	if len(p.decodeErrors) == 0 {
 		return nil
@@ -327,13 +631,13 @@ func (t *Token) AsInt64() int64 {
 			}
 			tot -= int64(t.Value[i] - '0')
 			if tot > 0 {
-				appendDecodeError(t, outOfRange)
+				appendNumberDecodeError(t, outOfRange)
 				return math.MinInt64
 			}
 			if i+1 < len(t.Value) {
 				tot *= 10
 				if tot > 0 {
-					appendDecodeError(t, outOfRange)
+					appendNumberDecodeError(t, outOfRange)
 					return math.MinInt64
 				}
 			}
@@ -345,13 +649,13 @@ func (t *Token) AsInt64() int64 {
 			}
 			tot += int64(t.Value[i] - '0')
 			if tot < 0 {
-				appendDecodeError(t, outOfRange)
+				appendNumberDecodeError(t, outOfRange)
 				return math.MaxInt64
 			}
 			if i+1 < len(t.Value) {
 				tot *= 10
 				if tot < 0 {
-					appendDecodeError(t, outOfRange)
+					appendNumberDecodeError(t, outOfRange)
 					return math.MaxInt64
 				}
 			}
@@ -364,19 +668,19 @@ func (t *Token) AsInt64() int64 {
 	// 0-9. In this case we'll still parse it if it's a valid 64-bit float,
 	// is integer valued, and fits in an int (e.g. 1.0, 1.5e3).
 slow_path:
-	f, err := strconv.ParseFloat(string(t.Value), 64)
+	f, err := parseNumber(t.Value, 64)
 	if err != nil {
 		// This should always be an 'out of range' error, given that we know the
 		// syntax is valid.
 		if f >= 9.223372036854776e+18 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MaxInt64
 		}
 		if f <= -9.223372036854776e+18 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MinInt64
 		}
-		appendDecodeError(t, outOfRange)
+		appendNumberDecodeError(t, outOfRange)
 		return int64(f)
 	}
 	if math.Floor(f) == f { // redundant with next check, but makes it possible to give distinct 'out of range' vs. 'not an int' errors
@@ -386,27 +690,27 @@ slow_path:
 		// If we get here, then the parsed value may not exactly correspond to the
 		// written value.
 		if f >= 9223372036854776000 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MaxInt64
 		}
 		if f < -9223372036854776000 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MinInt64
 		}
-		appendDecodeError(t, outOfRange)
+		appendNumberDecodeError(t, outOfRange)
 		return int64(f)
 	}
 
 	rounded := math.Round(f)
 	if rounded >= 9223372036854776000 {
-		appendDecodeError(t, outOfRange)
+		appendNumberDecodeError(t, outOfRange)
 		return math.MaxInt64
 	}
 	if rounded < -9223372036854776000 {
-		appendDecodeError(t, outOfRange)
+		appendNumberDecodeError(t, outOfRange)
 		return math.MinInt64
 	}
-	appendDecodeError(t, notAnInteger)
+	appendNumberDecodeError(t, notAnInteger)
 	return int64(rounded)
 }
 
@@ -424,13 +728,13 @@ func (t *Token) AsInt32() int32 {
 			}
 			tot -= int32(t.Value[i] - '0')
 			if tot > 0 {
-				appendDecodeError(t, outOfRange)
+				appendNumberDecodeError(t, outOfRange)
 				return math.MinInt32
 			}
 			if i+1 < len(t.Value) {
 				tot *= 10
 				if tot > 0 {
-					appendDecodeError(t, outOfRange)
+					appendNumberDecodeError(t, outOfRange)
 					return math.MinInt32
 				}
 			}
@@ -442,13 +746,13 @@ func (t *Token) AsInt32() int32 {
 			}
 			tot += int32(t.Value[i] - '0')
 			if tot < 0 {
-				appendDecodeError(t, outOfRange)
+				appendNumberDecodeError(t, outOfRange)
 				return math.MaxInt32
 			}
 			if i+1 < len(t.Value) {
 				tot *= 10
 				if tot < 0 {
-					appendDecodeError(t, outOfRange)
+					appendNumberDecodeError(t, outOfRange)
 					return math.MaxInt32
 				}
 			}
@@ -461,16 +765,16 @@ func (t *Token) AsInt32() int32 {
 	// 0-9. In this case we'll still parse it if it's a valid 64-bit float,
 	// is integer valued, and fits in an int (e.g. 1.0, 1.5e3).
 slow_path:
-	f, err := strconv.ParseFloat(string(t.Value), 64)
+	f, err := parseNumber(t.Value, 64)
 	if err != nil {
 		// This should always be an 'out of range' error, given that we know the
 		// syntax is valid.
 		if f >= 2.1474836e+09 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MaxInt32
 		}
 		if f <= -2.1474836e+09 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MinInt32
 		}
 		return int32(f)
@@ -478,11 +782,11 @@ slow_path:
 	if math.Floor(f) == f { // redundant with next check, but makes it possible to give distinct 'out of range' vs. 'not an int' errors
 		if f >= -float64ExactIntMax && f <= float64ExactIntMax {
 			if f > float64(math.MaxInt32) {
-				appendDecodeError(t, outOfRange)
+				appendNumberDecodeError(t, outOfRange)
 				return math.MaxInt32
 			}
 			if f < float64(math.MinInt32) {
-				appendDecodeError(t, outOfRange)
+				appendNumberDecodeError(t, outOfRange)
 				return math.MinInt32
 			}
 			return int32(f)
@@ -490,11 +794,11 @@ slow_path:
 		// If we get here, then the parsed value may not exactly correspond to the
 		// written value.
 		if f >= 2.1474836e+09 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MaxInt32
 		}
 		if f <= -2.1474836e+09 {
-			appendDecodeError(t, outOfRange)
+			appendNumberDecodeError(t, outOfRange)
 			return math.MinInt32
 		}
 		return int32(f)
@@ -502,17 +806,58 @@ slow_path:
 
 	f = math.Round(f)
 	if f > float64(math.MaxInt32) {
-		appendDecodeError(t, outOfRange)
+		appendNumberDecodeError(t, outOfRange)
 		return math.MaxInt32
 	}
 	if f < float64(math.MinInt32) {
-		appendDecodeError(t, outOfRange)
+		appendNumberDecodeError(t, outOfRange)
 		return math.MinInt32
 	}
-	appendDecodeError(t, notAnInteger)
+	appendNumberDecodeError(t, notAnInteger)
 	return int32(f)
 }
 
+// checkKey returns a message giving the reason that an object key is rejected
+// by p.MaxKeyBytes or p.ValidateKey, or the empty string if it is accepted.
+func (p *Parser) checkKey(key []byte) string {
+	if p.MaxKeyBytes > 0 && len(key) > p.MaxKeyBytes {
+		return fmt.Sprintf("Key is longer than %v bytes", p.MaxKeyBytes)
+	}
+	if p.ValidateKey != nil {
+		if err := p.ValidateKey(key); err != nil {
+			return "Invalid key: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// checkASCII implements Parser.RequireASCII for the tokenizer, yielding an
+// error token of kind ErrorNonASCII for the first non-ASCII character (if any)
+// in the input scanned since the state st had the given position, line and
+// line start. The positions are relative to the whole input, of which buf
+// begins at index st.base. It returns false if iteration should stop.
+func (p *Parser) checkASCII(yield func(Token) bool, buf []byte, st *rawTokenizeState, from, line, lineStart int) bool {
+	for i := from - st.base; i < st.pos; i++ {
+		if buf[i] < utf8.RuneSelf {
+			if n := lineTerminatorLen(p.LineTerminators, buf, i); n > 0 {
+				line++
+				lineStart = st.base + i + n - 1 + st.lineStartAdjust
+			}
+			continue
+		}
+		r, n := utf8.DecodeRune(buf[i:st.pos])
+		msg := fmt.Sprintf("Non-ASCII character %U", r)
+		if r == utf8.RuneError && n == 1 {
+			msg = fmt.Sprintf("Non-ASCII byte 0x%02X", buf[i])
+		}
+		err := mkErr(ErrorNonASCII, line, st.base+i-lineStart+1, msg)
+		err.Start, err.End = st.base+i, st.base+i+n-1
+		err.parser = p
+		return yield(err)
+	}
+	return true
+}
+
 func mkErr(errorKind Kind, line, col int, msg string) Token {
 	return Token{
 		Kind:     errorKind,
@@ -525,28 +870,176 @@ func mkErr(errorKind Kind, line, col int, msg string) Token {
 // a non-nil empty byte slice
 var notNilEmptyByteSlice = []byte{}
 
-// Tokenize returns an iter.Seq[Token] from a byte slice input.
+// Tokenize returns an iter.Seq[Token] from a byte slice input. Each iteration
+// over the sequence tokenizes the input from the beginning. If the consumer
+// stops iterating early, ValueRanges and Errors give the values and errors
+// tokenized before it stopped.
+//
+// If p.JSONSeq is set, the input is a JSON text sequence (RFC 7464): each
+// record begins with a record separator (0x1E) and contains a single value.
+// The records are tokenized separately, so that a truncated or malformed
+// record yields error tokens but does not prevent the following records from
+// being tokenized. Input before the first record separator is tokenized as a
+// record, and empty records are ignored. AllowMultipleValues does not apply.
+//
+// Tokenization does not allocate per token, provided that no Hook is set and
+// that strings and keys contain no escape sequences (their values are then
+// sub-slices of the input): each iteration makes a fixed number of
+// allocations, whatever the size of the input. Decoding numbers with
+// AsFloat64 does not allocate unless a decode error is recorded.
 func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
+	return p.tokenize(inp, nil)
+}
+
+// tokenize implements Tokenize. If sel is non-nil, values that it does not
+// keep are skipped (see TokenizeSelected). Each iteration over the returned
+// sequence tokenizes the input from the beginning.
+func (p *Parser) tokenize(inp []byte, sel *pathSelector) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		if sel != nil {
+			sel.stack = sel.stack[:0]
+		}
+		p.run(yield, func(yield func(Token) bool) {
+			if p.JSONSeq {
+				p.tokenizeRecords(inp, sel, yield)
+			} else {
+				p.tokenizer(inp, sel, p.newRawTokenizeState())(yield)
+			}
+		})
+	}
+}
+
+// run calls tokenize to yield the tokens of a single iteration, recording
+// errors and applying p.Quota, p.MaxErrors and p.Messages to the tokens
+// before yielding them.
+func (p *Parser) run(yield func(Token) bool, tokenize func(yield func(Token) bool)) {
+	p.errors = nil
+	p.valueRanges = nil
+	var usage Usage
+	tokenize(func(t Token) bool {
+		if p.Quota != nil && !IsError(t.Kind) {
+			usage.add(t)
+			if err := p.Quota(usage); err != nil {
+				t = Token{Line: t.Line, Col: t.Col, Start: t.Start, End: t.End, Kind: ErrorQuotaExceeded, ErrorMsg: err.Error(), parser: p}
+				p.localizeError(&t)
+				p.errors = append(p.errors, t)
+				yield(t)
+				return false
+			}
+		}
+		if !IsError(t.Kind) {
+			return yield(t)
+		}
+		p.localizeError(&t)
+		p.errors = append(p.errors, t)
+		return yield(t) && (p.MaxErrors <= 0 || len(p.errors) < p.MaxErrors)
+	})
+}
+
+// recordSeparator is the byte that begins each text of a JSON text sequence
+// (RFC 7464).
+const recordSeparator = 0x1E
+
+// tokenizeRecords tokenizes each record of a JSON text sequence (see
+// Parser.JSONSeq), yielding the tokens to yield.
+func (p *Parser) tokenizeRecords(inp []byte, sel *pathSelector, yield func(Token) bool) {
+	halted := false
+	yieldRecord := func(t Token) bool {
+		halted = !yield(t)
+		return !halted
+	}
+	st := p.newRawTokenizeState()
+	for {
+		end := len(inp)
+		if i := bytes.IndexByte(inp[st.pos:], recordSeparator); i >= 0 {
+			end = st.pos + i
+		}
+		// Each record is tokenized as a separate input, but the input is
+		// truncated rather than sliced so that positions are unchanged.
+		rst := *st
+		if sel != nil {
+			sel.stack = sel.stack[:0]
+		}
+		p.tokenizer(inp[:end], sel, &rst)(yieldRecord)
+		if halted || end == len(inp) || (p.StopAfterFirstValue && len(p.valueRanges) > 0) {
+			return
+		}
+		for st.pos <= end {
+			if n := lineTerminatorLen(p.LineTerminators, inp, st.pos); n > 0 {
+				st.pos += n - 1
+				st.line++
+				st.lineStart = st.pos + st.lineStartAdjust
+			}
+			st.pos++
+		}
+	}
+}
+
+// newRawTokenizeState returns the state for tokenizing an input from its
+// beginning.
+func (p *Parser) newRawTokenizeState() *rawTokenizeState {
 	st := &rawTokenizeState{
 		pos:           0,
 		lineStart:     0,
 		line:          1,
 		nextMustBeSep: false,
 	}
+	if p.Version >= TokenStreamV2 {
+		st.lineStartAdjust = 1
+	}
+	return st
+}
+
+// tokenizer returns a function that tokenizes the input from the position
+// given by st, yielding the tokens to its argument. It holds the state of a
+// single iteration.
+func (p *Parser) tokenizer(inp []byte, sel *pathSelector, st *rawTokenizeState) func(yield func(Token) bool) {
+	return p.tokenizerFrom(nil, inp, sel, st)
+}
 
+// tokenizerFrom is like tokenizer, but if src is non-nil, the raw tokens are
+// read from src (which updates st) rather than scanned from inp. (A func
+// value is not used for this, since the token would then escape to the
+// heap.)
+func (p *Parser) tokenizerFrom(src *readerSource, inp []byte, sel *pathSelector, st *rawTokenizeState) func(yield func(Token) bool) {
 	var haltedOnComment bool
 
+	raw := func(t *Token) bool {
+		if src != nil {
+			return src.next(t)
+		}
+		return rawTokenize(p, st, inp, t)
+	}
+	// checkASCII yields an error token if p.RequireASCII is set and the input
+	// scanned since the state had the given position, line and line start
+	// (relative to the whole input) contains a non-ASCII character, returning
+	// false if iteration should stop.
+	checkASCII := func(yield func(Token) bool, from, line, lineStart int) bool {
+		if !p.RequireASCII {
+			return true
+		}
+		buf := inp
+		if src != nil {
+			buf = src.buf
+		}
+		return p.checkASCII(yield, buf, st, from, line, lineStart)
+	}
 	next := func(yield func(Token) bool) (t Token, ok bool) {
-		if !p.AllowComments {
-			ok = rawTokenize(p, st, inp, &t)
+		if !p.AllowComments && p.Hook == nil && !p.EmitWhitespace && !p.RequireASCII {
+			ok = raw(&t)
 			return
 		}
 		for {
-			ok = rawTokenize(p, st, inp, &t)
+			from, line, lineStart := st.base+st.pos, st.line, st.base+st.lineStart
+			ok = raw(&t)
+			if (!ok || !IsError(t.Kind)) && !checkASCII(yield, from, line, lineStart) {
+				ok = false
+				return
+			}
 			if !ok {
 				return
 			}
-			if t.Kind != Comment {
+			if t.Kind != Whitespace && (t.Kind != Comment || (!p.AllowComments && !st.hookToken)) {
 				return
 			}
 			if !yield(t) {
@@ -559,17 +1052,49 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 		}
 	}
 
-	var tokArray func(yield func(Token) bool) bool
-	var tokObject func(yield func(Token) bool) bool
+	// The key argument of tokArray and tokObject is the key of the container
+	// being tokenized (nil if it is not an object member), which is attached to
+	// its end token.
+	var tokArray func(yield func(Token) bool, key []byte) bool
+	var tokObject func(yield func(Token) bool, key []byte) bool
+
+	// yieldError yields an error token unless the consumer halted on a comment.
+	yieldError := func(yield func(Token) bool, errorKind Kind, line, col int, msg string) bool {
+		if haltedOnComment {
+			return true
+		}
+		err := mkErr(errorKind, line, col, msg)
+		err.parser = p
+		return yield(err)
+	}
+
+	allowTrailingCommas := p.AllowTrailingCommas || p.Commas >= CommasAllowTrailing
+
+	// yieldStart yields the ArrayStart or ObjectStart token t, or an error if
+	// this would exceed p.MaxDepth. The caller calls endContainer once the
+	// container has been tokenized.
+	depth := 0
+	yieldStart := func(yield func(Token) bool, t Token) bool {
+		depth++
+		if sel != nil {
+			sel.push()
+		}
+		if p.MaxDepth > 0 && depth > p.MaxDepth {
+			yieldError(yield, ErrorMaxDepthExceeded, t.Line, t.Col, "Maximum nesting depth exceeded")
+			return false
+		}
+		return yield(t)
+	}
+	endContainer := func() {
+		depth--
+		if sel != nil {
+			sel.pop()
+		}
+	}
 
 	main := func(yield func(Token) bool) {
 		yieldErr := func(errorKind Kind, line, col int, msg string) bool {
-			if !haltedOnComment {
-				err := mkErr(errorKind, line, col, msg)
-				p.errors = append(p.errors, err)
-				return yield(err)
-			}
-			return true
+			return yieldError(yield, errorKind, line, col, msg)
 		}
 
 		for i := 0; ; i++ {
@@ -578,86 +1103,121 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 				return
 			}
 
-			if i > 0 {
+			if i > 0 && (!p.AllowMultipleValues || p.JSONSeq) {
 				yieldErr(ErrorTrailingInput, t.Line, t.Col, "Trailing input")
 				return
 			}
 
+			if sel != nil {
+				sel.pending = sel.root
+			}
+
 			switch t.Kind {
 			case ObjectStart:
-				if !yield(t) {
+				if !yieldStart(yield, t) {
 					return
 				}
-				if !tokObject(yield) {
+				if !tokObject(yield, nil) {
 					return
 				}
+				endContainer()
+				p.valueRanges = append(p.valueRanges, ValueRange{t.Start, st.base + st.pos - 1})
 			case ArrayStart:
-				if !yield(t) {
+				if !yieldStart(yield, t) {
 					return
 				}
-				if !tokArray(yield) {
+				if !tokArray(yield, nil) {
 					return
 				}
-			case ObjectEnd, ArrayEnd, comma, colon:
-				if !yieldErr(ErrorUnexpectedToken, t.Line, t.Col, "Unexpected token") {
+				endContainer()
+				p.valueRanges = append(p.valueRanges, ValueRange{t.Start, st.base + st.pos - 1})
+			case ObjectEnd, ArrayEnd, Comma, Colon:
+				if !yieldErr(ErrorUnexpectedToken, t.Line, t.Col, "Unexpected token") || p.AllowMultipleValues {
 					return
 				}
 			default:
 				if !yield(t) {
 					return
 				}
+				if isValueKind(t.Kind) {
+					p.valueRanges = append(p.valueRanges, ValueRange{t.Start, t.End})
+				}
+			}
+
+			if p.StopAfterFirstValue && len(p.valueRanges) > 0 {
+				return
 			}
 		}
 	}
 
-	tokArray = func(yield func(Token) bool) bool {
+	tokArray = func(yield func(Token) bool, key []byte) bool {
 		yieldErr := func(errorKind Kind, line, col int, msg string) bool {
-			if !haltedOnComment {
-				return yield(mkErr(errorKind, line, col, msg))
-			}
-			return true
+			return yieldError(yield, errorKind, line, col, msg)
 		}
 
 		afterCommaLine := -1
 		afterCommaCol := -1
-		for {
-			valtok, ok := next(yield)
+		for index := 0; ; index++ {
+			var valtok Token
+			var ok bool
+			keep := sel == nil || sel.keep(index, nil)
+			from, line, lineStart := st.base+st.pos, st.line, st.base+st.lineStart
+			if !keep && skipRawValue(p, st, inp) {
+				if !checkASCII(yield, from, line, lineStart) {
+					return false
+				}
+				valtok.Kind, ok = skippedValue, true
+			} else {
+				valtok, ok = next(yield)
+			}
 			if !ok {
 				yieldErr(ErrorUnexpectedEOF, valtok.Line, valtok.Col, "Unexpected EOF (expected closing ']')")
 				return false
 			}
 
 			if valtok.Kind == ArrayEnd {
-				if afterCommaLine != -1 && !p.AllowTrailingCommas {
+				if afterCommaLine != -1 && !allowTrailingCommas {
 					if !yieldErr(ErrorTrailingComma, afterCommaLine, afterCommaCol, "Trailing ','") {
 						return false
 					}
 				}
+				valtok.Key = key
 				return yield(valtok)
 			}
 
 			switch valtok.Kind {
 			case ArrayStart:
-				if !yield(valtok) {
+				if !yieldStart(yield, valtok) {
 					return false
 				}
-				if !tokArray(yield) {
+				if !tokArray(yield, nil) {
 					return false
 				}
+				endContainer()
 			case ObjectStart:
-				if !yield(valtok) {
+				if !yieldStart(yield, valtok) {
 					return false
 				}
-				if !tokObject(yield) {
+				if !tokObject(yield, nil) {
 					return false
 				}
-			case String, Number, True, False, Null, ErrorLeadingZerosNotPermitted:
+				endContainer()
+			case String, Number, True, False, Null, Extension, ErrorLeadingZerosNotPermitted:
 				if !yield(valtok) {
 					return false
 				}
-			case comma:
+			case skippedValue:
+			case Comma:
 				afterCommaLine = valtok.Line
 				afterCommaCol = valtok.Col
+				if p.Commas == CommasLenient {
+					// an elided element
+					if keep && !yield(Token{Kind: Null, Line: valtok.Line, Col: valtok.Col, Start: valtok.Start, End: valtok.Start - 1, parser: p}) {
+						return false
+					}
+					continue
+				}
+				index--
 				if !yieldErr(ErrorUnexpectedComma, valtok.Line, valtok.Col, "Unexpected ',' inside array") {
 					return false
 				}
@@ -675,9 +1235,10 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 			}
 
 			if t.Kind == ArrayEnd {
+				t.Key = key
 				return yield(t)
 			}
-			if t.Kind != comma {
+			if t.Kind != Comma {
 				if !yieldErr(ErrorUnexpectedToken, t.Line, t.Col, "Unexpected token inside array (expecting ',')") {
 					return false
 				}
@@ -687,12 +1248,9 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 		}
 	}
 
-	tokObject = func(yield func(Token) bool) bool {
+	tokObject = func(yield func(Token) bool, key []byte) bool {
 		yieldErr := func(errorKind Kind, line, col int, msg string) bool {
-			if !haltedOnComment {
-				return yield(mkErr(errorKind, line, col, msg))
-			}
-			return true
+			return yieldError(yield, errorKind, line, col, msg)
 		}
 
 		afterCommaLine := -1
@@ -705,16 +1263,22 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 			}
 
 			if keytok.Kind == ObjectEnd {
-				if afterCommaLine != -1 && !p.AllowTrailingCommas {
+				if afterCommaLine != -1 && !allowTrailingCommas {
 					if !yieldErr(ErrorTrailingComma, afterCommaLine, afterCommaCol, "Trailing ','") {
 						return false
 					}
 				}
+				keytok.Key = key
 				return yield(keytok)
 			}
 
+			if keytok.Kind == Comma && p.Commas == CommasLenient {
+				afterCommaLine = keytok.Line
+				afterCommaCol = keytok.Col
+				continue
+			}
 			if keytok.Kind != String {
-				if keytok.Kind == comma {
+				if keytok.Kind == Comma {
 					if !yieldErr(ErrorUnexpectedComma, keytok.Line, keytok.Col, "Unexpected ',' inside object (expecting key)") {
 						return false
 					}
@@ -725,15 +1289,41 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 				}
 				keytok.Value = notNilEmptyByteSlice // error recovery; set empty key
 			}
+			if keytok.Kind == String && !haltedOnComment {
+				if msg := p.checkKey(keytok.Value); msg != "" {
+					err := mkErr(ErrorInvalidKey, keytok.Line, keytok.Col, msg)
+					err.Start, err.End = keytok.Start, keytok.End
+					err.parser = p
+					if !yield(err) {
+						return false
+					}
+				}
+			}
+			skip := sel != nil && !sel.keep(-1, keytok.Value)
+			if keytok.Kind == String && p.EmitKeyTokens && !skip {
+				keytok.Kind = Key
+				if !yield(keytok) {
+					return false
+				}
+			}
 
 			t, ok := next(yield)
-			if !ok || t.Kind != colon {
+			if !ok || t.Kind != Colon {
 				if !yieldErr(ErrorUnexpectedToken, t.Line, t.Col, "Unexpected token inside object (expecting ':')") {
 					return false
 				}
 			}
 
-			valtok, ok := next(yield)
+			var valtok Token
+			from, line, lineStart := st.base+st.pos, st.line, st.base+st.lineStart
+			if skip && skipRawValue(p, st, inp) {
+				if !checkASCII(yield, from, line, lineStart) {
+					return false
+				}
+				valtok.Kind, ok = skippedValue, true
+			} else {
+				valtok, ok = next(yield)
+			}
 			if !ok {
 				yieldErr(ErrorUnexpectedEOF, t.Line, t.Col, "Unexpected EOF")
 				return false
@@ -750,23 +1340,26 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 
 			switch valtok.Kind {
 			case ArrayStart:
-				if !yield(valtok) {
+				if !yieldStart(yield, valtok) {
 					return false
 				}
-				if !tokArray(yield) {
+				if !tokArray(yield, valtok.Key) {
 					return false
 				}
+				endContainer()
 			case ObjectStart:
-				if !yield(valtok) {
+				if !yieldStart(yield, valtok) {
 					return false
 				}
-				if !tokObject(yield) {
+				if !tokObject(yield, valtok.Key) {
 					return false
 				}
-			case String, Number, True, False, Null, ErrorLeadingZerosNotPermitted:
+				endContainer()
+			case String, Number, True, False, Null, Extension, ErrorLeadingZerosNotPermitted:
 				if !yield(valtok) {
 					return false
 				}
+			case skippedValue:
 			default:
 				if !yieldErr(ErrorUnexpectedToken, t.Line, t.Col, "Unexpected token inside object") {
 					return false
@@ -780,9 +1373,10 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 			}
 
 			if t.Kind == ObjectEnd {
+				t.Key = key
 				return yield(t)
 			}
-			if t.Kind != comma {
+			if t.Kind != Comma {
 				if !yieldErr(ErrorUnexpectedToken, t.Line, t.Col, "Unexpected token") {
 					return false
 				}
@@ -792,20 +1386,21 @@ func (p *Parser) Tokenize(inp []byte) iter.Seq[Token] {
 		}
 	}
 
-	return func(yield func(Token) bool) {
-		main(yield)
-	}
+	return main
 }
 
 type rawTokenizeState struct {
 	pos, lineStart, line int
+	base                 int // the index in the whole input of the input being scanned (nonzero only for TokenizeReader)
+	lineStartAdjust      int // added to the index of a line terminator to give lineStart
 	nextMustBeSep        bool
+	hookToken            bool // the last token was produced by a TokenHook
 }
 
 func rawTokenize(p *Parser, st *rawTokenizeState, inp []byte, out *Token) bool {
 	addErr := func(errorKind Kind, line, col int, msg string) Token {
 		err := mkErr(errorKind, line, col, msg)
-		p.errors = append(p.errors, err)
+		err.parser = p
 		return err
 	}
 
@@ -818,26 +1413,87 @@ func rawTokenize(p *Parser, st *rawTokenizeState, inp []byte, out *Token) bool {
 		case ' ', '\r', '\n', '\t', '/', ':', ',', '[', ']', '{', '}':
 			st.nextMustBeSep = false
 		default:
+			if p.extraWhitespaceLen(inp, st.pos) > 0 {
+				st.nextMustBeSep = false
+				break
+			}
 			st.pos++
 			*out = addErr(ErrorUnexpectedCharacter, st.line, st.pos-1-st.lineStart+1, "Unexpected character")
 			return true
 		}
 	}
 
+	wsStart, wsLine, wsCol := st.pos, st.line, st.pos-st.lineStart+1
 wsLoop:
-	for {
+	for st.pos < len(inp) {
 		switch inp[st.pos] {
+		case '\r':
+			if p.LineTerminators != LineTerminatorLF && (st.pos+1 >= len(inp) || inp[st.pos+1] != '\n') {
+				st.line++
+				st.lineStart = st.pos + st.lineStartAdjust
+			}
+			st.pos++
 		case '\n':
 			st.line++
-			st.lineStart = st.pos
+			st.lineStart = st.pos + st.lineStartAdjust
 			fallthrough
-		case ' ', '\r', '\t':
+		case ' ', '\t':
 			st.pos++
-			if st.pos >= len(inp) {
-				return false
-			}
 		default:
-			break wsLoop
+			n := p.extraWhitespaceLen(inp, st.pos)
+			if n == 0 {
+				break wsLoop
+			}
+			if lineTerminatorLen(p.LineTerminators, inp, st.pos) > 0 {
+				st.line++
+				st.lineStart = st.pos + n - 1 + st.lineStartAdjust
+			}
+			st.pos += n
+		}
+	}
+	if p.EmitWhitespace && st.pos > wsStart {
+		*out = Token{
+			Line:   wsLine,
+			Col:    wsCol,
+			Start:  wsStart,
+			End:    st.pos - 1,
+			Kind:   Whitespace,
+			Value:  inp[wsStart:st.pos],
+			parser: p,
+		}
+		return true
+	}
+	if st.pos >= len(inp) {
+		return false
+	}
+
+	st.hookToken = false
+	if p.Hook != nil {
+		// The hook is given a separate token, so that out does not escape to
+		// the heap when no hook is set.
+		var hookTok Token
+		if n := p.Hook.ScanToken(inp, st.pos, &hookTok); n > 0 {
+			*out = hookTok
+			start := st.pos
+			startLine := st.line
+			startCol := st.pos - st.lineStart + 1
+			st.pos += n
+			for i := start; i < st.pos; i++ {
+				if n := lineTerminatorLen(p.LineTerminators, inp, i); n > 0 {
+					i += n - 1
+					st.line++
+					st.lineStart = i + st.lineStartAdjust
+				}
+			}
+			st.hookToken = true
+			st.nextMustBeSep = out.Kind != Comment && out.Kind != String
+			out.parser = p
+			out.Line = startLine
+			out.Col = startCol
+			out.Start = start
+			out.End = st.pos - 1
+			out.Key = nil
+			return true
 		}
 	}
 
@@ -859,18 +1515,20 @@ wsLoop:
 					*out = addErr(ErrorUnexpectedEOF, st.line, st.pos-st.lineStart+1, "Unexpected EOF inside comment")
 					return true
 				}
-				if inp[st.pos] == '\n' {
+				if n := lineTerminatorLen(p.LineTerminators, inp, st.pos); n > 0 {
+					st.pos += n - 1
 					st.line++
-					st.lineStart = st.pos
-					st.pos++
+					st.lineStart = st.pos + st.lineStartAdjust
 				} else if inp[st.pos] == '*' {
-					st.pos++
-					if st.pos >= len(inp) {
+					if st.pos+1 >= len(inp) {
+						st.pos++
 						*out = addErr(ErrorUnexpectedEOF, st.line, st.pos-st.lineStart+1, "Unexpected EOF inside /* ... */ comment")
 						return true
 					}
-					if inp[st.pos] == '/' {
-						st.pos++
+					// If the '*' is not followed by '/', the following character is
+					// examined on the next iteration.
+					if inp[st.pos+1] == '/' {
+						st.pos += 2
 						out.parser = p
 						out.Line = startLine
 						out.Col = startCol
@@ -891,8 +1549,29 @@ wsLoop:
 					*out = addErr(ErrorUnexpectedEOF, st.line, st.pos-st.lineStart+1, "Unexpected EOF inside // comment")
 					return true
 				}
+				if (inp[st.pos] == '\r' && p.LineTerminators != LineTerminatorLF) || (inp[st.pos] == '\n' && p.EmitWhitespace) {
+					// Leave the line terminator to be consumed as whitespace.
+					out.parser = p
+					out.Line = startLine
+					out.Col = startCol
+					out.Start = start
+					out.End = st.pos - 1
+					out.Key = nil
+					out.Kind = Comment
+					out.Value = inp[start:st.pos]
+					out.ErrorMsg = ""
+					return true
+				}
+				if inp[st.pos] == 0xE2 && p.LineTerminators == LineTerminatorUnicode {
+					if n := lineTerminatorLen(p.LineTerminators, inp, st.pos); n > 0 {
+						st.pos += n - 1
+						st.line++
+						st.lineStart = st.pos + st.lineStartAdjust
+						continue
+					}
+				}
 				if inp[st.pos] == '\n' {
-					st.lineStart = st.pos
+					st.lineStart = st.pos + st.lineStartAdjust
 					st.pos++
 					st.line++
 
@@ -920,7 +1599,7 @@ wsLoop:
 		out.Start = st.pos
 		out.End = st.pos
 		out.Key = nil
-		out.Kind = colon
+		out.Kind = Colon
 		out.Value = nil
 		out.ErrorMsg = ""
 		st.pos++
@@ -932,7 +1611,7 @@ wsLoop:
 		out.Start = st.pos
 		out.End = st.pos
 		out.Key = nil
-		out.Kind = comma
+		out.Kind = Comma
 		out.Value = nil
 		out.ErrorMsg = ""
 		st.pos++
@@ -1119,6 +1798,7 @@ wsLoop:
 		return true
 	case '"':
 		start := st.pos
+		startLine := st.line
 		startCol := st.pos - st.lineStart + 1
 		st.pos++
 		var val []byte
@@ -1136,7 +1816,7 @@ wsLoop:
 				}
 				st.pos++
 				out.parser = p
-				out.Line = st.line
+				out.Line = startLine
 				out.Col = startCol
 				out.Start = start
 				out.End = st.pos - 1
@@ -1234,6 +1914,10 @@ wsLoop:
 					sz = 1
 				} else {
 					r, sz = utf8.DecodeRune(inp[st.pos:])
+					if (r == '\u2028' || r == '\u2029') && p.LineTerminators == LineTerminatorUnicode {
+						st.line++
+						st.lineStart = st.pos + sz - 1 + st.lineStartAdjust
+					}
 				}
 
 				// DEL is permitted according to
@@ -1270,6 +1954,27 @@ wsLoop:
 	}
 }
 
+// lineTerminatorLen returns the length in bytes of the line terminator
+// starting at inp[pos] under the given policy, or 0 if there is no line
+// terminator at inp[pos]. The '\r' of a "\r\n" sequence is not itself
+// considered to be a line terminator.
+func lineTerminatorLen(policy LineTerminatorPolicy, inp []byte, pos int) int {
+	switch inp[pos] {
+	case '\n':
+		return 1
+	case '\r':
+		if policy != LineTerminatorLF && (pos+1 >= len(inp) || inp[pos+1] != '\n') {
+			return 1
+		}
+	case 0xE2:
+		// U+2028 and U+2029 are encoded as E2 80 A8 and E2 80 A9.
+		if policy == LineTerminatorUnicode && pos+2 < len(inp) && inp[pos+1] == 0x80 && (inp[pos+2] == 0xA8 || inp[pos+2] == 0xA9) {
+			return 3
+		}
+	}
+	return 0
+}
+
 func hexVal(d byte) int {
 	if d >= '0' && d <= '9' {
 		return int(d) - '0'
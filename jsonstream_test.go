@@ -3,8 +3,12 @@ package jsonstream
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"math"
+	"regexp"
 	"strings"
 	"testing"
 	"unicode/utf8"
@@ -157,7 +161,7 @@ func TestTokenize(t *testing.T) {
 {1:25 Error: Leading zeros not permitted in numbers}
 {1:30 Number 3}
 {1:33 Number 0e2}
-{1:36 ArrayEnd }
+{1:36 ArrayEnd bar=}
 {1:37 ObjectEnd }
 `
 
@@ -491,6 +495,176 @@ func TestTrailingInput(t *testing.T) {
 	})
 }
 
+func TestLineTerminators(t *testing.T) {
+	positions := func(p *Parser, input string) string {
+		var sb strings.Builder
+		for tok := range p.Tokenize([]byte(input)) {
+			sb.WriteString(fmt.Sprintf("%v:%v %v\n", tok.Line, tok.Col, tok.Kind))
+		}
+		return sb.String()
+	}
+
+	const mixedInput = "[1,\r\n2,\r3,\n4,\r\n\r\n 5]"
+
+	t.Run("LF only", func(t *testing.T) {
+		var p Parser
+		const expected = "1:1 ArrayStart\n1:2 Number\n2:2 Number\n2:5 Number\n3:2 Number\n5:3 Number\n5:4 ArrayEnd\n"
+		if out := positions(&p, mixedInput); out != expected {
+			t.Errorf("Expected\n%v\ngot\n%v", expected, out)
+		}
+	})
+
+	t.Run("LF or CR", func(t *testing.T) {
+		p := Parser{LineTerminators: LineTerminatorLFOrCR}
+		const expected = "1:1 ArrayStart\n1:2 Number\n2:2 Number\n3:2 Number\n4:2 Number\n6:3 Number\n6:4 ArrayEnd\n"
+		if out := positions(&p, mixedInput); out != expected {
+			t.Errorf("Expected\n%v\ngot\n%v", expected, out)
+		}
+	})
+
+	t.Run("CRLF and LF give the same positions", func(t *testing.T) {
+		p := Parser{LineTerminators: LineTerminatorLFOrCR, AllowComments: true}
+		const lf = "{\n  \"a\": 1, // comment\n  /* multi\n line */ \"b\": [\n true\n ]\n}\n"
+		crlf := strings.ReplaceAll(lf, "\n", "\r\n")
+		if positions(&p, lf) != positions(&p, crlf) {
+			t.Errorf("Expected identical positions, got\n%v\nand\n%v", positions(&p, lf), positions(&p, crlf))
+		}
+	})
+
+	t.Run("line comments terminated by CR do not include the CR", func(t *testing.T) {
+		p := Parser{LineTerminators: LineTerminatorLFOrCR, AllowComments: true}
+		for tok := range p.Tokenize([]byte("[// foo\r\n1]")) {
+			if tok.Kind == Comment && string(tok.Value) != "// foo" {
+				t.Errorf("Unexpected comment value %q", tok.Value)
+			}
+			if IsError(tok.Kind) {
+				t.Errorf("Unexpected error %v", tok)
+			}
+		}
+	})
+
+	t.Run("lone CR inside a block comment", func(t *testing.T) {
+		p := Parser{LineTerminators: LineTerminatorLFOrCR, AllowComments: true}
+		const expected = "1:1 Comment\n3:7 Number\n"
+		if out := positions(&p, "/* a\r\rb */ 1"); out != expected {
+			t.Errorf("Expected\n%v\ngot\n%v", expected, out)
+		}
+	})
+
+	t.Run("Unicode line separators", func(t *testing.T) {
+		const input = "[\"a\u2028b\u2029c\", 1]"
+		p := Parser{LineTerminators: LineTerminatorUnicode}
+		const expected = "1:1 ArrayStart\n1:2 String\n3:6 Number\n3:7 ArrayEnd\n"
+		if out := positions(&p, input); out != expected {
+			t.Errorf("Expected\n%v\ngot\n%v", expected, out)
+		}
+		p = Parser{LineTerminators: LineTerminatorLFOrCR}
+		if out := positions(&p, input); !strings.HasPrefix(out, "1:1 ArrayStart\n1:2 String\n1:") {
+			t.Errorf("Expected U+2028 and U+2029 to be ignored, got\n%v", out)
+		}
+	})
+}
+
+func TestBlockComments(t *testing.T) {
+	for _, input := range []string{"/**/ 1", "/***/ 1", "/* a **/ 1", "/*\n*/ 1", "/* * / */ 1"} {
+		p := Parser{AllowComments: true}
+		var kinds []Kind
+		for tok := range p.Tokenize([]byte(input)) {
+			kinds = append(kinds, tok.Kind)
+		}
+		if len(kinds) != 2 || kinds[0] != Comment || kinds[1] != Number {
+			t.Errorf("Unexpected tokens for %q: %v", input, kinds)
+		}
+	}
+}
+
+func TestKindValues(t *testing.T) {
+	// Kinds added after the original ones must not change the values of the
+	// original ones.
+	if Comment != 9 || ErrorTrailingInput != 10|isError || ErrorUTF8DecodingErrorInsideString != 21|isError {
+		t.Errorf("Unexpected kind values %d %d %d", Comment, ErrorTrailingInput&^isError, ErrorUTF8DecodingErrorInsideString&^isError)
+	}
+	if Extension <= ErrorUTF8DecodingErrorInsideString&^isError || Key <= Extension || Whitespace <= Key {
+		t.Errorf("Expected Extension, Key and Whitespace to follow the error kinds")
+	}
+}
+
+func TestTokenHook(t *testing.T) {
+	// Recognizes '#' comments and date literals of the form @2006-01-02.
+	hook := TokenHookFunc(func(inp []byte, pos int, tok *Token) int {
+		switch inp[pos] {
+		case '#':
+			end := bytes.IndexByte(inp[pos:], '\n')
+			if end == -1 {
+				end = len(inp) - pos
+			}
+			tok.Kind = Comment
+			tok.Value = inp[pos : pos+end]
+			return end
+		case '@':
+			if pos+11 > len(inp) {
+				tok.Kind = ErrorUnexpectedEOF
+				tok.ErrorMsg = "Unexpected EOF in date literal"
+				return len(inp) - pos
+			}
+			tok.Kind = Extension
+			tok.Value = inp[pos+1 : pos+11]
+			return 11
+		}
+		return 0
+	})
+
+	t.Run("custom comments and literals", func(t *testing.T) {
+		const input = "# leading comment\n{\"a\": @2024-01-02, # trailing\n \"b\": [1, @1999-12-31]}"
+		const expected = `
+{1:1 Comment # leading comment}
+{2:2 ObjectStart }
+{2:8 Extension a=2024-01-02}
+{2:21 Comment # trailing}
+{3:8 ArrayStart b=}
+{3:9 Number 1}
+{3:12 Extension 1999-12-31}
+{3:23 ArrayEnd b=}
+{3:24 ObjectEnd }
+`
+		p := Parser{Hook: hook}
+		var sb strings.Builder
+		for tok := range p.Tokenize([]byte(input)) {
+			sb.WriteString(fmt.Sprintf("{%v}\n", tok))
+		}
+		if strings.TrimSpace(sb.String()) != strings.TrimSpace(expected) {
+			t.Errorf("Expected %v, got %v", expected, sb.String())
+		}
+	})
+
+	t.Run("standard comments are still rejected unless allowed", func(t *testing.T) {
+		p := Parser{Hook: hook}
+		if succeedsWith(&p, "[1, /* no */ 2]") {
+			t.Errorf("Expected to fail")
+		}
+		p = Parser{Hook: hook, AllowComments: true}
+		if !succeedsWith(&p, "[1, /* yes */ 2 # yes\n]") {
+			t.Errorf("Expected to succeed")
+		}
+	})
+
+	t.Run("errors from hooks", func(t *testing.T) {
+		p := Parser{Hook: hook}
+		if succeedsWith(&p, "[@2024]") {
+			t.Errorf("Expected to fail")
+		}
+	})
+}
+
+func succeedsWith(p *Parser, inp string) bool {
+	for t := range p.Tokenize([]byte(inp)) {
+		if IsError(t.Kind) {
+			return false
+		}
+	}
+	return true
+}
+
 const allowComments = 0
 const disallowComments = 1
 
@@ -540,6 +714,260 @@ func succeedsAllowingTrailingCommas(inp string) bool {
 	return true
 }
 
+func TestKeyTokens(t *testing.T) {
+	p := Parser{EmitKeyTokens: true}
+	var got []string
+	for tok := range p.Tokenize([]byte("{\"a\": 1,\n \"b\\n\": {\"c\": []}}")) {
+		got = append(got, fmt.Sprintf("%v %q %v:%v %v-%v", tok.Kind, tok.Value, tok.Line, tok.Col, tok.Start, tok.End))
+	}
+	expected := []string{
+		`ObjectStart "" 1:1 0-0`,
+		`Key "a" 1:2 1-3`,
+		`Number "1" 1:7 6-6`,
+		`Key "b\n" 2:3 10-14`,
+		`ObjectStart "" 2:10 17-17`,
+		`Key "c" 2:11 18-20`,
+		`ArrayStart "" 2:16 23-23`,
+		`ArrayEnd "" 2:17 24-24`,
+		`ObjectEnd "" 2:18 25-25`,
+		`ObjectEnd "" 2:19 26-26`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).WriteAll(p.Tokenize([]byte(`{"a": {"b": [1]}}`))); err != nil || buf.String() != `{"a":{"b":[1]}}` {
+		t.Errorf("Expected Writer to ignore Key tokens, got %v (error %v)", buf.String(), err)
+	}
+}
+
+func TestEndTokenKeys(t *testing.T) {
+	var p Parser
+	var got []string
+	for tok := range p.Tokenize([]byte(`{"a": [{"b": {}}, []], "c": {"d": []}}`)) {
+		if tok.Kind == ObjectStart || tok.Kind == ObjectEnd || tok.Kind == ArrayStart || tok.Kind == ArrayEnd {
+			got = append(got, fmt.Sprintf("%v %q", tok.Kind, tok.Key))
+		}
+	}
+	expected := []string{
+		`ObjectStart ""`,
+		`ArrayStart "a"`,
+		`ObjectStart ""`,
+		`ObjectStart "b"`,
+		`ObjectEnd "b"`,
+		`ObjectEnd ""`,
+		`ArrayStart ""`,
+		`ArrayEnd ""`,
+		`ArrayEnd "a"`,
+		`ObjectStart "c"`,
+		`ArrayStart "d"`,
+		`ArrayEnd "d"`,
+		`ObjectEnd "c"`,
+		`ObjectEnd ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestWhitespaceTokens(t *testing.T) {
+	const input = " \n{\"a\" : [1,\t2] , // c\n \"b\":null}\r\n "
+	p := Parser{AllowComments: true, EmitWhitespace: true, EmitKeyTokens: true}
+	covered := make([]bool, len(input))
+	var ws []string
+	for tok := range p.Tokenize([]byte(input)) {
+		if IsError(tok.Kind) {
+			t.Fatalf("Unexpected error %v", tok)
+		}
+		if tok.Kind == Whitespace {
+			ws = append(ws, fmt.Sprintf("%v:%v %q", tok.Line, tok.Col, tok.Value))
+			if string(tok.Value) != input[tok.Start:tok.End+1] {
+				t.Errorf("Value %q does not match range %v-%v", tok.Value, tok.Start, tok.End)
+			}
+		}
+		for i := tok.Start; i <= tok.End; i++ {
+			covered[i] = true
+		}
+	}
+	for i, c := range covered {
+		if !c && input[i] != ',' && input[i] != ':' {
+			t.Errorf("Byte %v (%q) not covered by any token", i, input[i])
+		}
+	}
+	expected := []string{`1:1 " \n"`, `2:6 " "`, `2:8 " "`, `2:12 "\t"`, `2:15 " "`, `2:17 " "`, `2:22 "\n "`, `3:12 "\r\n "`}
+	if strings.Join(ws, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected whitespace tokens %v, got %v", strings.Join(expected, ", "), strings.Join(ws, ", "))
+	}
+
+	var strict Parser
+	strict.EmitWhitespace = true
+	if !succeedsWith(&strict, "  [1, 2]  ") || succeedsWith(&strict, "  [1, 2]  3") {
+		t.Errorf("Expected whitespace tokens not to affect validation")
+	}
+}
+
+func TestTokenStreamVersions(t *testing.T) {
+	const input = "[1,\n2,\r\n 3, /* a\nb */ \"x\u2028y\", \n  true]"
+	positions := func(version TokenStreamVersion, policy LineTerminatorPolicy) string {
+		p := Parser{Version: version, LineTerminators: policy, AllowComments: true}
+		var out []string
+		for tok := range p.Tokenize([]byte(input)) {
+			out = append(out, fmt.Sprintf("%v:%v", tok.Line, tok.Col))
+		}
+		return strings.Join(out, " ")
+	}
+
+	cases := []struct {
+		version  TokenStreamVersion
+		policy   LineTerminatorPolicy
+		expected string
+	}{
+		{TokenStreamV1, LineTerminatorLF, "1:1 1:2 2:2 3:3 3:6 4:7 5:4 5:8"},
+		{TokenStreamV2, LineTerminatorLF, "1:1 1:2 2:1 3:2 3:5 4:6 5:3 5:7"},
+		{TokenStreamV2, LineTerminatorUnicode, "1:1 1:2 2:1 3:2 3:5 4:6 6:3 6:7"},
+	}
+	for _, c := range cases {
+		if got := positions(c.version, c.policy); got != c.expected {
+			t.Errorf("For version %v and policy %v expected %v, got %v", c.version, c.policy, c.expected, got)
+		}
+	}
+}
+
+func TestValueAndKeyEquals(t *testing.T) {
+	var p Parser
+	var tokens []Token
+	for tok := range p.Tokenize([]byte(`{"plain": "abc", "esc\u0061ped": "a\"b", "": ""}`)) {
+		tokens = append(tokens, tok)
+	}
+	cases := []struct {
+		tok        Token
+		key, value string
+	}{
+		{tokens[1], "plain", "abc"},
+		{tokens[2], "escaped", `a"b`},
+		{tokens[3], "", ""},
+	}
+	for _, c := range cases {
+		if !c.tok.KeyEquals(c.key) || !c.tok.ValueEquals(c.value) {
+			t.Errorf("Expected key %q and value %q, got %v", c.key, c.value, c.tok)
+		}
+		if c.tok.KeyEquals(c.key+"x") || c.tok.ValueEquals(c.value+"x") {
+			t.Errorf("Unexpected equality for %v", c.tok)
+		}
+	}
+	if tokens[0].KeyEquals("") {
+		t.Errorf("Expected KeyEquals to be false for a token with no key")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if !tokens[2].KeyEquals("escaped") || !tokens[2].ValueEquals(`a"b`) {
+			t.Fatal("Unexpected inequality")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+func TestValuePredicates(t *testing.T) {
+	var p Parser
+	var tok Token
+	for tok = range p.Tokenize([]byte(`"caf\u00e9 au lait \"special\""`)) {
+	}
+	const value = `café au lait "special"`
+	for _, s := range []string{"", "c", "café", "café au", value, "x", "cafe", value + " "} {
+		if got := tok.ValueHasPrefix(s); got != strings.HasPrefix(value, s) {
+			t.Errorf("ValueHasPrefix(%q) returned %v", s, got)
+		}
+	}
+	for _, s := range []string{"", `"`, `special"`, value, "special", " " + value} {
+		if got := tok.ValueHasSuffix(s); got != strings.HasSuffix(value, s) {
+			t.Errorf("ValueHasSuffix(%q) returned %v", s, got)
+		}
+	}
+	for _, s := range []string{"", "é", "au l", `"special"`, value, "spec ial", "ll", `""`, " " + value} {
+		if got := tok.ValueContains(s); got != strings.Contains(value, s) {
+			t.Errorf("ValueContains(%q) returned %v", s, got)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if !tok.ValueHasPrefix("café") || !tok.ValueHasSuffix(`"`) || !tok.ValueContains("lait") {
+			t.Fatal("Unexpected result")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+func TestMatchValue(t *testing.T) {
+	var p Parser
+	var tokens []Token
+	for tok := range p.Tokenize([]byte(`["card 4111-1111", "n\u006f match", "tab\there"]`)) {
+		tokens = append(tokens, tok)
+	}
+	re := regexp.MustCompile(`\d{4}-\d{4}|^no|\t`)
+	for i, expected := range []bool{true, true, true} {
+		if tokens[i+1].MatchValue(re) != expected {
+			t.Errorf("Unexpected result for %v", tokens[i+1])
+		}
+	}
+	if tokens[1].MatchValue(regexp.MustCompile(`^\d`)) {
+		t.Errorf("Unexpected match")
+	}
+
+	tokens[1].MatchValue(re)
+	allocs := testing.AllocsPerRun(100, func() {
+		tokens[1].MatchValue(re)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	inputs := []string{`[1,]`, `{"a" 1}`, `[01, 02`, `"\x"`, `[1, tru]`, "[\"a\n\"]", `[/* c */ 1,,]`, `[1]`}
+	for _, input := range inputs {
+		p := Parser{AllowComments: true}
+		var yielded []Token
+		for tok := range p.Tokenize([]byte(input)) {
+			if IsError(tok.Kind) {
+				yielded = append(yielded, tok)
+			}
+		}
+		if fmt.Sprint(p.Errors()) != fmt.Sprint(yielded) {
+			t.Errorf("For %s expected errors %v, got %v", input, yielded, p.Errors())
+		}
+	}
+
+	t.Run("early termination", func(t *testing.T) {
+		var p Parser
+		tokens := p.Tokenize([]byte(`[1,, 2]`))
+		for tok := range tokens {
+			if IsError(tok.Kind) {
+				break
+			}
+		}
+		if len(p.Errors()) != 1 || p.Errors()[0].ErrorMsg != "Unexpected ',' inside array" {
+			t.Errorf("Unexpected errors %v", p.Errors())
+		}
+
+		// Iterating again starts from the beginning.
+		var got []Kind
+		for tok := range tokens {
+			got = append(got, tok.Kind)
+			if len(got) == 2 {
+				break
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint([]Kind{ArrayStart, Number}) || len(p.Errors()) != 0 {
+			t.Errorf("Unexpected tokens %v and errors %v", got, p.Errors())
+		}
+	})
+}
+
 func TestAsInt64(t *testing.T) {
 	t.Run("simple case", func(t *testing.T) {
 		var p Parser
@@ -603,6 +1031,58 @@ func TestAsInt64(t *testing.T) {
 	})
 }
 
+func TestDecodeErrorPositions(t *testing.T) {
+	var p Parser
+	for tok := range p.Tokenize([]byte("[1,\n 2.5, 1e999]")) {
+		if tok.Kind == Number {
+			tok.AsInt32()
+			tok.AsFloat64()
+		}
+	}
+	errs := p.DecodeErrors()
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 decode errors, got %v", errs)
+	}
+	var de *NumberDecodeError
+	if !errors.As(errs[0], &de) || de.Line != 2 || de.Col != 3 || de.Start != 5 || de.Value != "2.5" || !IsNonIntegerDecodeError(errs[0]) {
+		t.Errorf("Unexpected error %+v", errs[0])
+	}
+	if !IsOutOfRangeDecodeError(errs[1]) || errs[1].Error() != "2:8 cannot decode 1e999: out of range" {
+		t.Errorf("Unexpected error %v", errs[1])
+	}
+	if !errors.As(errs[2], &de) || de.Start != 10 || errs[2].Error() != p.LastDecodeError().Error() {
+		t.Errorf("Unexpected error %v", errs[2])
+	}
+}
+
+func TestJSONSeq(t *testing.T) {
+	p := NewParser(WithJSONSeq())
+	cases := map[string]string{
+		"\x1e{\"a\": 1}\n\x1e[2]\n": `{"a":1},[2]`,
+		"\x1e{\"a\": 1\n\x1e[2]\n":  `{"a":1,<error: Unexpected EOF>,[2]`,
+		"\x1e1 2\n\x1e3\n":          `1,<error: Trailing input>,3`,
+		"\x1e\n\x1e\x1etrue":        `true`,
+		"null\n\x1e\"ab":            `null,<error: Unexpected EOF in string>`,
+		"":                          ``,
+	}
+	for input, expected := range cases {
+		if got := compactJSON(p.Tokenize([]byte(input))); got != expected {
+			t.Errorf("For %q expected %v, got %v", input, expected, got)
+		}
+	}
+
+	var positions []string
+	for tok := range p.Tokenize([]byte("\x1e[1,\n2]\n\x1e\n  3\n")) {
+		positions = append(positions, fmt.Sprintf("%v:%v@%v", tok.Line, tok.Col, tok.Start))
+	}
+	if fmt.Sprint(positions) != "[1:2@1 1:3@2 2:2@5 2:3@6 4:4@12]" {
+		t.Errorf("Unexpected positions %v", positions)
+	}
+	if fmt.Sprint(p.ValueRanges()) != "[{1 6} {12 12}]" {
+		t.Errorf("Unexpected value ranges %v", p.ValueRanges())
+	}
+}
+
 func TestSurrogatePairs(t *testing.T) {
 	t.Run("treble clef from RFC8259", func(t *testing.T) {
 		const input = `"\uD834\uDD1E"`
@@ -727,3 +1207,58 @@ func TestFuzz(t *testing.T) {
 		}
 	})
 }
+
+// compactJSON renders a token sequence as compact JSON text for use in test
+// assertions. Error tokens are rendered as <error: msg> and comments are
+// omitted.
+func compactJSON(tokens iter.Seq[Token]) string {
+	var sb strings.Builder
+	first := []bool{true}
+	for t := range tokens {
+		if t.Kind == Comment {
+			continue
+		}
+		if t.Kind == ArrayEnd || t.Kind == ObjectEnd {
+			if len(first) > 1 {
+				first = first[:len(first)-1]
+			}
+			if t.Kind == ArrayEnd {
+				sb.WriteByte(']')
+			} else {
+				sb.WriteByte('}')
+			}
+			continue
+		}
+		if !first[len(first)-1] {
+			sb.WriteByte(',')
+		}
+		first[len(first)-1] = false
+		if t.Key != nil {
+			kb, _ := json.Marshal(string(t.Key))
+			sb.Write(kb)
+			sb.WriteByte(':')
+		}
+		switch t.Kind {
+		case ArrayStart:
+			sb.WriteByte('[')
+			first = append(first, true)
+		case ObjectStart:
+			sb.WriteByte('{')
+			first = append(first, true)
+		case String:
+			vb, _ := json.Marshal(string(t.Value))
+			sb.Write(vb)
+		case Number, Extension:
+			sb.Write(t.Value)
+		case True:
+			sb.WriteString("true")
+		case False:
+			sb.WriteString("false")
+		case Null:
+			sb.WriteString("null")
+		default:
+			sb.WriteString(fmt.Sprintf("<error: %v>", t.ErrorMsg))
+		}
+	}
+	return sb.String()
+}
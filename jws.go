@@ -0,0 +1,46 @@
+package jsonstream
+
+import (
+	"encoding/base64"
+	"hash"
+	"io"
+	"iter"
+)
+
+// JWSSigner specifies how SignDetached signs a document.
+type JWSSigner struct {
+	Alg  string                           // the "alg" header parameter (e.g. "HS256" or "RS256")
+	Hash hash.Hash                        // hashes the signing input (e.g. hmac.New(sha256.New, key) for HS256, or sha256.New() for RS256)
+	Sign func(sum []byte) ([]byte, error) // if non-nil, computes the signature from the sum of Hash (e.g. using rsa.SignPKCS1v15); otherwise the sum is the signature
+}
+
+// SignDetached writes the canonical encoding of the given tokens (as for
+// HashTokens) to w and returns a JSON Web Signature over it in the compact
+// serialization with a detached payload: a string of the form
+// "<header>..<signature>". The payload is unencoded (RFC 7797), so that it is
+// hashed as it is written rather than being base64-encoded, and so the
+// document is never held in memory. The header is
+// {"alg":<Alg>,"b64":false,"crit":["b64"]}. The recipient verifies the
+// signature over the header, a '.' and the bytes written to w. If the tokens
+// contain an error or the write fails, the error is returned and no signature
+// is computed.
+func SignDetached(w io.Writer, tokens iter.Seq[Token], s JWSSigner) (string, error) {
+	header := appendQuotedString([]byte(`{"alg":`), []byte(s.Alg))
+	header = append(header, `,"b64":false,"crit":["b64"]}`...)
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+
+	s.Hash.Reset()
+	s.Hash.Write([]byte(encodedHeader + "."))
+	if err := NewWriter(io.MultiWriter(w, s.Hash)).WriteAll(tokens); err != nil {
+		return "", err
+	}
+
+	sig := s.Hash.Sum(nil)
+	if s.Sign != nil {
+		var err error
+		if sig, err = s.Sign(sig); err != nil {
+			return "", err
+		}
+	}
+	return encodedHeader + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
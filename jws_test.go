@@ -0,0 +1,70 @@
+package jsonstream
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSignDetached(t *testing.T) {
+	key := []byte("secret")
+	var p Parser
+	var payload bytes.Buffer
+	jws, err := SignDetached(&payload, p.Tokenize([]byte(`{"a": [1, 2], "b": "x"}`)), JWSSigner{Alg: "HS256", Hash: hmac.New(sha256.New, key)})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if payload.String() != `{"a":[1,2],"b":"x"}` {
+		t.Errorf("Unexpected payload %v", payload.String())
+	}
+
+	header, sig, ok := strings.Cut(jws, "..")
+	if !ok {
+		t.Fatalf("Expected a detached payload, got %v", jws)
+	}
+	if header != "eyJhbGciOiJIUzI1NiIsImI2NCI6ZmFsc2UsImNyaXQiOlsiYjY0Il19" {
+		t.Errorf("Unexpected header %v", header)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(header + "." + payload.String()))
+	if sig != base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Unexpected signature %v", sig)
+	}
+
+	t.Run("with a signing function", func(t *testing.T) {
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload bytes.Buffer
+		signer := JWSSigner{Alg: "RS256", Hash: sha256.New(), Sign: func(sum []byte) ([]byte, error) {
+			return rsa.SignPKCS1v15(nil, priv, crypto.SHA256, sum)
+		}}
+		jws, err := SignDetached(&payload, p.Tokenize([]byte(`[true]`)), signer)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		header, sig, _ := strings.Cut(jws, "..")
+		decoded, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(header + "." + payload.String()))
+		if rsa.VerifyPKCS1v15(&priv.PublicKey, crypto.SHA256, sum[:], decoded) != nil {
+			t.Errorf("Signature %v does not verify", sig)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var payload bytes.Buffer
+		if _, err := SignDetached(&payload, p.Tokenize([]byte(`[1,`)), JWSSigner{Alg: "HS256", Hash: hmac.New(sha256.New, key)}); err == nil {
+			t.Errorf("Expected an error for malformed input")
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// Mapping is a compiled mapping specification (see CompileMapping).
+type Mapping struct {
+	rules   []mappingRule
+	members []*mappingTarget // the members of the output object, in order
+}
+
+type mappingRule struct {
+	from    []any    // the pattern matched against the paths of the input
+	collect bool     // whether the target ends with [] (collecting every match)
+	coerce  bool     // whether to apply the coercion given by to
+	to      Coercion // the coercion applied to matching values
+}
+
+// mappingTarget is a member of the output object, which either receives the
+// values of a rule or is an object with further members.
+type mappingTarget struct {
+	key     string
+	rule    int // the index of the rule, or -1 for an object
+	members []*mappingTarget
+}
+
+// MappingError is returned by CompileMapping if the specification is invalid.
+type MappingError struct {
+	Line int    // the line of the specification at which the error was found
+	Col  int    // the column (in bytes) at which the error was found
+	Msg  string // a description of the error
+}
+
+func (e *MappingError) Error() string {
+	return fmt.Sprintf("jsonstream: invalid mapping at %v:%v: %v", e.Line, e.Col, e.Msg)
+}
+
+var mappingCoercions = map[string]Coercion{
+	"string":  CoerceToString,
+	"number":  CoerceToNumber,
+	"bool":    CoerceToBool,
+	"rfc3339": CoerceEpochToRFC3339,
+	"epoch":   CoerceRFC3339ToEpoch,
+}
+
+// CompileMapping compiles a mapping specification, which reshapes each
+// top-level value in the input into an object whose members are taken from
+// the value. This is useful for remapping records without writing a custom
+// stage. A specification consists of lines of the form
+//
+//	source -> target
+//	source -> target as coercion
+//
+// where source is a path within the value, written using the path steps of
+// CompileQuery (e.g. .user.name, .items[0] or .tags[]), and target is the
+// member of the output object that receives the value, written as a sequence
+// of keys (e.g. .name or ."user id".first). The output member is the first
+// value matching source, or if target ends with [], an array of every value
+// matching source. The optional coercion converts the value as for Coerce,
+// and is one of string, number, bool, rfc3339 (CoerceEpochToRFC3339) or
+// epoch (CoerceRFC3339ToEpoch). Blank lines and lines beginning with # are
+// ignored. For example:
+//
+//	# Flatten a user record.
+//	.user.name     -> .name
+//	.user.age      -> .age as number
+//	.user.emails[] -> .contact.emails[]
+//	.created       -> .created as rfc3339
+//
+// Each target must be different, and no target may be nested within another.
+func CompileMapping(spec string) (*Mapping, error) {
+	m := &Mapping{}
+	for i, line := range strings.Split(spec, "\n") {
+		if s := strings.TrimSpace(line); s == "" || s[0] == '#' {
+			continue
+		}
+		if err := m.compileRule(line); err != nil {
+			qe := err.(*QueryError)
+			if qe.Offset >= len(line) {
+				qe.Msg = strings.Replace(qe.Msg, "end of query", "end of line", 1)
+			}
+			return nil, &MappingError{Line: i + 1, Col: qe.Offset + 1, Msg: qe.Msg}
+		}
+	}
+	return m, nil
+}
+
+// compileRule adds the rule given by a line of a mapping specification. It
+// returns a *QueryError giving the offset of any error in the line.
+func (m *Mapping) compileRule(line string) error {
+	qp := queryParser{src: strings.TrimRight(line, "\r")}
+	from, err := qp.parsePath()
+	if err != nil {
+		return err
+	}
+	if err := qp.expect("->"); err != nil {
+		return err
+	}
+	qp.skipSpace()
+	targetStart := qp.pos
+	to, err := qp.parsePath()
+	if err != nil {
+		return err
+	}
+	rule := mappingRule{from: from}
+	if n := len(to); n > 0 && to[n-1] == (Wildcard{}) {
+		rule.collect = true
+		to = to[:n-1]
+	}
+	if len(to) == 0 {
+		qp.pos = targetStart
+		return qp.errorf("Target must have at least one key")
+	}
+	if qp.eatWord("as") {
+		qp.skipSpace()
+		start := qp.pos
+		name := qp.ident()
+		if rule.to, rule.coerce = mappingCoercions[name]; !rule.coerce {
+			qp.pos = start
+			return qp.errorf("Unknown coercion %q", name)
+		}
+	}
+	qp.skipSpace()
+	if qp.pos < len(qp.src) {
+		return qp.unexpected()
+	}
+
+	members := &m.members
+	for i, step := range to {
+		key, ok := step.(string)
+		if !ok {
+			qp.pos = targetStart
+			return qp.errorf("Target must consist only of keys")
+		}
+		var target *mappingTarget
+		for _, t := range *members {
+			if t.key == key {
+				target = t
+			}
+		}
+		last := i == len(to)-1
+		if target != nil && (last || target.rule >= 0) {
+			qp.pos = targetStart
+			return qp.errorf("Target conflicts with an earlier target")
+		}
+		if target == nil {
+			target = &mappingTarget{key: key, rule: -1}
+			if last {
+				target.rule = len(m.rules)
+			}
+			*members = append(*members, target)
+		}
+		members = &target.members
+	}
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// parsePath parses a sequence of path steps as for CompileQuery, returning it
+// as a pattern (see PathMatches).
+func (qp *queryParser) parsePath() ([]any, error) {
+	qp.skipSpace()
+	start := qp.pos
+	n, err := qp.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if n, path := splitQueryPrefix(n); n.op == queryIdentity {
+		return path, nil
+	}
+	qp.pos = start
+	return nil, qp.errorf("Expected a path")
+}
+
+// Run reshapes each top-level value in the input as given by the mapping,
+// yielding an object for each. The values selected by the mapping are copied
+// with their original positions and are the only tokens that are buffered.
+// Members whose sources match no value are omitted, as are objects whose
+// members are all omitted. If a value cannot be coerced, it is copied
+// unchanged and a *CoercionError is added to the decode errors of the
+// associated Parser (see Parser.DecodeErrors). If the input contains an
+// error, the error is yielded and iteration stops. Comments, Key tokens and
+// Whitespace tokens are discarded.
+func (m *Mapping) Run(tokens iter.Seq[Token]) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		type capture struct {
+			rule  int // the rule whose last captured value is being buffered
+			depth int // the depth at which the value started
+		}
+		var pt pathTracker
+		var active []capture
+		captured := make([][][]Token, len(m.rules)) // the values matching each rule
+		depth := 0
+		for t := range tokens {
+			if IsError(t.Kind) {
+				yield(t)
+				return
+			}
+			path := pt.next(t)
+			if !isValueKind(t.Kind) && !isContainerEnd(t.Kind) {
+				continue
+			}
+
+			for _, c := range active {
+				v := &captured[c.rule][len(captured[c.rule])-1]
+				*v = append(*v, t)
+			}
+			if isValueKind(t.Kind) {
+				for i, r := range m.rules {
+					if (!r.collect && len(captured[i]) > 0) || !PathMatches(path, r.from) {
+						continue
+					}
+					v := t
+					if r.coerce && t.Kind != Null {
+						if err := coerceToken(&v, r.to); err != nil {
+							err.Path = path
+							appendDecodeError(&v, err)
+						}
+					}
+					captured[i] = append(captured[i], []Token{v})
+					active = append(active, capture{rule: i, depth: depth})
+				}
+			}
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+			active = slices.DeleteFunc(active, func(c capture) bool { return c.depth >= depth })
+
+			if depth == 0 {
+				ok := yield(Token{Kind: ObjectStart}) &&
+					m.emit(m.members, captured, yield) &&
+					yield(Token{Kind: ObjectEnd})
+				if !ok {
+					return
+				}
+				for i := range captured {
+					captured[i] = captured[i][:0]
+				}
+			}
+		}
+	}
+}
+
+// emit yields the given members of an output object, returning false if
+// iteration should stop.
+func (m *Mapping) emit(members []*mappingTarget, captured [][][]Token, yield func(Token) bool) bool {
+	for _, target := range members {
+		key := []byte(target.key)
+		if target.rule < 0 {
+			if !hasMappedValues(target.members, captured) {
+				continue
+			}
+			if !yield(Token{Kind: ObjectStart, Key: key}) ||
+				!m.emit(target.members, captured, yield) ||
+				!yield(Token{Kind: ObjectEnd, Key: key}) {
+				return false
+			}
+			continue
+		}
+
+		r := m.rules[target.rule]
+		values := captured[target.rule]
+		if len(values) == 0 {
+			continue
+		}
+		if r.collect && !yield(Token{Kind: ArrayStart, Key: key}) {
+			return false
+		}
+		for _, v := range values {
+			for i, t := range v {
+				if i == 0 || i == len(v)-1 {
+					t.Key = key
+					if r.collect {
+						t.Key = nil
+					}
+				}
+				if !yield(t) {
+					return false
+				}
+			}
+		}
+		if r.collect && !yield(Token{Kind: ArrayEnd, Key: key}) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasMappedValues reports whether any of the given members of an output
+// object have values.
+func hasMappedValues(members []*mappingTarget, captured [][][]Token) bool {
+	for _, target := range members {
+		if target.rule >= 0 && len(captured[target.rule]) > 0 || target.rule < 0 && hasMappedValues(target.members, captured) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package jsonstream
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMapping(t *testing.T) {
+	const spec = `
+		# Flatten user records.
+		.user.name      -> .name
+		.user.age       -> .age as number
+		.user.emails[]  -> .contact.emails[]
+		.user.phone     -> .contact.phone
+		.created        -> .created as rfc3339
+		.tags           -> .labels
+		."user id"      -> ."ID"
+	`
+	const input = `
+		{"user": {"name": "Ann", "age": "41", "emails": ["a@x.org", "ann@y.org"]}, "created": 0, "tags": ["a", {"b": 1}], "user id": 7}
+		{"created": 1.5, "user": {"phone": "555", "name": "Bob"}}
+		[]
+	`
+	m, err := CompileMapping(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Parser{AllowMultipleValues: true}
+	got := strings.Join(splitTopLevel(m.Run(p.Tokenize([]byte(input)))), "\n")
+	expected := strings.Join([]string{
+		`{"name":"Ann","age":41,"contact":{"emails":["a@x.org","ann@y.org"]},"created":"1970-01-01T00:00:00Z","labels":["a",{"b":1}],"ID":7}`,
+		`{"name":"Bob","contact":{"phone":"555"},"created":"1970-01-01T00:00:01.5Z"}`,
+		`{}`,
+	}, "\n")
+	if got != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, got)
+	}
+	if err := p.DecodeError(); err != nil {
+		t.Errorf("Unexpected decode error %v", err)
+	}
+}
+
+func TestMappingPositions(t *testing.T) {
+	m, err := CompileMapping(".a[1] -> .x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Parser
+	var got []Token
+	for tok := range m.Run(p.Tokenize([]byte(`{"a": [1, 2]}`))) {
+		got = append(got, tok)
+	}
+	if len(got) != 3 || got[1].Kind != Number || got[1].KeyAsString() != "x" || got[1].Line != 1 || got[1].Col != 11 || got[1].Start != 10 {
+		t.Errorf("Unexpected tokens %v", got)
+	}
+}
+
+func TestMappingCoercionError(t *testing.T) {
+	m, err := CompileMapping(".n -> .n as number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Parser
+	got := strings.Join(splitTopLevel(m.Run(p.Tokenize([]byte(`{"n": "abc"}`)))), "\n")
+	if got != `{"n":"abc"}` {
+		t.Errorf("Unexpected output %v", got)
+	}
+	var ce *CoercionError
+	if !errors.As(p.DecodeError(), &ce) || ce.Value != "abc" || ce.To != CoerceToNumber {
+		t.Errorf("Unexpected decode error %v", p.DecodeError())
+	}
+}
+
+func TestMappingInputError(t *testing.T) {
+	m, err := CompileMapping(".a -> .b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Parser
+	var last Token
+	for tok := range m.Run(p.Tokenize([]byte(`{"a": 1, }`))) {
+		last = tok
+	}
+	if !IsError(last.Kind) {
+		t.Errorf("Expected an error token, got %v", last)
+	}
+}
+
+func TestCompileMappingErrors(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected string
+	}{
+		{`.a => .b`, `jsonstream: invalid mapping at 1:4: Unexpected '='`},
+		{"\n.a ->", `jsonstream: invalid mapping at 2:6: Unexpected end of line`},
+		{".a -> .b\n.c -> .b", `jsonstream: invalid mapping at 2:7: Target conflicts with an earlier target`},
+		{".a -> .b\n.c -> .b.c", `jsonstream: invalid mapping at 2:7: Target conflicts with an earlier target`},
+		{".a -> .b.c\n.c -> .b", `jsonstream: invalid mapping at 2:7: Target conflicts with an earlier target`},
+		{`.a -> .`, `jsonstream: invalid mapping at 1:7: Target must have at least one key`},
+		{`.a -> .b[0]`, `jsonstream: invalid mapping at 1:7: Target must consist only of keys`},
+		{`.a | .b -> .c`, `jsonstream: invalid mapping at 1:4: Unexpected '|'`},
+		{`.a[.b] -> .c`, `jsonstream: invalid mapping at 1:1: Expected a path`},
+		{`.a -> .b as integer`, `jsonstream: invalid mapping at 1:13: Unknown coercion "integer"`},
+		{`.a -> .b as number x`, `jsonstream: invalid mapping at 1:20: Unexpected 'x'`},
+	}
+	for _, c := range cases {
+		_, err := CompileMapping(c.spec)
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("%q: expected error %v, got %v", c.spec, c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package jsonstream
+
+import (
+	"iter"
+)
+
+// Match is a value found by Parser.FindAll.
+type Match struct {
+	Index      int      // the number of earlier matches (0 for the first match)
+	Path       []any    // the path of the value (see PathToSlice)
+	Line, Col  int      // the position of the value's first token
+	Start, End int      // the byte indices of the first and last bytes of the value in the input
+	Value      RawValue // a handle to the value
+}
+
+// FindAll yields the values in the input whose paths match the given pattern
+// (see PathMatches). Since every path matching a pattern has the same length,
+// matching values are never nested, and they are yielded strictly in the
+// order in which they appear in the input, each as soon as its last token has
+// been tokenized. No tokens are buffered: each match gives a RawValue that can
+// be tokenized or decoded on demand. If limit is positive, at most limit
+// matches are yielded, and tokenization stops after the last of them. If the
+// input contains an error, the error (as returned by Token.AsError) is yielded
+// and iteration stops.
+func (p *Parser) FindAll(inp []byte, pattern []any, limit int) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		var pt pathTracker
+		var m Match
+		var first Token
+		depth := -1 // the depth within the current match, or -1 if there is none
+		for t := range p.Tokenize(inp) {
+			if IsError(t.Kind) {
+				yield(Match{}, t.AsError())
+				return
+			}
+			path := pt.next(t)
+			if depth < 0 {
+				if !isValueKind(t.Kind) || !PathMatches(path, pattern) {
+					continue
+				}
+				first, depth = t, 0
+				m.Path = PathToSlice(path)
+			}
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+			if depth > 0 {
+				continue
+			}
+			m.Line, m.Col, m.Start, m.End = first.Line, first.Col, first.Start, t.End
+			m.Value = NewRawValue(inp, first, t)
+			if !yield(m, nil) {
+				return
+			}
+			m.Index++
+			depth = -1
+			if m.Index == limit {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package jsonstream
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindAll(t *testing.T) {
+	const input = `{"users": [{"name": "Ann", "tags": ["a"]}, {"tags": []}, {"name": {"first": "Bob"}}]}`
+	var p Parser
+	var got []string
+	for m, err := range p.FindAll([]byte(input), []any{"users", Wildcard{}, Wildcard{}}, 0) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%v %v %v:%v %v-%v %s", m.Index, m.Path, m.Line, m.Col, m.Start, m.End, m.Value.Bytes()))
+		if string(input[m.Start:m.End+1]) != string(m.Value.Bytes()) {
+			t.Errorf("Positions %v-%v do not give the value %s", m.Start, m.End, m.Value.Bytes())
+		}
+	}
+	expected := []string{
+		`0 [users 0 name] 1:21 20-24 "Ann"`,
+		`1 [users 0 tags] 1:36 35-39 ["a"]`,
+		`2 [users 1 tags] 1:53 52-53 []`,
+		`3 [users 2 name] 1:67 66-81 {"first": "Bob"}`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestFindAllLimit(t *testing.T) {
+	p := Parser{AllowMultipleValues: true}
+	var paths [][]any
+	for m, err := range p.FindAll([]byte(`[1, 2] [3] {"x": 4} [5, 6] [`), []any{Wildcard{}}, 3) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, m.Path)
+		var n int
+		if err := m.Value.Decode(&n); err != nil || n != len(paths) {
+			t.Errorf("Unexpected value %v (%v)", n, err)
+		}
+	}
+	if !reflect.DeepEqual(paths, [][]any{{0}, {1}, {0}}) {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+
+	var last error
+	n := 0
+	for _, err := range p.FindAll([]byte(`[1, 2] [`), []any{Wildcard{}}, 0) {
+		n++
+		last = err
+	}
+	if n != 3 || last == nil {
+		t.Errorf("Expected two matches followed by an error, got %v results ending with %v", n, last)
+	}
+}
@@ -0,0 +1,367 @@
+package jsonstream
+
+import (
+	"iter"
+)
+
+// MergeStrategy determines how MergeStreams combines two documents.
+type MergeStrategy int
+
+const (
+	// Merge as specified by RFC 7386 (JSON Merge Patch). Objects are merged
+	// recursively, a member of the second document replaces the member of the
+	// first document with the same key, and a null member in the second document
+	// deletes the corresponding member.
+	MergePatch MergeStrategy = iota
+	// As for MergePatch, except that arrays present at the same position in both
+	// documents are concatenated, and null members in the second document
+	// replace (rather than delete) the corresponding members.
+	MergeConcatArrays
+)
+
+// MergeStreams merges the document b into the document a according to the
+// given strategy, yielding a single token stream. This is useful for layered
+// configuration (e.g. a containing defaults and b containing overrides).
+// Members of the merged objects appear in the order of a, followed by any
+// members present only in b.
+//
+// The tokens of a are streamed, but b is buffered in full, so b should be the
+// smaller of the two documents. Comments, Key tokens and Whitespace tokens in
+// b are discarded. If a contains Key tokens (see Parser.EmitKeyTokens), the
+// Key token of a deleted member is removed with it, and Key tokens are added
+// for the members taken from b. If b contains error tokens, these are yielded
+// and no merge is performed.
+func MergeStreams(a, b iter.Seq[Token], strategy MergeStrategy) iter.Seq[Token] {
+	return mergeStreams(a, b, strategy, false)
+}
+
+// FillDefaults adds default values from the given template document to
+// the token stream. Each member of an object in the template that is missing
+// from the corresponding object in the input is added to the end of the
+// object. Objects present in both are filled recursively. If the template
+// contains a non-empty array, its first element is used as the template for
+// each element of the corresponding array in the input (so that, for
+// example, [{"enabled": true}] supplies a default for every object in an
+// array). Values in the input are never replaced.
+//
+// The input is streamed, but the template is buffered in full. Comments, Key
+// tokens and Whitespace tokens in the template are discarded, but if the input
+// contains Key tokens, they are added for the members filled from the
+// template. If the template contains error tokens, these are yielded and no
+// defaults are filled.
+func FillDefaults(tokens iter.Seq[Token], template iter.Seq[Token]) iter.Seq[Token] {
+	return mergeStreams(tokens, template, MergeConcatArrays, true)
+}
+
+func mergeStreams(a, b iter.Seq[Token], strategy MergeStrategy, defaults bool) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var bt []Token
+		hasErrors := false
+		for t := range b {
+			if IsError(t.Kind) {
+				hasErrors = true
+				if !yield(t) {
+					return
+				}
+			}
+			if t.Kind != Comment && t.Kind != Key && t.Kind != Whitespace {
+				bt = append(bt, t)
+			}
+		}
+		if hasErrors {
+			return
+		}
+
+		next, stop := iter.Pull(a)
+		defer stop()
+
+		m := streamMerger{
+			next:     next,
+			yield:    yield,
+			b:        bt,
+			ends:     valueEnds(bt),
+			strategy: strategy,
+			defaults: defaults,
+		}
+
+		for {
+			t, ok := next()
+			if !ok {
+				if len(bt) > 0 {
+					m.emitB(0, nil)
+				}
+				return
+			}
+			if isValueKind(t.Kind) {
+				if len(bt) == 0 {
+					if !m.copyValue(t) {
+						return
+					}
+				} else if !m.mergeValue(t, 0) {
+					return
+				}
+				break
+			}
+			if !yield(t) {
+				return
+			}
+		}
+
+		// Pass through anything following the first value (comments or errors).
+		for {
+			t, ok := next()
+			if !ok || !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// valueEnds returns a slice giving, for each index i, the index of the last
+// token of the value beginning at tokens[i].
+func valueEnds(tokens []Token) []int {
+	ends := make([]int, len(tokens))
+	var stack []int
+	for i, t := range tokens {
+		ends[i] = i
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			stack = append(stack, i)
+		case ArrayEnd, ObjectEnd:
+			if len(stack) > 0 {
+				ends[stack[len(stack)-1]] = i
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	for _, i := range stack {
+		ends[i] = len(tokens) - 1
+	}
+	return ends
+}
+
+type streamMerger struct {
+	next      func() (Token, bool)
+	yield     func(Token) bool
+	b         []Token
+	ends      []int
+	strategy  MergeStrategy
+	defaults  bool // values in a take precedence (see FillDefaults)
+	keyTokens bool // whether a contains Key tokens
+}
+
+// mergeValue merges the value of a beginning with t with the value of b
+// beginning at b[bi]. It returns false if iteration should stop.
+func (m *streamMerger) mergeValue(t Token, bi int) bool {
+	bt := m.b[bi]
+	if t.Kind == ObjectStart && bt.Kind == ObjectStart {
+		return m.mergeObjects(t, bi)
+	}
+	if m.defaults {
+		if t.Kind == ArrayStart && bt.Kind == ArrayStart && m.ends[bi] > bi+1 {
+			return m.fillArrayElements(t, bi+1)
+		}
+		return m.copyValue(t)
+	}
+	if m.strategy == MergeConcatArrays && t.Kind == ArrayStart && bt.Kind == ArrayStart {
+		if !m.yield(t) {
+			return false
+		}
+		for depth := 1; ; {
+			at, ok := m.next()
+			if !ok {
+				return false
+			}
+			switch at.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+			if depth == 0 {
+				for i := bi + 1; i < m.ends[bi]; i++ {
+					if !m.yield(m.b[i]) {
+						return false
+					}
+				}
+				return m.yield(at)
+			}
+			if !m.yield(at) {
+				return false
+			}
+		}
+	}
+	if !m.skipValue(t) {
+		return false
+	}
+	return m.emitB(bi, t.Key)
+}
+
+func (m *streamMerger) mergeObjects(t Token, bi int) bool {
+	if !m.yield(t) {
+		return false
+	}
+
+	members := make(map[string]int)
+	for i := bi + 1; i < m.ends[bi]; i = m.ends[i] + 1 {
+		members[string(m.b[i].Key)] = i
+	}
+
+	// The Key token of each member is held until it is known whether the
+	// member is deleted.
+	var held heldKey
+	for {
+		at, ok := m.next()
+		if !ok {
+			return false
+		}
+		if at.Kind == ObjectEnd {
+			if !held.flush(m.yield) {
+				return false
+			}
+			for i := bi + 1; i < m.ends[bi]; i = m.ends[i] + 1 {
+				if _, ok := members[string(m.b[i].Key)]; !ok {
+					continue
+				}
+				if m.strategy == MergePatch && m.b[i].Kind == Null {
+					continue
+				}
+				if m.keyTokens && !m.yield(Token{Kind: Key, Value: m.b[i].Key}) {
+					return false
+				}
+				if !m.emitB(i, m.b[i].Key) {
+					return false
+				}
+			}
+			return m.yield(at)
+		}
+		if held.hold(at) {
+			m.keyTokens = true
+			continue
+		}
+		if !isValueKind(at.Kind) {
+			if !held.flush(m.yield) || !m.yield(at) {
+				return false
+			}
+			continue
+		}
+
+		bj, ok := members[string(at.Key)]
+		if ok {
+			delete(members, string(at.Key))
+		}
+		if ok && m.strategy == MergePatch && m.b[bj].Kind == Null {
+			held.drop()
+			if !m.skipValue(at) {
+				return false
+			}
+			continue
+		}
+		if !held.flush(m.yield) {
+			return false
+		}
+		if !ok {
+			if !m.copyValue(at) {
+				return false
+			}
+		} else if !m.mergeValue(at, bj) {
+			return false
+		}
+	}
+}
+
+// emitB yields the value of b beginning at b[bi] with the given key. For
+// MergePatch, null members of objects are removed, as they would be when
+// applying the patch to an empty object. If a contains Key tokens, they are
+// added for the members of objects in the value.
+func (m *streamMerger) emitB(bi int, key []byte) bool {
+	for i := bi; i <= m.ends[bi]; i++ {
+		t := m.b[i]
+		if i == bi {
+			t.Key = key
+		} else if t.Key != nil && isValueKind(t.Kind) {
+			if m.strategy == MergePatch && t.Kind == Null {
+				continue
+			}
+			if m.keyTokens && !m.yield(Token{Kind: Key, Value: t.Key}) {
+				return false
+			}
+		}
+		if !m.yield(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// fillArrayElements yields the array of a beginning with t, using the value
+// of b beginning at b[bi] as the template for each element.
+func (m *streamMerger) fillArrayElements(t Token, bi int) bool {
+	if !m.yield(t) {
+		return false
+	}
+	for {
+		at, ok := m.next()
+		if !ok {
+			return false
+		}
+		if at.Kind == ArrayEnd {
+			return m.yield(at)
+		}
+		if !isValueKind(at.Kind) {
+			if !m.yield(at) {
+				return false
+			}
+			continue
+		}
+		if !m.mergeValue(at, bi) {
+			return false
+		}
+	}
+}
+
+// copyValue yields the value of a beginning with t.
+func (m *streamMerger) copyValue(t Token) bool {
+	if !m.yield(t) {
+		return false
+	}
+	if t.Kind != ArrayStart && t.Kind != ObjectStart {
+		return true
+	}
+	for depth := 1; depth > 0; {
+		at, ok := m.next()
+		if !ok {
+			return false
+		}
+		switch at.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if !m.yield(at) {
+			return false
+		}
+	}
+	return true
+}
+
+// skipValue consumes the value of a beginning with t without yielding it.
+func (m *streamMerger) skipValue(t Token) bool {
+	if t.Kind != ArrayStart && t.Kind != ObjectStart {
+		return true
+	}
+	for depth := 1; depth > 0; {
+		at, ok := m.next()
+		if !ok {
+			return false
+		}
+		switch at.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+	}
+	return true
+}
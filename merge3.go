@@ -0,0 +1,443 @@
+package jsonstream
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+)
+
+// MergeConflict describes a value that was changed in different ways in the
+// local and remote documents passed to Parser.ThreeWayMerge.
+type MergeConflict struct {
+	Path   []any  // the path of the value (see PathToSlice)
+	Local  []byte // the text of the value in the local document (nil if it was deleted)
+	Remote []byte // the text of the value in the remote document (nil if it was deleted)
+}
+
+var errEmptyMergeDocument = errors.New("jsonstream: cannot merge an empty document")
+
+// ThreeWayMerge applies the changes made to the document base in the document
+// remote to the document local. This is useful for upgrading a configuration
+// file that a user has edited (local) when a new version of the defaults it
+// was created from (base) is released (remote). The result is the text of
+// local with the following changes:
+//
+//   - A value that is unchanged in local but has changed in remote is replaced
+//     by the value in remote.
+//   - A member added in remote is added to the end of the object in local,
+//     together with any comments on the lines preceding it in remote.
+//   - A member deleted in remote is deleted from local, together with any
+//     comments preceding it, if its value is unchanged in local.
+//
+// Objects are merged member by member. Other values (including arrays) are
+// compared as a whole, and a value that has changed in both local and remote
+// is a conflict. Conflicts are resolved in favor of local and are reported in
+// the returned slice.
+//
+// The comments, whitespace and formatting of local are preserved everywhere
+// except in values taken from remote, which are copied from remote (adjusting
+// their indentation). The documents are tokenized using p, so comments are
+// preserved only if p.AllowComments is set. If a document contains an error,
+// the error (as returned by Token.AsError) is returned. If an object contains
+// duplicate keys, only the first member with each key is merged.
+func (p *Parser) ThreeWayMerge(base, local, remote []byte) ([]byte, []MergeConflict, error) {
+	q := *p
+	q.EmitKeyTokens = true
+	q.EmitWhitespace = false
+	q.AllowMultipleValues = false
+
+	var roots [3]*mergeValue
+	for i, inp := range [3][]byte{base, local, remote} {
+		root, err := parseMergeDocument(&q, inp)
+		if err != nil {
+			return nil, nil, err
+		}
+		roots[i] = root
+	}
+	b, l, r := roots[0], roots[1], roots[2]
+
+	m := threeWayMerger{p: &q, local: local, remote: remote}
+	out := slices.Clip(local[:l.start])
+	out = append(out, m.merge(b, l, r, nil, nil)...)
+	out = append(out, local[l.end+1:]...)
+	return out, m.conflicts, nil
+}
+
+// mergeValue is a value in a document passed to ThreeWayMerge.
+type mergeValue struct {
+	kind       Kind
+	start, end int    // the byte indices of the first and last bytes of the value
+	value      []byte // the Value of a scalar
+	elems      []*mergeValue
+	members    []mergeMember
+}
+
+type mergeMember struct {
+	key      string
+	keyStart int // the byte index of the key
+	value    *mergeValue
+}
+
+func parseMergeDocument(p *Parser, inp []byte) (*mergeValue, error) {
+	var tokens []Token
+	for t := range p.Tokenize(inp) {
+		if IsError(t.Kind) {
+			return nil, t.AsError()
+		}
+		if t.Kind != Comment {
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errEmptyMergeDocument
+	}
+	i := 0
+	return buildMergeValue(tokens, &i), nil
+}
+
+// buildMergeValue builds the value beginning at tokens[*i], which must not
+// contain errors, and advances *i past it.
+func buildMergeValue(tokens []Token, i *int) *mergeValue {
+	t := tokens[*i]
+	*i++
+	v := &mergeValue{kind: t.Kind, start: t.Start, end: t.End, value: t.Value}
+	switch t.Kind {
+	case ArrayStart:
+		for tokens[*i].Kind != ArrayEnd {
+			v.elems = append(v.elems, buildMergeValue(tokens, i))
+		}
+	case ObjectStart:
+		for tokens[*i].Kind != ObjectEnd {
+			k := tokens[*i]
+			*i++
+			v.members = append(v.members, mergeMember{key: string(k.Value), keyStart: k.Start, value: buildMergeValue(tokens, i)})
+		}
+	default:
+		return v
+	}
+	v.end = tokens[*i].End
+	*i++
+	return v
+}
+
+// member returns the first member of the object v with the given key, or nil
+// if there is none (or v is nil).
+func (v *mergeValue) member(key string) *mergeMember {
+	if v == nil {
+		return nil
+	}
+	for i := range v.members {
+		if v.members[i].key == key {
+			return &v.members[i]
+		}
+	}
+	return nil
+}
+
+// mergeValuesEqual returns true if a and b represent the same JSON value.
+// Members of objects are compared irrespective of their order.
+func mergeValuesEqual(a, b *mergeValue) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case ArrayStart:
+		return slices.EqualFunc(a.elems, b.elems, mergeValuesEqual)
+	case ObjectStart:
+		if len(a.members) != len(b.members) {
+			return false
+		}
+		for _, am := range a.members {
+			bm := b.member(am.key)
+			if bm == nil || !mergeValuesEqual(am.value, bm.value) {
+				return false
+			}
+		}
+		return true
+	}
+	return bytes.Equal(a.value, b.value)
+}
+
+type threeWayMerger struct {
+	p             *Parser
+	local, remote []byte
+	path          []any
+	conflicts     []MergeConflict
+}
+
+func (m *threeWayMerger) conflict(local, remote []byte) {
+	m.conflicts = append(m.conflicts, MergeConflict{Path: slices.Clone(m.path), Local: local, Remote: remote})
+}
+
+// merge returns the merged text of the local value l. The indentation of the
+// lines containing l and r are given by lIndent and rIndent.
+func (m *threeWayMerger) merge(b, l, r *mergeValue, lIndent, rIndent []byte) []byte {
+	if b.kind == ObjectStart && l.kind == ObjectStart && r.kind == ObjectStart {
+		return m.mergeObjects(b, l, r)
+	}
+	lt := m.local[l.start : l.end+1]
+	rt := m.remote[r.start : r.end+1]
+	switch {
+	case mergeValuesEqual(l, r), mergeValuesEqual(r, b):
+		return lt
+	case mergeValuesEqual(l, b):
+		return reindent(rt, rIndent, lIndent, false)
+	}
+	m.conflict(lt, rt)
+	return lt
+}
+
+// mergeItem is a member of a merged object.
+type mergeItem struct {
+	lead  []byte // whitespace and comments preceding the key
+	body  []byte // the key and the value
+	gap   []byte // whitespace and comments between the value and the comma
+	trail []byte // text following the comma up to and including the end of the line
+	index int    // the index of the member in the local object (-1 for new members)
+}
+
+func (m *threeWayMerger) mergeObjects(b, l, r *mergeValue) []byte {
+	ll := m.layout(m.local, l)
+	rl := m.layout(m.remote, r)
+
+	// The layout used for new members, which are indented by indent (and
+	// multiline values by bodyIndent).
+	style := ll
+	indent := trailingSpace(ll.lastLead())
+	var bodyIndent []byte
+	if len(l.members) > 0 {
+		bodyIndent = lineIndent(m.local, l.members[len(l.members)-1].keyStart)
+	} else {
+		from, to := lineIndent(m.remote, r.start), lineIndent(m.local, l.start)
+		style = objectLayout{
+			head:      reindent(rl.head, from, to, false),
+			afterLast: reindent(rl.afterLast, from, to, false),
+			comma:     rl.comma,
+		}
+		indent = reindent(trailingSpace(rl.lastLead()), from, to, true)
+		bodyIndent = indent
+	}
+	closingLine, closing := splitFirstLine(style.afterLast)
+	multiline := len(closingLine) > 0
+	if len(l.members) == 1 && !multiline {
+		// There is no separator to copy.
+		indent = []byte(" ")
+	}
+
+	var items []mergeItem
+	for i, lm := range l.members {
+		item := mergeItem{
+			lead:  ll.leads[i],
+			body:  m.local[lm.keyStart : lm.value.end+1],
+			gap:   ll.gaps[i],
+			index: i,
+		}
+		if i == len(l.members)-1 {
+			item.trail = closingLine
+		} else {
+			item.trail = ll.trails[i]
+		}
+		if l.member(lm.key) != &l.members[i] {
+			items = append(items, item)
+			continue
+		}
+
+		m.path = append(m.path, lm.key)
+		bm, rm := b.member(lm.key), r.member(lm.key)
+		switch {
+		case bm == nil && rm == nil:
+		case bm == nil:
+			if !mergeValuesEqual(lm.value, rm.value) {
+				m.conflict(m.local[lm.value.start:lm.value.end+1], m.remote[rm.value.start:rm.value.end+1])
+			}
+		case rm == nil:
+			if mergeValuesEqual(lm.value, bm.value) {
+				m.path = m.path[:len(m.path)-1]
+				continue
+			}
+			m.conflict(m.local[lm.value.start:lm.value.end+1], nil)
+		default:
+			v := m.merge(bm.value, lm.value, rm.value, lineIndent(m.local, lm.keyStart), lineIndent(m.remote, rm.keyStart))
+			item.body = append(slices.Clip(m.local[lm.keyStart:lm.value.start]), v...)
+		}
+		m.path = m.path[:len(m.path)-1]
+		items = append(items, item)
+	}
+
+	for i, rm := range r.members {
+		if r.member(rm.key) != &r.members[i] || l.member(rm.key) != nil {
+			continue
+		}
+		if bm := b.member(rm.key); bm != nil {
+			// Deleted in local.
+			if !mergeValuesEqual(rm.value, bm.value) {
+				m.path = append(m.path, rm.key)
+				m.conflict(nil, m.remote[rm.value.start:rm.value.end+1])
+				m.path = m.path[:len(m.path)-1]
+			}
+			continue
+		}
+		rIndent := lineIndent(m.remote, rm.keyStart)
+		item := mergeItem{
+			index: -1,
+			lead:  indent,
+			body:  reindent(m.remote[rm.keyStart:rm.value.end+1], rIndent, bodyIndent, false),
+		}
+		if lead := rl.leads[i]; multiline && bytes.ContainsRune(lead, '\n') {
+			item.lead = reindent(lead, rIndent, indent, true)
+		}
+		if multiline {
+			item.trail = []byte("\n")
+		}
+		items = append(items, item)
+	}
+
+	if len(items) > 0 && len(l.members) > 0 && items[0].index != 0 {
+		// The first member was deleted, so the new first member is indented as
+		// it was.
+		lead := bytes.TrimLeft(items[0].lead, " \t")
+		items[0].lead = append(slices.Clip(leadingSpace(ll.leads[0])), lead...)
+	}
+
+	out := append([]byte{'{'}, style.head...)
+	if len(items) == 0 {
+		if multiline && len(style.head) == 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, closing...)
+		return append(out, '}')
+	}
+	for i, item := range items {
+		out = append(out, item.lead...)
+		out = append(out, item.body...)
+		out = append(out, item.gap...)
+		final := i == len(items)-1
+		if !final || style.comma {
+			out = append(out, ',')
+		}
+		if !final {
+			out = append(out, item.trail...)
+			continue
+		}
+		if item.index >= 0 && item.index == len(l.members)-1 {
+			out = append(out, ll.afterLast...)
+		} else {
+			out = append(out, bytes.TrimRight(item.trail, "\r\n")...)
+			if multiline {
+				out = append(out, '\n')
+			}
+			out = append(out, closing...)
+		}
+	}
+	return append(out, '}')
+}
+
+// objectLayout gives the text surrounding the members of an object.
+type objectLayout struct {
+	head      []byte   // the text following '{' up to and including the end of its line
+	leads     [][]byte // the text preceding each key (following head or the previous trail)
+	gaps      [][]byte // the text between each value and the following comma
+	trails    [][]byte // the text following each comma up to and including the end of the line
+	afterLast []byte   // the text between the last value (or its comma) and '}'
+	comma     bool     // the last member is followed by a comma
+}
+
+func (ol objectLayout) lastLead() []byte {
+	if len(ol.leads) == 0 {
+		return nil
+	}
+	return ol.leads[len(ol.leads)-1]
+}
+
+func (m *threeWayMerger) layout(inp []byte, v *mergeValue) objectLayout {
+	var ol objectLayout
+	if len(v.members) == 0 {
+		ol.afterLast = inp[v.start+1 : v.end]
+		return ol
+	}
+	var lead []byte
+	ol.head, lead = splitFirstLine(inp[v.start+1 : v.members[0].keyStart])
+	for i, mm := range v.members {
+		ol.leads = append(ol.leads, lead)
+		after := mm.value.end + 1
+		st := rawTokenizeState{pos: after}
+		skipRawSpace(m.p, &st, inp)
+		comma := st.pos < len(inp) && inp[st.pos] == ','
+		if comma {
+			ol.gaps = append(ol.gaps, inp[after:st.pos])
+			after = st.pos + 1
+		} else {
+			ol.gaps = append(ol.gaps, nil)
+		}
+		if i == len(v.members)-1 {
+			ol.afterLast = inp[after:v.end]
+			ol.comma = comma
+			break
+		}
+		var trail []byte
+		trail, lead = splitFirstLine(inp[after:v.members[i+1].keyStart])
+		ol.trails = append(ol.trails, trail)
+	}
+	return ol
+}
+
+// splitFirstLine splits s, which contains only whitespace, commas and
+// comments, after the first line terminator that is not inside a comment. If
+// there is none, first is empty.
+func splitFirstLine(s []byte) (first, rest []byte) {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\n':
+			return s[:i+1], s[i+1:]
+		case bytes.HasPrefix(s[i:], []byte("//")):
+			end := bytes.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return nil, s
+			}
+			i += end - 1
+		case bytes.HasPrefix(s[i:], []byte("/*")):
+			end := bytes.Index(s[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, s
+			}
+			i += end + 3
+		}
+	}
+	return nil, s
+}
+
+// lineIndent returns the whitespace at the start of the line containing the
+// byte at index pos.
+func lineIndent(inp []byte, pos int) []byte {
+	start := bytes.LastIndexByte(inp[:pos], '\n') + 1
+	end := start
+	for end < pos && (inp[end] == ' ' || inp[end] == '\t') {
+		end++
+	}
+	return inp[start:end]
+}
+
+func leadingSpace(s []byte) []byte {
+	return s[:len(s)-len(bytes.TrimLeft(s, " \t"))]
+}
+
+func trailingSpace(s []byte) []byte {
+	return s[len(bytes.TrimRight(s, " \t")):]
+}
+
+// reindent replaces the prefix from of each line of s after the first (and of
+// the first line if first is true) with to.
+func reindent(s, from, to []byte, first bool) []byte {
+	if bytes.Equal(from, to) {
+		return s
+	}
+	var out []byte
+	for i, line := range bytes.SplitAfter(s, []byte("\n")) {
+		if (i > 0 || first) && bytes.HasPrefix(line, from) {
+			out = append(out, to...)
+			line = line[len(from):]
+		}
+		out = append(out, line...)
+	}
+	return out
+}
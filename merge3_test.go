@@ -0,0 +1,105 @@
+package jsonstream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	p := Parser{AllowComments: true, AllowTrailingCommas: true}
+
+	base := `{
+  // Server settings
+  "server": {
+    "host": "localhost",
+    "port": 8080
+  },
+  "debug": false,
+  "legacy": 1
+}`
+	local := `{
+  // Server settings
+  "server": {
+    "host": "example.com", // my host
+    "port": 8080
+  },
+  "debug": true, // enabled while testing
+  "legacy": 1,
+  "mine": [1, 2]
+}`
+	remote := `{
+  // Server settings
+  "server": {
+    "host": "localhost",
+    "port": 9090,
+    // Connection timeout in seconds
+    "timeout": 30
+  },
+  "debug": false,
+  "features": {
+    "a": true
+  }
+}`
+	expected := `{
+  // Server settings
+  "server": {
+    "host": "example.com", // my host
+    "port": 9090,
+    // Connection timeout in seconds
+    "timeout": 30
+  },
+  "debug": true, // enabled while testing
+  "mine": [1, 2],
+  "features": {
+    "a": true
+  }
+}`
+	out, conflicts, err := p.ThreeWayMerge([]byte(base), []byte(local), []byte(remote))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("Unexpected conflicts %v", conflicts)
+	}
+
+	cases := []struct {
+		base, local, remote string
+		expected            string
+		conflicts           string
+	}{
+		{`{"a": 1}`, `{"a": 1}`, `{"a": 1}`, `{"a": 1}`, "[]"},
+		{"/* c */ {\"a\": 1} // end\n", "/* c */ {\"a\": 1} // end\n", `{"a": 2}`, "/* c */ {\"a\": 2} // end\n", "[]"},
+		{`{"a": 1, "b": 2}`, `{"a": 1, "b": 2}`, `{"a": 1}`, `{"a": 1}`, "[]"},
+		{`{"a": 1, "b": 2}`, `{"a": 1, "b": 2}`, `{"b": 2}`, `{"b": 2}`, "[]"},
+		{`{"a": 1}`, `{"a": 1,}`, `{"a": 1, "b": 2}`, `{"a": 1, "b": 2,}`, "[]"},
+		{`{}`, `{}`, `{"a": 1}`, `{"a": 1}`, "[]"},
+		{"{\n  \"a\": [\n    1\n  ]\n}", "[{\n  \"x\": {\n  }\n}]", "{}", "[{\n  \"x\": {\n  }\n}]", "[{[] [91 123 10 32 32 34 120 34 58 32 123 10 32 32 125 10 125 93] [123 125]}]"},
+		{`{"a": {"b": 1}}`, `{"a": {}}`, `{"a": {"c": 2}}`, `{"a": {"c": 2}}`, "[]"},
+		{"{\n  \"s\": {}\n}", "{\n  \"s\": {}\n}", "{\n\t\"s\": {\n\t\t// x\n\t\t\"x\": 1,\n\t\t\"y\": [\n\t\t\t2\n\t\t]\n\t}\n}", "{\n  \"s\": {\n  \t// x\n  \t\"x\": 1,\n  \t\"y\": [\n  \t\t2\n  \t]\n  }\n}", "[]"},
+		{"{\n  \"a\": 1,\n  \"b\": 2\n}", "{\n  \"a\": 1,\n  \"b\": 2\n}", "{\n  \"a\": 1\n}", "{\n  \"a\": 1\n}", "[]"},
+		{"{\n  \"a\": 1,\n  \"b\": 2 // b\n}", "{\n  \"a\": 1, // a\n  \"b\": 2 // b\n}", "{\n  \"a\": 1\n}", "{\n  \"a\": 1 // a\n}", "[]"},
+		{`{"a": 1}`, `{"a": 2}`, `{"a": 3}`, `{"a": 2}`, "[{[a] [50] [51]}]"},
+		{`{"a": 1}`, `{"a": 2}`, `{}`, `{"a": 2}`, "[{[a] [50] []}]"},
+		{`{"a": 1}`, `{}`, `{"a": 3}`, `{}`, "[{[a] [] [51]}]"},
+		{`{}`, `{"a": 1}`, `{"a": 2}`, `{"a": 1}`, "[{[a] [49] [50]}]"},
+		{`{"a": [1, 2]}`, `{"a": [1, 2]}`, `{"a": [2, 1]}`, `{"a": [2, 1]}`, "[]"},
+		{`{"a": {"x": 1, "y": 2}}`, `{"a": {"y": 2, "x": 1}}`, `{"a": {"x": 1, "y": 2}}`, `{"a": {"y": 2, "x": 1}}`, "[]"},
+	}
+	for _, c := range cases {
+		out, conflicts, err := p.ThreeWayMerge([]byte(c.base), []byte(c.local), []byte(c.remote))
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+			continue
+		}
+		if string(out) != c.expected || fmt.Sprint(conflicts) != c.conflicts {
+			t.Errorf("For %s, %s, %s expected %s %v, got %s %v", c.base, c.local, c.remote, c.expected, c.conflicts, out, conflicts)
+		}
+	}
+
+	if _, _, err := p.ThreeWayMerge([]byte(`{}`), []byte(`{"a": }`), []byte(`{}`)); err == nil {
+		t.Errorf("Expected error")
+	}
+}
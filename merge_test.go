@@ -0,0 +1,128 @@
+package jsonstream
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeStreams(t *testing.T) {
+	merge := func(a, b string, strategy MergeStrategy) string {
+		var pa, pb Parser
+		return compactJSON(MergeStreams(pa.Tokenize([]byte(a)), pb.Tokenize([]byte(b)), strategy))
+	}
+
+	// Test cases from Appendix A of RFC 7386.
+	rfcCases := []struct{ target, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, c := range rfcCases {
+		if out := merge(c.target, c.patch, MergePatch); out != c.expected {
+			t.Errorf("Merging %v into %v: expected %v, got %v", c.patch, c.target, c.expected, out)
+		}
+	}
+
+	t.Run("nested objects preserve order and unchanged subtrees", func(t *testing.T) {
+		const a = `{"x": 1, "nested": {"keep": [1, {"deep": true}], "change": 1}, "y": [2]}`
+		const b = `{"nested": {"change": 2, "add": {"z": null}}, "new": "v"}`
+		const expected = `{"x":1,"nested":{"keep":[1,{"deep":true}],"change":2,"add":{}},"y":[2],"new":"v"}`
+		if out := merge(a, b, MergePatch); out != expected {
+			t.Errorf("Expected %v, got %v", expected, out)
+		}
+	})
+
+	t.Run("array concatenation", func(t *testing.T) {
+		const a = `{"list": [1, 2], "obj": {"inner": ["a"]}, "n": 1}`
+		const b = `{"list": [3, [4]], "obj": {"inner": ["b"]}, "n": null}`
+		const expected = `{"list":[1,2,3,[4]],"obj":{"inner":["a","b"]},"n":null}`
+		if out := merge(a, b, MergeConcatArrays); out != expected {
+			t.Errorf("Expected %v, got %v", expected, out)
+		}
+	})
+
+	t.Run("comments in the first document are preserved", func(t *testing.T) {
+		pa := Parser{AllowComments: true}
+		var pb Parser
+		var comments int
+		for tok := range MergeStreams(pa.Tokenize([]byte(`{/* c */ "a": 1}`)), pb.Tokenize([]byte(`{"a": 2}`)), MergePatch) {
+			if tok.Kind == Comment {
+				comments++
+			}
+		}
+		if comments != 1 {
+			t.Errorf("Expected 1 comment, got %v", comments)
+		}
+	})
+
+	t.Run("key tokens are removed and added with their members", func(t *testing.T) {
+		pa := Parser{EmitKeyTokens: true}
+		var pb Parser
+		var got []string
+		for tok := range MergeStreams(pa.Tokenize([]byte(`{"a": 1, "b": {"x": 1}}`)), pb.Tokenize([]byte(`{"a": null, "b": {"x": 2, "y": 3}, "c": {"d": 4}}`)), MergePatch) {
+			got = append(got, tok.Kind.String()+":"+string(tok.Value))
+		}
+		expected := []string{
+			"ObjectStart:", "Key:b", "ObjectStart:", "Key:x", "Number:2", "Key:y", "Number:3", "ObjectEnd:",
+			"Key:c", "ObjectStart:", "Key:d", "Number:4", "ObjectEnd:", "ObjectEnd:",
+		}
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("errors in the second document", func(t *testing.T) {
+		out := merge(`{"a": 1}`, `{"a": 2,}`, MergePatch)
+		if out != `<error: Trailing ','>` {
+			t.Errorf("Unexpected output %v", out)
+		}
+	})
+
+	t.Run("early termination", func(t *testing.T) {
+		var pa, pb Parser
+		n := 0
+		for range MergeStreams(pa.Tokenize([]byte(`{"a": [1, 2, 3]}`)), pb.Tokenize([]byte(`{"b": 1}`)), MergePatch) {
+			n++
+			if n == 2 {
+				break
+			}
+		}
+		if n != 2 {
+			t.Errorf("Expected 2 tokens, got %v", n)
+		}
+	})
+}
+
+func TestFillDefaults(t *testing.T) {
+	cases := []struct{ input, template, expected string }{
+		{`{"a": 1}`, `{"a": 2, "b": 3}`, `{"a":1,"b":3}`},
+		{`{}`, `{"a": null, "b": {"c": [1]}}`, `{"a":null,"b":{"c":[1]}}`},
+		{`{"b": {"x": 1}}`, `{"b": {"x": 2, "y": 3}, "c": 4}`, `{"b":{"x":1,"y":3},"c":4}`},
+		{`{"b": "not an object"}`, `{"b": {"x": 2}}`, `{"b":"not an object"}`},
+		{`{"a": null}`, `{"a": 1}`, `{"a":null}`},
+		{`{"list": [1, 2]}`, `{"list": [3]}`, `{"list":[1,2]}`},
+		{`[{"id": 1}, {"id": 2, "on": false}, 3]`, `[{"on": true}]`, `[{"id":1,"on":true},{"id":2,"on":false},3]`},
+		{`{"servers": [{"host": "a"}]}`, `{"servers": [{"port": 80, "tls": {"on": false}}]}`, `{"servers":[{"host":"a","port":80,"tls":{"on":false}}]}`},
+		{`[1]`, `{"a": 1}`, `[1]`},
+		{``, `{"a": 1}`, `{"a":1}`},
+	}
+	for _, c := range cases {
+		var p, tp Parser
+		out := compactJSON(FillDefaults(p.Tokenize([]byte(c.input)), tp.Tokenize([]byte(c.template))))
+		if out != c.expected {
+			t.Errorf("Filling %v from %v: expected %v, got %v", c.input, c.template, c.expected, out)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package jsonstream
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MessageCatalog gives templates for the messages of error tokens, keyed by
+// the kind of error, so that tools can present translated or customized
+// diagnostics. It is used by setting Parser.Messages to its Message method.
+// In a template, {msg} is replaced by the default message, {line} and {col}
+// by the position of the error, {stage} by the stage to which the error is
+// attributed (see Token.Stage) and {kind} by the name of the kind (e.g.
+// ErrorUnexpectedEOF). For example,
+//
+//	p := Parser{Messages: MessageCatalog{
+//		ErrorUnexpectedEOF:    "Fin de l'entrée inattendue",
+//		ErrorMaxDepthExceeded: "Imbrication trop profonde ({msg})",
+//	}.Message}
+//
+// Errors of kinds without a template keep their default messages.
+type MessageCatalog map[Kind]string
+
+// Message returns the message for the error token t.
+func (c MessageCatalog) Message(t Token) string {
+	tmpl, ok := c[t.Kind]
+	if !ok {
+		return t.ErrorMsg
+	}
+	return strings.NewReplacer(
+		"{msg}", t.ErrorMsg,
+		"{line}", strconv.Itoa(t.Line),
+		"{col}", strconv.Itoa(t.Col),
+		"{stage}", t.stage,
+		"{kind}", kindName(t.Kind),
+	).Replace(tmpl)
+}
+
+// localizeError replaces the message of the error token t as given by
+// p.Messages (if p is non-nil).
+func (p *Parser) localizeError(t *Token) {
+	if p != nil && p.Messages != nil {
+		t.ErrorMsg = p.Messages(*t)
+	}
+}
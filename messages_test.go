@@ -0,0 +1,57 @@
+package jsonstream
+
+import (
+	"testing"
+)
+
+func TestMessageCatalog(t *testing.T) {
+	catalog := MessageCatalog{
+		ErrorUnexpectedEOF:       "Fin inattendue ({kind})",
+		ErrorQuotaExceeded:       "Quota dépassé : {msg}",
+		ErrorUnexpectedToken:     "Jeton inattendu ({stage})",
+		ErrorUnexpectedCharacter: "Caractère inattendu à {line}:{col}",
+	}
+	p := NewParser(WithMessages(catalog.Message))
+	var last Token
+	for tok := range p.Tokenize([]byte("[1,\n  2")) {
+		last = tok
+	}
+	if last.ErrorMsg != "Fin inattendue (ErrorUnexpectedEOF)" || len(p.Errors()) != 1 || p.Errors()[0].ErrorMsg != last.ErrorMsg {
+		t.Errorf("Unexpected error %v", last)
+	}
+
+	p.Quota = MaxUsage(Usage{Depth: 1})
+	for tok := range p.Tokenize([]byte("[[]]")) {
+		last = tok
+	}
+	if last.ErrorMsg != "Quota dépassé : Quota exceeded: Depth is 2 (limit 1)" {
+		t.Errorf("Unexpected error %v", last)
+	}
+
+	// Errors of stages are localized using the Parser of the token at which
+	// they are reported, and errors without a template are unchanged.
+	p.Quota = nil
+	for tok := range UnwrapKey(p.Tokenize([]byte("[]")), "a") {
+		last = tok
+	}
+	if last.ErrorMsg != "Jeton inattendu (UnwrapKey)" {
+		t.Errorf("Unexpected error %v", last)
+	}
+	for tok := range RenameKeys(p.Tokenize([]byte(`{"a": 1, "b": 2}`)), map[string]string{"a": "b"}, RenameOptions{OnCollision: CollisionError}) {
+		if IsError(tok.Kind) {
+			last = tok
+		}
+	}
+	if last.Kind != ErrorKeyCollision || last.ErrorMsg == "" {
+		t.Errorf("Expected the default message, got %v", last)
+	}
+
+	state := p.NewRawState()
+	var raw Token
+	for NextRawToken(state, []byte("1 @"), &raw) {
+		last = raw
+	}
+	if last.ErrorMsg != "Caractère inattendu à 1:3" {
+		t.Errorf("Unexpected raw error %v", last)
+	}
+}
@@ -0,0 +1,352 @@
+package jsonstream
+
+import (
+	"bytes"
+	"io"
+)
+
+// CompactLog compacts a log of JSON records (e.g. NDJSON) by key, writing to
+// w only the last record for each key, in the order in which these records
+// occur in the input. The key of a record is the first value whose path
+// matches the pattern keyPath (see PathMatches). Records with no such value
+// are always kept. Records are written exactly as in the input, each followed
+// by a newline.
+//
+// The input is read from inp (from its current offset) with TokenizeReader,
+// and then read again after seeking back, so that memory use is proportional
+// to the number of distinct keys and to the size of the largest record
+// rather than to the size of the input (e.g. an *os.File can be compacted
+// without being read into memory). If the input contains an error, or
+// reading or seeking fails, the error (as returned by Token.AsError for an
+// error in the input) is returned and nothing is written.
+func CompactLog(w io.Writer, inp io.ReadSeeker, keyPath []any) error {
+	offset, err := inp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	last := make(map[string]int)
+	err = forEachLogRecord(inp, keyPath, func(i int, first Token, text []byte, key string, hasKey bool) error {
+		if hasKey {
+			last[key] = i
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := inp.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return forEachLogRecord(inp, keyPath, func(i int, first Token, text []byte, key string, hasKey bool) error {
+		if hasKey && last[key] != i {
+			return nil
+		}
+		if _, err := w.Write(text); err != nil {
+			return err
+		}
+		_, err := w.Write([]byte{'\n'})
+		return err
+	})
+}
+
+// logInput reads the input of a log of JSON records, retaining the input
+// read from the byte index base onwards so that the text of the current
+// record is available.
+type logInput struct {
+	r    io.Reader
+	buf  []byte
+	base int
+}
+
+func (l *logInput) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.buf = append(l.buf, p[:n]...)
+	return n, err
+}
+
+// text returns the input from the byte index start to the byte index end
+// inclusive, which must have been read and not discarded.
+func (l *logInput) text(start, end int) []byte {
+	return l.buf[start-l.base : end+1-l.base]
+}
+
+// discard releases the input before the byte index start.
+func (l *logInput) discard(start int) {
+	n := copy(l.buf, l.buf[start-l.base:])
+	l.buf = l.buf[:n]
+	l.base = start
+}
+
+// forEachLogRecord calls f with the index, first token, text and key of each
+// top-level value in the input read from r. The text is valid only until f
+// returns.
+func forEachLogRecord(r io.Reader, keyPath []any, f func(i int, first Token, text []byte, key string, hasKey bool) error) error {
+	p := Parser{AllowMultipleValues: true}
+	inp := &logInput{r: r}
+
+	var pt pathTracker
+	var key []byte
+	hasKey := false
+	var first Token
+	i, depth := 0, 0
+	keyDepth, keyStart := -1, 0
+
+	for t := range p.TokenizeReader(inp) {
+		if IsError(t.Kind) {
+			return t.AsError()
+		}
+		if t.Kind == Comment {
+			continue
+		}
+		if depth == 0 {
+			pt = pathTracker{}
+			first = t
+			hasKey = false
+			key = key[:0]
+			inp.discard(t.Start)
+		}
+
+		path := pt.next(t)
+		if !hasKey && keyDepth < 0 && isValueKind(t.Kind) && PathMatches(path, keyPath) {
+			// The kind is included so that (e.g.) 1 and "1" are distinct keys.
+			key = append(key, byte(t.Kind))
+			if t.Kind == ArrayStart || t.Kind == ObjectStart {
+				keyDepth, keyStart = depth, t.Start
+			} else {
+				hasKey = true
+				key = append(key, t.Value...)
+			}
+		}
+
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+			continue
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth == keyDepth {
+			keyDepth = -1
+			hasKey = true
+			key = append(key, inp.text(keyStart, t.End)...)
+		}
+
+		if depth == 0 {
+			if err := f(i, first, inp.text(first.Start, t.End), string(key), hasKey); err != nil {
+				return err
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// logRecord is a record in a log of JSON records indexed by JoinLogs.
+type logRecord struct {
+	first Token  // the first token of the record
+	text  []byte // the text of the record
+}
+
+// JoinLogs writes to w the inner join of two logs of JSON records (e.g.
+// NDJSON) on the key given by keyPath (as for CompactLog). For each pair of
+// records, one from left and one from right, that have the same key, a merged
+// object is written, consisting of the members of the left record followed by
+// the members of the right record whose keys are not in the left record. A
+// member of the left record whose key is also in the right record takes the
+// value from the right record. Records with no key or with no matching record
+// are omitted. Each merged object is written as compact JSON, followed by a
+// newline.
+//
+// Both inputs are read with TokenizeReader. The records of left that have
+// keys are first read into an index, and right is then streamed, so that
+// memory use is proportional to the size of left rather than of right; left
+// should be the smaller log. Merged objects are written in the order of the
+// records of right, then in the order of the records of left. If either input
+// contains an error, or reading fails, the error (as returned by
+// Token.AsError for an error in the input) is returned, and if left contains
+// an error nothing is written. If two records with the same key are not both
+// objects, an error is returned.
+func JoinLogs(w io.Writer, left, right io.Reader, keyPath []any) error {
+	index := make(map[string][]logRecord)
+	err := forEachLogRecord(left, keyPath, func(i int, first Token, text []byte, key string, hasKey bool) error {
+		if hasKey {
+			index[key] = append(index[key], logRecord{first, bytes.Clone(text)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	out := NewWriter(w)
+	err = forEachLogRecord(right, keyPath, func(i int, first Token, text []byte, key string, hasKey bool) error {
+		if !hasKey || len(index[key]) == 0 {
+			return nil
+		}
+		members, err := logRecordMembers(logRecord{first, text})
+		if err != nil {
+			return err
+		}
+		for _, r := range index[key] {
+			other, err := logRecordMembers(r)
+			if err != nil {
+				return err
+			}
+			if err := writeJoined(out, other, members); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if out.nValues > 0 {
+		_, err = w.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// logRecordMembers returns the tokens of each member of the record r, which
+// must be an object.
+func logRecordMembers(r logRecord) ([][]Token, error) {
+	if r.first.Kind != ObjectStart {
+		return nil, stageError("JoinLogs", ErrorUnexpectedToken, r.first, r.first, "Expected object").AsError()
+	}
+	var p Parser
+	var members [][]Token
+	depth := 0
+	for t := range p.Tokenize(r.text) {
+		if depth == 1 && isValueKind(t.Kind) {
+			members = append(members, nil)
+		}
+		if depth >= 1 && (isValueKind(t.Kind) || isContainerEnd(t.Kind)) && (depth > 1 || t.Kind != ObjectEnd) {
+			members[len(members)-1] = append(members[len(members)-1], t)
+		}
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+	}
+	return members, nil
+}
+
+// writeJoined writes the object merged from the members of the left and right
+// records for JoinLogs.
+func writeJoined(w *Writer, left, right [][]Token) error {
+	find := func(members [][]Token, key []byte) []Token {
+		for _, m := range members {
+			if string(m[0].Key) == string(key) {
+				return m
+			}
+		}
+		return nil
+	}
+	write := func(tokens []Token) error {
+		for _, t := range tokens {
+			if err := w.WriteToken(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := w.WriteToken(Token{Kind: ObjectStart}); err != nil {
+		return err
+	}
+	for _, m := range left {
+		if r := find(right, m[0].Key); r != nil {
+			m = r
+		}
+		if err := write(m); err != nil {
+			return err
+		}
+	}
+	for _, m := range right {
+		if find(left, m[0].Key) == nil {
+			if err := write(m); err != nil {
+				return err
+			}
+		}
+	}
+	return w.WriteToken(Token{Kind: ObjectEnd})
+}
+
+// ToNDJSON converts a sequence of concatenated JSON values in the input (e.g.
+// a file of pretty-printed documents) to NDJSON, writing each value to w as
+// compact JSON on a line of its own. The values are tokenized with the options
+// of p, except that AllowMultipleValues is always set; string escape
+// sequences in the input are preserved (see Writer.EnableOriginalEscapes) and
+// comments are discarded. The output for each value is written as soon as it
+// has been tokenized. If the input contains an error, the error (as returned
+// by Token.AsError) is returned, and the output for the preceding values may
+// have been written.
+func (p *Parser) ToNDJSON(w io.Writer, inp []byte) error {
+	q := *p
+	q.AllowMultipleValues = true
+	jw := NewWriter(w)
+	jw.EnableOriginalEscapes(inp)
+	if err := jw.WriteAll(q.Tokenize(inp)); err != nil {
+		return err
+	}
+	if jw.Written() > 0 {
+		_, err := w.Write([]byte{'\n'})
+		return err
+	}
+	return nil
+}
+
+// FromNDJSON converts NDJSON (or any sequence of concatenated JSON values) in
+// the input to a sequence of pretty-printed documents, formatting each value
+// as for Parser.Format with the given options. The documents are separated by
+// blank lines, so that the output is a readable fixture file that ToNDJSON
+// converts back. The values are tokenized with the options of p, except that
+// AllowMultipleValues is always set, and each document is written to w as soon
+// as it has been formatted. Comments between values are discarded. If the
+// input contains an error, the error (as returned by Token.AsError) is
+// returned, and the preceding documents may have been written.
+func (p *Parser) FromNDJSON(w io.Writer, inp []byte, opts FormatOptions) error {
+	q := *p
+	q.AllowMultipleValues = true
+	single := rawValueConfig(p)
+	var first Token
+	n, depth := 0, 0
+	for t := range q.Tokenize(inp) {
+		if IsError(t.Kind) {
+			return t.AsError()
+		}
+		if !isValueKind(t.Kind) && !isContainerEnd(t.Kind) {
+			continue
+		}
+		if depth == 0 {
+			first = t
+		}
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+		doc, err := single.Format(inp[first.Start:t.End+1], opts)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			doc = append([]byte{'\n'}, doc...)
+		}
+		if _, err := w.Write(doc); err != nil {
+			return err
+		}
+		n++
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package jsonstream
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAllowMultipleValues(t *testing.T) {
+	p := Parser{AllowMultipleValues: true}
+	inputs := map[string]string{
+		"":                        "",
+		"1 2":                     "1,2",
+		"{\"a\":1}\n[2]\n\"x\"\n": `{"a":1},[2],"x"`,
+		"{}{}":                    "{},{}",
+		"[1] ]":                   "[1],<error: Unexpected token>",
+		"[1] [2,]":                "[1],[2,<error: Trailing ','>",
+	}
+	for input, expected := range inputs {
+		got := ""
+		for i, v := range splitTopLevel(p.Tokenize([]byte(input))) {
+			if i > 0 {
+				got += ","
+			}
+			got += v
+		}
+		if got != expected {
+			t.Errorf("For %q expected %v, got %v", input, expected, got)
+		}
+	}
+
+	var strict Parser
+	if succeedsWith(&strict, "1 2") {
+		t.Errorf("Expected multiple values to be rejected by default")
+	}
+}
+
+func splitTopLevel(tokens iter.Seq[Token]) []string {
+	var values []string
+	var current []Token
+	depth := 0
+	for t := range tokens {
+		current = append(current, t)
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+			continue
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth == 0 || IsError(t.Kind) {
+			values = append(values, compactJSON(slices.Values(current)))
+			current = nil
+			if IsError(t.Kind) {
+				break
+			}
+		}
+	}
+	return values
+}
+
+func TestCompactLog(t *testing.T) {
+	const input = `{"id": 1, "v": "a"}
+{"id": 2, "v": "b"}
+{"v": "no id"}
+{"id": "1", "v": "c"}
+{"id": 1, "v": "d"}
+{"id": {"x": [1]}, "v": "e"}
+{"id": {"x": [1]}, "v": "f"}
+`
+	var buf bytes.Buffer
+	if err := CompactLog(&buf, strings.NewReader(input), []any{"id"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	const expected = `{"id": 2, "v": "b"}
+{"v": "no id"}
+{"id": "1", "v": "c"}
+{"id": 1, "v": "d"}
+{"id": {"x": [1]}, "v": "f"}
+`
+	if buf.String() != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, buf.String())
+	}
+
+	// The input is read from the current offset of the reader.
+	buf.Reset()
+	r := strings.NewReader("header\n{\"id\": 1, \"v\": 1}\n{\"id\": 1, \"v\": 2}\n")
+	r.Seek(7, io.SeekStart)
+	if err := CompactLog(&buf, r, []any{"id"}); err != nil || buf.String() != "{\"id\": 1, \"v\": 2}\n" {
+		t.Errorf("Unexpected output %q (%v)", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := CompactLog(&buf, strings.NewReader("{\"id\": 1}\n{\"id\": 1,}\n"), []any{"id"}); err == nil || err.Error() != "2:10 Error: Trailing ','" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written for malformed input")
+	}
+}
+
+func TestValueRanges(t *testing.T) {
+	const input = "{\"a\": [1]}\n  2 \"x\"[]\n{}"
+	p := Parser{AllowMultipleValues: true}
+	var seen []int
+	for range p.Tokenize([]byte(input)) {
+		seen = append(seen, len(p.ValueRanges()))
+	}
+	expected := []ValueRange{{0, 9}, {13, 13}, {15, 17}, {18, 19}, {21, 22}}
+	if !slices.Equal(p.ValueRanges(), expected) {
+		t.Errorf("Expected %v, got %v", expected, p.ValueRanges())
+	}
+	for _, r := range p.ValueRanges() {
+		var single Parser
+		if !succeedsWith(&single, input[r.Start:r.End+1]) {
+			t.Errorf("Range %v does not contain a single value", r)
+		}
+	}
+	if !slices.Equal(seen, []int{0, 0, 0, 0, 0, 1, 2, 3, 3, 4, 4}) {
+		t.Errorf("Unexpected number of ranges seen during iteration: %v", seen)
+	}
+}
+
+func TestJoinLogs(t *testing.T) {
+	const users = `{"id": 1, "name": "Ann", "v": 0}
+{"id": 2, "name": "Bob"}
+{"name": "no id"}
+{"id": 3, "name": "Cy"}
+`
+	const orders = `{"order": "a", "id": 2, "v": {"x": 1}, "total": 10}
+{"order": "b", "id": 1, "total": 5}
+{"order": "c", "id": 4, "total": 7}
+{"order": "d", "id": 2, "total": [1, 2]}
+{"order": "e", "id": "1"}
+`
+	var buf bytes.Buffer
+	if err := JoinLogs(&buf, strings.NewReader(users), strings.NewReader(orders), []any{"id"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	const expected = `{"id":2,"name":"Bob","order":"a","v":{"x":1},"total":10}
+{"id":1,"name":"Ann","v":0,"order":"b","total":5}
+{"id":2,"name":"Bob","order":"d","total":[1,2]}
+`
+	if buf.String() != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, buf.String())
+	}
+
+	// Left members come first whichever input is larger.
+	buf.Reset()
+	if err := JoinLogs(&buf, strings.NewReader(orders), strings.NewReader(`{"id": 1, "name": "Ann", "total": 0}`), []any{"id"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if buf.String() != "{\"order\":\"b\",\"id\":1,\"total\":0,\"name\":\"Ann\"}\n" {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := JoinLogs(&buf, strings.NewReader(users), strings.NewReader(`{"id": 5}`), []any{"id"}); err != nil || buf.Len() != 0 {
+		t.Errorf("Expected no output, got %q (%v)", buf.String(), err)
+	}
+
+	if err := JoinLogs(&buf, strings.NewReader("{\"id\": 1}\n[1]"), strings.NewReader("{\"id\": 1,}\n"), []any{"id"}); err == nil || err.Error() != "1:9 Error: Trailing ','" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := JoinLogs(&buf, strings.NewReader("[1]"), strings.NewReader("{\"id\": 1}\n[1]"), []any{0}); err == nil || err.Error() != "2:2 Error (JoinLogs): Expected object" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestNDJSONConversion(t *testing.T) {
+	const pretty = "// users\n{\n  \"id\": 1,\n  \"name\": \"\\u00c5sa\"\n}\n\n[\n  1,\n  2\n]\n\n\"x\"\n"
+	p := Parser{AllowComments: true}
+	var ndjson bytes.Buffer
+	if err := p.ToNDJSON(&ndjson, []byte(pretty)); err != nil {
+		t.Fatal(err)
+	}
+	const expected = "{\"id\":1,\"name\":\"\\u00c5sa\"}\n[1,2]\n\"x\"\n"
+	if ndjson.String() != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, ndjson.String())
+	}
+
+	var back bytes.Buffer
+	if err := p.FromNDJSON(&back, ndjson.Bytes(), FormatOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if back.String() != pretty[len("// users\n"):] {
+		t.Errorf("Expected\n%v\ngot\n%v", pretty, back.String())
+	}
+
+	var empty bytes.Buffer
+	if err := p.ToNDJSON(&empty, []byte(" // nothing\n")); err != nil || empty.Len() != 0 {
+		t.Errorf("Unexpected output %q (error %v)", empty.String(), err)
+	}
+
+	var partial bytes.Buffer
+	err := p.FromNDJSON(&partial, []byte("{\"a\": 1}\n{\"a\": }\n"), FormatOptions{})
+	if err == nil || partial.String() != "{\n  \"a\": 1\n}\n" {
+		t.Errorf("Unexpected output %q (error %v)", partial.String(), err)
+	}
+	if err := p.ToNDJSON(&partial, []byte("[1")); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
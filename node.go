@@ -0,0 +1,111 @@
+package jsonstream
+
+import (
+	"iter"
+	"sort"
+)
+
+// Node is a value in a tree built by BuildTree, giving the structure of a
+// document together with the position of each value in the input.
+type Node struct {
+	Kind       Kind    // the kind of the value's first token (e.g. ObjectStart for an object)
+	Key        []byte  // the key of the value if it is an object member, or nil
+	Value      []byte  // the value of a scalar (as for Token.Value)
+	Line, Col  int     // the position of the value's first token
+	Start, End int     // the byte indices of the first and last bytes of the value in the input
+	Parent     *Node   // the enclosing array or object, or nil for the root
+	Children   []*Node // the elements of an array or the members of an object, in order
+}
+
+// BuildTree builds a tree for the first value in the token sequence whose path
+// matches the given pattern (see PathMatches). An empty pattern selects the
+// first top-level value. Comments, Key tokens and Whitespace tokens are
+// ignored. Only the tokens of the selected value are retained, so this can be
+// used to load a subtree of a large document. If the input contains an error
+// before the end of the selected value, the error (as returned by
+// Token.AsError) is returned. If no value matches, the result is nil.
+func BuildTree(tokens iter.Seq[Token], pattern []any) (*Node, error) {
+	var pt pathTracker
+	var root, current *Node
+	for t := range tokens {
+		if IsError(t.Kind) {
+			return nil, t.AsError()
+		}
+		path := pt.next(t)
+		if current == nil {
+			if !isValueKind(t.Kind) || !PathMatches(path, pattern) {
+				continue
+			}
+		}
+
+		switch {
+		case isContainerEnd(t.Kind):
+			current.End = t.End
+			if current == root {
+				return root, nil
+			}
+			current = current.Parent
+		case isValueKind(t.Kind):
+			n := &Node{
+				Kind:   t.Kind,
+				Key:    t.Key,
+				Value:  t.Value,
+				Line:   t.Line,
+				Col:    t.Col,
+				Start:  t.Start,
+				End:    t.End,
+				Parent: current,
+			}
+			if current == nil {
+				root = n
+				n.Key = nil
+			} else {
+				current.Children = append(current.Children, n)
+			}
+			if t.Kind == ArrayStart || t.Kind == ObjectStart {
+				current = n
+			} else if current == nil {
+				return root, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Find returns the innermost node in the tree rooted at n whose range in the
+// input contains the byte at index offset, or nil if there is none. This is
+// useful for mapping an editor's cursor position to a value.
+func (n *Node) Find(offset int) *Node {
+	if offset < n.Start || offset > n.End {
+		return nil
+	}
+	for {
+		i := sort.Search(len(n.Children), func(i int) bool { return n.Children[i].End >= offset })
+		if i == len(n.Children) || n.Children[i].Start > offset {
+			return n
+		}
+		n = n.Children[i]
+	}
+}
+
+// Path returns the path of the node relative to the root of its tree (see
+// PathToSlice).
+func (n *Node) Path() []any {
+	var path []any
+	for ; n.Parent != nil; n = n.Parent {
+		if n.Parent.Kind == ArrayStart {
+			path = append(path, n.index())
+		} else {
+			path = append(path, string(n.Key))
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// index returns the index of n among the children of its parent.
+func (n *Node) index() int {
+	return sort.Search(len(n.Parent.Children), func(i int) bool { return n.Parent.Children[i].Start >= n.Start })
+}
@@ -0,0 +1,76 @@
+package jsonstream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	input := []byte("{\"a\": [1, {\"b\": \"x\"}],\n \"c\": null}")
+	p := Parser{EmitKeyTokens: true}
+	root, err := BuildTree(p.Tokenize(input), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if root.Kind != ObjectStart || root.Start != 0 || root.End != len(input)-1 || len(root.Children) != 2 {
+		t.Fatalf("Unexpected root %+v", root)
+	}
+	a, c := root.Children[0], root.Children[1]
+	if string(a.Key) != "a" || a.Kind != ArrayStart || string(input[a.Start:a.End+1]) != `[1, {"b": "x"}]` || a.Parent != root {
+		t.Errorf("Unexpected node %+v", a)
+	}
+	if string(c.Key) != "c" || c.Kind != Null || c.Line != 2 || c.Col != 8 {
+		t.Errorf("Unexpected node %+v", c)
+	}
+	b := a.Children[1].Children[0]
+	if string(b.Value) != "x" || fmt.Sprint(b.Path()) != "[a 1 b]" {
+		t.Errorf("Unexpected node %+v at %v", b, b.Path())
+	}
+
+	finds := map[int]string{
+		0:  "[]",
+		1:  "[]",
+		6:  "[a]",
+		7:  "[a 0]",
+		8:  "[a]",
+		10: "[a 1]",
+		17: "[a 1 b]",
+		19: "[a 1]",
+		28: "[]",
+		30: "[c]",
+	}
+	for offset, expected := range finds {
+		n := root.Find(offset)
+		if n == nil || fmt.Sprint(n.Path()) != expected {
+			t.Errorf("For offset %v expected %v, got %+v", offset, expected, n)
+		}
+	}
+	if root.Find(len(input)) != nil || root.Find(-1) != nil {
+		t.Errorf("Expected no node outside the input")
+	}
+
+	t.Run("subtree", func(t *testing.T) {
+		var p Parser
+		n, err := BuildTree(p.Tokenize(input), []any{"a", 1})
+		if err != nil || n == nil || n.Kind != ObjectStart || n.Key != nil || n.Parent != nil || n.Start != 10 || n.End != 19 {
+			t.Fatalf("Unexpected result %+v %v", n, err)
+		}
+		if n.Find(17).Path()[0] != "b" {
+			t.Errorf("Expected path relative to subtree root")
+		}
+
+		n, err = BuildTree(p.Tokenize(input), []any{"a", 0})
+		if err != nil || n == nil || n.Kind != Number || string(n.Value) != "1" {
+			t.Errorf("Unexpected result %+v %v", n, err)
+		}
+
+		n, err = BuildTree(p.Tokenize(input), []any{"missing"})
+		if n != nil || err != nil {
+			t.Errorf("Unexpected result %+v %v", n, err)
+		}
+
+		if _, err := BuildTree(p.Tokenize([]byte(`{"a": [1,,2]}`)), []any{"a"}); err == nil {
+			t.Errorf("Expected error")
+		}
+	})
+}
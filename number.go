@@ -0,0 +1,262 @@
+package jsonstream
+
+import (
+	"strconv"
+)
+
+// Largest integer n such that n and all smaller non-negative integers can be
+// exactly represented as a float64 and no other integer is rounded to n
+// (i.e. JavaScript's Number.MAX_SAFE_INTEGER).
+const maxSafeInteger = float64ExactIntMax - 1
+
+// IsInteger returns true iff the token is a Number whose value is an integer.
+// Values written using fraction or exponent syntax are integers if they are
+// integer valued (e.g. 1.0 and 1.5e1). The check is exact and does not
+// depend on the range of any integer or floating point type.
+func (t *Token) IsInteger() bool {
+	_, _, ok := t.integerDigits()
+	return ok
+}
+
+// IsSafeInteger returns true iff the token is a Number whose value is an
+// integer in the range [-(2^53-1), 2^53-1]. Such values can be converted to
+// float64 (or a JavaScript number) and back without loss of precision.
+func (t *Token) IsSafeInteger() bool {
+	sig, zeros, ok := t.integerDigits()
+	if !ok || len(sig)+zeros > 16 {
+		return false
+	}
+	var n uint64
+	for _, d := range sig {
+		n = n*10 + uint64(d-'0')
+	}
+	for range zeros {
+		n *= 10
+	}
+	return n <= maxSafeInteger
+}
+
+// integerDigits returns the significant digits of an integer-valued Number
+// token (without leading or trailing zeros), followed by the number of
+// trailing zeros. The digits are empty for zero. It returns false if the token
+// is not an integer-valued Number. The digits are a sub-slice of the token's
+// Value unless the value is written with a fraction.
+func (t *Token) integerDigits() (sig []byte, zeros int, ok bool) {
+	if t.Kind != Number {
+		return nil, 0, false
+	}
+	parts := splitNumber(t.Value)
+
+	// The value is (Integer ++ Fraction) * 10^(Exponent - len(Fraction)).
+	sig = parts.Integer
+	if len(parts.Fraction) > 0 {
+		sig = make([]byte, 0, len(parts.Integer)+len(parts.Fraction))
+		sig = append(append(sig, parts.Integer...), parts.Fraction...)
+	}
+	for len(sig) > 0 && sig[0] == '0' {
+		sig = sig[1:]
+	}
+	if len(sig) == 0 {
+		return nil, 0, true
+	}
+	zeros = parts.Exponent - len(parts.Fraction)
+	for sig[len(sig)-1] == '0' {
+		sig = sig[:len(sig)-1]
+		zeros++
+	}
+	if zeros < 0 {
+		return nil, 0, false
+	}
+	return sig, zeros, true
+}
+
+// NumberParts gives the components of a numeric literal. The value of the
+// literal is (Integer ++ Fraction) * 10^(Exponent - len(Fraction)), negated
+// if Negative is true.
+type NumberParts struct {
+	Negative bool   // true iff the literal begins with '-'
+	Integer  []byte // the digits preceding the decimal point (a sub-slice of the token's Value)
+	Fraction []byte // the digits following the decimal point, or nil if none (a sub-slice of the token's Value)
+	Exponent int    // the value of the exponent, or 0 if none (saturates at ±2^30)
+}
+
+// NumberParts returns the components of the token's value. It panics if
+// the token's Kind is not Number. The components are extracted from the
+// literal as written (e.g. 1.50e+2 has Integer "1", Fraction "50" and
+// Exponent 2), so that they can be passed to arbitrary precision decimal
+// types without parsing the literal again.
+func (t *Token) NumberParts() NumberParts {
+	if t.Kind != Number {
+		panic("jsonstream: NumberParts called on non-Number token")
+	}
+	return splitNumber(t.Value)
+}
+
+// splitNumber splits a JSON numeric literal into its components.
+func splitNumber(b []byte) (parts NumberParts) {
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		parts.Negative = true
+		i++
+	}
+	start := i
+	for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+		i++
+	}
+	parts.Integer = b[start:i]
+	if i < len(b) && b[i] == '.' {
+		i++
+		start = i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		parts.Fraction = b[start:i]
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		neg := false
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			neg = b[i] == '-'
+			i++
+		}
+		exp := 0
+		for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+			if exp < 1<<30 {
+				exp = exp*10 + int(b[i]-'0')
+			}
+		}
+		parts.Exponent = min(exp, 1<<30)
+		if neg {
+			parts.Exponent = -parts.Exponent
+		}
+	}
+	return
+}
+
+// ParseNumber parses a JSON numeric literal as a float64. The result is the
+// float64 value nearest to the exact value of the literal (rounding ties to
+// even), as for strconv.ParseFloat, so that formatting the result with
+// strconv.FormatFloat(f, 'g', -1, 64) and parsing it again gives the same
+// value. The result does not depend on the locale or on any other global
+// state. Only the syntax permitted by the JSON standard is accepted (so, for
+// example, "+1", "1_000", "0x10" and "Inf" are rejected).
+//
+// Errors have type *strconv.NumError. If the value is out of range, the
+// result is ±Inf and the error wraps strconv.ErrRange. Values that have at
+// most 15 significant digits and a small exponent are parsed without
+// allocating.
+func ParseNumber(b []byte) (float64, error) {
+	if !isValidNumber(b) {
+		return 0, &strconv.NumError{Func: "ParseNumber", Num: string(b), Err: strconv.ErrSyntax}
+	}
+	f, err := parseNumber(b, 64)
+	if numErr, ok := err.(*strconv.NumError); ok {
+		numErr.Func = "ParseNumber"
+	}
+	return f, err
+}
+
+// parseNumber parses a JSON numeric literal as a float of the given bit size
+// without allocating in the common case. It falls back to strconv.ParseFloat
+// for inputs that cannot be parsed exactly using float arithmetic.
+func parseNumber(b []byte, bitSize int) (float64, error) {
+	if f, ok := parseNumberFast(b, bitSize); ok {
+		return f, nil
+	}
+	return strconv.ParseFloat(string(b), bitSize)
+}
+
+var float64Pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+var float32Pow10 = [...]float32{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10}
+
+// parseNumberFast parses b if its mantissa and its power of ten are both
+// exactly representable, in which case a single (correctly rounded)
+// multiplication or division gives the correctly rounded result. It returns
+// false for all other inputs, including invalid ones.
+func parseNumberFast(b []byte, bitSize int) (float64, bool) {
+	i := 0
+	neg := false
+	if i < len(b) && b[i] == '-' {
+		neg = true
+		i++
+	}
+
+	var mant uint64
+	exp, digits := 0, 0
+	for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+		mant = mant*10 + uint64(b[i]-'0')
+		digits++
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	if i < len(b) && b[i] == '.' {
+		i++
+		start := i
+		for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+			mant = mant*10 + uint64(b[i]-'0')
+			digits++
+			exp--
+		}
+		if i == start {
+			return 0, false
+		}
+	}
+	// 19 digits always fit in a uint64.
+	if digits > 19 {
+		return 0, false
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		expNeg := false
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			expNeg = b[i] == '-'
+			i++
+		}
+		e, start := 0, i
+		for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+			if i-start >= 3 {
+				return 0, false
+			}
+			e = e*10 + int(b[i]-'0')
+		}
+		if i == start {
+			return 0, false
+		}
+		if expNeg {
+			e = -e
+		}
+		exp += e
+	}
+	if i != len(b) {
+		return 0, false
+	}
+
+	var f float64
+	if bitSize == 32 {
+		if mant > 1<<24 || exp < -len(float32Pow10)+1 || exp > len(float32Pow10)-1 {
+			return 0, false
+		}
+		f32 := float32(mant)
+		if exp < 0 {
+			f32 /= float32Pow10[-exp]
+		} else {
+			f32 *= float32Pow10[exp]
+		}
+		f = float64(f32)
+	} else {
+		if mant > 1<<53 || exp < -len(float64Pow10)+1 || exp > len(float64Pow10)-1 {
+			return 0, false
+		}
+		f = float64(mant)
+		if exp < 0 {
+			f /= float64Pow10[-exp]
+		} else {
+			f *= float64Pow10[exp]
+		}
+	}
+	if neg {
+		f = -f
+	}
+	return f, true
+}
@@ -0,0 +1,129 @@
+package jsonstream
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestIsInteger(t *testing.T) {
+	cases := []struct {
+		value   string
+		integer bool
+		safe    bool
+	}{
+		{"0", true, true},
+		{"-0", true, true},
+		{"0.0e-5", true, true},
+		{"123", true, true},
+		{"-123", true, true},
+		{"1.0", true, true},
+		{"1.5", false, false},
+		{"1.5e1", true, true},
+		{"15e-1", false, false},
+		{"150e-1", true, true},
+		{"1e-1", false, false},
+		{"9007199254740991", true, true},
+		{"-9007199254740991", true, true},
+		{"9007199254740992", true, false},
+		{"9.007199254740991e15", true, true},
+		{"1e16", true, false},
+		{"1e999999999999999999999", true, false},
+		{"1e-999999999999999999999", false, false},
+		{"123456789012345678901234567890", true, false},
+	}
+	for _, c := range cases {
+		tok := Token{Kind: Number, Value: []byte(c.value)}
+		if tok.IsInteger() != c.integer {
+			t.Errorf("Expected IsInteger() == %v for %v", c.integer, c.value)
+		}
+		if tok.IsSafeInteger() != c.safe {
+			t.Errorf("Expected IsSafeInteger() == %v for %v", c.safe, c.value)
+		}
+	}
+
+	str := Token{Kind: String, Value: []byte("1")}
+	if str.IsInteger() || str.IsSafeInteger() {
+		t.Errorf("Expected false for String token")
+	}
+}
+
+func TestNumberParts(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected NumberParts
+	}{
+		{"0", NumberParts{Integer: []byte("0")}},
+		{"-12", NumberParts{Negative: true, Integer: []byte("12")}},
+		{"1.50e+2", NumberParts{Integer: []byte("1"), Fraction: []byte("50"), Exponent: 2}},
+		{"-0.001E-7", NumberParts{Negative: true, Integer: []byte("0"), Fraction: []byte("001"), Exponent: -7}},
+		{"5e99999999999999999999", NumberParts{Integer: []byte("5"), Exponent: 1 << 30}},
+	}
+	for _, c := range cases {
+		tok := Token{Kind: Number, Value: []byte(c.value)}
+		got := tok.NumberParts()
+		if got.Negative != c.expected.Negative || string(got.Integer) != string(c.expected.Integer) || string(got.Fraction) != string(c.expected.Fraction) || got.Exponent != c.expected.Exponent {
+			t.Errorf("For %v expected %+v, got %+v", c.value, c.expected, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic")
+		}
+	}()
+	tok := Token{Kind: String, Value: []byte("1")}
+	tok.NumberParts()
+}
+
+func TestParseNumber(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var values []string
+	for range 20000 {
+		var b []byte
+		if r.Intn(2) == 0 {
+			b = append(b, '-')
+		}
+		b = strconv.AppendUint(b, uint64(r.Int63n(1<<uint(r.Intn(62)+1))), 10)
+		if r.Intn(2) == 0 {
+			b = append(b, '.')
+			b = strconv.AppendUint(b, uint64(r.Int63n(1000000)), 10)
+		}
+		if r.Intn(2) == 0 {
+			b = append(b, 'e')
+			b = strconv.AppendInt(b, int64(r.Intn(60)-30), 10)
+		}
+		values = append(values, string(b))
+	}
+	values = append(values, "0", "-0", "9007199254740993", "1e23", "1e400", "-1e400", "4.9e-325", "0.1", "123456789012345678901234567890")
+
+	for _, v := range values {
+		expected, expectedErr := strconv.ParseFloat(v, 64)
+		got, err := ParseNumber([]byte(v))
+		if math.Float64bits(got) != math.Float64bits(expected) || (err == nil) != (expectedErr == nil) {
+			t.Fatalf("For %v expected %v (error %v), got %v (error %v)", v, expected, expectedErr, got, err)
+		}
+
+		expected, expectedErr = strconv.ParseFloat(v, 32)
+		tok := Token{Kind: Number, Value: []byte(v)}
+		if f := tok.AsFloat32(); math.Float32bits(f) != math.Float32bits(float32(expected)) {
+			t.Fatalf("For %v expected float32 %v (error %v), got %v", v, float32(expected), expectedErr, f)
+		}
+	}
+
+	for _, v := range []string{"", "-", "+1", "1.", ".5", "1e", "0x10", "1_000", "Inf", "NaN", " 1"} {
+		if _, err := ParseNumber([]byte(v)); !errors.Is(err, strconv.ErrSyntax) {
+			t.Errorf("Expected syntax error for %q, got %v", v, err)
+		}
+	}
+	if _, err := ParseNumber([]byte("1e400")); !errors.Is(err, strconv.ErrRange) || err.(*strconv.NumError).Func != "ParseNumber" {
+		t.Errorf("Expected range error, got %v", err)
+	}
+
+	b := []byte("-12345.678e-3")
+	if allocs := testing.AllocsPerRun(100, func() { ParseNumber(b) }); allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
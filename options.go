@@ -0,0 +1,137 @@
+package jsonstream
+
+// Option configures a Parser created by NewParser.
+type Option func(*Parser)
+
+// NewParser returns a Parser configured with the given options. A Parser can
+// also be configured by setting its fields directly (the zero value is a valid
+// Parser that accepts only standard JSON), but options remain source
+// compatible as new configuration is added.
+func NewParser(opts ...Option) *Parser {
+	p := &Parser{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithComments allows /* */ and // comments in the input (see
+// Parser.AllowComments).
+func WithComments() Option {
+	return func(p *Parser) { p.AllowComments = true }
+}
+
+// WithTrailingCommas allows trailing commas in arrays and objects (see
+// Parser.AllowTrailingCommas).
+func WithTrailingCommas() Option {
+	return func(p *Parser) { p.AllowTrailingCommas = true }
+}
+
+// WithMultipleValues allows a sequence of top-level values (see
+// Parser.AllowMultipleValues).
+func WithMultipleValues() Option {
+	return func(p *Parser) { p.AllowMultipleValues = true }
+}
+
+// WithKeyTokens causes a Key token to be yielded before each object member
+// (see Parser.EmitKeyTokens).
+func WithKeyTokens() Option {
+	return func(p *Parser) { p.EmitKeyTokens = true }
+}
+
+// WithWhitespace causes a Whitespace token to be yielded for each run of
+// whitespace (see Parser.EmitWhitespace).
+func WithWhitespace() Option {
+	return func(p *Parser) { p.EmitWhitespace = true }
+}
+
+// WithLineTerminators sets the line terminator policy (see
+// Parser.LineTerminators).
+func WithLineTerminators(policy LineTerminatorPolicy) Option {
+	return func(p *Parser) { p.LineTerminators = policy }
+}
+
+// WithHook sets the hook used to recognize custom syntax (see Parser.Hook).
+func WithHook(hook TokenHook) Option {
+	return func(p *Parser) { p.Hook = hook }
+}
+
+// WithFilename sets the name of the input (see Parser.Filename).
+func WithFilename(name string) Option {
+	return func(p *Parser) { p.Filename = name }
+}
+
+// WithVersion selects the version of the token stream behavior (see
+// Parser.Version).
+func WithVersion(version TokenStreamVersion) Option {
+	return func(p *Parser) { p.Version = version }
+}
+
+// WithMaxDepth limits the nesting depth of arrays and objects (see
+// Parser.MaxDepth).
+func WithMaxDepth(n int) Option {
+	return func(p *Parser) { p.MaxDepth = n }
+}
+
+// WithMaxKeyBytes limits the length of object keys (see Parser.MaxKeyBytes).
+func WithMaxKeyBytes(n int) Option {
+	return func(p *Parser) { p.MaxKeyBytes = n }
+}
+
+// WithKeyValidator sets a function to check each object key (see
+// Parser.ValidateKey).
+func WithKeyValidator(validate func(key []byte) error) Option {
+	return func(p *Parser) { p.ValidateKey = validate }
+}
+
+// WithStopAfterFirstValue stops tokenizing once the first top-level value is
+// complete (see Parser.StopAfterFirstValue).
+func WithStopAfterFirstValue() Option {
+	return func(p *Parser) { p.StopAfterFirstValue = true }
+}
+
+// WithCommas sets the comma policy (see Parser.Commas).
+func WithCommas(policy CommaPolicy) Option {
+	return func(p *Parser) { p.Commas = policy }
+}
+
+// WithQuota sets a function to check the resources used by tokenization (see
+// Parser.Quota).
+func WithQuota(quota QuotaFunc) Option {
+	return func(p *Parser) { p.Quota = quota }
+}
+
+// WithJSONSeq tokenizes input as a JSON text sequence (see Parser.JSONSeq).
+func WithJSONSeq() Option {
+	return func(p *Parser) { p.JSONSeq = true }
+}
+
+// WithExtraWhitespace treats the given characters as whitespace between tokens
+// (see Parser.ExtraWhitespace and UnicodeWhitespace).
+func WithExtraWhitespace(chars string) Option {
+	return func(p *Parser) { p.ExtraWhitespace = chars }
+}
+
+// WithMaxErrors limits the number of error tokens yielded (see
+// Parser.MaxErrors).
+func WithMaxErrors(n int) Option {
+	return func(p *Parser) { p.MaxErrors = n }
+}
+
+// WithMessages sets a function to give the messages of error tokens (see
+// Parser.Messages and MessageCatalog).
+func WithMessages(messages func(t Token) string) Option {
+	return func(p *Parser) { p.Messages = messages }
+}
+
+// WithReaderBuffer sets the buffer used by TokenizeReader (see
+// Parser.ReaderBuffer).
+func WithReaderBuffer(b *ReaderBuffer) Option {
+	return func(p *Parser) { p.ReaderBuffer = b }
+}
+
+// WithRequireASCII requires the input to be pure ASCII (see
+// Parser.RequireASCII).
+func WithRequireASCII() Option {
+	return func(p *Parser) { p.RequireASCII = true }
+}
@@ -0,0 +1,259 @@
+package jsonstream
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewParser(t *testing.T) {
+	p := NewParser(WithComments(), WithTrailingCommas(), WithFilename("config.json"))
+	if !p.AllowComments || !p.AllowTrailingCommas || p.Filename != "config.json" {
+		t.Errorf("Options not applied: %+v", p)
+	}
+	if !succeedsWith(p, "[1, /* two */ 2,]") {
+		t.Errorf("Expected comments and trailing commas to be accepted")
+	}
+
+	if !reflect.DeepEqual(*NewParser(), Parser{}) {
+		t.Errorf("Expected NewParser with no options to return a zero-value Parser")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	p := NewParser(WithMaxDepth(2))
+	inputs := map[string]string{
+		`[[1]]`:           `[[1]]`,
+		`{"a":[1]}`:       `{"a":[1]}`,
+		`[[[1]]]`:         `[[<error: Maximum nesting depth exceeded>`,
+		`{"a":{"b":{}}}`:  `{"a":{<error: Maximum nesting depth exceeded>`,
+		`[[1],[2],[[3]]]`: `[[1],[2],[<error: Maximum nesting depth exceeded>`,
+	}
+	for input, expected := range inputs {
+		if got := compactJSON(p.Tokenize([]byte(input))); got != expected {
+			t.Errorf("For %v expected %v, got %v", input, expected, got)
+		}
+	}
+
+	if !succeedsWith(&Parser{}, "[[[[[[1]]]]]]") {
+		t.Errorf("Expected no depth limit by default")
+	}
+
+	mp := NewParser(WithMaxDepth(1), WithMultipleValues())
+	if got := compactJSON(mp.Tokenize([]byte("[1] [2] [[3]]"))); got != "[1],[2],[<error: Maximum nesting depth exceeded>" {
+		t.Errorf("Unexpected result for multiple values: %v", got)
+	}
+}
+
+func TestKeyValidation(t *testing.T) {
+	noControl := func(key []byte) error {
+		for _, c := range key {
+			if c < 0x20 {
+				return fmt.Errorf("control character %q", c)
+			}
+		}
+		return nil
+	}
+	p := NewParser(WithMaxKeyBytes(3), WithKeyValidator(noControl))
+	inputs := map[string]string{
+		`{"abc":1,"d":[2]}`:        `{"abc":1,"d":[2]}`,
+		`{"abcd":1,"e":2}`:         `{<error: Key is longer than 3 bytes>,"abcd":1,"e":2}`,
+		`[{"\u00e9t\u00e9":{}}]`:   `[{<error: Key is longer than 3 bytes>,"été":{}}]`,
+		`{"a\tb":1}`:               `{<error: Invalid key: control character '\t'>,"a\tb":1}`,
+		`{"a":{"\n":null,"ok":1}}`: `{"a":{<error: Invalid key: control character '\n'>,"\n":null,"ok":1}}`,
+	}
+	for input, expected := range inputs {
+		if got := compactJSON(p.Tokenize([]byte(input))); got != expected {
+			t.Errorf("For %v expected %v, got %v", input, expected, got)
+		}
+	}
+
+	var errTok Token
+	for tok := range p.Tokenize([]byte("{\"a\": 1,\n  \"long\": 2}")) {
+		if IsError(tok.Kind) {
+			errTok = tok
+		}
+	}
+	if errTok.Kind != ErrorInvalidKey || errTok.Line != 2 || errTok.Col != 4 || errTok.Start != 11 || errTok.End != 16 {
+		t.Errorf("Unexpected error %v (%v-%v)", errTok, errTok.Start, errTok.End)
+	}
+
+	if !succeedsWith(&Parser{}, `{"a long key":1}`) {
+		t.Errorf("Expected no key limit by default")
+	}
+}
+
+func TestStopAfterFirstValue(t *testing.T) {
+	p := NewParser(WithStopAfterFirstValue(), WithComments())
+	inputs := map[string]string{
+		`{"a": 1} garbage`:      `{"a":1}`,
+		`/* c */ [1, 2]{`:       `[1,2]`,
+		"\"str\"\x00\x01":       `"str"`,
+		`123 456`:               `123`,
+		`[1, 2`:                 `[1,2,<error: Unexpected EOF inside array>`,
+		`{"a": [1, 2,]} "next"`: `{"a":[1,2,<error: Trailing ','>]}`,
+	}
+	for input, expected := range inputs {
+		if got := compactJSON(p.Tokenize([]byte(input))); got != expected {
+			t.Errorf("For %q expected %v, got %v", input, expected, got)
+		}
+	}
+
+	input := []byte(`{"len": 3}abc`)
+	for range p.Tokenize(input) {
+	}
+	if r := p.ValueRanges(); len(r) != 1 || string(input[r[0].End+1:]) != "abc" {
+		t.Errorf("Unexpected value ranges %v", r)
+	}
+}
+
+func TestCommaPolicies(t *testing.T) {
+	inputs := []string{`[1,2]`, `[1,2,]`, `[1,,3]`, `[,1]`, `[,]`, `[,,]`, `[1,,]`, `{"a":1,}`, `{,"a":1,,"b":2,,}`, `{,}`}
+	expected := map[CommaPolicy][]string{
+		CommasStrict: {
+			`[1,2]`,
+			`[1,2,<error: Trailing ','>]`,
+			`[1,<error: Unexpected ',' inside array>,3]`,
+			`[<error: Unexpected ',' inside array>,1]`,
+			`[<error: Unexpected ',' inside array>,<error: Trailing ','>]`,
+			`[<error: Unexpected ',' inside array>,<error: Unexpected ',' inside array>,<error: Trailing ','>]`,
+			`[1,<error: Unexpected ',' inside array>,<error: Trailing ','>]`,
+			`{"a":1,<error: Trailing ','>}`,
+			`{<error: Unexpected ',' inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected token inside object>,<error: Unexpected token>,<error: Unexpected ',' inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,"":"b",<error: Unexpected token>,<error: Unexpected token inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected token inside object>}`,
+			`{<error: Unexpected ',' inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected EOF>`,
+		},
+		CommasAllowTrailing: {
+			`[1,2]`,
+			`[1,2]`,
+			`[1,<error: Unexpected ',' inside array>,3]`,
+			`[<error: Unexpected ',' inside array>,1]`,
+			`[<error: Unexpected ',' inside array>]`,
+			`[<error: Unexpected ',' inside array>,<error: Unexpected ',' inside array>]`,
+			`[1,<error: Unexpected ',' inside array>]`,
+			`{"a":1}`,
+			`{<error: Unexpected ',' inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected token inside object>,<error: Unexpected token>,<error: Unexpected ',' inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,"":"b",<error: Unexpected token>,<error: Unexpected token inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected token inside object>}`,
+			`{<error: Unexpected ',' inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected EOF>`,
+		},
+		CommasLenient: {
+			`[1,2]`,
+			`[1,2]`,
+			`[1,null,3]`,
+			`[null,1]`,
+			`[null]`,
+			`[null,null]`,
+			`[1,null]`,
+			`{"a":1}`,
+			`{"a":1,"b":2}`,
+			`{}`,
+		},
+	}
+	for policy, outputs := range expected {
+		p := NewParser(WithCommas(policy))
+		for i, input := range inputs {
+			if got := compactJSON(p.Tokenize([]byte(input))); got != outputs[i] {
+				t.Errorf("For %v with policy %v expected %v, got %v", input, policy, outputs[i], got)
+			}
+		}
+	}
+
+	p := NewParser(WithCommas(CommasLenient))
+	for tok := range p.Tokenize([]byte(`[1,,3]`)) {
+		if tok.Kind == Null && (tok.Start != 3 || tok.End != 2 || tok.Col != 4) {
+			t.Errorf("Unexpected elided element %+v", tok)
+		}
+	}
+	if got := compactJSON(p.TokenizeSelected([]byte(`[,[1],,{"a":1,,"b":2}]`), []any{1}, []any{3, "a"})); got != `[[1],{"a":1}]` {
+		t.Errorf("Unexpected selected tokens %v", got)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := []byte(`[@, #, %, ^, 1]`)
+	var unlimited Parser
+	all := len(slices.Collect(unlimited.Tokenize(input)))
+
+	p := NewParser(WithMaxErrors(2))
+	tokens := slices.Collect(p.Tokenize(input))
+	if len(tokens) >= all || !IsError(tokens[len(tokens)-1].Kind) {
+		t.Errorf("Expected tokenization to halt at the second error, got %v", tokens)
+	}
+	if len(p.Errors()) != 2 {
+		t.Errorf("Expected 2 errors, got %v", p.Errors())
+	}
+
+	p = NewParser(WithMaxErrors(100))
+	if got := len(slices.Collect(p.Tokenize(input))); got != all {
+		t.Errorf("Expected %v tokens below the limit, got %v", all, got)
+	}
+}
+
+func TestExtraWhitespace(t *testing.T) {
+	const input = "{\"a\":\u00a0[1,\ftrue\u3000,\ufeffnull]}\ufeff"
+	var strict Parser
+	if got := compactJSON(strict.Tokenize([]byte(input))); !strings.Contains(got, "<error") {
+		t.Errorf("Expected errors in strict mode, got %v", got)
+	}
+
+	p := NewParser(WithExtraWhitespace(UnicodeWhitespace))
+	if got := compactJSON(p.Tokenize([]byte(input))); got != `{"a":[1,true,null]}` {
+		t.Errorf("Unexpected tokens %v", got)
+	}
+	if got := compactJSON(p.TokenizeSelected([]byte(input), []any{"a", 2})); got != `{"a":[null]}` {
+		t.Errorf("Unexpected selected tokens %v", got)
+	}
+	if got := compactJSON(p.Tokenize([]byte("[\"\u00a0\"]"))); got != "[\"\u00a0\"]" {
+		t.Errorf("Expected strings to be unaffected, got %v", got)
+	}
+
+	p = NewParser(WithExtraWhitespace("\f"), WithWhitespace())
+	var kinds []string
+	for tok := range p.Tokenize([]byte("[\f1\u00a0]")) {
+		kinds = append(kinds, tok.Kind.String())
+	}
+	if fmt.Sprint(kinds) != "[ArrayStart Whitespace Number Error Error ArrayEnd]" {
+		t.Errorf("Expected only the given characters to be whitespace, got %v", kinds)
+	}
+
+	p = NewParser(WithExtraWhitespace(UnicodeWhitespace), WithLineTerminators(LineTerminatorUnicode))
+	for tok := range p.Tokenize([]byte("[\u20281]")) {
+		if tok.Kind == Number && (tok.Line != 2 || tok.Start != 4) {
+			t.Errorf("Expected U+2028 to terminate the line, got %v", tok)
+		}
+	}
+}
+
+func TestRequireASCII(t *testing.T) {
+	const input = "{\"a\": \"caf\u00e9\", \"b\": [1,\u00a02], \"\u00fc\\u00fc\": \"\\u00e9\"}"
+	p := NewParser(WithRequireASCII(), WithExtraWhitespace(UnicodeWhitespace))
+	var errs []string
+	for tok := range p.Tokenize([]byte(input)) {
+		if IsError(tok.Kind) {
+			errs = append(errs, fmt.Sprintf("%v:%v %v-%v %v", tok.Line, tok.Col, tok.Start, tok.End, tok.ErrorMsg))
+		}
+	}
+	expected := "[1:11 10-11 Non-ASCII character U+00E9 1:24 23-24 Non-ASCII character U+00A0 1:31 30-31 Non-ASCII character U+00FC]"
+	if fmt.Sprint(errs) != expected {
+		t.Errorf("Expected %v, got %v", expected, errs)
+	}
+	if errs := p.Errors(); len(errs) != 3 || errs[0].Kind != ErrorNonASCII {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	p = NewParser(WithRequireASCII(), WithComments())
+	for tok := range p.Tokenize([]byte("[1, // \u00e9\n  2]")) {
+		if IsError(tok.Kind) && (tok.ErrorMsg != "Non-ASCII character U+00E9" || tok.Line != 1 || tok.Col != 8) {
+			t.Errorf("Unexpected error %v", tok)
+		}
+	}
+	if errs := p.Errors(); len(errs) != 1 {
+		t.Errorf("Expected an error for the comment, got %v", errs)
+	}
+	if got := compactJSON(p.TokenizeSelected([]byte("[\"\u00e9\", 1]"), []any{1})); got != `[<error: Non-ASCII character U+00E9>,1]` {
+		t.Errorf("Expected skipped values to be checked, got %v", got)
+	}
+	if got := compactJSON(p.TokenizeReader(strings.NewReader("[\"\\u00e9\"]"))); got != `["é"]` {
+		t.Errorf("Expected escapes to be allowed, got %v", got)
+	}
+}
@@ -0,0 +1,171 @@
+package jsonstream
+
+import (
+	"encoding/json"
+	"errors"
+	"iter"
+	"slices"
+)
+
+// OrderedMap is a JSON object that preserves the order of its members. It is
+// the type of the objects decoded by DecodeOrdered. The zero value is an empty
+// map ready to use.
+type OrderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+// Len returns the number of members.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Get returns the value of the member with the given key.
+func (m *OrderedMap) Get(key string) (any, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Set sets the value of the member with the given key. A new member is added
+// after the existing members, and an existing member keeps its position.
+func (m *OrderedMap) Set(key string, value any) {
+	if m.values == nil {
+		m.values = make(map[string]any)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Delete removes the member with the given key, if any.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	m.keys = slices.DeleteFunc(m.keys, func(k string) bool { return k == key })
+}
+
+// Keys returns the keys of the members in order. The slice must not be
+// modified.
+func (m *OrderedMap) Keys() []string {
+	return m.keys
+}
+
+// All returns a sequence of the keys and values of the members in order.
+func (m *OrderedMap) All() iter.Seq2[string, any] {
+	return func(yield func(string, any) bool) {
+		for _, k := range m.keys {
+			if !yield(k, m.values[k]) {
+				return
+			}
+		}
+	}
+}
+
+// MarshalJSON encodes the map as a JSON object with its members in order.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, k := range m.keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendQuotedString(buf, []byte(k))
+		buf = append(buf, ':')
+		v, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, v...)
+	}
+	return append(buf, '}'), nil
+}
+
+// UnmarshalJSON decodes a JSON object (as for DecodeOrdered) into the map,
+// replacing its members.
+func (m *OrderedMap) UnmarshalJSON(data []byte) error {
+	var p Parser
+	v, err := DecodeOrdered(p.Tokenize(data))
+	if err != nil {
+		return err
+	}
+	om, ok := v.(*OrderedMap)
+	if !ok {
+		return errNotAnObject
+	}
+	*m = *om
+	return nil
+}
+
+var errNotAnObject = errors.New("jsonstream: cannot decode non-object value into OrderedMap")
+
+// DecodeOrdered decodes the first value in the token sequence. Objects are
+// decoded as *OrderedMap, arrays as []any, strings as string, numbers as
+// json.Number (so that their literals are preserved), booleans as bool, null
+// as nil and Extension tokens as their Value (as a string). If an object has
+// several members with the same key, the last value is kept at the position
+// of the first. Comments, Key tokens and Whitespace tokens are ignored. If the
+// input contains an error before the end of the first value, the error (as
+// returned by Token.AsError) is returned. If the sequence ends before the end
+// of the first value, or its array and object tokens are unbalanced,
+// ErrMalformedTokenSequence is returned.
+func DecodeOrdered(tokens iter.Seq[Token]) (any, error) {
+	var stack []any // the *OrderedMap and *[]any values being decoded
+	for t := range tokens {
+		if IsError(t.Kind) {
+			return nil, t.AsError()
+		}
+		var v any
+		switch t.Kind {
+		case Comment, Key, Whitespace:
+			continue
+		case ArrayStart:
+			stack = append(stack, &[]any{})
+			continue
+		case ObjectStart:
+			stack = append(stack, &OrderedMap{})
+			continue
+		case ArrayEnd, ObjectEnd:
+			if len(stack) == 0 {
+				return nil, ErrMalformedTokenSequence
+			}
+			switch c := stack[len(stack)-1].(type) {
+			case *[]any:
+				if t.Kind != ArrayEnd {
+					return nil, ErrMalformedTokenSequence
+				}
+				v = *c
+			case *OrderedMap:
+				if t.Kind != ObjectEnd {
+					return nil, ErrMalformedTokenSequence
+				}
+				v = c
+			}
+			stack = stack[:len(stack)-1]
+		case String:
+			v = string(t.Value)
+		case Number:
+			v = json.Number(t.Value)
+		case True:
+			v = true
+		case False:
+			v = false
+		case Null:
+			v = nil
+		default:
+			v = string(t.Value)
+		}
+
+		if len(stack) == 0 {
+			return v, nil
+		}
+		switch c := stack[len(stack)-1].(type) {
+		case *[]any:
+			*c = append(*c, v)
+		case *OrderedMap:
+			c.Set(string(t.Key), v)
+		}
+	}
+	return nil, ErrMalformedTokenSequence
+}
@@ -0,0 +1,85 @@
+package jsonstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOrdered(t *testing.T) {
+	p := Parser{AllowComments: true}
+	v, err := DecodeOrdered(p.Tokenize([]byte(`{"z": 1, /* c */ "a": [true, null, "s", {}], "m": {"y": 1.50, "b": false}, "z": 2}`)))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	m, ok := v.(*OrderedMap)
+	if !ok {
+		t.Fatalf("Expected *OrderedMap, got %T", v)
+	}
+	if strings.Join(m.Keys(), ",") != "z,a,m" || m.Len() != 3 {
+		t.Errorf("Unexpected keys %v", m.Keys())
+	}
+	if z, _ := m.Get("z"); z != json.Number("2") {
+		t.Errorf("Expected last value of duplicate key, got %v", z)
+	}
+	a, _ := m.Get("a")
+	if !reflect.DeepEqual(a, []any{true, nil, "s", &OrderedMap{}}) {
+		t.Errorf("Unexpected array %#v", a)
+	}
+	inner, _ := m.Get("m")
+	if strings.Join(inner.(*OrderedMap).Keys(), ",") != "y,b" {
+		t.Errorf("Unexpected inner keys %v", inner.(*OrderedMap).Keys())
+	}
+
+	out, err := json.Marshal(m)
+	if err != nil || string(out) != `{"z":2,"a":[true,null,"s",{}],"m":{"y":1.50,"b":false}}` {
+		t.Errorf("Unexpected encoding %s %v", out, err)
+	}
+
+	for _, input := range []string{`[1, 2,]`, `[1, 2`, ``} {
+		if _, err := DecodeOrdered(p.Tokenize([]byte(input))); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+	if _, err := DecodeOrdered(func(yield func(Token) bool) { yield(Token{Kind: ObjectEnd}) }); !errors.Is(err, ErrMalformedTokenSequence) {
+		t.Errorf("Expected ErrMalformedTokenSequence, got %v", err)
+	}
+
+	v, err = DecodeOrdered(p.Tokenize([]byte(`"x"`)))
+	if v != "x" || err != nil {
+		t.Errorf("Unexpected result %v %v", v, err)
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	var m OrderedMap
+	m.Set("b", 1)
+	m.Set("a", 2)
+	m.Set("c", 3)
+	m.Set("b", 4)
+	m.Delete("a")
+	m.Delete("missing")
+	var got []string
+	for k, v := range m.All() {
+		got = append(got, fmt.Sprintf("%v=%v", k, v))
+	}
+	if strings.Join(got, " ") != "b=4 c=3" {
+		t.Errorf("Unexpected members %v", got)
+	}
+
+	var s struct {
+		Config *OrderedMap `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(`{"config": {"x": 1, "w": {"v": []}}}`), &s); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if out, _ := json.Marshal(s.Config); string(out) != `{"x":1,"w":{"v":[]}}` {
+		t.Errorf("Unexpected round trip %s", out)
+	}
+	if err := json.Unmarshal([]byte(`[1]`), &m); err == nil {
+		t.Errorf("Expected error decoding array into OrderedMap")
+	}
+}
@@ -1,9 +1,9 @@
 package jsonstream
 
 import (
-	"encoding/json"
 	"fmt"
 	"iter"
+	"strconv"
 	"strings"
 )
 
@@ -67,7 +67,8 @@ func SliceToPath(elems []any) Path {
 }
 
 // PathEquals returns true iff the given path is equivalent to the given
-// sequence of int and string values.
+// sequence of int and string values. FoldKey values can also be used to
+// compare keys case-insensitively.
 func PathEquals(path Path, elems []any) bool {
 	p := path.end
 	for i := len(elems) - 1; i >= 0; i-- {
@@ -84,8 +85,83 @@ func PathEquals(path Path, elems []any) bool {
 			if p.index >= 0 || p.key != e {
 				return false
 			}
+		case FoldKey:
+			if p.index >= 0 || !e.matches(p.key) {
+				return false
+			}
+		default:
+			panic("PathEquals: invalid element type; must be int, string or FoldKey")
+		}
+		p = p.previous
+	}
+	return p == nil
+}
+
+// Wildcard can be used as an element of a pattern passed to PathMatches (and
+// to the stages that accept patterns) to match any single key or index.
+type Wildcard struct{}
+
+// FoldKey can be used as an element of a pattern passed to PathMatches (and
+// to the stages that accept patterns), or of the sequence passed to
+// PathEquals, to match an object key case-insensitively. This is useful for
+// payloads whose producers are inconsistent about the case of keys. ASCII
+// letters are compared case-insensitively, and if Unicode is set, keys are
+// instead compared under Unicode case folding (as by strings.EqualFold), so
+// that (e.g.) "ÉTÉ" also matches "été".
+type FoldKey struct {
+	Key     string
+	Unicode bool
+}
+
+// matches reports whether the key k matches key.
+func (k FoldKey) matches(key string) bool {
+	if k.Unicode {
+		return strings.EqualFold(k.Key, key)
+	}
+	if len(k.Key) != len(key) {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		a, b := k.Key[i], key[i]
+		if 'A' <= a && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
+
+// PathMatches returns true iff the given path matches the given pattern. A
+// pattern is a sequence of int, string, Wildcard and FoldKey values. It
+// matches a path of the same length if each int or string element is equal
+// to the corresponding path element and each FoldKey element matches it.
+func PathMatches(path Path, pattern []any) bool {
+	p := path.end
+	for i := len(pattern) - 1; i >= 0; i-- {
+		if p == nil {
+			return false
+		}
+		switch e := pattern[i].(type) {
+		case int:
+			if p.index < 0 || p.index != e {
+				return false
+			}
+		case string:
+			if p.index >= 0 || p.key != e {
+				return false
+			}
+		case FoldKey:
+			if p.index >= 0 || !e.matches(p.key) {
+				return false
+			}
+		case Wildcard:
 		default:
-			panic("PathEquals: invalid element type; must be int or string")
+			panic("PathMatches: invalid element type; must be int, string, Wildcard or FoldKey")
 		}
 		p = p.previous
 	}
@@ -94,28 +170,85 @@ func PathEquals(path Path, elems []any) bool {
 
 // String() returns a string representation of the path. The string is a
 // sequence of JavaScript indexation operators that can be used to access the
-// value (e.g. [0]["foo"][1]]).
+// value (e.g. [0]["foo"][1]]). Keys are quoted as JSON strings.
 func (p Path) String() string {
-	var sb strings.Builder
-	var rec func(*pathNode)
-	rec = func(p *pathNode) {
-		if p == nil {
-			return
+	return string(p.appendString(nil, func(buf []byte, key string) []byte {
+		buf = append(buf, '[')
+		buf = appendQuotedString(buf, []byte(key))
+		return append(buf, ']')
+	}))
+}
+
+// JSString returns a JavaScript expression suffix for the path that uses dot
+// notation for keys that are valid identifiers (e.g. [0].foo["a b"]).
+func (p Path) JSString() string {
+	return string(p.appendString(nil, func(buf []byte, key string) []byte {
+		if isJSIdentifier(key) {
+			return append(append(buf, '.'), key...)
 		}
-		rec(p.previous)
-		if p.index == notAnIndex {
-			kb, err := json.Marshal(p.key)
-			if err != nil {
-				panic("Error marshaling string in jsonstream.Path.String()")
-			}
-			k := string(kb)
-			sb.WriteString(fmt.Sprintf("[%v]", k))
-		} else {
-			sb.WriteString(fmt.Sprintf("[%v]", p.index))
+		buf = append(buf, '[')
+		buf = appendQuotedString(buf, []byte(key))
+		return append(buf, ']')
+	}))
+}
+
+// GoIndexString returns a sequence of Go index expressions for the path
+// (e.g. [0]["foo"][1]), with keys quoted as Go string literals, for accessing
+// the value decoded into nested []any and map[string]any values (after type
+// assertions).
+func (p Path) GoIndexString() string {
+	return string(p.appendString(nil, func(buf []byte, key string) []byte {
+		buf = append(buf, '[')
+		buf = strconv.AppendQuote(buf, key)
+		return append(buf, ']')
+	}))
+}
+
+// JSONPointer returns the JSON Pointer (RFC 6901) for the path (e.g.
+// /0/foo/1). The pointer for the empty path is the empty string.
+func (p Path) JSONPointer() string {
+	var buf []byte
+	for _, elem := range PathToSlice(p) {
+		buf = append(buf, '/')
+		switch e := elem.(type) {
+		case int:
+			buf = strconv.AppendInt(buf, int64(e), 10)
+		case string:
+			buf = append(buf, strings.NewReplacer("~", "~0", "/", "~1").Replace(e)...)
 		}
 	}
-	rec(p.end)
-	return sb.String()
+	return string(buf)
+}
+
+// appendString appends the path to buf, writing indices in brackets and keys
+// using appendKey.
+func (p Path) appendString(buf []byte, appendKey func(buf []byte, key string) []byte) []byte {
+	for _, elem := range PathToSlice(p) {
+		switch e := elem.(type) {
+		case int:
+			buf = append(buf, '[')
+			buf = strconv.AppendInt(buf, int64(e), 10)
+			buf = append(buf, ']')
+		case string:
+			buf = appendKey(buf, e)
+		}
+	}
+	return buf
+}
+
+// isJSIdentifier reports whether s is an ASCII JavaScript identifier, which
+// can follow '.' in a property access.
+func isJSIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isIdentStart(c) && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
 }
 
 func addIndex(pool *[]pathNode, p **pathNode, index int) {
@@ -128,13 +261,8 @@ func addKeyLookup(p **pathNode, key string, pool *[]pathNode) {
 
 // simple means of increasing memory locality
 func newPathNode(pool *[]pathNode, previous *pathNode, index int, key string) *pathNode {
-	if *pool == nil {
-		p := make([]pathNode, 128)
-		pool = &p
-	}
 	if len(*pool) == 0 {
-		*pool = nil
-		return newPathNode(pool, previous, index, key)
+		*pool = make([]pathNode, 128)
 	}
 	n := &(*pool)[0]
 	n.previous = previous
@@ -145,35 +273,83 @@ func newPathNode(pool *[]pathNode, previous *pathNode, index int, key string) *p
 }
 
 // WithPaths converts a sequence of Token values into a sequence of
-// TokenWithPath values.
+// TokenWithPath values. ArrayEnd and ObjectEnd tokens are omitted. Tokens that
+// are not values (comments, errors, and Key and Whitespace tokens) have the
+// path of the enclosing array or object, and do not affect the indices of the
+// elements of an array.
 func WithPaths(tokens iter.Seq[Token]) iter.Seq[TokenWithPath] {
-	var pool []pathNode
 	return func(yield func(TokenWithPath) bool) {
-		var currentPath *pathNode
+		var pt pathTracker
 		for t := range tokens {
+			path := pt.next(t)
 			if t.Kind == ArrayEnd || t.Kind == ObjectEnd {
-				currentPath = currentPath.previous
 				continue
 			}
-
-			if currentPath != nil {
-				if currentPath.index == notAnIndex {
-					currentPath = newPathNode(&pool, currentPath.previous, notAnIndex, string(t.Key))
-				} else {
-					currentPath = newPathNode(&pool, currentPath.previous, currentPath.index+1, "")
-				}
-			}
-
-			if !yield(TokenWithPath{t, Path{currentPath}}) {
+			if !yield(TokenWithPath{t, path}) {
 				return
 			}
+		}
+	}
+}
 
-			switch t.Kind {
-			case ArrayStart:
-				addIndex(&pool, &currentPath, -1)
-			case ObjectStart:
-				addKeyLookup(&currentPath, "", &pool)
-			}
+// pathTracker incrementally computes the path of each token in a stream. Unlike
+// WithPaths, it also assigns paths to ArrayEnd and ObjectEnd tokens (the path
+// of the container being closed), and it does not advance the index for
+// tokens that are not values (such as comments).
+type pathTracker struct {
+	pool    []pathNode
+	current *pathNode
+	depth   int
+}
+
+// next returns the path of the given token and updates the tracker's state.
+func (pt *pathTracker) next(t Token) Path {
+	switch {
+	case t.Kind == ArrayEnd || t.Kind == ObjectEnd:
+		if pt.depth > 0 {
+			pt.current = pt.current.previous
+			pt.depth--
+		}
+		return Path{pt.current}
+	case !isValueKind(t.Kind):
+		if pt.depth == 0 {
+			return Path{pt.current}
 		}
+		return Path{pt.current.previous}
+	}
+
+	if pt.depth > 0 {
+		if pt.current.index == notAnIndex {
+			pt.current = newPathNode(&pt.pool, pt.current.previous, notAnIndex, string(t.Key))
+		} else {
+			pt.current = newPathNode(&pt.pool, pt.current.previous, pt.current.index+1, "")
+		}
+	}
+	path := Path{pt.current}
+
+	switch t.Kind {
+	case ArrayStart:
+		addIndex(&pt.pool, &pt.current, -1)
+		pt.depth++
+	case ObjectStart:
+		addKeyLookup(&pt.current, "", &pt.pool)
+		pt.depth++
+	}
+
+	return path
+}
+
+// isContainerEnd returns true for ArrayEnd and ObjectEnd.
+func isContainerEnd(k Kind) bool {
+	return k == ArrayEnd || k == ObjectEnd
+}
+
+// isValueKind returns true for token kinds that represent (the start of) a JSON
+// value.
+func isValueKind(k Kind) bool {
+	switch k {
+	case ObjectStart, ArrayStart, String, Number, True, False, Null, Extension, ErrorLeadingZerosNotPermitted:
+		return true
 	}
+	return false
 }
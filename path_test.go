@@ -3,6 +3,7 @@ package jsonstream
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -120,3 +121,116 @@ func TestWithPath(t *testing.T) {
 		t.Errorf("Expected %v, got %v", expected, out.String())
 	}
 }
+
+func TestWithPathNonValueTokens(t *testing.T) {
+	p := Parser{EmitKeyTokens: true, EmitWhitespace: true, AllowComments: true}
+	var got []string
+	for tp := range WithPaths(p.Tokenize([]byte(`{"a": [1, /* c */ 2], "b": 3}`))) {
+		got = append(got, tp.Token.Kind.String()+" "+tp.Path.String())
+	}
+	expected := []string{
+		"ObjectStart ", "Key ", "Whitespace ", `ArrayStart ["a"]`, `Number ["a"][0]`, `Whitespace ["a"]`,
+		`Comment ["a"]`, `Whitespace ["a"]`, `Number ["a"][1]`, "Whitespace ", "Key ", "Whitespace ", `Number ["b"]`,
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestFoldKey(t *testing.T) {
+	cases := []struct {
+		key      FoldKey
+		path     string
+		expected bool
+	}{
+		{FoldKey{Key: "userId"}, "USERID", true},
+		{FoldKey{Key: "userId"}, "user_id", false},
+		{FoldKey{Key: "\u00e9t\u00e9"}, "\u00c9T\u00c9", false},
+		{FoldKey{Key: "\u00e9t\u00e9", Unicode: true}, "\u00c9T\u00c9", true},
+		{FoldKey{Key: "k", Unicode: true}, "\u212a", true},
+		{FoldKey{Key: "k"}, "\u212a", false},
+	}
+	for _, c := range cases {
+		path := SliceToPath([]any{c.path})
+		if PathMatches(path, []any{c.key}) != c.expected || PathEquals(path, []any{c.key}) != c.expected {
+			t.Errorf("Expected matching %v against %q to give %v", c.key, c.path, c.expected)
+		}
+	}
+}
+
+func TestPathMatches(t *testing.T) {
+	path := Path{
+		end: &pathNode{
+			index: notAnIndex,
+			key:   "b",
+			previous: &pathNode{
+				index: 1,
+				previous: &pathNode{
+					index:    notAnIndex,
+					key:      "a",
+					previous: nil,
+				},
+			},
+		},
+	}
+	matching := [][]any{
+		{"a", 1, "b"},
+		{Wildcard{}, 1, "b"},
+		{"a", Wildcard{}, "b"},
+		{Wildcard{}, Wildcard{}, Wildcard{}},
+		{FoldKey{Key: "A"}, 1, FoldKey{Key: "b"}},
+		{FoldKey{Key: "A", Unicode: true}, 1, "b"},
+	}
+	for _, pattern := range matching {
+		if !PathMatches(path, pattern) {
+			t.Errorf("Expected %v to match %v", pattern, path)
+		}
+	}
+	notMatching := [][]any{
+		{},
+		{"a", 1},
+		{Wildcard{}, Wildcard{}},
+		{"a", 1, "b", Wildcard{}},
+		{"a", "1", "b"},
+		{0, 1, "b"},
+		{"A", 1, "b"},
+		{"a", FoldKey{Key: "1"}, "b"},
+		{"a", 1, FoldKey{Key: "bb"}},
+	}
+	for _, pattern := range notMatching {
+		if PathMatches(path, pattern) {
+			t.Errorf("Expected %v not to match %v", pattern, path)
+		}
+	}
+}
+
+func TestPathRenderings(t *testing.T) {
+	cases := []struct {
+		path                          []any
+		str, js, goIndex, jsonPointer string
+	}{
+		{[]any{}, ``, ``, ``, ``},
+		{[]any{"foo", 0, "bar"}, `["foo"][0]["bar"]`, `.foo[0].bar`, `["foo"][0]["bar"]`, `/foo/0/bar`},
+		{[]any{"a b", "$x_1", "1a", ""}, `["a b"]["$x_1"]["1a"][""]`, `["a b"].$x_1["1a"][""]`, `["a b"]["$x_1"]["1a"][""]`, `/a b/$x_1/1a/`},
+		{[]any{"<&>", "a/b~c"}, `["<&>"]["a/b~c"]`, `["<&>"]["a/b~c"]`, `["<&>"]["a/b~c"]`, `/<&>/a~1b~0c`},
+		{[]any{"q\"\né"}, `["q\"\né"]`, `["q\"\né"]`, `["q\"\né"]`, "/q\"\né"},
+	}
+	for _, c := range cases {
+		// SliceToPath takes the elements of the path from last to first.
+		elems := slices.Clone(c.path)
+		slices.Reverse(elems)
+		p := SliceToPath(elems)
+		if got := p.String(); got != c.str {
+			t.Errorf("%v: expected String %v, got %v", c.path, c.str, got)
+		}
+		if got := p.JSString(); got != c.js {
+			t.Errorf("%v: expected JSString %v, got %v", c.path, c.js, got)
+		}
+		if got := p.GoIndexString(); got != c.goIndex {
+			t.Errorf("%v: expected GoIndexString %v, got %v", c.path, c.goIndex, got)
+		}
+		if got := p.JSONPointer(); got != c.jsonPointer {
+			t.Errorf("%v: expected JSONPointer %q, got %q", c.path, c.jsonPointer, got)
+		}
+	}
+}
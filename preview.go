@@ -0,0 +1,40 @@
+package jsonstream
+
+// PreviewSummary describes the part of the input covered by Parser.Preview.
+type PreviewSummary struct {
+	Truncated bool // true iff the input contains tokens following those returned
+	Offset    int  // the byte index in the input at which the preview stops
+	Depth     int  // the number of arrays and objects left open at Offset
+}
+
+// Preview returns the first maxTokens tokens of the input, together with a
+// summary of where the preview stops. Only the returned tokens (and at most
+// one following token) are scanned, so the cost does not depend on the size
+// of the input. Comments count towards maxTokens when AllowComments is set.
+// If the input is not truncated, Offset is len(inp).
+func (p *Parser) Preview(inp []byte, maxTokens int) ([]Token, PreviewSummary) {
+	var tokens []Token
+	var summary PreviewSummary
+	for t := range p.Tokenize(inp) {
+		if len(tokens) == maxTokens {
+			summary.Truncated = true
+			break
+		}
+		tokens = append(tokens, t)
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			summary.Depth++
+		case ArrayEnd, ObjectEnd:
+			summary.Depth--
+		}
+	}
+
+	summary.Offset = len(inp)
+	if summary.Truncated {
+		summary.Offset = 0
+		if len(tokens) > 0 {
+			summary.Offset = tokens[len(tokens)-1].End + 1
+		}
+	}
+	return tokens, summary
+}
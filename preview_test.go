@@ -0,0 +1,39 @@
+package jsonstream
+
+import (
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	const input = `{"a": [1, 2, 3], "b": {"c": null}}`
+
+	var p Parser
+	tokens, summary := p.Preview([]byte(input), 4)
+	if len(tokens) != 4 || tokens[3].Kind != Number || tokens[3].AsInt() != 2 {
+		t.Errorf("Unexpected tokens %v", tokens)
+	}
+	expected := PreviewSummary{Truncated: true, Offset: 11, Depth: 2}
+	if summary != expected {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+	if input[:summary.Offset] != `{"a": [1, 2` {
+		t.Errorf("Unexpected preview text %v", input[:summary.Offset])
+	}
+
+	tokens, summary = p.Preview([]byte(input), 100)
+	expected = PreviewSummary{Offset: len(input)}
+	if len(tokens) != 10 || summary != expected {
+		t.Errorf("Expected 10 tokens and %+v, got %v tokens and %+v", expected, len(tokens), summary)
+	}
+
+	tokens, summary = p.Preview([]byte(input), 10)
+	if len(tokens) != 10 || summary != expected {
+		t.Errorf("Expected 10 tokens and %+v, got %v tokens and %+v", expected, len(tokens), summary)
+	}
+
+	tokens, summary = p.Preview([]byte(input), 0)
+	expected = PreviewSummary{Truncated: true}
+	if len(tokens) != 0 || summary != expected {
+		t.Errorf("Expected no tokens and %+v, got %v tokens and %+v", expected, len(tokens), summary)
+	}
+}
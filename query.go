@@ -0,0 +1,1171 @@
+package jsonstream
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Query is a compiled query expression (see CompileQuery).
+type Query struct {
+	prefix []any       // the leading path steps of the query, which are evaluated while streaming
+	last   int         // if positive, the element counted from the end of the arrays selected by prefix
+	filter queryFilter // the remainder of the query
+}
+
+// QueryError is returned by CompileQuery if the expression is invalid.
+type QueryError struct {
+	Offset int    // the byte offset in the expression at which the error was found
+	Msg    string // a description of the error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("jsonstream: invalid query at offset %v: %v", e.Offset, e.Msg)
+}
+
+// CompileQuery compiles a query written in a small subset of the jq language.
+// A query is a filter that maps each input value to zero or more output
+// values. The following filters are supported:
+//
+//	.               the input value
+//	.foo, ."foo"    the member with the given key
+//	.[n]            the element at index n (negative indices count from the end)
+//	.[f]            the element or member at each index or key given by f
+//	.[]             each element of an array or member of an object
+//	f | g           the outputs of g applied to each output of f
+//	f, g            the outputs of f followed by the outputs of g
+//	[f]             an array of the outputs of f
+//	f + g, f - g, f * g, f / g, f % g
+//	                arithmetic (+ also concatenates strings and arrays)
+//	f == g, f != g, f < g, f <= g, f > g, f >= g
+//	                comparison (values of different types are ordered null,
+//	                false, true, numbers, strings, arrays, objects)
+//	f and g, f or g, not
+//	                boolean operators (false and null are false and all other
+//	                values are true)
+//	select(f)       the input value if f is true
+//	map(f)          [.[] | f]
+//	length          the length of a string, array or object
+//	keys            the sorted keys of an object or the indices of an array
+//	empty           no output
+//
+// together with number, string, true, false and null literals and
+// parentheses. The path steps can also be applied to other filters (e.g.
+// .a[0].b or (.a, .b)[0]). Unlike in jq, selecting a member or element that
+// does not exist, or selecting from a value that has no members or elements,
+// produces no output (rather than null or an error), and if an object has
+// several members with the same key, each of them is selected. Arithmetic is
+// performed using float64 values.
+func CompileQuery(expr string) (*Query, error) {
+	qp := queryParser{src: expr}
+	n, err := qp.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	qp.skipSpace()
+	if qp.pos < len(qp.src) {
+		return nil, qp.unexpected()
+	}
+	n, prefix := splitQueryPrefix(n)
+	n, last := splitQueryLast(n)
+	return &Query{prefix: prefix, last: last, filter: compileQueryNode(n)}, nil
+}
+
+// Run applies the query to each top-level value in the input and yields the
+// outputs as a sequence of top-level values. The leading path steps of the
+// query (e.g. .items[] in .items[] | select(.price > 10) | .name) are
+// evaluated while streaming, so that only the values they select are
+// buffered. If the path steps end with a negative index (e.g. .items[-2]),
+// only the last elements of the array needed to find the element are
+// buffered. If the input contains an error, or a filter cannot be applied to
+// a value (e.g. when adding a string to a number), an error token is yielded
+// and iteration stops. Comments, Key tokens and Whitespace tokens are
+// discarded.
+func (q *Query) Run(tokens iter.Seq[Token]) iter.Seq[Token] {
+	return q.run(tokens, q.prefix)
+}
+
+// RunAt is like Run except that the query is applied to each value whose path
+// matches the pattern anchor (see PathMatches), rather than to each top-level
+// value, so that the paths in the query are relative to the anchor. For
+// example, with the anchor {"orders", Wildcard{}}, the query .items[-1]
+// selects the last item of each order.
+func (q *Query) RunAt(tokens iter.Seq[Token], anchor []any) iter.Seq[Token] {
+	return q.run(tokens, append(slices.Clip(anchor), q.prefix...))
+}
+
+func (q *Query) run(tokens iter.Seq[Token], prefix []any) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var pt pathTracker
+		var buf []Token
+		var suffix [][]Token // if q.last > 0, a ring of the last q.last elements of the array
+		n := 0               // if q.last > 0, the number of elements of the array
+		depth := 0
+		for t := range tokens {
+			if IsError(t.Kind) {
+				yield(t)
+				return
+			}
+			path := pt.next(t)
+			if !isValueKind(t.Kind) && !isContainerEnd(t.Kind) {
+				continue
+			}
+			if depth == 0 && (!isValueKind(t.Kind) || !PathMatches(path, prefix)) {
+				continue
+			}
+
+			if q.last > 0 {
+				switch {
+				case depth == 0 && t.Kind != ArrayStart:
+					// Only an array has an element at a negative index.
+					continue
+				case depth == 0:
+					n = 0
+				case depth == 1 && isValueKind(t.Kind):
+					if i := n % q.last; i < len(suffix) {
+						suffix[i] = suffix[i][:0]
+					} else {
+						suffix = append(suffix, nil)
+					}
+					n++
+				}
+				if depth > 1 || depth == 1 && isValueKind(t.Kind) {
+					i := (n - 1) % q.last
+					suffix[i] = append(suffix[i], t)
+				}
+			} else {
+				buf = append(buf, t)
+			}
+			switch t.Kind {
+			case ArrayStart, ObjectStart:
+				depth++
+			case ArrayEnd, ObjectEnd:
+				depth--
+			}
+			if depth == 0 {
+				v := buf
+				if q.last > 0 {
+					if n < q.last {
+						continue
+					}
+					v = suffix[n%q.last]
+				}
+				if !q.emit(v, yield) {
+					return
+				}
+				buf = buf[:0]
+			}
+		}
+	}
+}
+
+var errQueryStopped = errors.New("query stopped")
+
+// emit yields the outputs of the query's filter for the value v. It returns
+// false if iteration should stop.
+func (q *Query) emit(v []Token, yield func(Token) bool) bool {
+	err := q.filter(v, func(out []Token) error {
+		for i, t := range out {
+			if i == 0 || i == len(out)-1 {
+				t.Key = nil
+			}
+			if !yield(t) {
+				return errQueryStopped
+			}
+		}
+		return nil
+	})
+	var qe *queryEvalError
+	if errors.As(err, &qe) {
+		start, end := v[0], v[len(v)-1]
+		if qe.value != nil && qe.value[0].Line > 0 {
+			start, end = qe.value[0], qe.value[len(qe.value)-1]
+		}
+		yield(stageError("Query", ErrorQuery, start, end, qe.msg))
+		return false
+	}
+	return err == nil
+}
+
+// queryFilter yields the outputs of a filter for the value v (the tokens of a
+// single value). Yielded values must not be modified. Evaluation stops if
+// yield returns an error.
+type queryFilter func(v []Token, yield func([]Token) error) error
+
+type queryEvalError struct {
+	value []Token // the value that caused the error (nil if unknown)
+	msg   string
+}
+
+func (e *queryEvalError) Error() string {
+	return e.msg
+}
+
+func queryErrorf(value []Token, format string, args ...any) error {
+	return &queryEvalError{value: value, msg: fmt.Sprintf(format, args...)}
+}
+
+type queryOp int
+
+const (
+	queryIdentity queryOp = iota
+	queryField            // the members of args[0] with key name
+	queryIndex            // args[0][args[1]]
+	queryIterate          // args[0][]
+	queryLiteral          // value
+	queryArray            // [args[0]] (or [] if there are no args)
+	queryPipe             // args[0] | args[1]
+	queryComma            // args[0], args[1]
+	queryArith            // args[0] name args[1]
+	queryCompare          // args[0] name args[1]
+	queryAnd              // args[0] and args[1]
+	queryOr               // args[0] or args[1]
+	queryNegate           // -args[0]
+	querySelect           // select(args[0])
+	queryBuiltin          // the builtin filter name
+)
+
+type queryNode struct {
+	op    queryOp
+	name  string
+	args  []*queryNode
+	value []Token
+}
+
+// splitQueryPrefix removes the leading path steps from the query n that can
+// be matched against the paths of the input tokens, returning them as a
+// pattern (see PathMatches).
+func splitQueryPrefix(n *queryNode) (*queryNode, []any) {
+	parent, chain, ok := queryPathChain(n)
+	if !ok {
+		return n, nil
+	}
+	var prefix []any
+	for i := len(chain) - 1; i >= 0; i-- {
+		step, ok := queryPathStep(chain[i])
+		if !ok {
+			break
+		}
+		prefix = append(prefix, step)
+	}
+	if !removeQueryPathSteps(&n, parent, chain, len(prefix)) {
+		return n, nil
+	}
+	return n, prefix
+}
+
+// splitQueryLast removes a leading path step from the query n that is a
+// negative index (after the prefix has been removed by splitQueryPrefix),
+// returning the number of the element counted from the end of the array (1
+// for .[-1]), or 0 if there is no such step.
+func splitQueryLast(n *queryNode) (*queryNode, int) {
+	parent, chain, ok := queryPathChain(n)
+	if !ok || len(chain) == 0 {
+		return n, 0
+	}
+	s := chain[len(chain)-1]
+	if s.op != queryIndex || s.args[1].op != queryLiteral || s.args[1].value[0].Kind != Number {
+		return n, 0
+	}
+	f, err := parseNumber(s.args[1].value[0].Value, 64)
+	if err != nil || f >= 0 || f != math.Trunc(f) || f < -maxSafeInteger {
+		return n, 0
+	}
+	if !removeQueryPathSteps(&n, parent, chain, 1) {
+		return n, 0
+	}
+	return n, int(-f)
+}
+
+// queryPathChain returns the path steps (outermost first) that are applied to
+// the input value at the start of the query n, together with the pipe whose
+// first argument they form (or nil). It returns false if the first filter of
+// the query is not a sequence of path steps applied to the input value.
+func queryPathChain(n *queryNode) (parent *queryNode, chain []*queryNode, ok bool) {
+	first := n
+	for first.op == queryPipe {
+		parent = first
+		first = first.args[0]
+	}
+	bottom := first
+	for bottom.op == queryField || bottom.op == queryIndex || bottom.op == queryIterate {
+		chain = append(chain, bottom)
+		bottom = bottom.args[0]
+	}
+	return parent, chain, bottom.op == queryIdentity
+}
+
+// removeQueryPathSteps removes the innermost k steps of chain (as returned by
+// queryPathChain for *n) from the query *n. It returns false if they cannot be
+// removed.
+func removeQueryPathSteps(n **queryNode, parent *queryNode, chain []*queryNode, k int) bool {
+	// An index computed by a filter is applied to the input value, so the
+	// steps cannot be removed from beneath it.
+	for _, s := range chain[:len(chain)-k] {
+		if s.op == queryIndex && s.args[1].op != queryLiteral {
+			return false
+		}
+	}
+	if k == 0 {
+		return false
+	}
+
+	identity := &queryNode{op: queryIdentity}
+	switch {
+	case k < len(chain):
+		chain[len(chain)-1-k].args[0] = identity
+	case parent != nil:
+		parent.args[0] = identity
+	default:
+		*n = identity
+	}
+	return true
+}
+
+// queryPathStep returns the pattern element equivalent to the path step s.
+func queryPathStep(s *queryNode) (any, bool) {
+	switch s.op {
+	case queryField:
+		return s.name, true
+	case queryIterate:
+		return Wildcard{}, true
+	case queryIndex:
+		if s.args[1].op != queryLiteral {
+			return nil, false
+		}
+		lit := s.args[1].value[0]
+		switch lit.Kind {
+		case String:
+			return string(lit.Value), true
+		case Number:
+			f, err := parseNumber(lit.Value, 64)
+			if err == nil && f >= 0 && f == math.Trunc(f) && f <= maxSafeInteger {
+				return int(f), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func compileQueryNode(n *queryNode) queryFilter {
+	switch n.op {
+	case queryIdentity:
+		return func(v []Token, yield func([]Token) error) error {
+			return yield(v)
+		}
+	case queryField:
+		base := compileQueryNode(n.args[0])
+		key := n.name
+		return func(v []Token, yield func([]Token) error) error {
+			return base(v, func(x []Token) error {
+				return queryMembers(x, key, yield)
+			})
+		}
+	case queryIndex:
+		base := compileQueryNode(n.args[0])
+		index := compileQueryNode(n.args[1])
+		return func(v []Token, yield func([]Token) error) error {
+			return base(v, func(x []Token) error {
+				return index(v, func(i []Token) error {
+					return queryIndexValue(x, i, yield)
+				})
+			})
+		}
+	case queryIterate:
+		base := compileQueryNode(n.args[0])
+		return func(v []Token, yield func([]Token) error) error {
+			return base(v, func(x []Token) error {
+				return queryChildren(x, yield)
+			})
+		}
+	case queryLiteral:
+		value := n.value
+		return func(v []Token, yield func([]Token) error) error {
+			return yield(value)
+		}
+	case queryArray:
+		if len(n.args) == 0 {
+			return func(v []Token, yield func([]Token) error) error {
+				return yield([]Token{{Kind: ArrayStart}, {Kind: ArrayEnd}})
+			}
+		}
+		elems := compileQueryNode(n.args[0])
+		return func(v []Token, yield func([]Token) error) error {
+			out := []Token{{Kind: ArrayStart}}
+			err := elems(v, func(x []Token) error {
+				out = appendQueryValue(out, x, nil)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return yield(append(out, Token{Kind: ArrayEnd}))
+		}
+	case queryPipe:
+		a, b := compileQueryNode(n.args[0]), compileQueryNode(n.args[1])
+		return func(v []Token, yield func([]Token) error) error {
+			return a(v, func(x []Token) error {
+				return b(x, yield)
+			})
+		}
+	case queryComma:
+		a, b := compileQueryNode(n.args[0]), compileQueryNode(n.args[1])
+		return func(v []Token, yield func([]Token) error) error {
+			if err := a(v, yield); err != nil {
+				return err
+			}
+			return b(v, yield)
+		}
+	case queryArith, queryCompare:
+		a, b := compileQueryNode(n.args[0]), compileQueryNode(n.args[1])
+		op := n.name
+		apply := queryArithmetic
+		if n.op == queryCompare {
+			apply = queryComparison
+		}
+		return func(v []Token, yield func([]Token) error) error {
+			return b(v, func(y []Token) error {
+				return a(v, func(x []Token) error {
+					out, err := apply(op, x, y)
+					if err != nil {
+						return err
+					}
+					return yield(out)
+				})
+			})
+		}
+	case queryAnd, queryOr:
+		a, b := compileQueryNode(n.args[0]), compileQueryNode(n.args[1])
+		or := n.op == queryOr
+		return func(v []Token, yield func([]Token) error) error {
+			return a(v, func(x []Token) error {
+				if queryTruthy(x) == or {
+					return yield(queryBool(or))
+				}
+				return b(v, func(y []Token) error {
+					return yield(queryBool(queryTruthy(y)))
+				})
+			})
+		}
+	case queryNegate:
+		a := compileQueryNode(n.args[0])
+		return func(v []Token, yield func([]Token) error) error {
+			return a(v, func(x []Token) error {
+				if x[0].Kind != Number {
+					return queryErrorf(x, "Cannot negate %v", queryTypeName(x))
+				}
+				neg := Token{Kind: Number}
+				if x[0].Value[0] == '-' {
+					neg.Value = x[0].Value[1:]
+				} else {
+					neg.Value = append([]byte{'-'}, x[0].Value...)
+				}
+				return yield([]Token{neg})
+			})
+		}
+	case querySelect:
+		cond := compileQueryNode(n.args[0])
+		return func(v []Token, yield func([]Token) error) error {
+			return cond(v, func(c []Token) error {
+				if queryTruthy(c) {
+					return yield(v)
+				}
+				return nil
+			})
+		}
+	}
+
+	switch n.name {
+	case "length":
+		return queryLength
+	case "keys":
+		return queryKeys
+	case "not":
+		return func(v []Token, yield func([]Token) error) error {
+			return yield(queryBool(!queryTruthy(v)))
+		}
+	default: // empty
+		return func(v []Token, yield func([]Token) error) error {
+			return nil
+		}
+	}
+}
+
+// queryChildren yields the elements of an array or the values of the members
+// of an object.
+func queryChildren(v []Token, yield func([]Token) error) error {
+	if v[0].Kind != ArrayStart && v[0].Kind != ObjectStart {
+		return nil
+	}
+	for i := 1; i < len(v)-1; {
+		n := queryValueLen(v[i:])
+		if err := yield(v[i : i+n]); err != nil {
+			return err
+		}
+		i += n
+	}
+	return nil
+}
+
+// queryValueLen returns the number of tokens in the value beginning with the
+// first of the given tokens.
+func queryValueLen(tokens []Token) int {
+	depth := 0
+	for i, t := range tokens {
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth == 0 {
+			return i + 1
+		}
+	}
+	return len(tokens)
+}
+
+func queryMembers(v []Token, key string, yield func([]Token) error) error {
+	if v[0].Kind != ObjectStart {
+		return nil
+	}
+	return queryChildren(v, func(c []Token) error {
+		if string(c[0].Key) == key {
+			return yield(c)
+		}
+		return nil
+	})
+}
+
+func queryIndexValue(v, index []Token, yield func([]Token) error) error {
+	switch {
+	case index[0].Kind == String:
+		return queryMembers(v, string(index[0].Value), yield)
+	case index[0].Kind == Number && v[0].Kind == ArrayStart:
+		f, err := parseNumber(index[0].Value, 64)
+		if err != nil || f != math.Trunc(f) {
+			return nil
+		}
+		if f < 0 {
+			f += float64(queryCount(v))
+		}
+		i := 0
+		return queryChildren(v, func(c []Token) error {
+			i++
+			if float64(i-1) == f {
+				return yield(c)
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+func queryCount(v []Token) int {
+	n := 0
+	queryChildren(v, func([]Token) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// appendQueryValue appends the tokens of the value v to out, giving it the
+// specified key.
+func appendQueryValue(out, v []Token, key []byte) []Token {
+	start := len(out)
+	out = append(out, v...)
+	out[start].Key = key
+	out[len(out)-1].Key = key
+	return out
+}
+
+var (
+	queryTrue  = []Token{{Kind: True}}
+	queryFalse = []Token{{Kind: False}}
+)
+
+func queryBool(b bool) []Token {
+	if b {
+		return queryTrue
+	}
+	return queryFalse
+}
+
+func queryNumber(f float64) []Token {
+	var b []byte
+	if f == math.Trunc(f) && math.Abs(f) < 1e21 {
+		b = strconv.AppendFloat(nil, f, 'f', -1, 64)
+	} else {
+		b = strconv.AppendFloat(nil, f, 'g', -1, 64)
+	}
+	return []Token{{Kind: Number, Value: b}}
+}
+
+func queryTruthy(v []Token) bool {
+	return v[0].Kind != Null && v[0].Kind != False
+}
+
+func queryTypeName(v []Token) string {
+	switch v[0].Kind {
+	case Null:
+		return "null"
+	case True, False:
+		return "boolean"
+	case Number:
+		return "number"
+	case ArrayStart:
+		return "array"
+	case ObjectStart:
+		return "object"
+	}
+	return "string"
+}
+
+func queryArithmetic(op string, x, y []Token) ([]Token, error) {
+	xk, yk := x[0].Kind, y[0].Kind
+	switch {
+	case op == "+" && xk == Null:
+		return y, nil
+	case op == "+" && yk == Null:
+		return x, nil
+	case xk == Number && yk == Number:
+		a, _ := parseNumber(x[0].Value, 64)
+		b, _ := parseNumber(y[0].Value, 64)
+		var r float64
+		switch op {
+		case "+":
+			r = a + b
+		case "-":
+			r = a - b
+		case "*":
+			r = a * b
+		case "/":
+			if b == 0 {
+				return nil, queryErrorf(x, "Cannot divide %v by zero", string(x[0].Value))
+			}
+			r = a / b
+		default:
+			if math.Abs(a) >= 1<<63 || math.Abs(b) >= 1<<63 {
+				return nil, queryErrorf(x, "Cannot apply '%%' to numbers out of range")
+			}
+			if int64(b) == 0 {
+				return nil, queryErrorf(x, "Cannot divide %v by zero", string(x[0].Value))
+			}
+			r = float64(int64(a) % int64(b))
+		}
+		if math.IsInf(r, 0) || math.IsNaN(r) {
+			return nil, queryErrorf(x, "Result of '%v' is out of range", op)
+		}
+		return queryNumber(r), nil
+	case op == "+" && xk == String && yk == String:
+		s := make([]byte, 0, len(x[0].Value)+len(y[0].Value))
+		s = append(append(s, x[0].Value...), y[0].Value...)
+		return []Token{{Kind: String, Value: s}}, nil
+	case op == "+" && xk == ArrayStart && yk == ArrayStart:
+		out := make([]Token, 0, len(x)+len(y)-2)
+		out = append(out, Token{Kind: ArrayStart})
+		out = append(out, x[1:len(x)-1]...)
+		out = append(out, y[1:len(y)-1]...)
+		return append(out, Token{Kind: ArrayEnd}), nil
+	}
+	return nil, queryErrorf(x, "Cannot apply '%v' to %v and %v", op, queryTypeName(x), queryTypeName(y))
+}
+
+func queryComparison(op string, x, y []Token) ([]Token, error) {
+	c := queryCompareValues(x, y)
+	switch op {
+	case "==":
+		return queryBool(c == 0), nil
+	case "!=":
+		return queryBool(c != 0), nil
+	case "<":
+		return queryBool(c < 0), nil
+	case "<=":
+		return queryBool(c <= 0), nil
+	case ">":
+		return queryBool(c > 0), nil
+	default:
+		return queryBool(c >= 0), nil
+	}
+}
+
+func queryRank(k Kind) int {
+	switch k {
+	case Null:
+		return 0
+	case False:
+		return 1
+	case True:
+		return 2
+	case Number:
+		return 3
+	case ArrayStart:
+		return 5
+	case ObjectStart:
+		return 6
+	}
+	return 4
+}
+
+// queryCompareValues compares two values using the ordering of jq.
+func queryCompareValues(x, y []Token) int {
+	if c := cmp.Compare(queryRank(x[0].Kind), queryRank(y[0].Kind)); c != 0 {
+		return c
+	}
+	switch x[0].Kind {
+	case Number:
+		a, _ := parseNumber(x[0].Value, 64)
+		b, _ := parseNumber(y[0].Value, 64)
+		return cmp.Compare(a, b)
+	case ArrayStart:
+		return slices.CompareFunc(queryValues(x), queryValues(y), queryCompareValues)
+	case ObjectStart:
+		xm, ym := querySortedMembers(x), querySortedMembers(y)
+		if c := slices.CompareFunc(xm, ym, func(a, b []Token) int {
+			return bytes.Compare(a[0].Key, b[0].Key)
+		}); c != 0 {
+			return c
+		}
+		return slices.CompareFunc(xm, ym, queryCompareValues)
+	case Null, True, False:
+		return 0
+	}
+	return bytes.Compare(x[0].Value, y[0].Value)
+}
+
+func queryValues(v []Token) [][]Token {
+	var values [][]Token
+	queryChildren(v, func(c []Token) error {
+		values = append(values, c)
+		return nil
+	})
+	return values
+}
+
+func querySortedMembers(v []Token) [][]Token {
+	members := queryValues(v)
+	slices.SortStableFunc(members, func(a, b []Token) int {
+		return bytes.Compare(a[0].Key, b[0].Key)
+	})
+	return members
+}
+
+func queryLength(v []Token, yield func([]Token) error) error {
+	switch v[0].Kind {
+	case Null:
+		return yield(queryNumber(0))
+	case True, False:
+		return queryErrorf(v, "Boolean has no length")
+	case Number:
+		if v[0].Value[0] == '-' {
+			return yield([]Token{{Kind: Number, Value: v[0].Value[1:]}})
+		}
+		return yield(v)
+	case ArrayStart, ObjectStart:
+		return yield(queryNumber(float64(queryCount(v))))
+	}
+	return yield(queryNumber(float64(utf8.RuneCount(v[0].Value))))
+}
+
+func queryKeys(v []Token, yield func([]Token) error) error {
+	out := []Token{{Kind: ArrayStart}}
+	switch v[0].Kind {
+	case ObjectStart:
+		for _, m := range querySortedMembers(v) {
+			out = append(out, Token{Kind: String, Value: m[0].Key})
+		}
+	case ArrayStart:
+		for i := range queryCount(v) {
+			out = append(out, queryNumber(float64(i))...)
+		}
+	default:
+		return queryErrorf(v, "%v has no keys", queryTypeName(v))
+	}
+	return yield(append(out, Token{Kind: ArrayEnd}))
+}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func (qp *queryParser) errorf(format string, args ...any) error {
+	return &QueryError{Offset: qp.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (qp *queryParser) unexpected() error {
+	if qp.pos >= len(qp.src) {
+		return qp.errorf("Unexpected end of query")
+	}
+	r, _ := utf8.DecodeRuneInString(qp.src[qp.pos:])
+	return qp.errorf("Unexpected %q", r)
+}
+
+func (qp *queryParser) skipSpace() {
+	for qp.pos < len(qp.src) {
+		switch qp.src[qp.pos] {
+		case ' ', '\t', '\n', '\r':
+			qp.pos++
+		default:
+			return
+		}
+	}
+}
+
+// eat consumes the given operator if it is next in the input.
+func (qp *queryParser) eat(op string) bool {
+	qp.skipSpace()
+	if len(qp.src)-qp.pos >= len(op) && qp.src[qp.pos:qp.pos+len(op)] == op {
+		qp.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (qp *queryParser) expect(op string) error {
+	if !qp.eat(op) {
+		return qp.unexpected()
+	}
+	return nil
+}
+
+// eatWord consumes the given identifier if it is next in the input.
+func (qp *queryParser) eatWord(word string) bool {
+	qp.skipSpace()
+	start := qp.pos
+	if qp.ident() == word {
+		return true
+	}
+	qp.pos = start
+	return false
+}
+
+func isQueryIdentByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// ident consumes an identifier (returning "" if there is none).
+func (qp *queryParser) ident() string {
+	start := qp.pos
+	for qp.pos < len(qp.src) && isQueryIdentByte(qp.src[qp.pos], qp.pos == start) {
+		qp.pos++
+	}
+	return qp.src[start:qp.pos]
+}
+
+func queryBinary(op queryOp, name string, a, b *queryNode) *queryNode {
+	return &queryNode{op: op, name: name, args: []*queryNode{a, b}}
+}
+
+func (qp *queryParser) parsePipe() (*queryNode, error) {
+	n, err := qp.parseComma()
+	for err == nil && qp.eat("|") {
+		var r *queryNode
+		if r, err = qp.parseComma(); err == nil {
+			n = queryBinary(queryPipe, "", n, r)
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseComma() (*queryNode, error) {
+	n, err := qp.parseOr()
+	for err == nil && qp.eat(",") {
+		var r *queryNode
+		if r, err = qp.parseOr(); err == nil {
+			n = queryBinary(queryComma, "", n, r)
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseOr() (*queryNode, error) {
+	n, err := qp.parseAnd()
+	for err == nil && qp.eatWord("or") {
+		var r *queryNode
+		if r, err = qp.parseAnd(); err == nil {
+			n = queryBinary(queryOr, "", n, r)
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseAnd() (*queryNode, error) {
+	n, err := qp.parseComparison()
+	for err == nil && qp.eatWord("and") {
+		var r *queryNode
+		if r, err = qp.parseComparison(); err == nil {
+			n = queryBinary(queryAnd, "", n, r)
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseComparison() (*queryNode, error) {
+	n, err := qp.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if qp.eat(op) {
+			r, err := qp.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return queryBinary(queryCompare, op, n, r), nil
+		}
+	}
+	return n, nil
+}
+
+func (qp *queryParser) parseAdditive() (*queryNode, error) {
+	n, err := qp.parseMultiplicative()
+	for err == nil {
+		var op string
+		switch {
+		case qp.eat("+"):
+			op = "+"
+		case qp.eat("-"):
+			op = "-"
+		default:
+			return n, nil
+		}
+		var r *queryNode
+		if r, err = qp.parseMultiplicative(); err == nil {
+			n = queryBinary(queryArith, op, n, r)
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseMultiplicative() (*queryNode, error) {
+	n, err := qp.parseUnary()
+	for err == nil {
+		var op string
+		switch {
+		case qp.eat("*"):
+			op = "*"
+		case qp.eat("/"):
+			op = "/"
+		case qp.eat("%"):
+			op = "%"
+		default:
+			return n, nil
+		}
+		var r *queryNode
+		if r, err = qp.parseUnary(); err == nil {
+			n = queryBinary(queryArith, op, n, r)
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseUnary() (*queryNode, error) {
+	if qp.eat("-") {
+		n, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		neg := &queryNode{op: queryNegate, args: []*queryNode{n}}
+		if n.op == queryLiteral && n.value[0].Kind == Number {
+			// Fold negative number literals, so that e.g. .[-1] has a literal
+			// index.
+			compileQueryNode(neg)(nil, func(v []Token) error {
+				neg = &queryNode{op: queryLiteral, value: v}
+				return nil
+			})
+		}
+		return neg, nil
+	}
+	return qp.parsePostfix()
+}
+
+func (qp *queryParser) parsePostfix() (*queryNode, error) {
+	n, err := qp.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		qp.skipSpace()
+		if qp.pos+1 < len(qp.src) && qp.src[qp.pos] == '.' && qp.src[qp.pos+1] == '[' {
+			qp.pos++
+		}
+		switch {
+		case qp.pos+1 < len(qp.src) && qp.src[qp.pos] == '.':
+			qp.pos++
+			key, err := qp.parseFieldName()
+			if err != nil {
+				return nil, err
+			}
+			n = &queryNode{op: queryField, name: key, args: []*queryNode{n}}
+		case qp.eat("["):
+			if qp.eat("]") {
+				n = &queryNode{op: queryIterate, args: []*queryNode{n}}
+				continue
+			}
+			index, err := qp.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := qp.expect("]"); err != nil {
+				return nil, err
+			}
+			n = queryBinary(queryIndex, "", n, index)
+		default:
+			return n, nil
+		}
+	}
+}
+
+// parseFieldName parses the key following the '.' of a path step.
+func (qp *queryParser) parseFieldName() (string, error) {
+	if qp.pos < len(qp.src) && qp.src[qp.pos] == '"' {
+		s, err := qp.parseString()
+		if err != nil {
+			return "", err
+		}
+		return string(s[0].Value), nil
+	}
+	if key := qp.ident(); key != "" {
+		return key, nil
+	}
+	return "", qp.unexpected()
+}
+
+func (qp *queryParser) parsePrimary() (*queryNode, error) {
+	qp.skipSpace()
+	if qp.pos >= len(qp.src) {
+		return nil, qp.unexpected()
+	}
+
+	switch c := qp.src[qp.pos]; {
+	case c == '.':
+		qp.pos++
+		if qp.pos < len(qp.src) && (qp.src[qp.pos] == '"' || isQueryIdentByte(qp.src[qp.pos], true)) {
+			key, err := qp.parseFieldName()
+			if err != nil {
+				return nil, err
+			}
+			return &queryNode{op: queryField, name: key, args: []*queryNode{{op: queryIdentity}}}, nil
+		}
+		return &queryNode{op: queryIdentity}, nil
+	case c == '"':
+		s, err := qp.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{op: queryLiteral, value: s}, nil
+	case c >= '0' && c <= '9':
+		return qp.parseNumber()
+	case c == '(':
+		qp.pos++
+		n, err := qp.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return n, qp.expect(")")
+	case c == '[':
+		qp.pos++
+		if qp.eat("]") {
+			return &queryNode{op: queryArray}, nil
+		}
+		n, err := qp.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{op: queryArray, args: []*queryNode{n}}, qp.expect("]")
+	}
+
+	start := qp.pos
+	switch name := qp.ident(); name {
+	case "true":
+		return &queryNode{op: queryLiteral, value: queryTrue}, nil
+	case "false":
+		return &queryNode{op: queryLiteral, value: queryFalse}, nil
+	case "null":
+		return &queryNode{op: queryLiteral, value: []Token{{Kind: Null}}}, nil
+	case "length", "keys", "not", "empty":
+		return &queryNode{op: queryBuiltin, name: name}, nil
+	case "select", "map":
+		if err := qp.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := qp.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := qp.expect(")"); err != nil {
+			return nil, err
+		}
+		if name == "select" {
+			return &queryNode{op: querySelect, args: []*queryNode{f}}, nil
+		}
+		iterate := &queryNode{op: queryIterate, args: []*queryNode{{op: queryIdentity}}}
+		return &queryNode{op: queryArray, args: []*queryNode{queryBinary(queryPipe, "", iterate, f)}}, nil
+	case "":
+		return nil, qp.unexpected()
+	default:
+		qp.pos = start
+		return nil, qp.errorf("Unknown function %q", name)
+	}
+}
+
+// parseString parses a string literal (using JSON syntax).
+func (qp *queryParser) parseString() ([]Token, error) {
+	start := qp.pos
+	end := start + 1
+	for ; end < len(qp.src) && qp.src[end] != '"'; end++ {
+		if qp.src[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(qp.src) {
+		return nil, qp.errorf("Unterminated string")
+	}
+	qp.pos = end + 1
+
+	var p Parser
+	for t := range p.Tokenize([]byte(qp.src[start:qp.pos])) {
+		if t.Kind != String {
+			qp.pos = start
+			return nil, qp.errorf("Invalid string literal (%v)", t.ErrorMsg)
+		}
+		return []Token{{Kind: String, Value: t.Value}}, nil
+	}
+	return nil, qp.errorf("Invalid string literal")
+}
+
+// parseNumber parses a number literal (using JSON syntax).
+func (qp *queryParser) parseNumber() (*queryNode, error) {
+	start := qp.pos
+	digits := func() {
+		for qp.pos < len(qp.src) && qp.src[qp.pos] >= '0' && qp.src[qp.pos] <= '9' {
+			qp.pos++
+		}
+	}
+	digits()
+	if qp.pos < len(qp.src) && qp.src[qp.pos] == '.' {
+		qp.pos++
+		digits()
+	}
+	if qp.pos < len(qp.src) && (qp.src[qp.pos] == 'e' || qp.src[qp.pos] == 'E') {
+		qp.pos++
+		if qp.pos < len(qp.src) && (qp.src[qp.pos] == '+' || qp.src[qp.pos] == '-') {
+			qp.pos++
+		}
+		digits()
+	}
+	lit := []byte(qp.src[start:qp.pos])
+	if !isValidNumber(lit) {
+		qp.pos = start
+		return nil, qp.errorf("Invalid number %q", lit)
+	}
+	return &queryNode{op: queryLiteral, value: []Token{{Kind: Number, Value: lit}}}, nil
+}
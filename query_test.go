@@ -0,0 +1,230 @@
+package jsonstream
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	const input = `{
+		"items": [
+			{"name": "apple", "price": 1.5, "tags": ["fruit"]},
+			{"name": "bread", "price": 3, "tags": []},
+			{"name": "cheese", "price": 12, "tags": ["dairy", "aged"]}
+		],
+		"count": 3
+	}`
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{`.`, `{"items":[{"name":"apple","price":1.5,"tags":["fruit"]},{"name":"bread","price":3,"tags":[]},{"name":"cheese","price":12,"tags":["dairy","aged"]}],"count":3}`},
+		{`.count`, `3`},
+		{`."count"`, `3`},
+		{`.missing`, ``},
+		{`.count.x`, ``},
+		{`.items[1].name`, `"bread"`},
+		{`.items[-1].name`, `"cheese"`},
+		{`.items[.count - 2].name`, `"bread"`},
+		{`.["count"]`, `3`},
+		{`.items[].name`, `"apple","bread","cheese"`},
+		{`.items[] | select(.price > 2) | .name`, `"bread","cheese"`},
+		{`.items | map(.price * 2)`, `[3,6,24]`},
+		{`[.items[].tags | length]`, `[1,0,2]`},
+		{`.items[0] | keys`, `["name","price","tags"]`},
+		{`.items[2].tags | keys`, `[0,1]`},
+		{`.items[0].name + "!"`, `"apple!"`},
+		{`.items[0].tags + .items[2].tags`, `["fruit","dairy","aged"]`},
+		{`.count, .count + 1`, `3,4`},
+		{`(.items[0], .items[1]).price`, `1.5,3`},
+		{`.count / 2, .count % 2, -.count, 1e3 * 1000`, `1.5,1,-3,1000000`},
+		{`.items[] | select(.name == "apple" or .price >= 12) | .name`, `"apple","cheese"`},
+		{`.items[] | select(.name != "apple" and (.tags | length) > 0) | .price`, `12`},
+		{`[.items[].name] | .[0] < .[1], (null < false), ([1, 2] < [1, 3]), ([1, [2]] == [1, [2]])`, `true,true,true,true`},
+		{`.count | not, (null | not)`, `false,true`},
+		{`.items[] | empty`, ``},
+		{`[]`, `[]`},
+		{`[.items[].name | select(. == "none")]`, `[]`},
+		{`"été" | length`, `3`},
+	}
+	for _, c := range cases {
+		q, err := CompileQuery(c.query)
+		if err != nil {
+			t.Errorf("Unexpected error compiling %v: %v", c.query, err)
+			continue
+		}
+		var p Parser
+		got := strings.Join(splitTopLevel(q.Run(p.Tokenize([]byte(input)))), ",")
+		if got != c.expected {
+			t.Errorf("For %v expected %v, got %v", c.query, c.expected, got)
+		}
+	}
+}
+
+func TestQueryStreaming(t *testing.T) {
+	q, err := CompileQuery(`.[] | .id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.prefix, []any{Wildcard{}}) {
+		t.Errorf("Expected .[] to be evaluated while streaming, got prefix %v", q.prefix)
+	}
+
+	prefixes := map[string][]any{
+		`.a.b[2] | .c`: {"a", "b", 2},
+		`.a[-1].b`:     {"a"},
+		`.a[.i]`:       nil,
+		`.a["b"][][0]`: {"a", "b", Wildcard{}, 0},
+		`.a + 1`:       nil,
+		`[.a[]]`:       nil,
+		`.a | .b`:      {"a"},
+	}
+	for query, expected := range prefixes {
+		pq, err := CompileQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(pq.prefix, expected) {
+			t.Errorf("For %v expected prefix %v, got %v", query, expected, pq.prefix)
+		}
+	}
+
+	p := Parser{AllowMultipleValues: true, AllowComments: true}
+	got := strings.Join(splitTopLevel(q.Run(p.Tokenize([]byte(`[{"id": 1}, /* c */ {"id": 2}] {"x": {"id": 3}} 4`)))), ",")
+	if got != "1,2,3" {
+		t.Errorf("Unexpected output %v", got)
+	}
+
+	n := 0
+	for range q.Run(p.Tokenize([]byte(`[{"id": 1}, {"id": 2}]`))) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("Expected iteration to stop")
+	}
+}
+
+func TestQueryNegativeIndex(t *testing.T) {
+	q, err := CompileQuery(`.a[-2].b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.prefix, []any{"a"}) || q.last != 2 {
+		t.Errorf("Expected .a[-2] to be evaluated while streaming, got prefix %v and last %v", q.prefix, q.last)
+	}
+	for _, query := range []string{`.a[-1.5]`, `.a[-0]`, `.a[.i][-1]`, `[.a[-1]]`} {
+		pq, err := CompileQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pq.last != 0 {
+			t.Errorf("For %v expected no negative index, got %v", query, pq.last)
+		}
+	}
+
+	cases := []struct {
+		query    string
+		input    string
+		expected string
+	}{
+		{`.[-1]`, `[1, 2, 3] [] [[4, 5]] {"a": 6} 7`, `3,[4,5]`},
+		{`.[-3]`, `[1, 2, 3, 4, 5] [1, 2] [{"x": [1]}, 2, 3]`, `3,{"x":[1]}`},
+		{`.a[-2].b`, `{"a": [{"b": 1}, {"b": 2}, {"c": 3}]} {"a": [{"b": 4}]} {"a": {"x": {"b": 5}, "y": 6}}`, `2`},
+		{`.[][-1] | . * 10`, `[[1, 2], [], [3]] {"x": [4], "y": 5}`, `20,30,40`},
+		{`.a[-1], .a[0]`, `{"a": [1, 2]}`, `2,1`},
+		{`.[-1][-1].x`, `[[{"x": 1}], [{"x": 2}, {"x": 3}]]`, `3`},
+	}
+	for _, c := range cases {
+		q, err := CompileQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Parser{AllowMultipleValues: true}
+		got := strings.Join(splitTopLevel(q.Run(p.Tokenize([]byte(c.input)))), ",")
+		if got != c.expected {
+			t.Errorf("For %v on %v expected %v, got %v", c.query, c.input, c.expected, got)
+		}
+	}
+}
+
+func TestQueryRunAt(t *testing.T) {
+	const input = `{"orders": [{"id": 1, "items": ["a", "b"]}, {"id": 2, "items": ["c"]}, {"id": 3, "items": []}], "items": ["x"]}`
+	q, err := CompileQuery(`.items[-1]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Parser
+	got := strings.Join(splitTopLevel(q.RunAt(p.Tokenize([]byte(input)), []any{"orders", Wildcard{}})), ",")
+	if got != `"b","c"` {
+		t.Errorf("Unexpected output %v", got)
+	}
+
+	q, err = CompileQuery(`select(.id > 1) | .id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = strings.Join(splitTopLevel(q.RunAt(p.Tokenize([]byte(input)), []any{"orders", Wildcard{}})), ",")
+	if got != `2,3` {
+		t.Errorf("Unexpected output %v", got)
+	}
+	got = strings.Join(splitTopLevel(q.RunAt(p.Tokenize([]byte(input)), nil)), ",")
+	if got != `` {
+		t.Errorf("Unexpected output %v", got)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	compileErrors := map[string]string{
+		``:            "offset 0: Unexpected end of query",
+		`.a |`:        "offset 4: Unexpected end of query",
+		`.a ]`:        "offset 3: Unexpected ']'",
+		`foo(.)`:      `offset 0: Unknown function "foo"`,
+		`select .a`:   "offset 7: Unexpected '.'",
+		`"abc`:        "offset 0: Unterminated string",
+		`"\x"`:        "offset 0: Invalid string literal (Unexpected character after '\\' in string)",
+		`01`:          `offset 0: Invalid number "01"`,
+		`.a[1`:        "offset 4: Unexpected end of query",
+		`.items..a`:   "offset 7: Unexpected '.'",
+		`[.a, .b`:     "offset 7: Unexpected end of query",
+		`.a == .b ==`: "offset 9: Unexpected '='",
+	}
+	for query, expected := range compileErrors {
+		_, err := CompileQuery(query)
+		var qe *QueryError
+		if !errors.As(err, &qe) || err.Error() != "jsonstream: invalid query at "+expected {
+			t.Errorf("For %v expected error %v, got %v", query, expected, err)
+		}
+	}
+
+	var p Parser
+	runErrors := map[string]string{
+		`.a + .b`:     `<error: Cannot apply '+' to string and number>`,
+		`.b / 0`:      `<error: Cannot divide 1 by zero>`,
+		`.c | length`: `<error: Boolean has no length>`,
+		`.a | keys`:   `<error: string has no keys>`,
+		`-.a`:         `<error: Cannot negate string>`,
+	}
+	for query, expected := range runErrors {
+		q, err := CompileQuery(query)
+		if err != nil {
+			t.Errorf("Unexpected error compiling %v: %v", query, err)
+			continue
+		}
+		if got := compactJSON(q.Run(p.Tokenize([]byte(`{"a": "x", "b": 1, "c": true}`)))); got != expected {
+			t.Errorf("For %v expected %v, got %v", query, expected, got)
+		}
+	}
+
+	q, _ := CompileQuery(`.[] | . + 1`)
+	for tok := range q.Run(p.Tokenize([]byte("[1,\n\"x\"]"))) {
+		if IsError(tok.Kind) && (tok.Line != 2 || tok.Col != 2 || tok.Start != 4) {
+			t.Errorf("Expected error at position of \"x\", got %v", tok)
+		}
+	}
+	if got := compactJSON(q.Run(p.Tokenize([]byte(`[1, 2`)))); got != "2,3,<error: Unexpected EOF inside array>" {
+		t.Errorf("Unexpected output %v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package jsonstream
+
+import "fmt"
+
+// Usage gives the resources used by an iteration over the tokens of an input,
+// for enforcing quotas on untrusted input (see Parser.Quota).
+type Usage struct {
+	Bytes       int // the number of bytes of input tokenized
+	Tokens      int // the number of tokens yielded (not including errors)
+	StringBytes int // the total length of the decoded values of strings and keys
+	Depth       int // the current nesting depth of arrays and objects
+}
+
+// QuotaFunc checks the resources used by tokenization. It is called before
+// each token is yielded with the resources used up to and including that
+// token. If it returns an error, the token is replaced by an error token of
+// kind ErrorQuotaExceeded giving the error's message, and tokenization halts.
+type QuotaFunc func(u Usage) error
+
+// QuotaError is the error returned by the QuotaFunc returned by MaxUsage
+// when a limit is exceeded.
+type QuotaError struct {
+	Resource string // the name of the field of Usage that exceeded its limit
+	Limit    int    // the limit
+	Used     int    // the usage that exceeded the limit
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("Quota exceeded: %v is %v (limit %v)", e.Resource, e.Used, e.Limit)
+}
+
+// MaxUsage returns a QuotaFunc that fails with a *QuotaError when a field of
+// the usage exceeds the corresponding field of limit. Fields of limit that are
+// zero or negative impose no limit.
+func MaxUsage(limit Usage) QuotaFunc {
+	return func(u Usage) error {
+		check := func(resource string, limit, used int) error {
+			if limit > 0 && used > limit {
+				return &QuotaError{Resource: resource, Limit: limit, Used: used}
+			}
+			return nil
+		}
+		if err := check("Bytes", limit.Bytes, u.Bytes); err != nil {
+			return err
+		}
+		if err := check("Tokens", limit.Tokens, u.Tokens); err != nil {
+			return err
+		}
+		if err := check("StringBytes", limit.StringBytes, u.StringBytes); err != nil {
+			return err
+		}
+		return check("Depth", limit.Depth, u.Depth)
+	}
+}
+
+// add updates the usage for the yielding of the token t.
+func (u *Usage) add(t Token) {
+	u.Bytes = max(u.Bytes, t.End+1)
+	u.Tokens++
+	switch t.Kind {
+	case ArrayStart, ObjectStart:
+		u.Depth++
+	case ArrayEnd, ObjectEnd:
+		u.Depth--
+		return // the key of an end token is that of its container
+	case String:
+		u.StringBytes += len(t.Value)
+	}
+	if t.Kind != Key {
+		u.StringBytes += len(t.Key)
+	}
+}
@@ -0,0 +1,56 @@
+package jsonstream
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	const input = `{"name": "abcdef", "list": [[1, 2], [3]], "x": true}`
+	cases := []struct {
+		limit    Usage
+		expected string
+	}{
+		{Usage{}, `{"name":"abcdef","list":[[1,2],[3]],"x":true}`},
+		{Usage{Bytes: 20}, `{"name":"abcdef",<error: Quota exceeded: Bytes is 28 (limit 20)>`},
+		{Usage{Tokens: 4}, `{"name":"abcdef","list":[[<error: Quota exceeded: Tokens is 5 (limit 4)>`},
+		{Usage{StringBytes: 12}, `{"name":"abcdef",<error: Quota exceeded: StringBytes is 14 (limit 12)>`},
+		{Usage{Depth: 2}, `{"name":"abcdef","list":[<error: Quota exceeded: Depth is 3 (limit 2)>`},
+	}
+	for _, c := range cases {
+		p := NewParser(WithQuota(MaxUsage(c.limit)))
+		if got := compactJSON(p.Tokenize([]byte(input))); got != c.expected {
+			t.Errorf("With limit %+v expected %v, got %v", c.limit, c.expected, got)
+		}
+	}
+
+	t.Run("custom quota functions", func(t *testing.T) {
+		var calls int
+		p := NewParser(WithQuota(func(u Usage) error {
+			calls++
+			if u.Tokens != calls {
+				t.Errorf("Expected %v tokens, got %+v", calls, u)
+			}
+			return nil
+		}))
+		for range p.Tokenize([]byte(input)) {
+		}
+		if calls != 13 {
+			t.Errorf("Expected 13 calls, got %v", calls)
+		}
+	})
+
+	t.Run("the quota error is recorded", func(t *testing.T) {
+		p := NewParser(WithQuota(MaxUsage(Usage{Depth: 1})))
+		for range p.Tokenize([]byte(`[[1]]`)) {
+		}
+		errs := p.Errors()
+		if len(errs) != 1 || errs[0].Kind != ErrorQuotaExceeded || errs[0].Error() != "1:2 Error: Quota exceeded: Depth is 2 (limit 1)" {
+			t.Errorf("Unexpected errors %v", errs)
+		}
+		var qe *QuotaError
+		if err := MaxUsage(Usage{Depth: 1})(Usage{Depth: 2}); !errors.As(err, &qe) || qe.Resource != "Depth" || qe.Used != 2 || qe.Limit != 1 {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
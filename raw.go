@@ -0,0 +1,57 @@
+package jsonstream
+
+// RawState holds the state of a low-level tokenization by NextRawToken.
+type RawState struct {
+	p  *Parser
+	st rawTokenizeState
+}
+
+// NewRawState returns the state for tokenizing an input from its beginning
+// using NextRawToken. The options of p that affect the scanning of individual
+// tokens (EmitWhitespace, Hook, LineTerminators, Version and Filename) and the
+// messages of errors (Messages) apply; the others are ignored.
+func (p *Parser) NewRawState() *RawState {
+	return &RawState{p: p, st: *p.newRawTokenizeState()}
+}
+
+// Pos returns the index in the input of the next byte to be tokenized.
+func (s *RawState) Pos() int {
+	return s.st.pos
+}
+
+// NextRawToken scans the next token of the input into out. It returns false
+// (leaving out unchanged) at the end of the input. The same input must be
+// passed on each call with a given state.
+//
+// This is the lexer used by Tokenize, without the structural layer, for
+// building custom grammars (such as framing protocols) on top of JSON tokens.
+// The tokens are not checked against the structure of JSON: ':' and ','
+// separators are yielded as tokens of kind Colon and Comma; comments are
+// always yielded (as tokens of kind Comment); no Key tokens are yielded and
+// no keys are attached to values; and an ArrayEnd or ObjectEnd token need not
+// close anything. Positions and the values of strings are as for Tokenize. An
+// error token is yielded for input that cannot be scanned as a token, after
+// which scanning continues with the following byte.
+func NextRawToken(state *RawState, input []byte, out *Token) bool {
+	if !rawTokenize(state.p, &state.st, input, out) {
+		return false
+	}
+	if IsError(out.Kind) {
+		state.p.localizeError(out)
+	}
+	return true
+}
+
+// SkipRawValue advances the state past the value that begins with the next
+// token of the input (following any whitespace and comments), so that a
+// subtree that is not needed (e.g. the value of a key other than the one being
+// looked for in a huge object) can be passed over without scanning its
+// tokens. As for the values skipped by TokenizeSelected, only the structure
+// of the value is scanned: the value is not validated, Hook is not called, and
+// no error token is yielded for it. It returns false, leaving the state
+// unchanged, if no value begins with the next token (e.g. if the next token is
+// a ']', ',' or ':' or the input has ended). The same input must be passed as
+// to NextRawToken.
+func SkipRawValue(state *RawState, input []byte) bool {
+	return skipRawValue(state.p, &state.st, input)
+}
@@ -0,0 +1,85 @@
+package jsonstream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNextRawToken(t *testing.T) {
+	rawTokens := func(p *Parser, input string) string {
+		var sb strings.Builder
+		state := p.NewRawState()
+		var tok Token
+		for NextRawToken(state, []byte(input), &tok) {
+			if IsError(tok.Kind) {
+				fmt.Fprintf(&sb, "[%v]", tok)
+			} else {
+				fmt.Fprintf(&sb, "[%v:%v %v %s]", tok.Line, tok.Col, tok.Kind, tok.Value)
+			}
+		}
+		if state.Pos() != len(input) {
+			fmt.Fprintf(&sb, " stopped at %v", state.Pos())
+		}
+		return sb.String()
+	}
+
+	var p Parser
+	cases := map[string]string{
+		`{"a": [1, true]}`: `[1:1 ObjectStart ][1:2 String a][1:5 Colon ][1:7 ArrayStart ][1:8 Number 1][1:9 Comma ][1:11 True ][1:15 ArrayEnd ][1:16 ObjectEnd ]`,
+		`]] , :`:           `[1:1 ArrayEnd ][1:2 ArrayEnd ][1:4 Comma ][1:6 Colon ]`,
+		"1 /* c */ 2":      `[1:1 Number 1][1:3 Comment /* c */][1:11 Number 2]`,
+		"1 @ 2":            `[1:1 Number 1][1:3 Error: Unexpected char '64'][1:5 Number 2]`,
+		``:                 ``,
+	}
+	for input, expected := range cases {
+		if got := rawTokens(&p, input); got != expected {
+			t.Errorf("For %q expected\n%v\ngot\n%v", input, expected, got)
+		}
+	}
+
+	ws := Parser{EmitWhitespace: true, Version: TokenStreamV2}
+	if got := rawTokens(&ws, "1,\n 2"); got != "[1:1 Number 1][1:2 Comma ][1:3 Whitespace \n ][2:2 Number 2]" {
+		t.Errorf("Unexpected tokens %v", got)
+	}
+}
+
+func TestSkipRawValue(t *testing.T) {
+	const input = "{\"skip\": {\"deep\": [1, {\"x\": \"}\"}],\n \"s\": \"a\\\"b\"}, \"n\": 12, // c\n \"target\": [true]}"
+	p := Parser{Version: TokenStreamV2}
+	state := p.NewRawState()
+	var tok Token
+	var skipped []string
+	var found Token
+	for NextRawToken(state, []byte(input), &tok) {
+		if tok.Kind != String {
+			continue
+		}
+		key := tok.AsString()
+		if !NextRawToken(state, []byte(input), &tok) || tok.Kind != Colon {
+			t.Fatalf("Expected a colon after %q, got %v", key, tok)
+		}
+		if key != "target" {
+			start := state.Pos()
+			if !SkipRawValue(state, []byte(input)) {
+				t.Fatalf("Expected to skip the value of %q", key)
+			}
+			skipped = append(skipped, strings.TrimSpace(input[start:state.Pos()]))
+			continue
+		}
+		if NextRawToken(state, []byte(input), &found) {
+			break
+		}
+	}
+	if fmt.Sprint(skipped) != "[{\"deep\": [1, {\"x\": \"}\"}],\n \"s\": \"a\\\"b\"} 12]" {
+		t.Errorf("Unexpected skipped values %q", skipped)
+	}
+	if found.Kind != ArrayStart || found.Line != 3 || found.Col != 12 || found.Start != 75 {
+		t.Errorf("Unexpected token after skipping %v (at %v)", found, found.Start)
+	}
+
+	state = p.NewRawState()
+	if NextRawToken(state, []byte("[]"), &tok); SkipRawValue(state, []byte("[]")) || state.Pos() != 1 {
+		t.Errorf("Expected no value to be skipped before ']', got position %v", state.Pos())
+	}
+}
@@ -0,0 +1,132 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"iter"
+)
+
+// RawValue is a handle to a value in an input that can be tokenized or
+// decoded on demand. A RawValue holds only the position of the value and the
+// configuration of the Parser that tokenized it, so that values skipped in a
+// first pass over a document can be captured cheaply and processed later
+// (e.g. only when they are needed). The zero value is not a valid handle.
+type RawValue struct {
+	input  []byte
+	first  Token  // the first token of the value
+	end    int    // the index of the last byte of the value in the input
+	config Parser // the configuration with which the value is tokenized
+}
+
+// NewRawValue returns a handle to the value in the input that begins with the
+// token first and ends with the token last (the same token for a scalar
+// value), both of which must have been yielded by Tokenize for the input. The
+// options of the Parser that yielded first are used when tokenizing the value,
+// except that AllowMultipleValues, JSONSeq and StopAfterFirstValue are
+// ignored.
+func NewRawValue(input []byte, first, last Token) RawValue {
+	return RawValue{input: input, first: first, end: last.End, config: rawValueConfig(first.parser)}
+}
+
+// rawValueConfig returns the configuration with which a RawValue for a value
+// tokenized by p is tokenized.
+func rawValueConfig(p *Parser) Parser {
+	var config Parser
+	if p != nil {
+		config = *p
+		config.errors = nil
+		config.decodeErrors = nil
+		config.valueRanges = nil
+	}
+	config.AllowMultipleValues = false
+	config.JSONSeq = false
+	config.StopAfterFirstValue = false
+	return config
+}
+
+// Bytes returns the text of the value (a sub-slice of the input).
+func (rv RawValue) Bytes() []byte {
+	return rv.input[rv.first.Start : rv.end+1]
+}
+
+// Tokenize returns the tokens of the value. The tokens have the same positions
+// as the corresponding tokens yielded by Tokenize for the whole input, and the
+// value has the key of first. Decode errors recorded for the tokens (see
+// Parser.DecodeErrors) are recorded by the Parser that yielded first.
+func (rv RawValue) Tokenize() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		p := rv.config
+		depth := 0
+		for t := range p.Tokenize(rv.Bytes()) {
+			if t.Line > 0 {
+				if t.Line == 1 {
+					t.Col += rv.first.Col - 1
+				}
+				t.Line += rv.first.Line - 1
+			}
+			t.Start += rv.first.Start
+			t.End += rv.first.Start
+			if rv.first.parser != nil {
+				t.parser = rv.first.parser
+			}
+			if isContainerEnd(t.Kind) {
+				depth--
+			}
+			if depth == 0 && (isValueKind(t.Kind) || isContainerEnd(t.Kind)) {
+				t.Key = rv.first.Key
+			}
+			if t.Kind == ArrayStart || t.Kind == ObjectStart {
+				depth++
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// Decode decodes the value into the value pointed to by v, using
+// encoding/json. If the value cannot be tokenized, the error (as returned by
+// Token.AsError) is returned.
+func (rv RawValue) Decode(v any) error {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteAll(rv.Tokenize()); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf.Bytes(), v)
+}
+
+// Get returns a handle to the first value within the value whose path
+// (relative to the value) matches the given pattern (see PathMatches). If
+// the value contains an error before the end of the selected value, the
+// error (as returned by Token.AsError) is returned. If no value matches,
+// ErrPathNotFound is returned.
+func (rv RawValue) Get(path ...any) (RawValue, error) {
+	var pt pathTracker
+	var first Token
+	found := false
+	depth := 0
+	for t := range rv.Tokenize() {
+		if IsError(t.Kind) {
+			return RawValue{}, t.AsError()
+		}
+		tp := pt.next(t)
+		if !found {
+			if !isValueKind(t.Kind) || !PathMatches(tp, path) {
+				continue
+			}
+			first, found = t, true
+		}
+		switch t.Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth == 0 {
+			return RawValue{input: rv.input, first: first, end: t.End, config: rv.config}, nil
+		}
+	}
+	return RawValue{}, ErrPathNotFound
+}
@@ -0,0 +1,77 @@
+package jsonstream
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRawValue(t *testing.T) {
+	const input = "{\"a\": 1,\n \"b\": {\"c\": [1, 2], \"d\": \"x\"}}"
+	p := Parser{Filename: "in.json"}
+	var tokens []Token
+	var b RawValue
+	var bStart Token
+	for tok := range p.Tokenize([]byte(input)) {
+		tokens = append(tokens, tok)
+		switch {
+		case tok.Kind == ObjectStart && tok.KeyEquals("b"):
+			bStart = tok
+		case tok.Kind == ObjectEnd && tok.KeyEquals("b"):
+			b = NewRawValue([]byte(input), bStart, tok)
+		}
+	}
+
+	if string(b.Bytes()) != `{"c": [1, 2], "d": "x"}` {
+		t.Errorf("Unexpected bytes %s", b.Bytes())
+	}
+	// The tokens of the value have the same positions and keys as in the
+	// original tokenization.
+	got := slices.Collect(b.Tokenize())
+	if !slices.EqualFunc(got, tokens[2:len(tokens)-1], func(x, y Token) bool {
+		return x.String() == y.String() && x.Start == y.Start && x.End == y.End && string(x.Key) == string(y.Key) && x.Filename() == y.Filename()
+	}) {
+		t.Errorf("Expected\n%v\ngot\n%v", tokens[2:len(tokens)-1], got)
+	}
+
+	var v struct {
+		C []int
+		D string
+	}
+	if err := b.Decode(&v); err != nil || !slices.Equal(v.C, []int{1, 2}) || v.D != "x" {
+		t.Errorf("Unexpected result %v (%v)", v, err)
+	}
+
+	c, err := b.Get("c", 1)
+	if err != nil || string(c.Bytes()) != "2" {
+		t.Fatalf("Unexpected result %q (%v)", c.Bytes(), err)
+	}
+	for tok := range c.Tokenize() {
+		if tok.Kind != Number || tok.Line != 2 || tok.Col != 18 || tok.Start != 25 || tok.AsInt() != 2 {
+			t.Errorf("Unexpected token %v", tok)
+		}
+	}
+	if _, err := b.Get("e"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+}
+
+func TestRawValueErrors(t *testing.T) {
+	const input = `[1, {"a": [}]`
+	var p Parser
+	var first Token
+	for tok := range p.Tokenize([]byte(input)) {
+		if tok.Kind == ObjectStart {
+			first = tok
+		}
+	}
+	// Tokens are only checked once the value is processed.
+	rv := NewRawValue([]byte(input), first, Token{End: len(input) - 2})
+	var v any
+	if err := rv.Decode(&v); err == nil || err.Error() != "1:12 Error: Unexpected token inside array" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := rv.Get("b"); err == nil || err.Error() != "1:12 Error: Unexpected token inside array" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
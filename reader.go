@@ -0,0 +1,238 @@
+package jsonstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"iter"
+)
+
+const (
+	// readerBufferSize is the default minimum size of the buffer of
+	// TokenizeReader.
+	readerBufferSize = 64 * 1024
+	// minReaderBufferSize is the smallest minimum size of the buffer of
+	// TokenizeReader that may be set with ReaderBuffer.MinSize.
+	minReaderBufferSize = 512
+	// readerLookahead is the number of bytes that must follow a token in the
+	// buffer of TokenizeReader for the token to be known to be complete (e.g.
+	// a number that is not continued by the next read).
+	readerLookahead = 16
+	// maxConsecutiveEmptyReads is the number of reads returning no data and
+	// no error after which TokenizeReader gives up (as for bufio.Reader).
+	maxConsecutiveEmptyReads = 100
+)
+
+// TokenizeReader is like Tokenize, but reads the input from r as it is
+// tokenized, so that memory use is proportional to the size of the largest
+// token rather than to the size of the input. Each iteration over the
+// sequence reads from r where the previous iteration stopped, so the
+// sequence is normally iterated only once.
+//
+// The positions of the tokens and of the value ranges (see ValueRanges) are
+// the same as for Tokenize with the whole input. Since the input is not
+// retained, the values and keys of the tokens are copies, and a Hook is
+// called with a window of the input rather than the whole input. JSONSeq is
+// ignored. If r returns an error other than io.EOF, an error token of kind
+// ErrorRead is yielded after the tokens read before the error, positioned at
+// the first byte not tokenized, and iteration stops.
+//
+// The buffer holding the input grows as needed to hold the longest token and
+// shrinks again once the input following it is shorter. Its limits can be
+// set, and the buffer reused across iterations, with Parser.ReaderBuffer.
+func (p *Parser) TokenizeReader(r io.Reader) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		b := p.ReaderBuffer
+		if b == nil {
+			b = &ReaderBuffer{}
+		}
+		src := &readerSource{p: p, r: r, b: b, buf: b.take(), st: p.newRawTokenizeState()}
+		defer func() { b.release(src.buf) }()
+		p.run(yield, func(yield func(Token) bool) {
+			stopped := false
+			p.tokenizerFrom(src, nil, nil, src.st)(func(t Token) bool {
+				// Tokens following a read error (e.g. for containers left
+				// unclosed) are not errors in the input.
+				if src.failed {
+					return false
+				}
+				stopped = !yield(t)
+				return !stopped
+			})
+			if src.failed && !stopped {
+				st := src.st
+				t := mkErr(ErrorRead, st.line, st.pos-st.lineStart+1, "Read error: "+src.err.Error())
+				t.parser = p
+				yield(t)
+			}
+		})
+	}
+}
+
+// ErrReaderBufferFull is the error given by the ErrorRead token yielded by
+// TokenizeReader when a token does not fit in a buffer of
+// ReaderBuffer.MaxSize bytes.
+var ErrReaderBufferFull = errors.New("jsonstream: token exceeds ReaderBuffer.MaxSize")
+
+// ReaderBuffer is the buffer of TokenizeReader. Setting Parser.ReaderBuffer
+// allows the limits of the buffer to be set, the buffer to be reused by
+// successive iterations over the sequences returned by TokenizeReader, and
+// the use of the buffer to be monitored (e.g. by a long-lived service that
+// parses many streams). A ReaderBuffer may be used by only one iteration at
+// a time.
+type ReaderBuffer struct {
+	MinSize int // The size of the buffer when it is allocated, below which it does not shrink (default 64 KiB; values below 512 are treated as 512)
+	MaxSize int // If greater than zero, the size above which the buffer does not grow (a token that does not fit, with a few bytes of the input following it, gives an error token of kind ErrorRead with ErrReaderBufferFull)
+	buf     []byte
+	stats   ReaderBufferStats
+}
+
+// ReaderBufferStats gives statistics for a ReaderBuffer, accumulated since it
+// was created or last reset.
+type ReaderBufferStats struct {
+	Size      int   // The current size of the buffer in bytes (0 if it is not allocated)
+	PeakSize  int   // The largest size the buffer has had
+	Grows     int   // The number of times the buffer has grown
+	Shrinks   int   // The number of times the buffer has shrunk
+	BytesRead int64 // The number of bytes of input read into the buffer
+}
+
+// Stats returns the statistics for the buffer.
+func (b *ReaderBuffer) Stats() ReaderBufferStats {
+	stats := b.stats
+	stats.Size = cap(b.buf)
+	return stats
+}
+
+// Reset zeroes the statistics for the buffer. An allocated buffer of
+// MinSize bytes is kept for reuse; a larger one is released.
+func (b *ReaderBuffer) Reset() {
+	if cap(b.buf) > b.minSize() {
+		b.buf = nil
+	}
+	b.stats = ReaderBufferStats{PeakSize: cap(b.buf)}
+}
+
+func (b *ReaderBuffer) minSize() int {
+	if b.MinSize <= 0 {
+		return readerBufferSize
+	}
+	return max(b.MinSize, minReaderBufferSize)
+}
+
+// take returns the buffer for an iteration, allocating it if necessary.
+func (b *ReaderBuffer) take() []byte {
+	buf := b.buf
+	b.buf = nil
+	if buf == nil {
+		buf = make([]byte, 0, b.minSize())
+		b.stats.PeakSize = max(b.stats.PeakSize, cap(buf))
+	}
+	return buf[:0]
+}
+
+// release returns the buffer used by an iteration, which is kept for the
+// next iteration unless it is larger than MinSize.
+func (b *ReaderBuffer) release(buf []byte) {
+	if cap(buf) <= b.minSize() {
+		b.buf = buf[:0]
+	} else {
+		b.stats.Shrinks++
+	}
+}
+
+// readerSource scans the raw tokens of the input read from an io.Reader for
+// TokenizeReader. The buffer holds the input from the index st.base onwards
+// that has been read but not yet tokenized.
+type readerSource struct {
+	p      *Parser
+	r      io.Reader
+	b      *ReaderBuffer
+	buf    []byte
+	st     *rawTokenizeState
+	eof    bool  // whether r has returned an error
+	err    error // the error returned by r, if not io.EOF
+	failed bool  // whether tokenization stopped because of the error
+}
+
+// next is like rawTokenize, reading from r as needed.
+func (s *readerSource) next(out *Token) bool {
+	if s.failed {
+		return false
+	}
+	for {
+		saved := *s.st
+		ok := rawTokenize(s.p, s.st, s.buf, out)
+		complete := ok && out.Kind != ErrorUnexpectedEOF && s.st.pos+readerLookahead < len(s.buf)
+		if complete || (s.eof && s.err == nil) {
+			if !ok {
+				return false
+			}
+			if !IsError(out.Kind) {
+				out.Start += s.st.base
+				out.End += s.st.base
+			}
+			out.Value = bytes.Clone(out.Value)
+			return true
+		}
+		*s.st = saved
+		if s.err != nil {
+			s.failed = true
+			return false
+		}
+		s.fill()
+	}
+}
+
+// fill moves the untokenized input to the start of the buffer and reads more
+// input, growing the buffer if it is full and shrinking it if the input is
+// much smaller than it. Since the untokenized input is tokenized again after
+// each fill, at least as much input is read as was already in the buffer
+// (unless the buffer fills), so that a long token read in small pieces is not
+// tokenized a quadratic number of times.
+func (s *readerSource) fill() {
+	n := copy(s.buf, s.buf[s.st.pos:])
+	s.buf = s.buf[:n]
+	s.st.base += s.st.pos
+	s.st.lineStart -= s.st.pos
+	s.st.pos = 0
+	stats := &s.b.stats
+	switch minSize := s.b.minSize(); {
+	case len(s.buf) == cap(s.buf):
+		size := 2 * cap(s.buf)
+		if s.b.MaxSize > 0 {
+			if cap(s.buf) >= s.b.MaxSize {
+				s.eof, s.err = true, ErrReaderBufferFull
+				return
+			}
+			size = min(size, max(s.b.MaxSize, minSize))
+		}
+		s.buf = append(make([]byte, 0, size), s.buf...)
+		stats.Grows++
+		stats.PeakSize = max(stats.PeakSize, cap(s.buf))
+	case cap(s.buf) > minSize && len(s.buf) <= cap(s.buf)/4:
+		// Halving the buffer at most once per fill keeps it from being
+		// reallocated repeatedly for input whose tokens vary in length.
+		s.buf = append(make([]byte, 0, max(cap(s.buf)/2, minSize)), s.buf...)
+		stats.Shrinks++
+	}
+	want := len(s.buf) + max(len(s.buf), 1)
+	for empty := 0; len(s.buf) < want && len(s.buf) < cap(s.buf); {
+		n, err := s.r.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+n]
+		stats.BytesRead += int64(n)
+		if err != nil {
+			s.eof = true
+			if err != io.EOF {
+				s.err = err
+			}
+			return
+		}
+		if n > 0 {
+			empty = 0
+		} else if empty++; empty == maxConsecutiveEmptyReads {
+			s.eof, s.err = true, io.ErrNoProgress
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package jsonstream
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTokenizeReader(t *testing.T) {
+	long := strings.Repeat("x", 3*readerBufferSize)
+	inputs := []string{
+		`{"a": [1, 2.5e3, true, null], "b\n": "cé"}`,
+		"[1,\r\n  2]\n{\"x\":\n\"" + long + "\"} 123456",
+		"// comment\n[1, /* c */ 2]",
+		`[1, 2`,
+		`{"a": tru}`,
+		``,
+	}
+	p := Parser{AllowMultipleValues: true, AllowComments: true}
+	for _, input := range inputs {
+		expected := slices.Collect(p.Tokenize([]byte(input)))
+		expectedRanges := p.ValueRanges()
+		for _, r := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input))} {
+			got := slices.Collect(p.TokenizeReader(r))
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("For %.40q expected\n%v\ngot\n%v", input, expected, got)
+			}
+			if ranges := p.ValueRanges(); !reflect.DeepEqual(ranges, expectedRanges) {
+				t.Errorf("For %.40q expected value ranges %v, got %v", input, expectedRanges, ranges)
+			}
+		}
+	}
+}
+
+func TestTokenizeReaderError(t *testing.T) {
+	var p Parser
+	r := io.MultiReader(strings.NewReader("[1,"+strings.Repeat(" ", 20)+"\n 2"), iotest.ErrReader(errors.New("boom")))
+	var got []string
+	for tok := range p.TokenizeReader(r) {
+		got = append(got, tok.String())
+	}
+	expected := []string{"1:1 ArrayStart ", "1:2 Number 1", "1:4 Error: Read error: boom"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if errs := p.Errors(); len(errs) != 1 || errs[0].Kind != ErrorRead || errs[0].Line != 1 || errs[0].Col != 4 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+func TestReaderBuffer(t *testing.T) {
+	b := &ReaderBuffer{MinSize: 1024}
+	p := NewParser(WithReaderBuffer(b))
+	long := `["` + strings.Repeat("x", 20000) + `"` + strings.Repeat(", 1", 5000) + `]`
+	expected := slices.Collect(p.Tokenize([]byte(long)))
+	if got := slices.Collect(p.TokenizeReader(strings.NewReader(long))); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Unexpected tokens")
+	}
+	stats := b.Stats()
+	if stats.Grows == 0 || stats.Shrinks == 0 || stats.PeakSize < 20000 || stats.Size != 0 || stats.BytesRead != int64(len(long)) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	b.Reset()
+	for range p.TokenizeReader(strings.NewReader(`[1, 2]`)) {
+	}
+	if stats := b.Stats(); stats != (ReaderBufferStats{Size: 1024, PeakSize: 1024, BytesRead: 6}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	for range p.TokenizeReader(strings.NewReader(`[3]`)) {
+	}
+	if stats := b.Stats(); stats != (ReaderBufferStats{Size: 1024, PeakSize: 1024, BytesRead: 9}) {
+		t.Errorf("Expected the buffer to be reused, got stats %+v", stats)
+	}
+
+	t.Run("tokens larger than the maximum size", func(t *testing.T) {
+		b := &ReaderBuffer{MinSize: 1024, MaxSize: 4096}
+		p := NewParser(WithReaderBuffer(b))
+		var got []string
+		for tok := range p.TokenizeReader(strings.NewReader(`[1, "` + strings.Repeat("x", 5000) + `"]`)) {
+			got = append(got, tok.String())
+		}
+		expected := []string{"1:1 ArrayStart ", "1:2 Number 1", "1:4 Error: Read error: " + ErrReaderBufferFull.Error()}
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+		if stats := b.Stats(); stats.PeakSize != 4096 || stats.Size != 0 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package jsonstream
+
+import (
+	"bytes"
+	"iter"
+)
+
+type recoverFrame struct {
+	kind Kind   // ArrayStart or ObjectStart
+	key  []byte // the key of the container (attached to its end token)
+}
+
+// RecoverValue transforms a token sequence containing errors into the best
+// effort reconstruction of the values that the input was intended to contain.
+// This is useful for tooling that repairs broken JSON (such as truncated log
+// records) rather than rejecting it. The error tokens are yielded unchanged,
+// marking the points at which the input was broken, and the other tokens form
+// a well-formed sequence, so that the repaired JSON can be written by passing
+// all but the error tokens to a Writer. In particular:
+//
+//   - Arrays and objects left open at the end of the input (or when the
+//     input stops after an error) are closed.
+//   - A number with leading zeros (e.g. 007) is yielded as a Number token with
+//     the zeros removed, following its error token.
+//   - An ArrayEnd or ObjectEnd token that does not match the innermost open
+//     container is replaced by the matching end token, following an error
+//     token, and one that does not close any container is replaced by an error
+//     token.
+//
+// Elements and members whose values could not be tokenized are omitted. The
+// synthesized end tokens are positioned immediately after the last token in
+// the input and have an empty range (End is Start - 1).
+func RecoverValue(tokens iter.Seq[Token]) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		var stack []recoverFrame
+		var last Token
+		for t := range tokens {
+			if t.Key == nil && isValueKind(t.Kind) && len(stack) > 0 && stack[len(stack)-1].kind == ObjectStart {
+				t.Key = notNilEmptyByteSlice
+			}
+			switch {
+			case t.Kind == ErrorLeadingZerosNotPermitted:
+				if !yield(t) {
+					return
+				}
+				t.Kind = Number
+				t.Value = trimLeadingZeros(t.Value)
+				t.ErrorMsg = ""
+			case IsError(t.Kind):
+			case t.Kind == ArrayStart || t.Kind == ObjectStart:
+				stack = append(stack, recoverFrame{kind: t.Kind, key: t.Key})
+			case isContainerEnd(t.Kind):
+				if len(stack) == 0 {
+					t = stageError("RecoverValue", ErrorUnexpectedToken, t, t, "Unexpected token (no open array or object)")
+					break
+				}
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if (t.Kind == ArrayEnd) != (top.kind == ArrayStart) {
+					msg := "Unexpected '}' (expected closing ']')"
+					if top.kind == ObjectStart {
+						msg = "Unexpected ']' (expected closing '}')"
+					}
+					if !yield(stageError("RecoverValue", ErrorUnexpectedToken, t, t, msg)) {
+						return
+					}
+					t = recoverEnd(top, t)
+				}
+			}
+			if !IsError(t.Kind) && t.Kind != Comment && t.Kind != Whitespace {
+				last = t
+			}
+			if !yield(t) {
+				return
+			}
+		}
+
+		at := last
+		at.Start = last.End + 1
+		at.End = last.End
+		at.Col += last.End - last.Start + 1
+		for i := len(stack) - 1; i >= 0; i-- {
+			if !yield(recoverEnd(stack[i], at)) {
+				return
+			}
+		}
+	}
+}
+
+// recoverEnd returns the end token for the container f positioned at the
+// token at.
+func recoverEnd(f recoverFrame, at Token) Token {
+	t := Token{Kind: ObjectEnd, Key: f.key, Line: at.Line, Col: at.Col, Start: at.Start, End: at.End, parser: at.parser}
+	if f.kind == ArrayStart {
+		t.Kind = ArrayEnd
+	}
+	return t
+}
+
+// trimLeadingZeros removes the redundant leading zeros of a numeric literal.
+func trimLeadingZeros(b []byte) []byte {
+	neg := len(b) > 0 && b[0] == '-'
+	digits := b
+	if neg {
+		digits = b[1:]
+	}
+	n := len(digits) - len(bytes.TrimLeft(digits, "0"))
+	if n == len(digits) || (n < len(digits) && (digits[n] < '0' || digits[n] > '9')) {
+		n-- // keep a zero before a fraction or exponent, or the only digit
+	}
+	if n <= 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b)-n)
+	if neg {
+		out = append(out, '-')
+	}
+	return append(out, digits[n:]...)
+}
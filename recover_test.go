@@ -0,0 +1,72 @@
+package jsonstream
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestRecoverValue(t *testing.T) {
+	// repaired writes the non-error tokens and counts the error tokens.
+	repaired := func(tokens func(func(Token) bool)) string {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		errs := 0
+		for tok := range RecoverValue(tokens) {
+			if IsError(tok.Kind) {
+				errs++
+				continue
+			}
+			if err := w.WriteToken(tok); err != nil {
+				return fmt.Sprintf("write error: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Sprintf("flush error: %v", err)
+		}
+		return fmt.Sprintf("%v (%v errors)", buf.String(), errs)
+	}
+
+	cases := map[string]string{
+		`{"a": [1, 2, {"b": "c"}]}`:  `{"a":[1,2,{"b":"c"}]} (0 errors)`,
+		`{"a": [1, 2, {"b": "c"`:     `{"a":[1,2,{"b":"c"}]} (1 errors)`,
+		`{"ts": 12, "msg": "trunc`:   `{"ts":12} (2 errors)`,
+		`[007, -00.5, 0, -01e3, 00]`: `[7,-0.5,0,-1e3,0] (4 errors)`,
+		`[1, tru, 3]`:                `[1,3] (3 errors)`,
+		`{"a": 1 "b": 2}`:            `{"a":1} (5 errors)`,
+		`[1,, 2]`:                    `[1,2] (1 errors)`,
+		`{"a": {"b": [true, {"c": 2`: `{"a":{"b":[true,{"c":2}]}} (1 errors)`,
+	}
+	var p Parser
+	for input, expected := range cases {
+		if got := repaired(p.Tokenize([]byte(input))); got != expected {
+			t.Errorf("For %v expected %v, got %v", input, expected, got)
+		}
+	}
+
+	t.Run("mismatched end tokens", func(t *testing.T) {
+		tokens := []Token{{Kind: ArrayStart}, {Kind: Number, Value: []byte("1")}, {Kind: ObjectEnd}, {Kind: ArrayEnd}, {Kind: Null}}
+		got := repaired(func(yield func(Token) bool) {
+			for _, t := range tokens {
+				if !yield(t) {
+					return
+				}
+			}
+		})
+		if got != "[1]\nnull (2 errors)" {
+			t.Errorf("Unexpected result %q", got)
+		}
+	})
+
+	t.Run("closing tokens are positioned after the input", func(t *testing.T) {
+		var ends []Token
+		for tok := range RecoverValue(p.Tokenize([]byte(`{"a": [1`))) {
+			if isContainerEnd(tok.Kind) {
+				ends = append(ends, tok)
+			}
+		}
+		if len(ends) != 2 || ends[0].Kind != ArrayEnd || ends[0].KeyAsString() != "a" || ends[1].Kind != ObjectEnd || ends[0].Start != 8 || ends[0].End != 7 || ends[0].Col != 9 {
+			t.Errorf("Unexpected end tokens %+v", ends)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package jsonstream
+
+import (
+	"iter"
+)
+
+// Reducer is called by Reduce for each value in a token sequence with the
+// accumulated result so far, the path of the value, and the value's token (the
+// ArrayStart or ObjectStart token for an array or object). It returns the new
+// accumulated result.
+type Reducer[T any] func(acc T, path Path, t Token) T
+
+// Reduce calls reducer for each value in the token sequence in document order
+// (so that an array or object is visited before its elements or members),
+// starting with the accumulated result init, and returns the final result.
+// For example, the following counts the strings at each path:
+//
+//	counts, err := Reduce(tokens, map[string]int{}, func(acc map[string]int, path Path, t Token) map[string]int {
+//		if t.Kind == String {
+//			acc[path.String()]++
+//		}
+//		return acc
+//	})
+//
+// Comments, Key tokens and Whitespace tokens are ignored. If the input
+// contains an error, the error (as returned by Token.AsError) is returned
+// together with the result accumulated before it.
+func Reduce[T any](tokens iter.Seq[Token], init T, reducer Reducer[T]) (T, error) {
+	var pt pathTracker
+	acc := init
+	for t := range tokens {
+		if IsError(t.Kind) {
+			return acc, t.AsError()
+		}
+		path := pt.next(t)
+		if isValueKind(t.Kind) {
+			acc = reducer(acc, path, t)
+		}
+	}
+	return acc, nil
+}
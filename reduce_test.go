@@ -0,0 +1,36 @@
+package jsonstream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReduce(t *testing.T) {
+	p := Parser{AllowComments: true, EmitKeyTokens: true}
+	input := []byte(`{"a": [1, 2.5, /* c */ "x"], "b": {"c": 3}}`)
+
+	sum, err := Reduce(p.Tokenize(input), 0.0, func(acc float64, path Path, t Token) float64 {
+		if t.Kind == Number {
+			acc += t.AsFloat64()
+		}
+		return acc
+	})
+	if err != nil || sum != 6.5 {
+		t.Errorf("Unexpected result %v %v", sum, err)
+	}
+
+	paths, err := Reduce(p.Tokenize(input), []string(nil), func(acc []string, path Path, t Token) []string {
+		return append(acc, fmt.Sprintf("%v:%v", path, t.Kind))
+	})
+	const expected = `[:ObjectStart ["a"]:ArrayStart ["a"][0]:Number ["a"][1]:Number ["a"][2]:String ["b"]:ObjectStart ["b"]["c"]:Number]`
+	if err != nil || fmt.Sprint(paths) != expected {
+		t.Errorf("Expected %v, got %v %v", expected, paths, err)
+	}
+
+	n, err := Reduce(p.Tokenize([]byte(`[1, 2,, 3]`)), 0, func(acc int, path Path, t Token) int {
+		return acc + 1
+	})
+	if err == nil || n != 3 {
+		t.Errorf("Expected error after 3 values, got %v %v", n, err)
+	}
+}
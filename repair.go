@@ -0,0 +1,184 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Fix describes a change made to the input by Repair.
+type Fix struct {
+	Line, Col int    // the position in the input at which the change was made
+	Msg       string // a description of the change
+}
+
+// Repair fixes common problems in almost-JSON input (such as hand-edited
+// configuration or the output of a buggy generator) and returns the first
+// value in the input as compact standard JSON, together with a report of each
+// fix made. The following are fixed:
+//
+//   - Comments are removed.
+//   - Trailing commas are removed.
+//   - Single-quoted strings are converted to double-quoted strings.
+//   - Unquoted object keys (identifiers followed by ':') are quoted.
+//   - Leading zeros are removed from numbers.
+//   - Arrays and objects left open at the end of the input are closed.
+//
+// Any other input that cannot be parsed is removed as for RecoverValue, and
+// reported as a fix giving the original error message, as is the end of
+// truncated input. If the input contains no value, the result is empty.
+func Repair(input []byte) ([]byte, []Fix) {
+	p := Parser{
+		AllowComments: true,
+		Commas:        CommasAllowTrailing,
+		EmitKeyTokens: true,
+		Hook:          TokenHookFunc(scanRepairable),
+	}
+
+	var buf bytes.Buffer
+	var fixes []Fix
+	w := NewWriter(&buf)
+	var last Token       // the last token other than a comment or error
+	var comments []Token // the comments since last
+	sawError := false    // whether there was an error since last
+	for t := range RecoverValue(p.Tokenize(input)) {
+		switch {
+		case t.Kind == Comment:
+			fixes = append(fixes, Fix{t.Line, t.Col, "Removed comment"})
+			comments = append(comments, t)
+			continue
+		case t.Kind == ErrorLeadingZerosNotPermitted:
+			fixes = append(fixes, Fix{t.Line, t.Col, "Removed leading zeros from number"})
+			sawError = true
+			continue
+		case IsError(t.Kind):
+			line, col := t.Line, t.Col
+			if line == 0 { // the position of an EOF error is not known
+				line, col = tokenAfter(last)
+			}
+			msg := "Removed invalid input (" + t.ErrorMsg + ")"
+			if t.Kind == ErrorUnexpectedEOF {
+				msg = "Input ends unexpectedly (" + t.ErrorMsg + ")"
+			} else {
+				sawError = true
+			}
+			fixes = append(fixes, Fix{line, col, msg})
+			continue
+		case isContainerEnd(t.Kind):
+			closer := "'}'"
+			if t.Kind == ArrayEnd {
+				closer = "']'"
+			}
+			if !sawError && hasTrailingComma(input, last, t, comments) {
+				fixes = append(fixes, Fix{t.Line, t.Col, "Removed trailing comma before " + closer})
+			}
+			if t.End < t.Start {
+				fixes = append(fixes, Fix{t.Line, t.Col, "Inserted missing " + closer})
+			}
+		case t.Kind == Key || t.Kind == String:
+			if input[t.Start] == '\'' {
+				fixes = append(fixes, Fix{t.Line, t.Col, "Replaced single quotes with double quotes"})
+			} else if input[t.Start] != '"' {
+				fixes = append(fixes, Fix{t.Line, t.Col, "Quoted unquoted key"})
+			}
+		}
+
+		_ = w.WriteToken(t) // the tokens from RecoverValue are well-formed
+		if t.End >= t.Start {
+			last = t
+		}
+		comments = comments[:0]
+		sawError = false
+	}
+	_ = w.Flush()
+	return buf.Bytes(), fixes
+}
+
+// hasTrailingComma reports whether the last input before the end token end,
+// ignoring whitespace and the given comments, is a comma following the token
+// last.
+func hasTrailingComma(input []byte, last, end Token, comments []Token) bool {
+	i := end.Start - 1
+	if end.End < end.Start { // inserted at the end of the input
+		i = len(input) - 1
+	}
+outer:
+	for ; i > last.End; i-- {
+		for _, c := range comments {
+			if i >= c.Start && i <= c.End {
+				i = c.Start
+				continue outer
+			}
+		}
+		switch input[i] {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return input[i] == ','
+		}
+	}
+	return false
+}
+
+// tokenAfter returns the position immediately after the token t.
+func tokenAfter(t Token) (line, col int) {
+	if t.Line == 0 {
+		return 1, 1
+	}
+	return t.Line, t.Col + t.End - t.Start + 1
+}
+
+// scanRepairable is a TokenHook that scans the single-quoted strings and
+// unquoted keys fixed by Repair as String tokens. Other input is left to the
+// tokenizer, so that a malformed single-quoted string is reported as an
+// error.
+func scanRepairable(inp []byte, pos int, tok *Token) int {
+	switch c := inp[pos]; {
+	case c == '\'':
+		// Convert the literal to a double-quoted literal and decode that, so
+		// that the escapes are handled as for standard strings.
+		lit := []byte{'"'}
+		for i := pos + 1; i < len(inp); i++ {
+			switch inp[i] {
+			case '\'':
+				var s string
+				if json.Unmarshal(append(lit, '"'), &s) != nil {
+					return 0
+				}
+				tok.Kind = String
+				tok.Value = []byte(s)
+				return i + 1 - pos
+			case '"':
+				lit = append(lit, '\\', '"')
+			case '\\':
+				if i+1 < len(inp) && inp[i+1] == '\'' {
+					lit = append(lit, '\'')
+				} else if i+1 < len(inp) {
+					lit = append(lit, inp[i], inp[i+1])
+				}
+				i++
+			default:
+				lit = append(lit, inp[i])
+			}
+		}
+		return 0
+	case isIdentStart(c):
+		n := 1
+		for pos+n < len(inp) && (isIdentStart(inp[pos+n]) || (inp[pos+n] >= '0' && inp[pos+n] <= '9')) {
+			n++
+		}
+		i := pos + n
+		for i < len(inp) && (inp[i] == ' ' || inp[i] == '\t' || inp[i] == '\r' || inp[i] == '\n') {
+			i++
+		}
+		if i >= len(inp) || inp[i] != ':' {
+			return 0
+		}
+		tok.Kind = String
+		tok.Value = inp[pos : pos+n]
+		return n
+	}
+	return 0
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$'
+}
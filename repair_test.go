@@ -0,0 +1,70 @@
+package jsonstream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	cases := []struct {
+		input, output string
+		fixes         []string
+	}{
+		{`{"a": [1, 2]}`, `{"a":[1,2]}`, nil},
+		{`{"a": [1, 2,], "b": {"c": 3,},}`, `{"a":[1,2],"b":{"c":3}}`, []string{
+			"1:13 Removed trailing comma before ']'",
+			"1:29 Removed trailing comma before '}'",
+			"1:31 Removed trailing comma before '}'",
+		}},
+		{"{\n  // the name\n  name: 'Bob \"B\" O\\'Brien', /* age */ 'age': 042\n}", `{"name":"Bob \"B\" O'Brien","age":42}`, []string{
+			"2:4 Removed comment",
+			"3:4 Quoted unquoted key",
+			"3:10 Replaced single quotes with double quotes",
+			"3:30 Removed comment",
+			"3:40 Replaced single quotes with double quotes",
+			"3:47 Removed leading zeros from number",
+		}},
+		{`[1, {"a": [true, "x"`, `[1,{"a":[true,"x"]}]`, []string{
+			"1:21 Input ends unexpectedly (Unexpected EOF inside array)",
+			"1:21 Inserted missing ']'",
+			"1:21 Inserted missing '}'",
+			"1:21 Inserted missing ']'",
+		}},
+		{`[1, 2,`, `[1,2]`, []string{
+			"1:6 Input ends unexpectedly (Unexpected EOF (expected closing ']'))",
+			"1:6 Removed trailing comma before ']'",
+			"1:6 Inserted missing ']'",
+		}},
+		{`[1, /* , */ 2 /* , */]`, `[1,2]`, []string{
+			"1:5 Removed comment",
+			"1:15 Removed comment",
+		}},
+		{`[1, @, 2]`, `[1,2]`, []string{
+			"1:5 Removed invalid input (Unexpected token inside array)",
+		}},
+		{`["a, b`, `[]`, []string{
+			"1:7 Removed invalid input (Unexpected token inside array)",
+			"1:2 Input ends unexpectedly (Unexpected EOF inside array)",
+			"1:2 Inserted missing ']'",
+		}},
+		{``, ``, nil},
+	}
+
+	for _, c := range cases {
+		output, fixes := Repair([]byte(c.input))
+		var got []string
+		for _, f := range fixes {
+			got = append(got, fmt.Sprintf("%v:%v %v", f.Line, f.Col, f.Msg))
+		}
+		if string(output) != c.output {
+			t.Errorf("For %q expected output %v, got %v", c.input, c.output, string(output))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.fixes) {
+			t.Errorf("For %q expected fixes\n%q\ngot\n%q", c.input, c.fixes, got)
+		}
+		var p Parser
+		if len(output) > 0 && !succeedsWith(&p, string(output)) {
+			t.Errorf("For %q the output %v is not valid JSON", c.input, string(output))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+)
+
+// A Resolver returns the string value of a reference such as an environment
+// variable or secret, given its name.
+type Resolver func(name string) (string, error)
+
+// ResolveReferences replaces each reference (an object with a single member
+// whose key is a key of resolvers and whose value is a string, such as
+// {"$env": "HOME"}) with a string token whose value is returned by the
+// corresponding resolver for the member's value. For example,
+//
+//	ResolveReferences(tokens, map[string]Resolver{
+//		"$env": func(name string) (string, error) { return os.Getenv(name), nil },
+//	})
+//
+// The replacement token has the key of the reference and the position of the
+// whole reference object. If a resolver returns an error, a token of kind
+// ErrorReference is yielded in place of the reference. The resolved value is
+// never included in error messages.
+func ResolveReferences(tokens iter.Seq[Token], resolvers map[string]Resolver) iter.Seq[Token] {
+	isDirective := func(key []byte) bool {
+		_, ok := resolvers[string(key)]
+		return ok
+	}
+	return func(yield func(Token) bool) {
+		replaceDirectives(tokens, isDirective, yield, func(start, member, end Token) bool {
+			value, err := resolvers[string(member.Key)](string(member.Value))
+			if err != nil {
+				return yield(stageError("ResolveReferences", ErrorReference, start, end, fmt.Sprintf("Cannot resolve %s %q: %v", member.Key, member.Value, err)))
+			}
+			return yield(Token{
+				Line:   start.Line,
+				Col:    start.Col,
+				Start:  start.Start,
+				End:    end.End,
+				Key:    start.Key,
+				Kind:   String,
+				Value:  []byte(value),
+				parser: start.parser,
+			})
+		})
+	}
+}
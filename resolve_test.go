@@ -0,0 +1,44 @@
+package jsonstream
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveReferences(t *testing.T) {
+	resolvers := map[string]Resolver{
+		"$env": func(name string) (string, error) {
+			if name == "HOME" {
+				return "/home/user", nil
+			}
+			return "", errors.New("not set")
+		},
+		"$secret": func(name string) (string, error) {
+			return "s3cr3t:" + name, nil
+		},
+	}
+
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{`{"home": {"$env": "HOME"}, "key": {"$secret": "db/password"}}`, `{"home":"/home/user","key":"s3cr3t:db/password"}`},
+		{`[{"$env": "HOME"}, {"$env": "HOME", "x": 1}, {"$env": 1}, {"$other": "HOME"}]`, `["/home/user",{"$env":"HOME","x":1},{"$env":1},{"$other":"HOME"}]`},
+		{`{"$env": "HOME"}`, `"/home/user"`},
+		{`{"a": {"$env": "MISSING"}}`, `{<error: Cannot resolve $env "MISSING": not set>}`},
+	}
+	for _, c := range cases {
+		var p Parser
+		out := compactJSON(ResolveReferences(p.Tokenize([]byte(c.input)), resolvers))
+		if out != c.expected {
+			t.Errorf("For %v expected %v, got %v", c.input, c.expected, out)
+		}
+	}
+
+	var p Parser
+	for tok := range ResolveReferences(p.Tokenize([]byte(`{"a": {"$env": "HOME"}}`)), resolvers) {
+		if tok.Kind == String && (tok.KeyAsString() != "a" || tok.Start != 6 || tok.End != 21) {
+			t.Errorf("Unexpected token %v (%v-%v)", tok, tok.Start, tok.End)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package jsonstream
+
+import (
+	"iter"
+)
+
+// TokenizeSelected is like Tokenize, but it yields only the tokens of the
+// values whose paths match one of the given patterns (see PathMatches),
+// together with the tokens of the arrays and objects that contain them (and
+// any keys, comments and whitespace inside these). This is useful for
+// decoders that consume only a few fields of a large input. Other values are
+// skipped by scanning only their structure (brackets, strings and comments),
+// which is considerably faster than tokenizing them, as strings are not
+// unescaped and no tokens are constructed. Skipped values are not validated,
+// and p.Hook is not called for them, so custom syntax inside skipped values
+// must not contain unbalanced brackets or quotes. Comments immediately
+// preceding a skipped value are also skipped.
+//
+// For example, given the patterns {"user", "name"} and {"tags", Wildcard{}},
+// the input
+//
+//	{"id": 1, "user": {"name": "x", "email": "y"}, "tags": ["a", "b"]}
+//
+// yields the tokens of
+//
+//	{"user": {"name": "x"}, "tags": ["a", "b"]}
+func (p *Parser) TokenizeSelected(inp []byte, patterns ...[]any) iter.Seq[Token] {
+	sel := &pathSelector{patterns: patterns, root: make([]int, 0, len(patterns))}
+	for i, pat := range patterns {
+		if len(pat) == 0 {
+			sel.root = nil
+			break
+		}
+		sel.root = append(sel.root, i)
+	}
+	return p.tokenize(inp, sel)
+}
+
+// pathSelector determines which values are skipped by TokenizeSelected.
+type pathSelector struct {
+	patterns [][]any
+	root     []int // the indices of the patterns that may match the descendants of a top-level value (nil if it is selected)
+
+	// For each open container, the indices of the patterns that may match its
+	// descendants (nil if the container is inside a selected value).
+	stack   [][]int
+	pending []int // the value of stack for the container most recently passed to keep
+}
+
+// keep returns true if the value with the given index (for an array element)
+// or key (for an object member, in which case index is -1) in the innermost
+// open container is selected or may contain a selected value.
+func (sel *pathSelector) keep(index int, key []byte) bool {
+	sel.pending = nil
+	top := sel.stack[len(sel.stack)-1]
+	if top == nil {
+		return true
+	}
+	depth := len(sel.stack) - 1
+	var next []int
+	for _, i := range top {
+		pat := sel.patterns[i]
+		switch e := pat[depth].(type) {
+		case int:
+			if e != index {
+				continue
+			}
+		case string:
+			if index != -1 || e != string(key) {
+				continue
+			}
+		case FoldKey:
+			if index != -1 || !e.matches(string(key)) {
+				continue
+			}
+		case Wildcard:
+		default:
+			panic("TokenizeSelected: invalid element type; must be int, string, Wildcard or FoldKey")
+		}
+		if len(pat) == depth+1 {
+			return true
+		}
+		next = append(next, i)
+	}
+	sel.pending = next
+	return next != nil
+}
+
+// push is called when a container is entered.
+func (sel *pathSelector) push() {
+	sel.stack = append(sel.stack, sel.pending)
+	sel.pending = nil
+}
+
+// pop is called when a container is exited.
+func (sel *pathSelector) pop() {
+	sel.stack = sel.stack[:len(sel.stack)-1]
+}
+
+// skipRawValue advances st past the value beginning at st.pos (following any
+// whitespace and comments), scanning only its structure. It returns false,
+// leaving st unchanged, if no value begins there (e.g. if the next character
+// is ']').
+func skipRawValue(p *Parser, st *rawTokenizeState, inp []byte) bool {
+	saved := *st
+	skipRawSpace(p, st, inp)
+	if st.pos >= len(inp) {
+		*st = saved
+		return false
+	}
+	switch inp[st.pos] {
+	case ']', '}', ',', ':':
+		*st = saved
+		return false
+	}
+
+	start := st.pos
+	depth := 0
+scan:
+	for st.pos < len(inp) {
+		c := inp[st.pos]
+		switch c {
+		case '"':
+			for st.pos++; st.pos < len(inp) && inp[st.pos] != '"'; {
+				if inp[st.pos] == '\\' && st.pos+1 < len(inp) {
+					st.pos++
+				}
+				st.advanceRaw(p, inp)
+			}
+			st.pos = min(st.pos+1, len(inp))
+		case '[', '{':
+			depth++
+			st.pos++
+		case ']', '}':
+			if depth == 0 {
+				break scan
+			}
+			depth--
+			st.pos++
+		case ',', ':':
+			if depth == 0 {
+				break scan
+			}
+			st.pos++
+		case ' ', '\t', '\r', '\n', '/':
+			if depth == 0 {
+				break scan
+			}
+			skipRawSpace(p, st, inp)
+			if st.pos < len(inp) && inp[st.pos] == '/' {
+				// not a comment
+				st.pos++
+			}
+		default:
+			if depth == 0 && p.extraWhitespaceLen(inp, st.pos) > 0 {
+				break scan
+			}
+			st.pos++
+		}
+		if depth == 0 && (c == '"' || c == ']' || c == '}') {
+			break
+		}
+	}
+	if st.pos == start {
+		*st = saved
+		return false
+	}
+	return true
+}
+
+// skipRawSpace advances st past any whitespace and comments.
+func skipRawSpace(p *Parser, st *rawTokenizeState, inp []byte) {
+	for st.pos < len(inp) {
+		switch inp[st.pos] {
+		case ' ', '\t', '\r', '\n':
+			st.advanceRaw(p, inp)
+		case '/':
+			if !p.AllowComments || st.pos+1 >= len(inp) {
+				return
+			}
+			switch inp[st.pos+1] {
+			case '/':
+				for st.pos += 2; st.pos < len(inp) && lineTerminatorLen(p.LineTerminators, inp, st.pos) == 0; {
+					st.pos++
+				}
+			case '*':
+				for st.pos += 2; st.pos < len(inp) && !(inp[st.pos] == '*' && st.pos+1 < len(inp) && inp[st.pos+1] == '/'); {
+					st.advanceRaw(p, inp)
+				}
+				st.pos = min(st.pos+2, len(inp))
+			default:
+				return
+			}
+		default:
+			n := p.extraWhitespaceLen(inp, st.pos)
+			if n == 0 {
+				return
+			}
+			if lineTerminatorLen(p.LineTerminators, inp, st.pos) > 0 {
+				st.advanceRaw(p, inp)
+			} else {
+				st.pos += n
+			}
+		}
+	}
+}
+
+// advanceRaw advances st past the byte at st.pos and any line terminator that
+// begins there.
+func (st *rawTokenizeState) advanceRaw(p *Parser, inp []byte) {
+	if n := lineTerminatorLen(p.LineTerminators, inp, st.pos); n > 0 {
+		st.pos += n - 1
+		st.line++
+		st.lineStart = st.pos + st.lineStartAdjust
+	}
+	st.pos++
+}
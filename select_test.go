@@ -0,0 +1,82 @@
+package jsonstream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeSelected(t *testing.T) {
+	const input = `{"id": 1, "user": {"name": "x", "email": "y\"}"}, "tags": ["a", {"b": [1]}], "n": null}`
+	cases := []struct {
+		patterns [][]any
+		expected string
+	}{
+		{[][]any{{"user", "name"}, {"tags", Wildcard{}}}, `{"user":{"name":"x"},"tags":["a",{"b":[1]}]}`},
+		{[][]any{{"tags", 1, "b"}}, `{"tags":[{"b":[1]}]}`},
+		{[][]any{{"tags", 0}}, `{"tags":["a"]}`},
+		{[][]any{{"n"}, {"id"}}, `{"id":1,"n":null}`},
+		{[][]any{{FoldKey{Key: "USER"}, FoldKey{Key: "Name"}}}, `{"user":{"name":"x"}}`},
+		{[][]any{{"missing", "x"}}, `{}`},
+		{[][]any{{}}, `{"id":1,"user":{"name":"x","email":"y\"}"},"tags":["a",{"b":[1]}],"n":null}`},
+		{nil, `{}`},
+	}
+	for _, c := range cases {
+		var p Parser
+		if got := compactJSON(p.TokenizeSelected([]byte(input), c.patterns...)); got != c.expected {
+			t.Errorf("For %v expected %v, got %v", c.patterns, c.expected, got)
+		}
+	}
+
+	t.Run("comments and positions", func(t *testing.T) {
+		p := Parser{AllowComments: true, AllowTrailingCommas: true}
+		input := "[/* a ] */ {\"x\": [\n\n1, // ]\n \"\\u2028]\"]},\n {\"x\": 2, \"y\": 3},]"
+		var out []string
+		for tok := range p.TokenizeSelected([]byte(input), []any{Wildcard{}, "y"}) {
+			out = append(out, fmt.Sprintf("%v@%v:%v", tok.Kind, tok.Line, tok.Col))
+		}
+		expected := "ArrayStart@1:1 Comment@1:2 ObjectStart@1:12 ObjectEnd@4:13 ObjectStart@5:3 Number@5:17 ObjectEnd@5:18 ArrayEnd@5:20"
+		if got := strings.Join(out, " "); got != expected {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("errors outside skipped values", func(t *testing.T) {
+		var p Parser
+		inputs := map[string]string{
+			`{"a": [1, 2, }`:  `{<error: Unexpected EOF>`,
+			`{"a": 1 "b": 2}`: `{<error: Unexpected token>,<error: Unexpected token inside object (expecting key)>,<error: Unexpected token inside object (expecting ':')>,<error: Unexpected token inside object>,<error: Unexpected EOF>`,
+			`[1, 2`:           `[<error: Unexpected EOF inside array>`,
+			`{"a": }`:         `{<error: Unexpected token inside object>,<error: Unexpected EOF>`,
+			`{"b": [1, 2,]}`:  `{"b":[1,2,<error: Trailing ','>]}`,
+			`[/]`:             `[<error: Unexpected token inside array>,<error: Unexpected EOF inside array>`,
+		}
+		for input, expected := range inputs {
+			if got := compactJSON(p.TokenizeSelected([]byte(input), []any{"b"})); got != expected {
+				t.Errorf("For %v expected %v, got %v", input, expected, got)
+			}
+		}
+	})
+
+	t.Run("matches Tokenize for selected values", func(t *testing.T) {
+		p := Parser{LineTerminators: LineTerminatorUnicode}
+		for _, tok := range []string{`"x"`, `[1, {"a": "b"}]`, `{"k": [true, false]}`} {
+			input := fmt.Sprintf("{\"skip\": {\"deep\": [[[\"\\\"]\u2028\"]]],\r\n\"x\": 1},\n \"keep\": %v, \"after\": 1}", tok)
+			selected := p.TokenizeSelected([]byte(input), []any{"keep"})
+			var all []Token
+			for t := range p.Tokenize([]byte(input)) {
+				all = append(all, t)
+			}
+			i := 0
+			for st := range selected {
+				for i < len(all) && (all[i].Start != st.Start || all[i].Kind != st.Kind) {
+					i++
+				}
+				if i == len(all) || all[i].Line != st.Line || all[i].Col != st.Col || string(all[i].Value) != string(st.Value) {
+					t.Errorf("Token %v does not match Tokenize", st)
+					break
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package jsonstream
+
+import (
+	"log/slog"
+	"reflect"
+	"unicode/utf8"
+)
+
+// The LogValue methods below allow tokens and errors to be logged using
+// log/slog as groups of attributes rather than as flat strings, e.g.
+//
+//	slog.Error("invalid input", "err", tok)
+//
+// logs the kind, position and message of the error token tok as separate
+// fields.
+
+var errorKindNames = map[Kind]string{
+	ErrorTrailingInput:                   "ErrorTrailingInput",
+	ErrorUnexpectedEOF:                   "ErrorUnexpectedEOF",
+	ErrorUnexpectedToken:                 "ErrorUnexpectedToken",
+	ErrorTrailingComma:                   "ErrorTrailingComma",
+	ErrorUnexpectedComma:                 "ErrorUnexpectedComma",
+	ErrorUnexpectedCharacter:             "ErrorUnexpectedCharacter",
+	ErrorLeadingZerosNotPermitted:        "ErrorLeadingZerosNotPermitted",
+	ErrorExpectedDigitAfterDecimalPoint:  "ErrorExpectedDigitAfterDecimalPoint",
+	ErrorExpectedDigitFollowingEInNumber: "ErrorExpectedDigitFollowingEInNumber",
+	ErrorBadUnicodeEscape:                "ErrorBadUnicodeEscape",
+	ErrorIllegalControlCharInsideString:  "ErrorIllegalControlCharInsideString",
+	ErrorUTF8DecodingErrorInsideString:   "ErrorUTF8DecodingErrorInsideString",
+	ErrorKeyCollision:                    "ErrorKeyCollision",
+	ErrorInclude:                         "ErrorInclude",
+	ErrorReference:                       "ErrorReference",
+	ErrorMaxDepthExceeded:                "ErrorMaxDepthExceeded",
+	ErrorQuery:                           "ErrorQuery",
+	ErrorStage:                           "ErrorStage",
+	ErrorQuotaExceeded:                   "ErrorQuotaExceeded",
+	ErrorTypeMismatch:                    "ErrorTypeMismatch",
+	ErrorInvalidKey:                      "ErrorInvalidKey",
+	ErrorRead:                            "ErrorRead",
+	ErrorNonASCII:                        "ErrorNonASCII",
+	ErrorExpansionDepth:                  "ErrorExpansionDepth",
+	ErrorExpansionSize:                   "ErrorExpansionSize",
+}
+
+// kindName returns the name of the constant for the kind k (unlike
+// Kind.String, which returns "Error" for every error kind).
+func kindName(k Kind) string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return k.String()
+}
+
+// maxLogSnippet is the maximum length in bytes of a value in a log record.
+const maxLogSnippet = 64
+
+// logSnippet returns s, truncated to at most maxLogSnippet bytes (at a UTF-8
+// boundary) with "..." appended if it is longer.
+func logSnippet(s []byte) string {
+	if len(s) <= maxLogSnippet {
+		return string(s)
+	}
+	n := maxLogSnippet
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return string(s[:n]) + "..."
+}
+
+// LogValue implements slog.LogValuer. The attributes are the kind of the
+// token (the name of its constant, e.g. ErrorUnexpectedEOF), its line,
+// column and offset (except for errors detected by the tokenizer, which give
+// only a line and column), its filename, key and a snippet of its value if it
+// has them, and for an error token, the stage to which it is attributed and
+// its message.
+func (t Token) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("kind", kindName(t.Kind)),
+		slog.Int("line", t.Line),
+		slog.Int("col", t.Col),
+	}
+	if !IsError(t.Kind) || t.stage != "" {
+		attrs = append(attrs, slog.Int("offset", t.Start))
+	}
+	if name := t.Filename(); name != "" {
+		attrs = append(attrs, slog.String("filename", name))
+	}
+	if t.Key != nil {
+		attrs = append(attrs, slog.String("key", logSnippet(t.Key)))
+	}
+	if len(t.Value) > 0 {
+		attrs = append(attrs, slog.String("snippet", logSnippet(t.Value)))
+	}
+	if IsError(t.Kind) {
+		if t.stage != "" {
+			attrs = append(attrs, slog.String("stage", t.stage))
+		}
+		attrs = append(attrs, slog.String("msg", t.ErrorMsg))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *NumberDecodeError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("line", e.Line),
+		slog.Int("col", e.Col),
+		slog.Int("offset", e.Start),
+		slog.String("snippet", logSnippet([]byte(e.Value))),
+		slog.String("msg", e.Err.Error()),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *CoercionError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("kind", kindName(e.Kind)),
+		slog.Int("line", e.Line),
+		slog.Int("col", e.Col),
+		slog.Int("offset", e.Start),
+		slog.String("path", e.Path.String()),
+		slog.String("to", e.To.String()),
+	}
+	if e.Kind != ArrayStart && e.Kind != ObjectStart {
+		attrs = append(attrs, slog.String("snippet", logSnippet([]byte(e.Value))), slog.String("msg", e.reason))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *UnmarshalError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("kind", kindName(e.Kind)),
+		slog.Int("line", e.Line),
+		slog.Int("col", e.Col),
+		slog.Int("offset", e.Start),
+		slog.String("path", e.Path.String()),
+		slog.Any("type", e.Type),
+	}
+	if e.Kind != ArrayStart && e.Kind != ObjectStart {
+		attrs = append(attrs, slog.String("snippet", logSnippet([]byte(e.Value))))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("msg", e.Err.Error()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *UnknownFieldError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("line", e.Line),
+		slog.Int("col", e.Col),
+		slog.Int("offset", e.Start),
+		slog.String("path", e.Path.String()),
+		slog.String("key", logSnippet([]byte(e.Key))),
+		slog.Any("type", e.Type),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *MissingFieldError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("line", e.Line),
+		slog.Int("col", e.Col),
+		slog.Int("offset", e.Start),
+		slog.String("path", e.Path.String()),
+		slog.String("field", e.Field),
+		slog.Any("type", e.Type),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *DuplicateKeyError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("line", e.Line),
+		slog.Int("col", e.Col),
+		slog.Int("offset", e.Start),
+		slog.String("key", logSnippet([]byte(e.Key))),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *QuotaError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("resource", e.Resource),
+		slog.Int("limit", e.Limit),
+		slog.Int("used", e.Used),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *QueryError) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("offset", e.Offset), slog.String("msg", e.Msg))
+}
+
+// LogValue implements slog.LogValuer.
+func (e *MappingError) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("line", e.Line), slog.Int("col", e.Col), slog.String("msg", e.Msg))
+}
+
+// LogValue implements slog.LogValuer.
+func (e *TokenSeqError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("index", e.Index),
+		slog.Any("token", e.Token),
+		slog.String("msg", e.Reason),
+	)
+}
+
+// LogValue implements slog.LogValuer. The attributes of the token are
+// included only if the failure is attributable to a token.
+func (e *PartialWriteError) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.Int64("written", e.Written)}
+	if !reflect.ValueOf(e.Token).IsZero() {
+		attrs = append(attrs, slog.Any("token", e.Token))
+	}
+	return slog.GroupValue(append(attrs, slog.String("msg", e.Err.Error()))...)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *RequestBodyError) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.Int("status", e.Status)}
+	if e.Line > 0 {
+		attrs = append(attrs, slog.Int("line", e.Line), slog.Int("col", e.Col))
+	}
+	if e.Stage != "" {
+		attrs = append(attrs, slog.String("stage", e.Stage))
+	}
+	return slog.GroupValue(append(attrs, slog.String("msg", e.Message))...)
+}
@@ -0,0 +1,73 @@
+package jsonstream
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	p := Parser{Filename: "in.json"}
+	var errTok, strTok Token
+	for tok := range p.Tokenize([]byte("{\"k\": \"" + strings.Repeat("é", 40) + "\",\n  \"x\": tru}")) {
+		if tok.Kind == String {
+			strTok = tok
+		}
+		if IsError(tok.Kind) {
+			errTok = tok
+			break
+		}
+	}
+	logger.Info("tokens", "err", errTok, "tok", strTok)
+	stageErr := NewStageError("Check", strTok, "Bad value")
+	logger.Info("stage", "err", stageErr)
+	logger.Info("errors",
+		"quota", &QuotaError{Resource: "Depth", Limit: 2, Used: 3},
+		"seq", &TokenSeqError{Index: 1, Token: Token{Kind: ArrayEnd}, Reason: "Unexpected ArrayEnd"},
+		"partial", &PartialWriteError{Written: 4, Err: errors.New("closed")},
+		"number", &NumberDecodeError{Line: 1, Col: 2, Start: 1, Value: "1.5", Err: errors.New("not an integer")},
+		"dup", &DuplicateKeyError{Line: 1, Col: 9, Start: 8, Key: "k"},
+		"unmarshal", &UnmarshalError{Line: 1, Col: 2, Start: 1, Kind: String, Value: "x", Type: reflect.TypeFor[int]()},
+		"unknown", &UnknownFieldError{Line: 1, Col: 7, Start: 6, Key: "k", Type: reflect.TypeFor[decodeInner]()},
+		"missing", &MissingFieldError{Line: 1, Col: 1, Field: "X", Type: reflect.TypeFor[decodeInner]()},
+	)
+
+	expected := `level=INFO msg=tokens err.kind=ErrorUnexpectedToken err.line=2 err.col=7 err.filename=in.json err.msg="Unexpected token inside object" ` +
+		`tok.kind=String tok.line=1 tok.col=7 tok.offset=6 tok.filename=in.json tok.key=k tok.snippet=` + strings.Repeat("é", 32) + `...` + "\n" +
+		`level=INFO msg=stage err.kind=ErrorStage err.line=1 err.col=7 err.offset=6 err.filename=in.json err.stage=Check err.msg="Bad value"` + "\n" +
+		`level=INFO msg=errors quota.resource=Depth quota.limit=2 quota.used=3 ` +
+		`seq.index=1 seq.token.kind=ArrayEnd seq.token.line=0 seq.token.col=0 seq.token.offset=0 seq.msg="Unexpected ArrayEnd" ` +
+		`partial.written=4 partial.msg=closed ` +
+		`number.line=1 number.col=2 number.offset=1 number.snippet=1.5 number.msg="not an integer" ` +
+		`dup.line=1 dup.col=9 dup.offset=8 dup.key=k ` +
+		`unmarshal.kind=String unmarshal.line=1 unmarshal.col=2 unmarshal.offset=1 unmarshal.path="" unmarshal.type=int unmarshal.snippet=x ` +
+		`unknown.line=1 unknown.col=7 unknown.offset=6 unknown.path="" unknown.key=k unknown.type=jsonstream.decodeInner ` +
+		`missing.line=1 missing.col=1 missing.offset=0 missing.path="" missing.field=X missing.type=jsonstream.decodeInner` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, buf.String())
+	}
+}
+
+func TestKindName(t *testing.T) {
+	for k := ErrorTrailingInput; k <= ErrorExpansionSize; k++ {
+		if name := kindName(k); !strings.HasPrefix(name, "Error") || name == "Error" {
+			t.Errorf("No name for error kind %d", k)
+		}
+	}
+	if kindName(ObjectStart) != "ObjectStart" {
+		t.Errorf("Unexpected name %v", kindName(ObjectStart))
+	}
+}
@@ -0,0 +1,38 @@
+package jsonstream
+
+// Stage returns the name of the stage that produced an error token (e.g.
+// "Include"), or the empty string if the error was produced by the tokenizer.
+// The name is included in the message of the error.
+//
+// All stages follow the same contract for errors: error tokens in the input
+// of a stage are yielded unchanged (keeping the stage that produced them and
+// their position in the original input), and errors detected by a stage are
+// reported by yielding an error token that gives the stage's name and the
+// position of the input that it could not process. A stage that cannot
+// continue after an error stops once the error token has been yielded. If the
+// consumer of a stage stops iterating, the stage yields nothing further and
+// stops iterating over its input, so that the input can release its
+// resources.
+// User-defined stages can follow the same contract using NewStageError.
+func (t Token) Stage() string {
+	return t.stage
+}
+
+// NewStageError returns an error token of kind ErrorStage for the stage with
+// the given name, positioned at the token at (e.g. the first token of a value
+// that the stage could not process).
+func NewStageError(stage string, at Token, msg string) Token {
+	return stageError(stage, ErrorStage, at, at, msg)
+}
+
+// stageError returns an error token of the given kind for a stage, spanning
+// the input from the start of the token start to the end of the token end.
+func stageError(stage string, kind Kind, start, end Token, msg string) Token {
+	err := mkErr(kind, start.Line, start.Col, msg)
+	err.Start = start.Start
+	err.End = end.End
+	err.parser = start.parser
+	err.stage = stage
+	err.parser.localizeError(&err)
+	return err
+}
@@ -0,0 +1,133 @@
+package jsonstream
+
+import (
+	"iter"
+	"testing"
+)
+
+func TestStageErrors(t *testing.T) {
+	var p Parser
+	for tok := range p.Tokenize([]byte(`[1,]`)) {
+		if IsError(tok.Kind) && tok.Stage() != "" {
+			t.Errorf("Expected tokenizer error to have no stage, got %q", tok.Stage())
+		}
+	}
+
+	t.Run("errors are attributed to the stage that detected them", func(t *testing.T) {
+		cases := []struct {
+			tokens iter.Seq[Token]
+			stage  string
+			msg    string
+		}{
+			{RenameKeys(p.Tokenize([]byte(`{"a": 1, "b": 2}`)), map[string]string{"a": "b"}, RenameOptions{OnCollision: CollisionError}), "RenameKeys", `1:15 Error (RenameKeys): Key "b" collides with an earlier key in the same object`},
+			{GroupBy(p.Tokenize([]byte(`{}`)), []any{"k"}, nil), "GroupBy", "1:1 Error (GroupBy): Expected array"},
+			{TopK(p.Tokenize([]byte(`1`)), 1, []any{"v"}), "TopK", "1:1 Error (TopK): Expected array"},
+		}
+		for _, c := range cases {
+			var errs []Token
+			for tok := range c.tokens {
+				if IsError(tok.Kind) {
+					errs = append(errs, tok)
+				}
+			}
+			if len(errs) != 1 || errs[0].Stage() != c.stage || errs[0].Error() != c.msg {
+				t.Errorf("Expected one error %q from %v, got %v", c.msg, c.stage, errs)
+			}
+		}
+	})
+
+	t.Run("errors pass through later stages unchanged", func(t *testing.T) {
+		var errs []Token
+		tokens := Delete(RenameKeys(p.Tokenize([]byte(`{"a": 1, "b": [1,]}`)), map[string]string{"a": "c"}, RenameOptions{}), []any{"c"})
+		for tok := range tokens {
+			if IsError(tok.Kind) {
+				errs = append(errs, tok)
+			}
+		}
+		if len(errs) != 1 || errs[0].Stage() != "" || errs[0].Error() != "1:17 Error: Trailing ','" {
+			t.Errorf("Unexpected errors %v", errs)
+		}
+	})
+
+	t.Run("NewStageError", func(t *testing.T) {
+		p := Parser{Filename: "in.json"}
+		for tok := range p.Tokenize([]byte("[1,\n \"x\"]")) {
+			if tok.Kind != String {
+				continue
+			}
+			err := NewStageError("Check", tok, "Expected number")
+			if err.Kind != ErrorStage || err.Stage() != "Check" || err.Start != tok.Start || err.End != tok.End {
+				t.Errorf("Unexpected error token %#v", err)
+			}
+			if err.Error() != "in.json:2:3 Error (Check): Expected number" {
+				t.Errorf("Unexpected message %v", err)
+			}
+		}
+	})
+}
+
+func TestStageEarlyTermination(t *testing.T) {
+	input := []byte(`[{"a": 1, "b": {"$inc": "x"}, "c": {"$env": "E"}, "d": [1, 2, {"e": null}]}, {"a": 2, "b": "x"}, 3]`)
+	load := func(string, string) ([]byte, error) { return []byte(`{"q": [1]}`), nil }
+	env := func(string) (string, error) { return "v", nil }
+	query, err := CompileQuery(".[] | .a, .d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tp Parser
+	stages := map[string]func(iter.Seq[Token]) iter.Seq[Token]{
+		"Delete": func(s iter.Seq[Token]) iter.Seq[Token] { return Delete(s, []any{Wildcard{}, "a"}) },
+		"Insert": func(s iter.Seq[Token]) iter.Seq[Token] { return Insert(s, []any{0, "z"}, tp.Tokenize([]byte(`[1]`))) },
+		"Splice": func(s iter.Seq[Token]) iter.Seq[Token] { return Splice(s, []any{0, "z"}, tp.Tokenize([]byte(`[1]`))) },
+		"RenameKeys": func(s iter.Seq[Token]) iter.Seq[Token] {
+			return RenameKeys(s, map[string]string{"a": "b"}, RenameOptions{OnCollision: CollisionError})
+		},
+		"Coerce": func(s iter.Seq[Token]) iter.Seq[Token] {
+			return Coerce(s, CoercionRule{[]any{Wildcard{}, "a"}, CoerceToString})
+		},
+		"Dedupe": func(s iter.Seq[Token]) iter.Seq[Token] { return Dedupe(s, DedupeOptions{}, nil) },
+		"Include": func(s iter.Seq[Token]) iter.Seq[Token] {
+			return Include(s, IncludeOptions{Directive: "$inc", Load: load})
+		},
+		"ResolveReferences": func(s iter.Seq[Token]) iter.Seq[Token] { return ResolveReferences(s, map[string]Resolver{"$env": env}) },
+		"MergeStreams": func(s iter.Seq[Token]) iter.Seq[Token] {
+			return MergeStreams(s, tp.Tokenize([]byte(`[1]`)), MergePatch)
+		},
+		"FillDefaults": func(s iter.Seq[Token]) iter.Seq[Token] { return FillDefaults(s, tp.Tokenize([]byte(`[{"x": 1}]`))) },
+		"GroupBy":      func(s iter.Seq[Token]) iter.Seq[Token] { return GroupBy(s, []any{"a"}, []any{"a"}) },
+		"TopK":         func(s iter.Seq[Token]) iter.Seq[Token] { return TopK(s, 2, []any{"a"}) },
+		"Tee":          func(s iter.Seq[Token]) iter.Seq[Token] { return Tee(s, 1)[0] },
+		"Query":        query.Run,
+		"WrapInObject": func(s iter.Seq[Token]) iter.Seq[Token] { return WrapInObject(s, "k") },
+		"UnwrapKey":    func(s iter.Seq[Token]) iter.Seq[Token] { return UnwrapKey(s, "a") },
+	}
+	for name, stage := range stages {
+		for _, inp := range [][]byte{input, []byte(`[1, 2,, 3]`), []byte(`{"a": 1}`)} {
+			for k := range 40 {
+				// Breaking out of the loop after k tokens must not panic (as it
+				// would if the stage yielded again), and the tokenizer must
+				// not be asked for more tokens once the stage has stopped.
+				var p Parser
+				stopped := false
+				source := func(yield func(Token) bool) {
+					for tok := range p.Tokenize(inp) {
+						if stopped {
+							t.Errorf("%v requested a token after stopping", name)
+						}
+						if !yield(tok) {
+							return
+						}
+					}
+				}
+				i := 0
+				for range stage(source) {
+					if i == k {
+						break
+					}
+					i++
+				}
+				stopped = true
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package jsonstream
+
+import (
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// SummaryOptions configures Summarize.
+type SummaryOptions struct {
+	// The quantiles (between 0 and 1) whose approximate values are yielded. If
+	// nil, the median and the 90th and 99th percentiles (0.5, 0.9 and 0.99)
+	// are yielded.
+	Quantiles []float64
+	// The compression of the t-digest used to approximate the quantiles, which
+	// bounds the number of centroids retained for each pattern. Larger values
+	// give more accurate quantiles using more memory. If zero, a default of
+	// 100 is used, for which the rank of each quantile is typically within
+	// 0.5% of the number of values of the true rank.
+	Compression float64
+}
+
+const defaultSummaryCompression = 100
+
+var defaultSummaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Summarize computes summary statistics of the numbers whose paths match
+// each of the given patterns (see PathMatches), for quick profiling of
+// huge documents (e.g. Summarize(tokens, [][]any{{Wildcard{}, "price"}}, opts)
+// for the prices of an array of records). It yields an array with one object
+// for each pattern, in order, of the form
+//
+//	{"count": 4, "min": 1, "max": 10, "mean": 4.5, "quantiles": {"0.5": 3.5, "0.9": 10, "0.99": 10}}
+//
+// where quantiles gives the approximate value of each quantile in
+// opts.Quantiles, computed using a t-digest (so quantiles of small inputs are
+// exact). Min and max are yielded as written in the input. If no number
+// matches a pattern, min, max, mean and the quantiles are null. Values other
+// than numbers, and numbers outside the range of float64, are ignored.
+//
+// Memory use is bounded by opts.Compression for each pattern, whatever the
+// size of the input. If the input contains an error, the error is yielded and
+// iteration stops.
+func Summarize(tokens iter.Seq[Token], patterns [][]any, opts SummaryOptions) iter.Seq[Token] {
+	quantiles := opts.Quantiles
+	if quantiles == nil {
+		quantiles = defaultSummaryQuantiles
+	}
+	compression := opts.Compression
+	if compression <= 0 {
+		compression = defaultSummaryCompression
+	}
+
+	return func(yield func(Token) bool) {
+		type summary struct {
+			digest   tdigest
+			sum      float64
+			min, max Token
+		}
+		summaries := make([]summary, len(patterns))
+		for i := range summaries {
+			summaries[i].digest.compression = compression
+		}
+
+		var pt pathTracker
+		for t := range tokens {
+			if IsError(t.Kind) {
+				yield(t)
+				return
+			}
+			path := pt.next(t)
+			if t.Kind != Number {
+				continue
+			}
+			f, err := parseNumber(t.Value, 64)
+			if err != nil {
+				continue
+			}
+			for i, pattern := range patterns {
+				if !PathMatches(path, pattern) {
+					continue
+				}
+				s := &summaries[i]
+				if s.digest.count == 0 || f < s.digest.min {
+					s.min = t
+				}
+				if s.digest.count == 0 || f > s.digest.max {
+					s.max = t
+				}
+				s.sum += f
+				s.digest.add(f)
+			}
+		}
+
+		if !yield(Token{Kind: ArrayStart}) {
+			return
+		}
+		for _, s := range summaries {
+			n := s.digest.count
+			out := []Token{
+				{Kind: ObjectStart},
+				scalarToken(Number, "count", strconv.AppendInt(nil, int64(n), 10)),
+			}
+			if n > 0 {
+				out = append(out,
+					scalarToken(Number, "min", s.min.Value),
+					scalarToken(Number, "max", s.max.Value),
+					scalarToken(Number, "mean", appendSummaryFloat(s.sum/n)))
+			} else {
+				out = append(out, scalarToken(Null, "min", nil), scalarToken(Null, "max", nil), scalarToken(Null, "mean", nil))
+			}
+			out = append(out, Token{Kind: ObjectStart, Key: []byte("quantiles")})
+			for _, q := range quantiles {
+				key := strconv.FormatFloat(q, 'g', -1, 64)
+				if n > 0 {
+					out = append(out, scalarToken(Number, key, appendSummaryFloat(s.digest.quantile(q))))
+				} else {
+					out = append(out, scalarToken(Null, key, nil))
+				}
+			}
+			out = append(out, Token{Kind: ObjectEnd, Key: []byte("quantiles")}, Token{Kind: ObjectEnd})
+			for _, t := range out {
+				if !yield(t) {
+					return
+				}
+			}
+		}
+		yield(Token{Kind: ArrayEnd})
+	}
+}
+
+// appendSummaryFloat returns the shortest representation of f (which is
+// finite, as the mean and quantiles of finite values are).
+func appendSummaryFloat(f float64) []byte {
+	return strconv.AppendFloat(nil, f, 'g', -1, 64)
+}
+
+// tdigest is a merging t-digest (Dunning and Ertl, "Computing Extremely
+// Accurate Quantiles Using t-Digests"), which approximates the distribution
+// of a stream of values by a bounded number of weighted centroids that are
+// smaller towards the extremes of the distribution.
+type tdigest struct {
+	compression float64
+	centroids   []centroid // merged, in order of mean
+	buffer      []centroid // added since the last merge
+	count       float64
+	min, max    float64
+}
+
+type centroid struct {
+	mean, weight float64
+}
+
+func (d *tdigest) add(x float64) {
+	if d.count == 0 || x < d.min {
+		d.min = x
+	}
+	if d.count == 0 || x > d.max {
+		d.max = x
+	}
+	d.count++
+	d.buffer = append(d.buffer, centroid{x, 1})
+	if len(d.buffer) >= 5*int(d.compression) {
+		d.merge()
+	}
+}
+
+// scale is the k1 scale function, which maps a quantile to the index of the
+// centroid containing it. Adjacent centroids are merged only while they span
+// at most one unit of the scale.
+func (d *tdigest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// merge merges the buffered values into the centroids.
+func (d *tdigest) merge() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.centroids, d.buffer...)
+	slices.SortFunc(all, func(a, b centroid) int {
+		switch {
+		case a.mean < b.mean:
+			return -1
+		case a.mean > b.mean:
+			return 1
+		}
+		return 0
+	})
+	merged := all[:1]
+	before := 0.0 // the weight of the centroids before the last merged centroid
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		w := last.weight + c.weight
+		if d.scale((before+w)/d.count)-d.scale(before/d.count) <= 1 {
+			last.mean += (c.mean - last.mean) * c.weight / w
+			last.weight = w
+			continue
+		}
+		before += last.weight
+		merged = append(merged, c)
+	}
+	d.centroids = merged
+	d.buffer = d.buffer[:0]
+}
+
+// quantile returns the approximate value of the quantile q, interpolating
+// between the centers of the centroids (and the minimum and maximum at the
+// ends). The digest must not be empty.
+func (d *tdigest) quantile(q float64) float64 {
+	d.merge()
+	cs := d.centroids
+	index := min(max(q, 0), 1) * d.count
+	if len(cs) == 1 {
+		return cs[0].mean
+	}
+	center := cs[0].weight / 2 // the weight before the center of cs[i]
+	if index < center {
+		return d.min + (cs[0].mean-d.min)*index/center
+	}
+	for i := 0; i+1 < len(cs); i++ {
+		gap := (cs[i].weight + cs[i+1].weight) / 2
+		if index < center+gap {
+			return cs[i].mean + (cs[i+1].mean-cs[i].mean)*(index-center)/gap
+		}
+		center += gap
+	}
+	last := cs[len(cs)-1]
+	return last.mean + (d.max-last.mean)*min((index-center)/(last.weight/2), 1)
+}
@@ -0,0 +1,61 @@
+package jsonstream
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	const input = `[{"price": 3, "qty": 1}, {"price": 1.50}, {"price": "n/a", "qty": 2}, {"price": 10}, {"price": 1e999}]`
+	var p Parser
+	got := compactJSON(Summarize(p.Tokenize([]byte(input)), [][]any{{Wildcard{}, "price"}, {Wildcard{}, "qty"}, {Wildcard{}, "none"}}, SummaryOptions{}))
+	expected := `[{"count":3,"min":1.50,"max":10,"mean":4.833333333333333,"quantiles":{"0.5":3,"0.9":10,"0.99":10}},` +
+		`{"count":2,"min":1,"max":2,"mean":1.5,"quantiles":{"0.5":1.5,"0.9":2,"0.99":2}},` +
+		`{"count":0,"min":null,"max":null,"mean":null,"quantiles":{"0.5":null,"0.9":null,"0.99":null}}]`
+	if got != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, got)
+	}
+
+	got = compactJSON(Summarize(p.Tokenize([]byte(`[1, 3, 4, 10]`)), [][]any{{Wildcard{}}}, SummaryOptions{}))
+	if got != `[{"count":4,"min":1,"max":10,"mean":4.5,"quantiles":{"0.5":3.5,"0.9":10,"0.99":10}}]` {
+		t.Errorf("Unexpected summary %v", got)
+	}
+	got = compactJSON(Summarize(p.Tokenize([]byte(`[1, 2, x]`)), [][]any{{Wildcard{}}}, SummaryOptions{}))
+	if !strings.HasPrefix(got, "<error") {
+		t.Errorf("Expected an error, got %v", got)
+	}
+}
+
+func TestSummarizeQuantileAccuracy(t *testing.T) {
+	const n = 100000
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, v := range rand.New(rand.NewSource(1)).Perm(n) {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Itoa(v + 1))
+	}
+	sb.WriteByte(']')
+
+	var p Parser
+	qs := []float64{0.001, 0.1, 0.5, 0.9, 0.999}
+	var values []string
+	for tok := range Summarize(p.Tokenize([]byte(sb.String())), [][]any{{Wildcard{}}}, SummaryOptions{Quantiles: qs}) {
+		if tok.Kind == Number {
+			values = append(values, string(tok.Value))
+		}
+	}
+	if len(values) != 4+len(qs) || values[0] != "100000" || values[1] != "1" || values[2] != "100000" || values[3] != "50000.5" {
+		t.Fatalf("Unexpected summary %v", values)
+	}
+	for i, q := range qs {
+		got, _ := strconv.ParseFloat(values[4+i], 64)
+		if math.Abs(got-q*n) > 0.005*n {
+			t.Errorf("Quantile %v: expected about %v, got %v", q, q*n, got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package jsonstream
+
+import (
+	"iter"
+	"math"
+	"sync"
+)
+
+// Tee returns n sequences that each yield all of the tokens of the given
+// sequence, which is iterated over only once. Tokens are buffered until every
+// returned sequence has consumed them, so memory use is proportional to how
+// far the fastest consumer is ahead of the slowest. A sequence that is never
+// iterated over therefore causes all tokens to be buffered. A consumer that
+// stops early no longer holds back the others.
+//
+// The returned sequences may be consumed from different goroutines, but each
+// may be iterated over only once.
+func Tee(tokens iter.Seq[Token], n int) []iter.Seq[Token] {
+	if n <= 0 {
+		panic("jsonstream: Tee requires at least one output")
+	}
+
+	st := &teeState{tokens: tokens, pos: make([]int, n), started: make([]bool, n), active: n}
+	seqs := make([]iter.Seq[Token], n)
+	for i := range seqs {
+		seqs[i] = func(yield func(Token) bool) {
+			st.mu.Lock()
+			if st.started[i] {
+				st.mu.Unlock()
+				panic("jsonstream: sequence returned by Tee iterated over more than once")
+			}
+			st.started[i] = true
+			st.mu.Unlock()
+
+			for {
+				t, ok := st.get(i)
+				if !ok {
+					return
+				}
+				if !yield(t) {
+					st.mu.Lock()
+					st.finish(i)
+					st.mu.Unlock()
+					return
+				}
+			}
+		}
+	}
+	return seqs
+}
+
+type teeState struct {
+	mu      sync.Mutex
+	tokens  iter.Seq[Token]
+	next    func() (Token, bool)
+	stop    func()
+	done    bool    // the underlying sequence is exhausted
+	buf     []Token // tokens not yet consumed by every output
+	offset  int     // the index in the underlying sequence of buf[0]
+	pos     []int   // the index of the next token for each output
+	started []bool
+	active  int // the number of outputs that have not finished
+}
+
+// get returns the next token for output i, or false if there are no more
+// tokens.
+func (st *teeState) get(i int) (Token, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var t Token
+	if bi := st.pos[i] - st.offset; bi < len(st.buf) {
+		t = st.buf[bi]
+	} else {
+		if !st.done {
+			if st.next == nil {
+				st.next, st.stop = iter.Pull(st.tokens)
+			}
+			var ok bool
+			t, ok = st.next()
+			st.done = !ok
+		}
+		if st.done {
+			st.finish(i)
+			return Token{}, false
+		}
+		st.buf = append(st.buf, t)
+	}
+	st.pos[i]++
+	st.trim()
+	return t, true
+}
+
+func (st *teeState) finish(i int) {
+	if st.pos[i] == math.MaxInt {
+		return
+	}
+	st.pos[i] = math.MaxInt
+	st.active--
+	if st.active == 0 && st.stop != nil {
+		st.stop()
+		st.done = true
+	}
+	st.trim()
+}
+
+// trim discards the buffered tokens that every output has consumed.
+func (st *teeState) trim() {
+	lowest := math.MaxInt
+	for _, p := range st.pos {
+		lowest = min(lowest, p)
+	}
+	k := min(lowest-st.offset, len(st.buf))
+	if k == 0 {
+		return
+	}
+	clear(st.buf[:k])
+	st.buf = st.buf[k:]
+	st.offset += k
+}
@@ -0,0 +1,117 @@
+package jsonstream
+
+import (
+	"iter"
+	"sync"
+	"testing"
+)
+
+func TestTee(t *testing.T) {
+	const input = `{"a": [1, 2, {"b": null}], "c": "d"}`
+
+	countingTokenize := func(count *int) iter.Seq[Token] {
+		var p Parser
+		return func(yield func(Token) bool) {
+			for t := range p.Tokenize([]byte(input)) {
+				*count++
+				if !yield(t) {
+					return
+				}
+			}
+		}
+	}
+
+	var p Parser
+	expected := compactJSON(p.Tokenize([]byte(input)))
+
+	t.Run("sequential", func(t *testing.T) {
+		count := 0
+		seqs := Tee(countingTokenize(&count), 3)
+		for _, seq := range seqs {
+			if got := compactJSON(seq); got != expected {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		}
+		if count != 10 {
+			t.Errorf("Expected the input to be tokenized once, got %v tokens", count)
+		}
+	})
+
+	t.Run("interleaved", func(t *testing.T) {
+		count := 0
+		seqs := Tee(countingTokenize(&count), 2)
+		next0, stop0 := iter.Pull(seqs[0])
+		defer stop0()
+		next1, stop1 := iter.Pull(seqs[1])
+		defer stop1()
+		for {
+			t0, ok0 := next0()
+			t1, ok1 := next1()
+			if ok0 != ok1 || t0.Kind != t1.Kind || string(t0.Value) != string(t1.Value) {
+				t.Fatalf("Token mismatch: %v %v", t0, t1)
+			}
+			if !ok0 {
+				break
+			}
+		}
+		if count != 10 {
+			t.Errorf("Expected the input to be tokenized once, got %v tokens", count)
+		}
+	})
+
+	t.Run("early stop", func(t *testing.T) {
+		count := 0
+		seqs := Tee(countingTokenize(&count), 2)
+		for range seqs[0] {
+			break
+		}
+		if got := compactJSON(seqs[1]); got != expected {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+
+		count = 0
+		seqs = Tee(countingTokenize(&count), 2)
+		for range seqs[0] {
+			break
+		}
+		for range seqs[1] {
+			break
+		}
+		if count != 1 {
+			t.Errorf("Expected tokenization to stop once all outputs stopped, got %v tokens", count)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		count := 0
+		seqs := Tee(countingTokenize(&count), 4)
+		results := make([]string, len(seqs))
+		var wg sync.WaitGroup
+		for i, seq := range seqs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = compactJSON(seq)
+			}()
+		}
+		wg.Wait()
+		for _, got := range results {
+			if got != expected {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		}
+	})
+
+	t.Run("iterating twice panics", func(t *testing.T) {
+		seqs := Tee(p.Tokenize([]byte(input)), 1)
+		for range seqs[0] {
+		}
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected panic")
+			}
+		}()
+		for range seqs[0] {
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package jsonstream
+
+import (
+	"container/heap"
+	"errors"
+	"iter"
+	"slices"
+	"strconv"
+)
+
+// TopK yields an array containing the k elements of the top-level array of
+// the input with the largest numeric values at the path matching the pattern
+// valuePath (see PathMatches), in descending order of value. Elements with
+// equal values are yielded in input order, and if there are more than k such
+// elements at the boundary, the earliest are kept. Elements with no numeric
+// value matching valuePath are ignored. Comments inside elements are
+// preserved.
+//
+// Only the current k largest elements are kept in memory. If the input
+// contains an error or its top-level value is not an array, the error is
+// yielded and iteration stops.
+func TopK(tokens iter.Seq[Token], k int, valuePath []any) iter.Seq[Token] {
+	if k <= 0 {
+		panic("jsonstream: TopK requires k > 0")
+	}
+	return func(yield func(Token) bool) {
+		var h topKHeap
+		i := 0
+		for elements, err := range batchTokens("TopK", tokens, 1) {
+			if err != nil {
+				yieldBatchError(yield, err)
+				return
+			}
+			elem := elements[0]
+			v, ok := findScalar(elem, valuePath)
+			if !ok || v.Kind != Number {
+				continue
+			}
+			f, err := parseNumber(v.Value, 64)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				continue
+			}
+			item := topKItem{tokens: elem, value: f, index: i}
+			i++
+			if len(h) < k {
+				heap.Push(&h, item)
+			} else if h.less(h[0], item) {
+				h[0] = item
+				heap.Fix(&h, 0)
+			}
+		}
+
+		slices.SortFunc(h, func(a, b topKItem) int {
+			if h.less(b, a) {
+				return -1
+			}
+			return 1
+		})
+
+		if !yield(Token{Kind: ArrayStart}) {
+			return
+		}
+		for _, item := range h {
+			for _, t := range item.tokens {
+				if !yield(t) {
+					return
+				}
+			}
+		}
+		yield(Token{Kind: ArrayEnd})
+	}
+}
+
+type topKItem struct {
+	tokens []Token
+	value  float64
+	index  int
+}
+
+// topKHeap is a min-heap of the largest elements seen so far, with later
+// elements considered smaller than earlier elements with the same value.
+type topKHeap []topKItem
+
+func (h topKHeap) less(a, b topKItem) bool {
+	return a.value < b.value || (a.value == b.value && a.index > b.index)
+}
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h topKHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topKHeap) Push(x any)        { *h = append(*h, x.(topKItem)) }
+func (h *topKHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,40 @@
+package jsonstream
+
+import (
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	const input = `[
+		{"id": 1, "score": 5},
+		{"id": 2, "score": 9},
+		{"id": 3},
+		{"id": 4, "score": 7},
+		{"id": 5, "score": 9},
+		{"id": 6, "score": "100"},
+		{"id": 7, "score": -1},
+		{"id": 8, "score": 7}
+	]`
+
+	cases := map[int]string{
+		1:  `[{"id":2,"score":9}]`,
+		3:  `[{"id":2,"score":9},{"id":5,"score":9},{"id":4,"score":7}]`,
+		4:  `[{"id":2,"score":9},{"id":5,"score":9},{"id":4,"score":7},{"id":8,"score":7}]`,
+		10: `[{"id":2,"score":9},{"id":5,"score":9},{"id":4,"score":7},{"id":8,"score":7},{"id":1,"score":5},{"id":7,"score":-1}]`,
+	}
+	for k, expected := range cases {
+		var p Parser
+		out := compactJSON(TopK(p.Tokenize([]byte(input)), k, []any{"score"}))
+		if out != expected {
+			t.Errorf("For k=%v expected\n%v\ngot\n%v", k, expected, out)
+		}
+	}
+
+	var p Parser
+	if out := compactJSON(TopK(p.Tokenize([]byte(`[1, 3, 2]`)), 2, []any{})); out != `[3,2]` {
+		t.Errorf("Unexpected output %v", out)
+	}
+	if out := compactJSON(TopK(p.Tokenize([]byte(`[1, 3,, 2]`)), 2, []any{})); out != `<error: Unexpected ',' inside array>` {
+		t.Errorf("Unexpected output %v", out)
+	}
+}
@@ -0,0 +1,140 @@
+package jsonstream
+
+import (
+	"fmt"
+	"iter"
+)
+
+// ValidationStrategy determines how Parser.ValidThenDecode combines
+// validation with decoding.
+type ValidationStrategy int
+
+const (
+	// Tokenize the entire input before decoding it, so that decoding is not
+	// begun for malformed input. This gives the cheapest reject path, at the
+	// cost of tokenizing valid input twice.
+	ValidateBeforeDecode ValidationStrategy = iota
+	// Tokenize the input once, stopping the decoder as soon as an error is
+	// encountered. The decoder may already have processed some of the input
+	// when it is stopped.
+	ValidateWhileDecoding
+)
+
+// ValidThenDecode validates the input and passes its tokens to decode
+// according to the given strategy. The sequence passed to decode never yields
+// an error token; if the input is malformed, the sequence ends before the
+// first error, and the error (as returned by Token.AsError) is returned in
+// place of any error returned by decode. Otherwise, the error returned by
+// decode is returned. With ValidateBeforeDecode, decode is not called for
+// malformed input.
+func (p *Parser) ValidThenDecode(inp []byte, strategy ValidationStrategy, decode func(tokens iter.Seq[Token]) error) error {
+	if strategy == ValidateBeforeDecode {
+		for t := range p.Tokenize(inp) {
+			if IsError(t.Kind) {
+				return t.AsError()
+			}
+		}
+		return decode(p.Tokenize(inp))
+	}
+
+	var syntaxErr error
+	tokens := func(yield func(Token) bool) {
+		for t := range p.Tokenize(inp) {
+			if IsError(t.Kind) {
+				syntaxErr = t.AsError()
+				return
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+	err := decode(tokens)
+	if syntaxErr != nil {
+		return syntaxErr
+	}
+	return err
+}
+
+// TokenSeqError is returned by ValidateTokenSeq for a token sequence that
+// does not have a valid structure. It wraps ErrMalformedTokenSequence.
+type TokenSeqError struct {
+	Index  int    // the index of the offending token in the sequence (the length of the sequence if it ends early)
+	Token  Token  // the offending token (the zero Token if the sequence ends early)
+	Reason string // a description of the problem
+}
+
+func (e *TokenSeqError) Error() string {
+	return fmt.Sprintf("jsonstream: malformed token sequence at token %v: %v", e.Index, e.Reason)
+}
+
+func (e *TokenSeqError) Unwrap() error {
+	return ErrMalformedTokenSequence
+}
+
+// ValidateTokenSeq checks that the token sequence is structurally valid, so
+// that (for example) it can be written by a Writer, returning a
+// *TokenSeqError for the first violation found. This is useful for debugging
+// stages that construct or rearrange tokens. A sequence is valid if each
+// ArrayEnd or ObjectEnd token closes the innermost open array or object, each
+// value in an object has a key, each Number token holds a valid JSON number,
+// it contains no error tokens or tokens of other kinds that cannot appear in
+// the output of Tokenize, and it does not end inside an array or object. Key,
+// Comment and Whitespace tokens are ignored, and any number of top-level
+// values is permitted.
+func ValidateTokenSeq(tokens iter.Seq[Token]) error {
+	var c tokenSeqChecker
+	i := 0
+	for t := range tokens {
+		if reason := c.check(t); reason != "" {
+			return &TokenSeqError{Index: i, Token: t, Reason: reason}
+		}
+		i++
+	}
+	if len(c.stack) > 0 {
+		return &TokenSeqError{Index: i, Reason: c.unclosed()}
+	}
+	return nil
+}
+
+// tokenSeqChecker checks the structure of a token sequence one token at a
+// time (see ValidateTokenSeq).
+type tokenSeqChecker struct {
+	stack []Kind // the start token kinds of the open containers
+}
+
+// check returns a description of the problem if the token t cannot follow
+// the tokens checked so far, or the empty string otherwise.
+func (c *tokenSeqChecker) check(t Token) string {
+	switch {
+	case IsError(t.Kind):
+		return "Error token (" + t.ErrorMsg + ")"
+	case t.Kind == Key || t.Kind == Comment || t.Kind == Whitespace:
+	case isContainerEnd(t.Kind):
+		if len(c.stack) == 0 {
+			return fmt.Sprintf("%v with no open array or object", t.Kind)
+		}
+		if top := c.stack[len(c.stack)-1]; (t.Kind == ArrayEnd) != (top == ArrayStart) {
+			return fmt.Sprintf("%v does not match %v", t.Kind, top)
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	case isValueKind(t.Kind):
+		if len(c.stack) > 0 && c.stack[len(c.stack)-1] == ObjectStart && t.Key == nil {
+			return fmt.Sprintf("%v in object has no key", t.Kind)
+		}
+		if t.Kind == Number && !isValidNumber(t.Value) {
+			return fmt.Sprintf("Invalid number %q", t.Value)
+		}
+		if t.Kind == ArrayStart || t.Kind == ObjectStart {
+			c.stack = append(c.stack, t.Kind)
+		}
+	default:
+		return fmt.Sprintf("Unexpected token of kind %v", t.Kind)
+	}
+	return ""
+}
+
+// unclosed describes the innermost open container at the end of a sequence.
+func (c *tokenSeqChecker) unclosed() string {
+	return fmt.Sprintf("Sequence ends inside %v", c.stack[len(c.stack)-1])
+}
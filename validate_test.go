@@ -0,0 +1,90 @@
+package jsonstream
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"testing"
+)
+
+func TestValidThenDecode(t *testing.T) {
+	sum := func(n *int, calls *int) func(iter.Seq[Token]) error {
+		return func(tokens iter.Seq[Token]) error {
+			*calls++
+			for t := range tokens {
+				if IsError(t.Kind) {
+					return errors.New("unexpected error token")
+				}
+				if t.Kind == Number {
+					*n += t.AsInt()
+				}
+			}
+			return nil
+		}
+	}
+
+	for _, strategy := range []ValidationStrategy{ValidateBeforeDecode, ValidateWhileDecoding} {
+		var p Parser
+		n, calls := 0, 0
+		if err := p.ValidThenDecode([]byte(`[1, 2, 3]`), strategy, sum(&n, &calls)); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if n != 6 || calls != 1 {
+			t.Errorf("Expected sum 6 from one call, got %v from %v calls", n, calls)
+		}
+
+		n, calls = 0, 0
+		err := p.ValidThenDecode([]byte(`[1, 2, 3,]`), strategy, sum(&n, &calls))
+		if err == nil || err.Error() != "1:9 Error: Trailing ','" {
+			t.Errorf("Unexpected error %v", err)
+		}
+		switch strategy {
+		case ValidateBeforeDecode:
+			if calls != 0 {
+				t.Errorf("Expected decode not to be called for malformed input")
+			}
+		case ValidateWhileDecoding:
+			if n != 6 || calls != 1 {
+				t.Errorf("Expected decoding to stop at the error, got sum %v from %v calls", n, calls)
+			}
+		}
+
+		decodeErr := errors.New("decode failed")
+		err = p.ValidThenDecode([]byte(`{}`), strategy, func(iter.Seq[Token]) error { return decodeErr })
+		if err != decodeErr {
+			t.Errorf("Expected decode error to be returned, got %v", err)
+		}
+	}
+}
+
+func TestValidateTokenSeq(t *testing.T) {
+	var p Parser
+	if err := ValidateTokenSeq(p.Tokenize([]byte(`{"a": [1, {"b": null}], "c": "x"}`))); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	key := []byte("k")
+	cases := []struct {
+		tokens   []Token
+		expected string
+	}{
+		{[]Token{{Kind: ArrayStart}, {Kind: ObjectEnd}}, "at token 1: ObjectEnd does not match ArrayStart"},
+		{[]Token{{Kind: ArrayEnd}}, "at token 0: ArrayEnd with no open array or object"},
+		{[]Token{{Kind: ObjectStart}, {Kind: Key, Value: key}, {Kind: Number, Value: []byte("1")}, {Kind: ObjectEnd}}, "at token 2: Number in object has no key"},
+		{[]Token{{Kind: ArrayStart}, {Kind: Number, Value: []byte("01")}, {Kind: ArrayEnd}}, `at token 1: Invalid number "01"`},
+		{[]Token{{Kind: ObjectStart}, {Kind: ArrayStart, Key: key}, {Kind: ArrayEnd, Key: key}}, "at token 3: Sequence ends inside ObjectStart"},
+		{[]Token{{Kind: Comma}}, "at token 0: Unexpected token of kind Comma"},
+		{[]Token{{Kind: ArrayStart}, mkErr(ErrorUnexpectedEOF, 0, 0, "Unexpected EOF")}, "at token 1: Error token (Unexpected EOF)"},
+	}
+	for _, c := range cases {
+		err := ValidateTokenSeq(slices.Values(c.tokens))
+		var tse *TokenSeqError
+		if !errors.As(err, &tse) || err.Error() != "jsonstream: malformed token sequence "+c.expected || !errors.Is(err, ErrMalformedTokenSequence) {
+			t.Errorf("Expected %v, got %v", c.expected, err)
+			continue
+		}
+		if tse.Index < len(c.tokens) && tse.Token.Kind != c.tokens[tse.Index].Kind {
+			t.Errorf("Unexpected token %v for %v", tse.Token, c.expected)
+		}
+	}
+}
@@ -0,0 +1,686 @@
+package jsonstream
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Writer encodes a sequence of tokens as compact JSON text. Comments are
+// omitted, so that the output is always standard JSON. Key and Whitespace
+// tokens are ignored (each key is also attached to the following value).
+// Each top-level value after the first is preceded by a newline.
+type Writer struct {
+	w        io.Writer
+	buf      []byte
+	stack    []Kind // the start token kinds of the open containers
+	inFirst  bool   // no value has yet been written in the innermost container
+	nValues  int    // the number of top-level values started
+	written  int64
+	err      error
+	maxBufSz int
+
+	sourceMap       SourceMap
+	recordSourceMap bool
+	escapeHTML      bool
+	jsonSeq         bool
+	original        []byte // the input whose string literals are copied (see EnableOriginalEscapes)
+	keyTok          Token  // the last Key token, if original is non-nil
+	sortKeys        bool
+	duplicates      DuplicateKeyPolicy
+	pending         []Token // the tokens of the object being buffered for sorting or removing duplicate keys
+	pendingDepth    int
+}
+
+// SourceMapping associates the position in the output of a Writer at which a
+// token was written with the position of the token in the input.
+type SourceMapping struct {
+	Output int64 // the byte offset in the output of the token (after any key)
+	Start  int   // the Start field of the token
+	Line   int   // the Line field of the token
+	Col    int   // the Col field of the token
+}
+
+// SourceMap is a sequence of source mappings in order of output offset.
+type SourceMap []SourceMapping
+
+// Lookup returns the mapping for the token whose output contains the given
+// output offset (i.e. the last mapping whose Output is at most offset). It
+// returns false if there is no such mapping.
+func (sm SourceMap) Lookup(offset int64) (SourceMapping, bool) {
+	i, found := slices.BinarySearchFunc(sm, offset, func(m SourceMapping, offset int64) int {
+		return cmp.Compare(m.Output, offset)
+	})
+	if !found {
+		if i == 0 {
+			return SourceMapping{}, false
+		}
+		i--
+	}
+	return sm[i], true
+}
+
+const defaultWriterBufferSize = 4096
+
+// ErrMalformedTokenSequence is returned by Writer when the token sequence does
+// not have a valid JSON structure (e.g. if an ArrayEnd token closes an
+// object). ValidateTokenSeq can be used to find the cause.
+var ErrMalformedTokenSequence = errors.New("jsonstream: malformed token sequence")
+
+// NewWriter returns a Writer that writes to w. Output is buffered, so Flush
+// (or WriteAll, which flushes) must be called once all tokens have been
+// written.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterSize(w, defaultWriterBufferSize)
+}
+
+// NewWriterSize is like NewWriter, but output is written to w as soon as at
+// least size bytes are buffered (the default is 4096). A Writer never
+// accumulates more than one token beyond this limit, so huge documents can be
+// streamed (e.g. over HTTP) with bounded memory. Each write to w is
+// synchronous, so a slow consumer applies backpressure to the producer of the
+// tokens. If size is not positive, the default is used.
+func NewWriterSize(w io.Writer, size int) *Writer {
+	if size <= 0 {
+		size = defaultWriterBufferSize
+	}
+	return &Writer{w: w, maxBufSz: size}
+}
+
+// EnableSourceMap causes the Writer to record a SourceMapping for each token
+// subsequently written (see SourceMap). This allows an error found in the
+// output of a pipeline of stages to be traced back to the original input.
+func (w *Writer) EnableSourceMap() {
+	w.recordSourceMap = true
+}
+
+// EnableHTMLEscaping causes the Writer to escape '<', '>' and '&' (and the
+// line terminators U+2028 and U+2029) inside strings and keys, so that the
+// output can be embedded safely inside an HTML <script> element. The output
+// remains equivalent JSON.
+func (w *Writer) EnableHTMLEscaping() {
+	w.escapeHTML = true
+}
+
+// EnableJSONSeq causes the Writer to write a JSON text sequence (RFC 7464):
+// each top-level value is preceded by a record separator (0x1E) and followed
+// by a newline, instead of values being separated by newlines.
+func (w *Writer) EnableJSONSeq() {
+	w.jsonSeq = true
+}
+
+// EnableOriginalEscapes causes the Writer to copy the text of each string and
+// key from input, the input from which the tokens were tokenized, rather than
+// re-encoding the decoded value, so that escape sequences such as \/ and
+// \u00e9 are preserved and the output of a pass-through pipeline differs
+// from the input as little as possible. (Tokens yielded by RawValue.Tokenize
+// have positions in the original input, so they can also be written in this
+// way.) The text is copied only if it is a JSON string literal for the value
+// of the token and contains no character that EnableHTMLEscaping requires to
+// be escaped. So strings whose values were changed by a stage, strings
+// recognized by a Hook from custom syntax, and literals containing unpaired
+// surrogate escapes (whose values are not the same characters) are
+// re-encoded. Keys are copied only if the Parser's EmitKeyTokens option is
+// set, as the positions of keys are given by Key tokens.
+func (w *Writer) EnableOriginalEscapes(input []byte) {
+	w.original = input
+}
+
+// EnableKeySorting causes the Writer to write the members of each object in
+// order of their keys (comparing the bytes of their UTF-8 encodings, which
+// orders them by code point), so that any token source can be normalized as
+// it is written. Members with the same key keep their order. Each object is
+// buffered (with the objects it contains) until it ends, so its tokens must
+// not be modified in the meantime.
+func (w *Writer) EnableKeySorting() {
+	w.sortKeys = true
+}
+
+// DuplicateKeyPolicy determines what a Writer does with members of an object
+// that have the same key as an earlier member (see
+// Writer.SetDuplicateKeyPolicy).
+type DuplicateKeyPolicy int
+
+const (
+	// Write every member, so that the object has duplicate keys.
+	DuplicatesKeepAll DuplicateKeyPolicy = iota
+	// Write only the first member with each key.
+	DuplicatesKeepFirst
+	// Write only the last member with each key, at the position of the first
+	// (as when decoding the object with encoding/json, where the last value
+	// wins).
+	DuplicatesKeepLast
+	// Return a *DuplicateKeyError for the first duplicate key.
+	DuplicatesError
+)
+
+// DuplicateKeyError is returned by a Writer with the DuplicatesError policy
+// when an object has a duplicate key. It gives the position of the value of
+// the later member.
+type DuplicateKeyError struct {
+	Line  int    // the line of the value of the member with the duplicate key
+	Col   int    // the column of the value of the member with the duplicate key
+	Start int    // the byte index of the start of the value in the input
+	Key   string // the key
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("jsonstream: %v:%v duplicate key %q", e.Line, e.Col, e.Key)
+}
+
+// SetDuplicateKeyPolicy sets what the Writer does with members of an object
+// that have the same key as an earlier member (the default is
+// DuplicatesKeepAll). As for EnableKeySorting, each object is buffered until
+// it ends if the policy is not DuplicatesKeepAll.
+func (w *Writer) SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) {
+	w.duplicates = policy
+}
+
+// SourceMap returns the source mappings recorded since EnableSourceMap was
+// called, in order of output offset. Tokens that produce no output (such as
+// comments) have no mapping.
+func (w *Writer) SourceMap() SourceMap {
+	return w.sourceMap
+}
+
+func (w *Writer) addMapping(t *Token) {
+	if w.recordSourceMap {
+		w.sourceMap = append(w.sourceMap, SourceMapping{
+			Output: w.written + int64(len(w.buf)),
+			Start:  t.Start,
+			Line:   t.Line,
+			Col:    t.Col,
+		})
+	}
+}
+
+// Written returns the number of bytes that have been written to the
+// underlying io.Writer (excluding any bytes still buffered).
+func (w *Writer) Written() int64 {
+	return w.written
+}
+
+// WriteToken writes a single token. If the token is an error token, its error
+// is returned. Once an error has been returned, all subsequent calls return
+// the same error.
+func (w *Writer) WriteToken(t Token) error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := t.AsError(); err != nil {
+		w.err = err
+		return err
+	}
+	if (w.sortKeys || w.duplicates != DuplicatesKeepAll) && (w.pending != nil || t.Kind == ObjectStart) {
+		return w.bufferObject(t)
+	}
+	return w.writeToken(t)
+}
+
+// writeToken writes a token that is not an error token.
+func (w *Writer) writeToken(t Token) error {
+	switch t.Kind {
+	case Key:
+		if w.original != nil {
+			w.keyTok = t
+		}
+		return nil
+	case Comment, Whitespace:
+		return nil
+	case ArrayEnd, ObjectEnd:
+		if len(w.stack) == 0 || (t.Kind == ArrayEnd) != (w.stack[len(w.stack)-1] == ArrayStart) {
+			w.err = ErrMalformedTokenSequence
+			return w.err
+		}
+		w.stack = w.stack[:len(w.stack)-1]
+		w.inFirst = false
+		w.addMapping(&t)
+		if t.Kind == ArrayEnd {
+			w.buf = append(w.buf, ']')
+		} else {
+			w.buf = append(w.buf, '}')
+		}
+		if w.jsonSeq && len(w.stack) == 0 {
+			w.buf = append(w.buf, '\n')
+		}
+		return w.maybeFlush()
+	}
+
+	if len(w.stack) == 0 {
+		if w.jsonSeq {
+			w.buf = append(w.buf, recordSeparator)
+		} else if w.nValues > 0 {
+			w.buf = append(w.buf, '\n')
+		}
+		w.nValues++
+	} else {
+		if !w.inFirst {
+			w.buf = append(w.buf, ',')
+		}
+		if w.stack[len(w.stack)-1] == ObjectStart {
+			if t.Key == nil {
+				w.err = ErrMalformedTokenSequence
+				return w.err
+			}
+			if lit := w.originalLiteral(w.keyTok, t.Key); lit != nil {
+				w.buf = append(w.buf, lit...)
+			} else {
+				w.buf = appendQuotedStringEscaping(w.buf, t.Key, w.escapeHTML)
+			}
+			w.buf = append(w.buf, ':')
+		}
+	}
+	w.inFirst = false
+	w.keyTok = Token{}
+	w.addMapping(&t)
+
+	switch t.Kind {
+	case ArrayStart:
+		w.buf = append(w.buf, '[')
+		w.stack = append(w.stack, ArrayStart)
+		w.inFirst = true
+	case ObjectStart:
+		w.buf = append(w.buf, '{')
+		w.stack = append(w.stack, ObjectStart)
+		w.inFirst = true
+	case String, Extension:
+		if lit := w.originalLiteral(t, t.Value); lit != nil {
+			w.buf = append(w.buf, lit...)
+		} else {
+			w.buf = appendQuotedStringEscaping(w.buf, t.Value, w.escapeHTML)
+		}
+	case Number:
+		w.buf = append(w.buf, t.Value...)
+	case True:
+		w.buf = append(w.buf, "true"...)
+	case False:
+		w.buf = append(w.buf, "false"...)
+	case Null:
+		w.buf = append(w.buf, "null"...)
+	default:
+		w.err = ErrMalformedTokenSequence
+		return w.err
+	}
+	if w.jsonSeq && len(w.stack) == 0 {
+		w.buf = append(w.buf, '\n')
+	}
+	return w.maybeFlush()
+}
+
+// WriteAll writes all of the given tokens and then flushes the Writer. It
+// returns ErrMalformedTokenSequence if the sequence ends inside an array or
+// object.
+func (w *Writer) WriteAll(tokens iter.Seq[Token]) error {
+	for t := range tokens {
+		if err := w.WriteToken(t); err != nil {
+			return err
+		}
+	}
+	return w.finish()
+}
+
+// bufferObject adds the token t to the object being buffered. Once the
+// object ends, its members are sorted and duplicates are removed as
+// configured, and its tokens are written.
+func (w *Writer) bufferObject(t Token) error {
+	switch t.Kind {
+	case Comment, Whitespace:
+		return nil
+	case ArrayStart, ObjectStart:
+		w.pendingDepth++
+	case ArrayEnd, ObjectEnd:
+		w.pendingDepth--
+	}
+	w.pending = append(w.pending, t)
+	if w.pendingDepth > 0 {
+		return nil
+	}
+	tokens, err := w.normalize(w.pending)
+	w.pending = nil
+	if err != nil {
+		w.err = err
+		return err
+	}
+	for _, t := range tokens {
+		if err := w.writeToken(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueEnd returns the index of the last token of the value that begins at
+// index i of tokens (which, for an object member, may begin with a Key
+// token).
+func valueEnd(tokens []Token, i int) int {
+	if tokens[i].Kind == Key && i+1 < len(tokens) {
+		i++
+	}
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].Kind {
+		case ArrayStart, ObjectStart:
+			depth++
+		case ArrayEnd, ObjectEnd:
+			depth--
+		}
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(tokens) - 1
+}
+
+// normalize returns the tokens of the value given by tokens with the members
+// of its objects sorted and duplicates removed as configured.
+func (w *Writer) normalize(tokens []Token) ([]Token, error) {
+	if len(tokens) < 2 || (tokens[0].Kind != ArrayStart && tokens[0].Kind != ObjectStart) {
+		return tokens, nil
+	}
+	type member struct {
+		tokens []Token // the tokens of the member, including any Key token
+		value  Token   // the first token of the value
+	}
+	var members []member
+	last := len(tokens) - 1
+	for i := 1; i < last; {
+		end := min(valueEnd(tokens, i), last-1)
+		m := member{tokens: tokens[i : end+1], value: tokens[i]}
+		if m.value.Kind == Key && i < end {
+			m.value = tokens[i+1]
+		}
+		members = append(members, m)
+		i = end + 1
+	}
+
+	if tokens[0].Kind == ObjectStart && w.duplicates != DuplicatesKeepAll {
+		first := make(map[string]int, len(members)) // the index in kept of the first member with each key
+		kept := members[:0:0]
+		for _, m := range members {
+			i, dup := first[string(m.value.Key)]
+			switch {
+			case !dup:
+				first[string(m.value.Key)] = len(kept)
+				kept = append(kept, m)
+			case w.duplicates == DuplicatesKeepLast:
+				kept[i] = m
+			case w.duplicates == DuplicatesError:
+				v := m.value
+				return nil, &DuplicateKeyError{Line: v.Line, Col: v.Col, Start: v.Start, Key: string(v.Key)}
+			}
+		}
+		members = kept
+	}
+	if tokens[0].Kind == ObjectStart && w.sortKeys {
+		slices.SortStableFunc(members, func(a, b member) int { return bytes.Compare(a.value.Key, b.value.Key) })
+	}
+
+	out := make([]Token, 0, len(tokens))
+	out = append(out, tokens[0])
+	for _, m := range members {
+		start := 0
+		if m.tokens[0].Kind == Key {
+			out = append(out, m.tokens[0])
+			start = 1
+		}
+		value, err := w.normalize(m.tokens[start:])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value...)
+	}
+	return append(out, tokens[last]), nil
+}
+
+// finish flushes the Writer once the last token has been written.
+func (w *Writer) finish() error {
+	if (len(w.stack) > 0 || w.pending != nil) && w.err == nil {
+		w.err = ErrMalformedTokenSequence
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return w.err
+}
+
+// PartialWriteError is returned by Writer.WriteAllPartial. It reports how much
+// of the output was written before the failure and where in the input the
+// failure occurred.
+type PartialWriteError struct {
+	Written int64 // the number of bytes written to the underlying io.Writer
+	Token   Token // the token that could not be written (the zero Token if the failure is not attributable to a token)
+	Err     error // the error (e.g. the error of an error token)
+}
+
+func (e *PartialWriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteAllPartial is like WriteAll, except that if an error occurs, all of the
+// output preceding the failure is flushed before a *PartialWriteError is
+// returned. This is useful for streaming responses in which errors late in the
+// input can only be signaled out of band (e.g. by aborting a chunked HTTP
+// response or setting a trailer), as the output written so far is as
+// complete as possible.
+func (w *Writer) WriteAllPartial(tokens iter.Seq[Token]) error {
+	for t := range tokens {
+		if err := w.WriteToken(t); err != nil {
+			w.Flush()
+			return &PartialWriteError{Written: w.written, Token: t, Err: err}
+		}
+	}
+	if err := w.finish(); err != nil {
+		return &PartialWriteError{Written: w.written, Err: err}
+	}
+	return nil
+}
+
+// Flush writes any buffered output to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	if len(w.buf) == 0 {
+		return w.err
+	}
+	n, err := w.w.Write(w.buf)
+	if err == nil && n < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	w.written += int64(n)
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func (w *Writer) maybeFlush() error {
+	if len(w.buf) >= w.maxBufSz {
+		return w.Flush()
+	}
+	return nil
+}
+
+// EstimateEncodedSize returns the number of bytes that Writer would write for
+// the given tokens, without producing the output. This allows callers to
+// preallocate output buffers or to enforce size limits before writing (e.g. by
+// re-tokenizing the input or using Tee). The size is exact if the tokens that
+// are later written are the same, which is the case for deterministic stages.
+// Any error that WriteAll would return is also returned.
+func EstimateEncodedSize(tokens iter.Seq[Token]) (int64, error) {
+	w := NewWriter(io.Discard)
+	err := w.WriteAll(tokens)
+	return w.Written(), err
+}
+
+// originalLiteral returns the text of the token t in the input given to
+// EnableOriginalEscapes if it is a JSON string literal for s, or nil.
+func (w *Writer) originalLiteral(t Token, s []byte) []byte {
+	if w.original == nil || t.Kind != String && t.Kind != Key || t.Start < 0 || t.End < t.Start || t.End >= len(w.original) {
+		return nil
+	}
+	lit := w.original[t.Start : t.End+1]
+	if !isStringLiteralFor(lit, s, w.escapeHTML) {
+		return nil
+	}
+	return lit
+}
+
+// isStringLiteralFor reports whether lit is a JSON string literal whose value
+// is s. If escapeHTML is true, lit must also escape the characters escaped by
+// Writer.EnableHTMLEscaping. Literals containing unpaired surrogate escapes
+// are rejected.
+func isStringLiteralFor(lit, s []byte, escapeHTML bool) bool {
+	if len(lit) < 2 || lit[0] != '"' || lit[len(lit)-1] != '"' {
+		return false
+	}
+	lit = lit[1 : len(lit)-1]
+	var rb [utf8.UTFMax]byte
+	for len(lit) > 0 {
+		c := lit[0]
+		n := 1
+		var dec []byte
+		switch {
+		case c < 0x20 || c == '"':
+			return false
+		case escapeHTML && (c == '<' || c == '>' || c == '&'):
+			return false
+		case c == '\\':
+			if len(lit) < 2 {
+				return false
+			}
+			n = 2
+			switch lit[1] {
+			case '"', '\\', '/':
+				dec = lit[1:2]
+			case 'b':
+				dec = []byte{'\b'}
+			case 'f':
+				dec = []byte{'\f'}
+			case 'n':
+				dec = []byte{'\n'}
+			case 'r':
+				dec = []byte{'\r'}
+			case 't':
+				dec = []byte{'\t'}
+			case 'u':
+				r := unicodeEscape(lit)
+				n = 6
+				if utf16.IsSurrogate(r) {
+					r = utf16.DecodeRune(r, unicodeEscape(lit[6:]))
+					n = 12
+				}
+				if r < 0 || r == utf8.RuneError {
+					return false
+				}
+				dec = rb[:utf8.EncodeRune(rb[:], r)]
+			default:
+				return false
+			}
+		case c >= utf8.RuneSelf:
+			r, sz := utf8.DecodeRune(lit)
+			if r == utf8.RuneError && sz == 1 || escapeHTML && (r == '\u2028' || r == '\u2029') {
+				return false
+			}
+			n = sz
+			dec = lit[:sz]
+		default:
+			dec = lit[:1]
+		}
+		if !bytes.HasPrefix(s, dec) {
+			return false
+		}
+		s = s[len(dec):]
+		lit = lit[n:]
+	}
+	return len(s) == 0
+}
+
+// unicodeEscape returns the code point given by the escape sequence \uXXXX
+// at the start of lit, or -1.
+func unicodeEscape(lit []byte) rune {
+	if len(lit) < 6 || lit[0] != '\\' || lit[1] != 'u' {
+		return -1
+	}
+	r := rune(0)
+	for _, d := range lit[2:6] {
+		v := hexVal(d)
+		if v < 0 {
+			return -1
+		}
+		r = r<<4 | rune(v)
+	}
+	return r
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendQuotedString appends s to buf as a JSON string literal using the
+// minimal escaping required by the JSON standard. Invalid UTF-8 is replaced
+// with U+FFFD.
+func appendQuotedString(buf []byte, s []byte) []byte {
+	return appendQuotedStringEscaping(buf, s, false)
+}
+
+// appendQuotedStringEscaping is like appendQuotedString, but if escapeHTML is
+// true it also escapes '<', '>', '&', U+2028 and U+2029 (see
+// Writer.EnableHTMLEscaping).
+func appendQuotedStringEscaping(buf []byte, s []byte, escapeHTML bool) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf && !(escapeHTML && (c == '<' || c == '>' || c == '&')) {
+			i++
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			r, sz := utf8.DecodeRune(s[i:])
+			if escapeHTML && (r == '\u2028' || r == '\u2029') {
+				buf = append(buf, s[start:i]...)
+				buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+				i += sz
+				start = i
+				continue
+			}
+			if r != utf8.RuneError || sz != 1 {
+				i += sz
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "�"...)
+			i++
+			start = i
+			continue
+		}
+		buf = append(buf, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			buf = append(buf, '\\', c)
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+		}
+		i++
+		start = i
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
@@ -0,0 +1,404 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	t.Run("round trips compact JSON", func(t *testing.T) {
+		inputs := []string{
+			`[]`,
+			`{}`,
+			`"str"`,
+			`[1,-2.5e10,true,false,null,"x",[],{}]`,
+			`{"a":{"b":[{"c":"d"}]},"e":[[[]]]}`,
+			`{"":1}`,
+		}
+		for _, input := range inputs {
+			var p Parser
+			var buf bytes.Buffer
+			if err := NewWriter(&buf).WriteAll(p.Tokenize([]byte(input))); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if buf.String() != input {
+				t.Errorf("Expected %v, got %v", input, buf.String())
+			}
+		}
+	})
+
+	t.Run("removes whitespace and comments", func(t *testing.T) {
+		p := Parser{AllowComments: true}
+		var buf bytes.Buffer
+		if err := NewWriter(&buf).WriteAll(p.Tokenize([]byte("{ \"a\" : [ 1 , 2 ] , // c\n \"b\" : /* c */ null }"))); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if buf.String() != `{"a":[1,2],"b":null}` {
+			t.Errorf("Unexpected output %v", buf.String())
+		}
+	})
+
+	t.Run("escapes strings", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteToken(Token{Kind: String, Value: []byte("a\"b\\c\n\t\x01\x1f日本\xff/")})
+		w.Flush()
+		const expected = `"a\"b\\c\n\t\u0001\u001f日本�/"`
+		if buf.String() != expected {
+			t.Errorf("Expected %v, got %v", expected, buf.String())
+		}
+	})
+
+	t.Run("separates top-level values with newlines", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteToken(Token{Kind: Number, Value: []byte("1")})
+		w.WriteToken(Token{Kind: ObjectStart})
+		w.WriteToken(Token{Kind: ObjectEnd})
+		w.Flush()
+		if buf.String() != "1\n{}" {
+			t.Errorf("Unexpected output %q", buf.String())
+		}
+	})
+
+	t.Run("error tokens", func(t *testing.T) {
+		var p Parser
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		err := w.WriteAll(p.Tokenize([]byte(`[1, 2,]`)))
+		if err == nil || err.Error() != "1:6 Error: Trailing ','" {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if w.WriteToken(Token{Kind: Null}) != err {
+			t.Errorf("Expected error to be sticky")
+		}
+	})
+
+	t.Run("malformed sequences", func(t *testing.T) {
+		sequences := [][]Token{
+			{{Kind: ArrayStart}, {Kind: ObjectEnd}},
+			{{Kind: ObjectStart}, {Kind: Number, Value: []byte("1")}, {Kind: ObjectEnd}},
+			{{Kind: ArrayEnd}},
+			{{Kind: ArrayStart}},
+		}
+		for _, seq := range sequences {
+			var buf bytes.Buffer
+			err := NewWriter(&buf).WriteAll(func(yield func(Token) bool) {
+				for _, t := range seq {
+					if !yield(t) {
+						return
+					}
+				}
+			})
+			if !errors.Is(err, ErrMalformedTokenSequence) {
+				t.Errorf("Expected ErrMalformedTokenSequence for %v, got %v", seq, err)
+			}
+		}
+	})
+
+	t.Run("large output is flushed incrementally", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteToken(Token{Kind: ArrayStart})
+		for range 10000 {
+			w.WriteToken(Token{Kind: Null})
+		}
+		if buf.Len() == 0 || w.Written() != int64(buf.Len()) {
+			t.Errorf("Expected some output to have been flushed, got %v bytes", buf.Len())
+		}
+	})
+
+	t.Run("buffer size is configurable", func(t *testing.T) {
+		var writes []int
+		w := NewWriterSize(writerFunc(func(b []byte) (int, error) {
+			writes = append(writes, len(b))
+			return len(b), nil
+		}), 16)
+		w.WriteToken(Token{Kind: ArrayStart})
+		for range 20 {
+			w.WriteToken(Token{Kind: Null})
+		}
+		w.WriteToken(Token{Kind: ArrayEnd})
+		w.Flush()
+		if w.Written() != 101 || len(writes) < 5 {
+			t.Errorf("Expected output in several writes, got %v (%v bytes)", writes, w.Written())
+		}
+		for _, n := range writes {
+			if n > 16+len(",null") {
+				t.Errorf("Write of %v bytes exceeds buffer size", n)
+			}
+		}
+	})
+
+	t.Run("short writes are errors", func(t *testing.T) {
+		w := NewWriter(writerFunc(func(b []byte) (int, error) {
+			return len(b) / 2, nil
+		}))
+		w.WriteToken(Token{Kind: String, Value: []byte("abcd")})
+		if err := w.Flush(); err != io.ErrShortWrite || w.Written() != 3 {
+			t.Errorf("Expected io.ErrShortWrite after 3 bytes, got %v after %v", err, w.Written())
+		}
+	})
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+func TestEstimateEncodedSize(t *testing.T) {
+	inputs := []string{
+		`[]`,
+		`{"a": [1, 2, {"b": "é\n"}], "c": null}`,
+		`"` + string(bytes.Repeat([]byte("x"), 10000)) + `"`,
+	}
+	for _, input := range inputs {
+		var p Parser
+		var buf bytes.Buffer
+		if err := NewWriter(&buf).WriteAll(p.Tokenize([]byte(input))); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		n, err := EstimateEncodedSize(Delete(p.Tokenize([]byte(input))))
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("Expected %v, got %v", buf.Len(), n)
+		}
+	}
+
+	var p Parser
+	if _, err := EstimateEncodedSize(p.Tokenize([]byte(`[1,,2]`))); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestWriterSourceMap(t *testing.T) {
+	const input = "{\n  \"a\": [1, true],\n  \"b\": \"x\"\n}"
+	var p Parser
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableSourceMap()
+	if err := w.WriteAll(Delete(p.Tokenize([]byte(input)), []any{"a", 0})); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if buf.String() != `{"a":[true],"b":"x"}` {
+		t.Fatalf("Unexpected output %v", buf.String())
+	}
+
+	var got []string
+	for _, m := range w.SourceMap() {
+		got = append(got, fmt.Sprintf("%v->%v(%v:%v)", m.Output, m.Start, m.Line, m.Col))
+	}
+	const expected = "0->0(1:1) 5->9(2:9) 6->13(2:13) 10->17(2:17) 16->27(3:9) 19->31(4:2)"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("Expected %v, got %v", expected, strings.Join(got, " "))
+	}
+
+	// The "e" of true is at output offset 9.
+	if m, ok := w.SourceMap().Lookup(9); !ok || m.Start != 13 {
+		t.Errorf("Unexpected lookup result %v %v", m, ok)
+	}
+	if _, ok := (SourceMap{}).Lookup(0); ok {
+		t.Errorf("Expected lookup in empty source map to fail")
+	}
+}
+
+func TestWriterHTMLEscaping(t *testing.T) {
+	var p Parser
+	input := "{\"</script>\":\"a & b <!-- \u2028\u2029 é\",\"n\":[1,null]}"
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableHTMLEscaping()
+	if err := w.WriteAll(p.Tokenize([]byte(input))); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := `{"\u003c/script\u003e":"a \u0026 b \u003c!-- \u2028\u2029 é","n":[1,null]}`
+	if buf.String() != expected {
+		t.Errorf("Expected %v, got %v", expected, buf.String())
+	}
+
+	var unescaped bytes.Buffer
+	if err := NewWriter(&unescaped).WriteAll(p.Tokenize([]byte(input))); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if unescaped.String() != input {
+		t.Errorf("Expected output without escaping to be unchanged, got %v", unescaped.String())
+	}
+
+	var decoded, original any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := json.Unmarshal([]byte(input), &original); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Escaped output is not equivalent to the input")
+	}
+}
+
+func TestWriterOriginalEscapes(t *testing.T) {
+	const input = "{\"k\\u0065y\": \"a\\/b\\u00e9\\ud83d\\ude00\\n\", \"x\": [\"\\u0041\", \"\\u003c>\", \"\\ud800\", \"<p>\"], \"y\\/\": \"z\"}"
+	write := func(escapeHTML bool, tokens iter.Seq[Token]) string {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.EnableOriginalEscapes([]byte(input))
+		if escapeHTML {
+			w.EnableHTMLEscaping()
+		}
+		if err := w.WriteAll(tokens); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return buf.String()
+	}
+
+	p := Parser{EmitKeyTokens: true}
+	cases := []struct {
+		escapeHTML bool
+		expected   string
+	}{
+		{false, `{"k\u0065y":"a\/b\u00e9\ud83d\ude00\n","x":["\u0041","\u003c>","` + "\uFFFD" + `","<p>"],"y\/":"z"}`},
+		{true, `{"k\u0065y":"a\/b\u00e9\ud83d\ude00\n","x":["\u0041","\u003c\u003e","` + "\uFFFD" + `","\u003cp\u003e"],"y\/":"z"}`},
+	}
+	for _, c := range cases {
+		if got := write(c.escapeHTML, p.Tokenize([]byte(input))); got != c.expected {
+			t.Errorf("Expected\n%v\ngot\n%v", c.expected, got)
+		}
+	}
+
+	// Keys are re-encoded without Key tokens, as are changed strings.
+	var q Parser
+	changed := func(yield func(Token) bool) {
+		for tok := range q.Tokenize([]byte(input)) {
+			if tok.Kind == String && string(tok.Value) == "A" {
+				tok.Value = []byte("B")
+			}
+			if !yield(tok) {
+				return
+			}
+		}
+	}
+	expected := `{"key":"a\/b\u00e9\ud83d\ude00\n","x":["B","\u003c>","` + "\uFFFD" + `","<p>"],"y/":"z"}`
+	if got := write(false, changed); got != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, got)
+	}
+
+	// The tokens of a RawValue have positions in the original input.
+	tokens := slices.Collect(q.Tokenize([]byte(input)))
+	rv, err := NewRawValue([]byte(input), tokens[0], tokens[len(tokens)-1]).Get("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `["\u0041","\u003c>","` + "\uFFFD" + `","<p>"]`
+	if got := write(false, rv.Tokenize()); got != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, got)
+	}
+}
+
+func TestWriterJSONSeq(t *testing.T) {
+	p := Parser{AllowMultipleValues: true}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableJSONSeq()
+	if err := w.WriteAll(p.Tokenize([]byte(`{"a": [1]} 2 "x" []`))); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := "\x1e{\"a\":[1]}\n\x1e2\n\x1e\"x\"\n\x1e[]\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	seq := Parser{JSONSeq: true}
+	if got := compactJSON(seq.Tokenize(buf.Bytes())); got != `{"a":[1]},2,"x",[]` {
+		t.Errorf("Expected the output to be tokenized as a sequence, got %v", got)
+	}
+}
+
+func TestWriteAllPartial(t *testing.T) {
+	var p Parser
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	err := w.WriteAllPartial(p.Tokenize([]byte("[1, {\"a\": \"b\"},\n [2, x]]")))
+	var pe *PartialWriteError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected *PartialWriteError, got %v", err)
+	}
+	if buf.String() != `[1,{"a":"b"},[2` || pe.Written != int64(buf.Len()) {
+		t.Errorf("Unexpected partial output %q (%v bytes reported)", buf.String(), pe.Written)
+	}
+	if pe.Token.Line != 2 || pe.Token.Col != 7 || err.Error() != "2:7 Error: Unexpected token inside array" {
+		t.Errorf("Unexpected error position %v:%v (%v)", pe.Token.Line, pe.Token.Col, err)
+	}
+
+	buf.Reset()
+	err = NewWriter(&buf).WriteAllPartial(p.Tokenize([]byte("[1, 2")))
+	if !errors.As(err, &pe) || buf.String() != "[1,2" || pe.Written != 4 {
+		t.Errorf("Unexpected result %v %q", err, buf.String())
+	}
+
+	buf.Reset()
+	err = NewWriter(&buf).WriteAllPartial(p.Tokenize([]byte("[1, 2]")))
+	if err != nil || buf.String() != "[1,2]" {
+		t.Errorf("Unexpected result %v %q", err, buf.String())
+	}
+}
+
+func TestWriterKeyNormalization(t *testing.T) {
+	const input = `{"b": 1, "a": {"z": [{"y": 1, "x": 2}], "c": 3}, "b": 2, "é": null, "B": true}
+		[{"b": 1, "b": [2]}, "s"]`
+	cases := []struct {
+		sort       bool
+		duplicates DuplicateKeyPolicy
+		expected   string
+	}{
+		{false, DuplicatesKeepAll, `{"b":1,"a":{"z":[{"y":1,"x":2}],"c":3},"b":2,"é":null,"B":true}` + "\n" + `[{"b":1,"b":[2]},"s"]`},
+		{true, DuplicatesKeepAll, `{"B":true,"a":{"c":3,"z":[{"x":2,"y":1}]},"b":1,"b":2,"é":null}` + "\n" + `[{"b":1,"b":[2]},"s"]`},
+		{false, DuplicatesKeepFirst, `{"b":1,"a":{"z":[{"y":1,"x":2}],"c":3},"é":null,"B":true}` + "\n" + `[{"b":1},"s"]`},
+		{false, DuplicatesKeepLast, `{"b":2,"a":{"z":[{"y":1,"x":2}],"c":3},"é":null,"B":true}` + "\n" + `[{"b":[2]},"s"]`},
+		{true, DuplicatesKeepLast, `{"B":true,"a":{"c":3,"z":[{"x":2,"y":1}]},"b":2,"é":null}` + "\n" + `[{"b":[2]},"s"]`},
+	}
+	p := Parser{AllowMultipleValues: true, EmitKeyTokens: true, AllowComments: true}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if c.sort {
+			w.EnableKeySorting()
+		}
+		w.SetDuplicateKeyPolicy(c.duplicates)
+		w.EnableOriginalEscapes([]byte(input))
+		if err := w.WriteAll(p.Tokenize([]byte(input))); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("For sort=%v, duplicates=%v expected\n%v\ngot\n%v", c.sort, c.duplicates, c.expected, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetDuplicateKeyPolicy(DuplicatesError)
+	err := w.WriteAll(p.Tokenize([]byte(input)))
+	var de *DuplicateKeyError
+	if !errors.As(err, &de) || de.Key != "b" || de.Line != 1 || de.Col != 55 || err.Error() != `jsonstream: 1:55 duplicate key "b"` {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output before the end of the object, got %q", buf.String())
+	}
+
+	w = NewWriter(&buf)
+	w.EnableKeySorting()
+	if err := w.WriteAll(slices.Values([]Token{{Kind: ObjectStart}})); err != ErrMalformedTokenSequence {
+		t.Errorf("Expected an error for an unclosed object")
+	}
+}